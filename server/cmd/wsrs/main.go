@@ -4,11 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
 	"server/internal/api"
-	"server/internal/store/pgstore"
+	"server/internal/storage"
+	"server/internal/store"
+	"server/internal/store/memstore"
+	"server/internal/store/pgstore/migrations"
+	"server/internal/store/sqlitestore"
+	"server/internal/ws"
+	"server/internal/ws/pgrelay"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
@@ -21,41 +33,279 @@ func main() {
 
 	ctx := context.Background()
 
-	pool, err := pgxpool.New(
-		ctx,
-		fmt.Sprintf(
+	// WS_RS_DATABASE_DSN picks the database by its scheme: sqlite:wsrs.db
+	// keeps everything in a SQLite file, for small self-hosted deployments,
+	// and postgres:// connects to Postgres. Unset, the WS_RS_DATABASE_*
+	// variables name the Postgres database.
+	dsn := os.Getenv("WS_RS_DATABASE_DSN")
+
+	sqlitePath, isSQLite := sqlitePath(dsn)
+
+	// `wsrs migrate` applies the migrations and exits, for deployments that
+	// migrate as a separate step.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if isSQLite {
+			openSQLite(ctx, sqlitePath).Close()
+
+			return
+		}
+
+		pool := connect(ctx, dsn)
+
+		defer pool.Close()
+
+		if err := migrations.Run(ctx, pool); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	// WS_RS_STORE=memory runs the server without Postgres, for demos and
+	// frontend development. Everything is lost on restart.
+	var q store.Store
+
+	var relay ws.Relay
+
+	if os.Getenv("WS_RS_STORE") == "memory" {
+		slog.Warn("Using the in-memory store, nothing will be persisted")
+
+		q = memstore.New()
+	} else if isSQLite {
+		// A SQLite file has a single instance to serve, so there is no
+		// replica to read from nor other instances to relay events to.
+		s := openSQLite(ctx, sqlitePath)
+
+		defer s.Close()
+
+		q = s
+	} else {
+		pool := connect(ctx, dsn)
+
+		defer pool.Close()
+
+		// WS_RS_AUTO_MIGRATE=false leaves the migrations to `wsrs migrate`
+		// or tern.
+		if os.Getenv("WS_RS_AUTO_MIGRATE") != "false" {
+			if err := migrations.Run(ctx, pool); err != nil {
+				panic(err)
+			}
+		}
+
+		// WS_RS_DATABASE_REPLICA_DSN points GET requests to a read replica,
+		// leaving the primary the writes.
+		if replica := connectReplica(ctx); replica != nil {
+			defer replica.Close()
+
+			q = store.NewPostgresWithReplica(pool, replica)
+		} else {
+			q = store.NewPostgres(pool)
+		}
+
+		// Instances running side by side share their events over
+		// LISTEN/NOTIFY once WS_RS_RELAY_EVENTS=true. A single instance has
+		// nobody to share them with.
+		if os.Getenv("WS_RS_RELAY_EVENTS") == "true" {
+			relay = pgrelay.New(pool)
+		}
+	}
+
+	cfg := api.ConfigFromEnv()
+
+	cfg.Relay = relay
+
+	attachments, err := storage.NewDisk(cfg.UploadsDir, cfg.UploadsBaseURL)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// The handler drains its websocket subscribers as soon as handlerCtx is
+	// done, which happens first thing on shutdown.
+	handlerCtx, stopHandler := context.WithCancel(ctx)
+
+	defer stopHandler()
+
+	handler := api.NewHandler(handlerCtx, q, cfg, attachments)
+
+	srv := &http.Server{Addr: ":8093", Handler: handler}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			if !errors.Is(err, http.ErrServerClosed) {
+				panic(err)
+			}
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	<-quit
+
+	slog.Info("Shutting down", "grace_period", cfg.ShutdownGracePeriod)
+
+	stopHandler()
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, cfg.ShutdownGracePeriod)
+
+	defer cancel()
+
+	// Shutdown stops accepting connections and waits for the requests in
+	// flight, and their database writes, to finish. Websockets were taken
+	// over from the server, so the handler waits for those itself.
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Failed to finish in-flight requests", "error", err)
+	}
+
+	if err := handler.Wait(shutdownCtx); err != nil {
+		slog.Warn("Failed to close every subscriber", "error", err)
+	}
+}
+
+// sqlitePath returns the path of a sqlite: DSN, all that follows the scheme,
+// so that sqlite:wsrs.db and sqlite:///var/lib/wsrs/wsrs.db both work.
+func sqlitePath(dsn string) (string, bool) {
+	path, ok := strings.CutPrefix(dsn, "sqlite:")
+
+	if !ok {
+		return "", false
+	}
+
+	return strings.TrimPrefix(path, "//"), true
+}
+
+// openSQLite opens the SQLite database at path, which applies the
+// migrations it doesn't have yet whatever WS_RS_AUTO_MIGRATE says: nothing
+// else migrates a SQLite file.
+func openSQLite(ctx context.Context, path string) *sqlitestore.Store {
+	s, err := sqlitestore.Open(ctx, path)
+
+	if err != nil {
+		panic(err)
+	}
+
+	slog.Info("Using the SQLite store", "path", path)
+
+	return s
+}
+
+// connect opens the pool of the Postgres database at dsn, or of the
+// WS_RS_DATABASE_* database when dsn is empty. The pool settings left unset
+// keep the pgxpool defaults.
+func connect(ctx context.Context, dsn string) *pgxpool.Pool {
+	if dsn == "" {
+		dsn = fmt.Sprintf(
 			"user=%s password=%s host=%s port=%s dbname=%s",
 			os.Getenv("WS_RS_DATABASE_USER"),
 			os.Getenv("WS_RS_DATABASE_PASSWORD"),
 			os.Getenv("WS_RS_DATABASE_HOST"),
 			os.Getenv("WS_RS_DATABASE_PORT"),
 			os.Getenv("WS_RS_DATABASE_NAME"),
-		),
-	)
+		)
+	} else if scheme, _, ok := strings.Cut(dsn, "://"); ok && scheme != "postgres" && scheme != "postgresql" {
+		panic(fmt.Errorf("unsupported WS_RS_DATABASE_DSN scheme %q", scheme))
+	}
+
+	cfg, err := pgxpool.ParseConfig(dsn)
 
 	if err != nil {
 		panic(err)
 	}
 
-	defer pool.Close()
+	pool := openPool(ctx, "Database pool", cfg)
 
 	if err := pool.Ping(ctx); err != nil {
 		panic(err)
 	}
 
-	handler := api.NewHandler(pgstore.New(pool))
+	return pool
+}
 
-	go func() {
-		if err := http.ListenAndServe(":8093", handler); err != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				panic(err)
-			}
-		}
-	}()
+// connectReplica opens the pool of the read replica at
+// WS_RS_DATABASE_REPLICA_DSN, or returns nil when it is unset. Unlike the
+// primary, the replica may be down on startup: reads go to the primary
+// until it is up.
+func connectReplica(ctx context.Context) *pgxpool.Pool {
+	dsn := os.Getenv("WS_RS_DATABASE_REPLICA_DSN")
 
-	quit := make(chan os.Signal, 1)
+	if dsn == "" {
+		return nil
+	}
 
-	signal.Notify(quit, os.Interrupt)
+	cfg, err := pgxpool.ParseConfig(dsn)
 
-	<-quit
+	if err != nil {
+		panic(err)
+	}
+
+	pool := openPool(ctx, "Replica pool", cfg)
+
+	if err := pool.Ping(ctx); err != nil {
+		slog.Warn("Failed to reach the read replica", "error", err)
+	}
+
+	return pool
+}
+
+// openPool opens a pool of cfg with the WS_RS_DATABASE_* pool settings,
+// which the primary and the replica share.
+func openPool(ctx context.Context, name string, cfg *pgxpool.Config) *pgxpool.Pool {
+	cfg.MaxConns = int32(intFromEnv("WS_RS_DATABASE_MAX_CONNS", int(cfg.MaxConns)))
+	cfg.MinConns = int32(intFromEnv("WS_RS_DATABASE_MIN_CONNS", int(cfg.MinConns)))
+	cfg.MaxConnIdleTime = durationFromEnv("WS_RS_DATABASE_MAX_CONN_IDLE_TIME", cfg.MaxConnIdleTime)
+	cfg.HealthCheckPeriod = durationFromEnv("WS_RS_DATABASE_HEALTH_CHECK_PERIOD", cfg.HealthCheckPeriod)
+
+	slog.Info(
+		name,
+		"max_conns", cfg.MaxConns,
+		"min_conns", cfg.MinConns,
+		"max_conn_idle_time", cfg.MaxConnIdleTime,
+		"health_check_period", cfg.HealthCheckPeriod,
+	)
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return pool
+}
+
+func intFromEnv(name string, fallback int) int {
+	raw := os.Getenv(name)
+
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(raw)
+
+	if err != nil || n < 0 || n > math.MaxInt32 {
+		slog.Warn("Invalid integer in environment, using default", "name", name, "value", raw, "default", fallback)
+
+		return fallback
+	}
+
+	return n
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+
+	if err != nil {
+		slog.Warn("Invalid duration in environment, using default", "name", name, "value", raw, "default", fallback)
+
+		return fallback
+	}
+
+	return d
 }
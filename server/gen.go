@@ -1,4 +1,4 @@
 package gen
 
 //go:generate go run ./cmd/tools/terndotenv/main.go
-//go:generate go run sqlc generate -f ./internal/store/pgstore/sqlc.yaml
+//go:generate go run github.com/sqlc-dev/sqlc/cmd/sqlc@v1.27.0 generate -f ./internal/store/pgstore/sqlc.yaml
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/api/apierr"
+)
+
+// authorizeAdmin guards the /admin endpoints, which need the configured
+// admin token as a bearer token.
+func (h apiHandler) authorizeAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+
+			apierr.Write(w, r, http.StatusUnauthorized, "Invalid admin token")
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleGetConnections lists the websocket connections of the hub, to debug
+// stuck rooms and clients in production.
+func (h apiHandler) handleGetConnections(w http.ResponseWriter, r *http.Request) {
+	connections := h.hub.Connections()
+
+	type connection struct {
+		RoomIDs       []string  `json:"room_ids"`
+		RemoteAddr    string    `json:"remote_addr"`
+		ParticipantID *string   `json:"participant_id"`
+		Host          bool      `json:"host"`
+		Multiplexed   bool      `json:"multiplexed"`
+		ConnectedAt   time.Time `json:"connected_at"`
+		EventsSent    int64     `json:"events_sent"`
+		Queued        int       `json:"queued"`
+	}
+
+	type response struct {
+		Connections []connection `json:"connections"`
+	}
+
+	data := make([]connection, len(connections))
+
+	for i, c := range connections {
+		data[i] = connection{
+			RoomIDs:       c.RoomIDs,
+			RemoteAddr:    c.RemoteAddr,
+			ParticipantID: nullUUIDPtr(c.ParticipantID),
+			Host:          c.Host,
+			Multiplexed:   c.Multiplexed,
+			ConnectedAt:   c.ConnectedAt.UTC(),
+			EventsSent:    c.EventsSent,
+			Queued:        c.Queued,
+		}
+	}
+
+	sendJSON(w, response{Connections: data})
+}
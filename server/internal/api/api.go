@@ -4,11 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
+	"time"
 
+	"server/internal/api/apierr"
+	"server/internal/api/openapi"
+	"server/internal/api/sanitize"
+	"server/internal/api/validate"
+	"server/internal/storage"
+	"server/internal/store"
 	"server/internal/store/pgstore"
+	"server/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -16,173 +28,2233 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type apiHandler struct {
-	q          *pgstore.Queries
-	r          *chi.Mux
-	upgrader   websocket.Upgrader
-	subscribes map[string]map[*websocket.Conn]context.CancelFunc
-	mu         *sync.Mutex
+	cfg         Config
+	q           store.Store
+	attachments storage.Store
+	r           *chi.Mux
+	upgrader    websocket.Upgrader
+	hub         *ws.Hub
+	tokenKey    []byte
+
+	ipConnections *ipConnections
+	replicaPins   *replicaPins
 }
 
 func (h apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.r.ServeHTTP(w, r)
 }
 
-func NewHandler(q *pgstore.Queries) http.Handler {
+func sendJSON(w http.ResponseWriter, rawData any) {
+	data, _ := json.Marshal(rawData)
+
+	w.Header().Set("content-type", "application/json")
+
+	_, _ = w.Write(data)
+}
+
+// sendValidationErrors writes a 422 listing every invalid field of the body.
+func sendValidationErrors(w http.ResponseWriter, r *http.Request, errs validate.Errors) {
+	apierr.WriteProblem(w, r, apierr.Problem{
+		Type:       apierr.TypeValidation,
+		Status:     http.StatusUnprocessableEntity,
+		Detail:     "Validation failed",
+		Extensions: map[string]any{"fields": errs},
+	})
+}
+
+// decodeBody decodes the JSON body of r into dst, writing a 422 naming the
+// offending field when it can't.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		sendValidationErrors(w, r, validate.DecodeErrors(err))
+
+		return false
+	}
+
+	return true
+}
+
+// decodeOptionalBody is decodeBody for endpoints where every field has a
+// default, so an empty body leaves dst untouched.
+func decodeOptionalBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		sendValidationErrors(w, r, validate.DecodeErrors(err))
+
+		return false
+	}
+
+	return true
+}
+
+// Handler serves the API. Once the context given to NewHandler is done, its
+// websocket subscribers are told the server is restarting and closed, and
+// Wait blocks until they are all gone.
+type Handler interface {
+	http.Handler
+	Wait(ctx context.Context) error
+}
+
+func NewHandler(ctx context.Context, q store.Store, cfg Config, attachments storage.Store) Handler {
 	a := apiHandler{
-		q: q,
+		cfg:         cfg,
+		q:           q,
+		attachments: attachments,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+			CheckOrigin:       checkOrigin(cfg.AllowedOrigins, cfg.AllowAnyOrigin),
+			Subprotocols:      []string{subscribeTokenProtocol},
+			EnableCompression: cfg.CompressWebsockets,
 		},
-		subscribes: make(map[string]map[*websocket.Conn]context.CancelFunc),
-		mu:         &sync.Mutex{},
+		hub: ws.NewHub(ctx, ws.HubOptions{
+			CoalescePerSecond: cfg.ReactionEventsPerSecond,
+			FramesPerSecond:   cfg.FramesPerSecond,
+			FrameBurst:        cfg.FrameBurst,
+			EventBufferSize:   cfg.EventBufferSize,
+			Relay:             cfg.Relay,
+		}),
+		tokenKey:      subscribeTokenKey(cfg.SubscribeTokenSecret),
+		ipConnections: newIPConnections(),
+		replicaPins:   newReplicaPins(),
 	}
 
 	r := chi.NewRouter()
+
+	// The router is set before the handlers are bound, since each bound
+	// method keeps its own copy of a. Commands are served through it.
+	a.r = r
+
 	r.Use(middleware.RequestID, middleware.Recoverer, middleware.Logger)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", accessCodeHeader, hostTokenHeader, participantHeader, idempotencyKeyHeader, apiVersionHeader, "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders:   []string{"Link", "X-Total-Count", "ETag", "Last-Modified", "Deprecation", apiVersionHeader, idempotentReplayedHeader},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
-	r.Get("/subscribe/{room_id}", a.handleSubscribe)
+	r.Group(func(r chi.Router) {
+		if cfg.MaxConnectionsPerIP > 0 {
+			r.Use(a.limitConnectionsPerIP)
+		}
+
+		r.Get("/subscribe", a.handleSubscribeMany)
+		r.Get("/subscribe/lobby", a.handleSubscribeLobby)
+		r.Get("/subscribe/{room_id}", a.handleSubscribe)
+	})
+
+	if cfg.DebugVars {
+		r.Handle("/debug/vars", expvar.Handler())
+	}
+
+	if cfg.AdminToken != "" {
+		r.With(a.authorizeAdmin).Get("/admin/connections", a.handleGetConnections)
+	}
+
+	if strings.HasPrefix(cfg.UploadsBaseURL, "/") {
+		prefix := strings.TrimSuffix(cfg.UploadsBaseURL, "/")
+
+		r.Handle(prefix+"/*", http.StripPrefix(prefix, http.FileServer(http.Dir(cfg.UploadsDir))))
+	}
+
+	var validateRequests []func(http.Handler) http.Handler
+
+	if cfg.ValidateRequests {
+		validator, err := openapi.NewValidator()
+
+		if err != nil {
+			panic(err)
+		}
+
+		validateRequests = append(validateRequests, validator.Middleware)
+	}
 
 	r.Route("/api", func(r chi.Router) {
-		r.Route("/rooms", func(r chi.Router) {
-			r.Post("/", a.handleCreateRoom)
-			r.Get("/", a.handleGetRooms)
-
-			r.Route("/{room_id}/messages", func(r chi.Router) {
-				r.Get("/", a.handleGetRoomMessages)
-				r.Post("/", a.handleCreateRoomMessage)
-
-				r.Route("/{message_id}", func(r chi.Router) {
-					r.Get("/", a.handleGetRoomMessage)
-					r.Patch("/react", a.handleReactToMessage)
-					r.Patch("/answered", a.handleMarkMessageAsAnswered)
-					r.Delete("/react", a.handleRemoveReactFromMessage)
-				})
-			})
+		r.Get("/openapi.json", handleOpenAPISpec)
+
+		r.Group(func(r chi.Router) {
+			r.Use(validateRequests...)
+			r.Use(a.idempotent)
+			r.Use(a.readFromReplica)
+
+			for _, version := range supportedAPIVersions {
+				r.With(withAPIVersion(version)).Route("/v"+strconv.Itoa(version), a.routes)
+			}
+
+			// The unversioned paths are kept as an alias of the versioned
+			// ones until clients have moved over.
+			r.With(legacyAPIAlias).Group(a.routes)
 		})
 	})
 
-	a.r = r
+	go a.scheduleRooms(ctx)
+	go a.sendLobbyViewerCounts(ctx)
+	go a.purgeIdempotencyKeys(ctx)
+	go a.purgeDeleted(ctx)
 
 	return a
 }
 
-func (h apiHandler) handleSubscribe(w http.ResponseWriter, r *http.Request) {
-	rawRoomId := chi.URLParam(r, "room_id")
+func (h apiHandler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
 
-	roomId, err := uuid.Parse(rawRoomId)
+	go func() {
+		h.hub.Wait()
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	_, _ = w.Write(openapi.Spec)
+}
+
+// routes registers the REST endpoints of one API version.
+func (a apiHandler) routes(r chi.Router) {
+	r.Route("/rooms", func(r chi.Router) {
+		r.Post("/", a.handleCreateRoom)
+		r.Get("/", a.handleGetRooms)
+		r.Get("/code/{code}", a.handleGetRoomByCode)
+		r.Get("/{room_id}", a.handleGetRoom)
+		r.Patch("/{room_id}", a.handleUpdateRoom)
+		r.Delete("/{room_id}", a.handleDeleteRoom)
+		r.Post("/{room_id}/close", a.handleCloseRoom)
+		r.Post("/{room_id}/subscribe_token", a.handleCreateSubscribeToken)
+		r.Get("/{room_id}/events", a.handleGetRoomEvents)
+		r.Get("/{room_id}/reports", a.handleGetRoomReports)
+		r.Get("/{room_id}/export", a.handleExportRoom)
+		r.Get("/{room_id}/stats", a.handleGetRoomStats)
+		r.Get("/{room_id}/presence", a.handleGetRoomPresence)
+		r.Post("/{room_id}/bans", a.handleCreateRoomBan)
+		r.Get("/{room_id}/bans", a.handleGetRoomBans)
+		r.Delete("/{room_id}/bans/{ban_id}", a.handleDeleteRoomBan)
+		r.Get("/{room_id}/audit_log", a.handleGetRoomAuditLog)
+
+		r.Route("/{room_id}/messages", func(r chi.Router) {
+			r.Get("/", a.handleGetRoomMessages)
+			r.Post("/", a.handleCreateRoomMessage)
+			r.Patch("/answered", a.handleMarkMessagesAsAnswered)
+			r.Get("/top", a.handleGetTopRoomMessages)
+			r.Get("/pending", a.handleGetPendingRoomMessages)
+			r.Get("/search", a.handleSearchRoomMessages)
+
+			r.Route("/{message_id}", func(r chi.Router) {
+				r.Get("/", a.handleGetRoomMessage)
+				r.Patch("/", a.handleUpdateRoomMessage)
+				r.Delete("/", a.handleDeleteRoomMessage)
+				r.Get("/replies", a.handleGetMessageReplies)
+				r.Post("/replies", a.handleCreateMessageReply)
+				r.Patch("/react", a.handleReactToMessage)
+				r.Patch("/answered", a.handleMarkMessageAsAnswered)
+				r.Patch("/pin", a.handlePinMessage)
+				r.Post("/merge", a.handleMergeMessage)
+				r.Post("/attachment", a.handleUploadMessageAttachment)
+				r.Post("/report", a.handleReportMessage)
+				r.Patch("/approve", a.handleApproveMessage)
+				r.Patch("/reject", a.handleRejectMessage)
+				r.Patch("/hide", a.handleHideMessage)
+				r.Delete("/react", a.handleRemoveReactFromMessage)
+			})
+		})
+	})
+}
+
+const (
+	MessageKindReactionChanged        = "reaction_changed"
+	MessageKindMessageAnswered        = "message_answered"
+	MessageKindMessagesAnswered       = "messages_answered"
+	MessageKindRoomUpdated            = "room_updated"
+	MessageKindRoomClosed             = "room_closed"
+	MessageKindRoomOpened             = "room_opened"
+	MessageKindMessageCreated         = "message_created"
+	MessageKindMessageEdited          = "message_edited"
+	MessageKindMessageDeleted         = "message_deleted"
+	MessageKindMessagePinned          = "message_pinned"
+	MessageKindMessageUnpinned        = "message_unpinned"
+	MessageKindMessageMerged          = "message_merged"
+	MessageKindMessageAttachmentAdded = "message_attachment_added"
+	MessageKindMessageHidden          = "message_hidden"
+	MessageKindSnapshot               = "snapshot"
+	// MessageKindViewerCount and MessageKindSomeoneTyping events are sent by
+	// the hub itself, with ws.ViewerCount and ws.SomeoneTyping payloads.
+	MessageKindViewerCount   = ws.KindViewerCount
+	MessageKindSomeoneTyping = ws.KindSomeoneTyping
+	// MessageKindServerRestarting is sent by the hub as the server shuts
+	// down, with a ws.ServerRestarting payload.
+	MessageKindServerRestarting = ws.KindServerRestarting
+	// MessageKindMessagePending, MessageKindMessageReported and
+	// MessageKindViewers are only sent to the subscribers that proved they
+	// host the room, see notifyHosts. MessageKindViewers is sent by the hub
+	// with a ws.Viewers payload.
+	MessageKindMessagePending  = "message_pending"
+	MessageKindMessageReported = "message_reported"
+	MessageKindViewers         = ws.KindViewers
+	// MessageKindParticipantJoined and MessageKindParticipantLeft are sent
+	// by the hub to the hosts' subscribers, with a ws.ParticipantPresence
+	// payload and no event id. See handleGetRoomPresence.
+	MessageKindParticipantJoined = ws.KindParticipantJoined
+	MessageKindParticipantLeft   = ws.KindParticipantLeft
+	// MessageKindEventSkipped stands in for the events a subscriber is left
+	// out of, with the same event id, so event ids never skip one.
+	MessageKindEventSkipped = ws.KindEventSkipped
+	// MessageKindRateLimited is sent by the hub to a subscriber sending
+	// frames too fast, with a ws.RateLimited payload.
+	MessageKindRateLimited = ws.KindRateLimited
+	// MessageKindFrameError is sent by the hub to a subscriber whose frame
+	// it could not act on, with a ws.FrameError payload.
+	MessageKindFrameError = ws.KindFrameError
+	// MessageKindSubscribed, MessageKindSubscribeFailed and
+	// MessageKindUnsubscribed are only sent on the multiplexed /subscribe
+	// connection, see ws.ServeMux.
+	MessageKindSubscribed      = ws.KindSubscribed
+	MessageKindSubscribeFailed = ws.KindSubscribeFailed
+	MessageKindUnsubscribed    = ws.KindUnsubscribed
+	// MessageKindRoomCreated and MessageKindRoomViewerCounts are only sent
+	// on the lobby connection, which also gets MessageKindRoomOpened and
+	// MessageKindRoomClosed for public rooms. See handleSubscribeLobby.
+	MessageKindRoomCreated      = "room_created"
+	MessageKindRoomViewerCounts = "room_viewer_counts"
+)
+
+// MessageReactionChanged is sent whenever a reaction is added to or removed
+// from a message.
+type MessageReactionChanged struct {
+	ID        string `json:"id"`
+	Count     int64  `json:"count"`
+	Type      string `json:"type"`
+	TypeCount int64  `json:"type_count"`
+	// Delta is 1 when the reaction was added and -1 when it was removed.
+	// During reaction storms only the latest event of a message and type
+	// is sent every so often, so clients should trust Count and TypeCount
+	// rather than add deltas up.
+	Delta int `json:"delta"`
+	// Rank is the position of the message by reactions, see messageResponse.
+	Rank int64 `json:"rank,omitempty"`
+}
+
+// MessageSnapshot is the first event of every subscription. Its event_id is
+// that of the last event it reflects, and the events after it follow with
+// no gap, though the first ones may already be reflected in it. See
+// ws.Snapshot.
+type MessageSnapshot struct {
+	Room     roomResponse      `json:"room"`
+	Messages []messageResponse `json:"messages"`
+}
+
+type MessageMessageAnswered struct {
+	ID string `json:"id"`
+	// Answer is what the host recorded as the answer, if anything.
+	Answer *string `json:"answer"`
+}
+
+type MessageMessagesAnswered struct {
+	IDs []string `json:"ids"`
+}
+
+type MessageRoomUpdated struct {
+	ID    string `json:"id"`
+	Theme string `json:"theme"`
+}
+
+// Reasons a room_closed event is sent for. They are also the reason of the
+// close frame that follows it.
+const (
+	roomClosedByHost  = "Room closed"
+	roomClosedDeleted = "Room deleted"
+	roomClosedExpired = "Room expired"
+)
+
+type MessageRoomClosed struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type MessageRoomOpened struct {
+	ID string `json:"id"`
+}
+
+type MessageMessageCreated struct {
+	ID       string  `json:"id"`
+	Message  string  `json:"message"`
+	ParentID *string `json:"parent_id"`
+}
+
+// MessageMessagePending is a message of a moderated room waiting for the
+// host to approve it.
+type MessageMessagePending struct {
+	ID       string  `json:"id"`
+	Message  string  `json:"message"`
+	ParentID *string `json:"parent_id"`
+}
+
+type MessageMessageReported struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type MessageMessageEdited struct {
+	ID       string    `json:"id"`
+	Message  string    `json:"message"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+type MessageMessageDeleted struct {
+	ID string `json:"id"`
+}
+
+type MessageMessagePinned struct {
+	ID string `json:"id"`
+}
+
+type MessageMessageUnpinned struct {
+	ID string `json:"id"`
+}
+
+type MessageMessageMerged struct {
+	ID            string `json:"id"`
+	IntoID        string `json:"into_id"`
+	ReactionCount int64  `json:"reaction_count"`
+}
+
+type MessageMessageHidden struct {
+	ID string `json:"id"`
+}
+
+type MessageMessageAttachmentAdded struct {
+	ID            string `json:"id"`
+	AttachmentURL string `json:"attachment_url"`
+}
+
+// notifyClients sends an event of the given kind to the subscribers of the
+// room, wrapped in a ws.Message envelope. The payload is the MessageXxx type
+// matching kind.
+func (h apiHandler) notifyClients(kind, rawRoomId string, value any) {
+	h.notifyClientsExcept(uuid.NullUUID{}, kind, rawRoomId, value)
+}
+
+// notifyHosts is notifyClients for the subscribers that proved they host the
+// room. The others get an event_skipped in its place.
+func (h apiHandler) notifyHosts(kind, rawRoomId string, value any) {
+	msg, err := ws.NewMessage(kind, rawRoomId, value)
+
+	if err != nil {
+		slog.Error("Failed to encode message", "kind", kind, "error", err)
+
+		return
+	}
+
+	msg.HostsOnly = true
+
+	h.hub.Publish(msg)
+}
+
+// notifyClientsExcept is notifyClients skipping the subscribers of the
+// given participant, when set.
+func (h apiHandler) notifyClientsExcept(participantId uuid.NullUUID, kind, rawRoomId string, value any) {
+	msg, err := ws.NewMessage(kind, rawRoomId, value)
 
 	if err != nil {
-		http.Error(w, "Invalid room id", http.StatusBadRequest)
+		slog.Error("Failed to encode message", "kind", kind, "error", err)
 
 		return
 	}
 
-	_, err = h.q.GetRoom(r.Context(), roomId)
+	msg.ExceptParticipant = participantId
+
+	// Reaction counts are absolute, so a subscriber that fell behind only
+	// needs the latest one of each message and type.
+	if v, ok := value.(MessageReactionChanged); ok {
+		msg.Coalesce = kind + ":" + v.ID + ":" + v.Type
+	}
+
+	h.hub.Publish(msg)
+}
+
+// closeRoomSubscribers sends a final room_closed event to the subscribers of
+// the room, then a close frame with ws.CloseRoomClosed and the same reason,
+// and drops the room from the hub. The lobby is told about public rooms.
+func (h apiHandler) closeRoomSubscribers(rawRoomId string, reason string, public bool) {
+	closed := MessageRoomClosed{
+		ID:     rawRoomId,
+		Reason: reason,
+	}
+
+	h.notifyClients(MessageKindRoomClosed, rawRoomId, closed)
+
+	if public {
+		h.notifyClients(MessageKindRoomClosed, lobbyRoomId, closed)
+	}
+
+	h.hub.Close(rawRoomId, ws.CloseRoomClosed, reason)
+}
+
+func (h apiHandler) readRoom(w http.ResponseWriter, r *http.Request) (room pgstore.Room, rawRoomId string, ok bool) {
+	rawRoomId = chi.URLParam(r, "room_id")
+
+	roomId, err := uuid.Parse(rawRoomId)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid room id")
+
+		return pgstore.Room{}, "", false
+	}
+
+	room, err = h.q.GetRoom(r.Context(), roomId)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Room not found")
+
+			return pgstore.Room{}, "", false
+		}
+
+		slog.Error("Failed to get room", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return pgstore.Room{}, "", false
+	}
+
+	return room, rawRoomId, true
+}
+
+func (h apiHandler) readMessage(w http.ResponseWriter, r *http.Request, room pgstore.Room) (message pgstore.Message, ok bool) {
+	messageId, err := uuid.Parse(chi.URLParam(r, "message_id"))
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid message id")
+
+		return pgstore.Message{}, false
+	}
+
+	message, err = h.q.GetMessage(r.Context(), messageId)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			http.Error(w, "Room not found", http.StatusBadRequest)
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return pgstore.Message{}, false
+		}
+
+		slog.Error("Failed to get message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return pgstore.Message{}, false
+	}
+
+	if message.RoomID != room.ID {
+		apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+		return pgstore.Message{}, false
+	}
+
+	return message, true
+}
+
+// subscribeRetryAfter is the Retry-After sent to clients turned away from a
+// room at its subscriber cap, past their connections per IP, or while the
+// server shuts down.
+const subscribeRetryAfter = 30 * time.Second
+
+func (h apiHandler) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	var (
+		info = ws.ClientInfo{IP: clientIP(r)}
+		err  error
+	)
+
+	// A subscribe token stands in for the credentials it was issued
+	// against. Without one, the access code and participant id are read
+	// from the request like on any other endpoint.
+	if token := readSubscribeToken(r); token != "" {
+		claims, err := h.verifySubscribeToken(token, room.ID)
+
+		if err != nil {
+			apierr.Write(w, r, http.StatusUnauthorized, err.Error())
+
+			return
+		}
+
+		info.ParticipantID = claims.ParticipantID
+		info.Host = claims.Host
+	} else {
+		if !authorizeRoomAccess(w, r, room) {
+			return
+		}
+
+		info.ParticipantID, err = readOptionalParticipantID(r)
+
+		if err != nil {
+			apierr.Write(w, r, http.StatusBadRequest, err.Error())
 
 			return
 		}
 
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		info.Host = isHost(r, room)
+	}
 
+	if !h.checkParticipantNotBanned(w, r, room, info.ParticipantID) {
 		return
 	}
 
-	c, err := h.upgrader.Upgrade(w, r, nil)
+	// Closed rooms get no more events, so there is nothing to subscribe to.
+	if room.Closed {
+		apierr.Write(w, r, http.StatusConflict, "Room is closed")
 
-	if err != nil {
-		slog.Warn("Failed to upgrade connection.", "error", err)
+		return
+	}
+
+	if h.hub.Draining() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(subscribeRetryAfter.Seconds())))
 
-		http.Error(w, "Failed to upgrade to WS connection", http.StatusBadRequest)
+		apierr.Write(w, r, http.StatusServiceUnavailable, "Server is restarting")
 
 		return
 	}
 
-	defer c.Close()
+	if current, _ := h.hub.Stats(rawRoomId); h.cfg.MaxRoomSubscribers > 0 && current >= h.cfg.MaxRoomSubscribers {
+		w.Header().Set("Retry-After", strconv.Itoa(int(subscribeRetryAfter.Seconds())))
 
-	h.mu.Lock()
+		apierr.Write(w, r, http.StatusServiceUnavailable, "Room is full")
 
-	ctx, cancel := context.WithCancel(r.Context())
+		return
+	}
 
-	if _, ok := h.subscribes[rawRoomId]; !ok {
-		h.subscribes[rawRoomId] = make(map[*websocket.Conn]context.CancelFunc, 0)
+	opts := ws.ServeOptions{
+		Snapshot:         h.roomSnapshot(room.ID, info.ParticipantID),
+		MaxClients:       h.cfg.MaxRoomSubscribers,
+		Command:          h.runCommands(r, room, info),
+		SlowClientPolicy: h.cfg.SlowClientPolicy,
 	}
 
-	slog.Info("new client connected", "room_id", rawRoomId, "client_ip", r.RemoteAddr)
+	// Clients reconnecting pass the id of the last event they got to have
+	// the ones they missed replayed.
+	if raw := r.URL.Query().Get("last_event_id"); raw != "" {
+		opts.LastEventID, err = strconv.ParseUint(raw, 10, 64)
+
+		if err != nil {
+			apierr.Write(w, r, http.StatusBadRequest, "Invalid last_event_id")
+
+			return
+		}
 
-	h.subscribes[rawRoomId][c] = cancel
+		opts.Resume = true
+	}
+
+	opts.Encoding, err = ws.ParseEncoding(r.URL.Query().Get("encoding"))
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid encoding")
+
+		return
+	}
+
+	// Clients only interested in some events, such as an overlay showing
+	// new questions, list their kinds. They are still told when the room
+	// closes, right before the connection is.
+	if raw := r.URL.Query().Get("events"); raw != "" {
+		for _, kind := range strings.Split(raw, ",") {
+			opts.Kinds = append(opts.Kinds, strings.TrimSpace(kind))
+		}
+
+		opts.Kinds = append(opts.Kinds, MessageKindRoomClosed)
+	}
+
+	c, err := h.upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		slog.Warn("Failed to upgrade connection.", "error", err)
 
-	h.mu.Unlock()
+		apierr.Write(w, r, http.StatusBadRequest, "Failed to upgrade to WS connection")
 
-	<-ctx.Done()
+		return
+	}
+
+	defer c.Close()
 
-	h.mu.Lock()
+	slog.Info("new client connected", "room_id", rawRoomId, "client_ip", r.RemoteAddr)
 
-	delete(h.subscribes[rawRoomId], c)
+	h.hub.Serve(rawRoomId, c, info, opts)
 
-	h.mu.Unlock()
+	slog.Info("client disconnected", "room_id", rawRoomId, "client_ip", r.RemoteAddr)
 }
 
 func (h apiHandler) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
 	type _body struct {
-		Theme string `json:"theme"`
+		Theme         string     `json:"theme"`
+		ExpiresAt     *time.Time `json:"expires_at"`
+		Private       bool       `json:"private"`
+		AccessCode    string     `json:"access_code"`
+		Description   string     `json:"description"`
+		HostName      string     `json:"host_name"`
+		Tags          []string   `json:"tags"`
+		StartsAt      *time.Time `json:"starts_at"`
+		EndsAt        *time.Time `json:"ends_at"`
+		Moderated     bool       `json:"moderated"`
+		ContentFilter bool       `json:"content_filter"`
 	}
 	var body _body
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v := validate.New()
+
+	v.Text("theme", &body.Theme, true, maxThemeLength)
+	v.Text("description", &body.Description, false, maxDescriptionLength)
+	v.Text("host_name", &body.HostName, false, maxHostNameLength)
+	v.Check(len(body.Tags) <= maxTags, "tags", fmt.Sprintf("must have at most %d tags", maxTags))
+
+	for i := range body.Tags {
+		v.Text(fmt.Sprintf("tags[%d]", i), &body.Tags[i], true, maxTagLength)
+	}
+
+	if body.Private {
+		v.Check(
+			len(body.AccessCode) >= minAccessCodeLength && len(body.AccessCode) <= maxAccessCodeLength,
+			"access_code",
+			fmt.Sprintf("must be between %d and %d characters", minAccessCodeLength, maxAccessCodeLength),
+		)
+	}
+
+	now := time.Now()
+
+	v.Check(body.ExpiresAt == nil || body.ExpiresAt.After(now), "expires_at", "must be in the future")
+	v.Check(body.EndsAt == nil || body.EndsAt.After(now), "ends_at", "must be in the future")
+	v.Check(body.EndsAt == nil || body.StartsAt == nil || body.EndsAt.After(*body.StartsAt), "ends_at", "must be after starts_at")
+
+	if !v.Valid() {
+		sendValidationErrors(w, r, v.Errors())
+
+		return
+	}
+
+	var expiresAt, startsAt, endsAt pgtype.Timestamptz
+
+	live := true
+
+	if body.ExpiresAt != nil {
+		expiresAt = pgtype.Timestamptz{Time: *body.ExpiresAt, Valid: true}
+	}
+
+	if body.StartsAt != nil {
+		startsAt = pgtype.Timestamptz{Time: *body.StartsAt, Valid: true}
+
+		live = !body.StartsAt.After(now)
+	}
+
+	if body.EndsAt != nil {
+		endsAt = pgtype.Timestamptz{Time: *body.EndsAt, Valid: true}
+	}
+
+	var accessCodeHash pgtype.Text
+
+	if body.Private {
+		hash, err := hashAccessCode(body.AccessCode)
+
+		if err != nil {
+			slog.Error("Failed to hash access code", "error", err)
+
+			apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+			return
+		}
+
+		accessCodeHash = pgtype.Text{String: hash, Valid: true}
+	}
+
+	hostToken, err := generateHostToken()
+
+	if err != nil {
+		slog.Error("Failed to generate host token", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
 
 		return
 	}
 
-	roomId, err := h.q.InsertRoom(r.Context(), body.Theme)
+	roomId, code, err := h.insertRoom(r.Context(), pgstore.InsertRoomParams{
+		Theme:          body.Theme,
+		ExpiresAt:      expiresAt,
+		Private:        body.Private,
+		AccessCodeHash: accessCodeHash,
+		Description:    body.Description,
+		HostName:       body.HostName,
+		Tags:           nonNilTags(body.Tags),
+		StartsAt:       startsAt,
+		EndsAt:         endsAt,
+		Live:           live,
+		HostTokenHash:  pgtype.Text{String: hashHostToken(hostToken), Valid: true},
+		Moderated:      body.Moderated,
+		ContentFilter:  body.ContentFilter,
+	})
 
 	if err != nil {
 		slog.Error("Failed to insert room", "error", err)
 
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
 
 		return
 	}
 
 	type response struct {
-		ID string `json"id"`
+		ID        string `json:"id"`
+		Code      string `json:"code"`
+		HostToken string `json:"host_token,omitempty"`
 	}
 
-	data, _ := json.Marshal(response{ID: roomId.String()})
+	// The host token is shown once and never stored, so a retry with the
+	// same Idempotency-Key gets the room back without it.
+	setIdempotentReplay(r, response{ID: roomId.String(), Code: code})
 
-	w.Header().Set("content-type", "application/json")
+	sendJSON(w, response{ID: roomId.String(), Code: code, HostToken: hostToken})
 
-	_, _ = w.Write(data)
+	if !body.Private {
+		h.announceRoom(r.Context(), roomId)
+	}
 }
 
-func (h apiHandler) handleGetRooms(w http.ResponseWriter, r *http.Request) {}
+func (h apiHandler) handleGetRooms(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPagination(r)
 
-func (h apiHandler) handleMarkMessageAsAnswered(w http.ResponseWriter, r *http.Request) {}
-
-func (h apiHandler) handleRemoveReactFromMessage(w http.ResponseWriter, r *http.Request) {}
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
 
-func (h apiHandler) handleCreateRoomMessage(w http.ResponseWriter, r *http.Request) {}
+		return
+	}
+
+	query := roomQuery{
+		Sort:   r.URL.Query().Get("sort"),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	if query.Sort == "" {
+		query.Sort = sortNewest
+	}
+
+	if query.Sort != sortNewest && query.Sort != sortOldest {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid sort")
+
+		return
+	}
+
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		query.Query = pgtype.Text{String: escapeLikePattern(q), Valid: true}
+	}
+
+	version, err := h.q.GetRoomListVersion(r.Context())
+
+	if err != nil {
+		slog.Error("Failed to get room list version", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	if checkNotModified(w, r, listETag(r, version.MaxChangeSeq, version.RowCount)) {
+		return
+	}
+
+	if rawCursor := r.URL.Query().Get("cursor"); rawCursor != "" {
+		cursor, err := decodeCursor(rawCursor)
+
+		if err != nil {
+			apierr.Write(w, r, http.StatusBadRequest, "Invalid cursor")
+
+			return
+		}
+
+		query.Cursor = &cursor
+	}
+
+	rooms, err := h.queryRooms(r.Context(), query)
+
+	if err != nil {
+		slog.Error("Failed to get rooms", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	total, err := h.q.CountRooms(r.Context(), query.Query)
+
+	if err != nil {
+		slog.Error("Failed to count rooms", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	roomIds := make([]uuid.UUID, len(rooms))
+
+	for i, room := range rooms {
+		roomIds[i] = room.ID
+	}
+
+	messageCounts, err := h.q.GetRoomMessageCounts(r.Context(), roomIds)
+
+	if err != nil {
+		slog.Error("Failed to count room messages", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	countByRoom := make(map[uuid.UUID]int64, len(messageCounts))
+
+	for _, c := range messageCounts {
+		countByRoom[c.RoomID] = c.MessageCount
+	}
+
+	type room struct {
+		roomResponse
+		MessageCount int64 `json:"message_count"`
+	}
+
+	type response struct {
+		Rooms      []room  `json:"rooms"`
+		NextCursor *string `json:"next_cursor"`
+	}
+
+	data := make([]room, len(rooms))
+
+	for i, row := range rooms {
+		data[i] = room{
+			roomResponse: toRoomResponse(row),
+			MessageCount: countByRoom[row.ID],
+		}
+	}
+
+	var nextCursor *string
+
+	if len(rooms) == int(limit) {
+		last := rooms[len(rooms)-1]
+
+		cursor := encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+
+		nextCursor = &cursor
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	sendJSON(w, response{Rooms: data, NextCursor: nextCursor})
+}
+
+func (h apiHandler) handleGetRoomByCode(w http.ResponseWriter, r *http.Request) {
+	code := normalizeRoomCode(chi.URLParam(r, "code"))
+
+	if len(code) != roomCodeLength {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid room code")
+
+		return
+	}
+
+	room, err := h.q.GetRoomByCode(r.Context(), code)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Room not found")
+
+			return
+		}
+
+		slog.Error("Failed to get room by code", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	if checkNotModifiedSince(w, r, room.UpdatedAt) {
+		return
+	}
+
+	sendJSON(w, toRoomResponse(room))
+}
+
+func (h apiHandler) handleGetRoom(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if checkNotModifiedSince(w, r, room.UpdatedAt) {
+		return
+	}
+
+	type response struct {
+		roomResponse
+		// ViewerCount is how many clients are subscribed right now. It is not
+		// covered by Last-Modified; clients follow it through viewer_count
+		// events once subscribed.
+		ViewerCount int `json:"viewer_count"`
+	}
+
+	viewerCount, _ := h.hub.Stats(rawRoomId)
+
+	sendJSON(w, response{roomResponse: toRoomResponse(room), ViewerCount: viewerCount})
+}
+
+func (h apiHandler) handleUpdateRoom(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	type _body struct {
+		Theme string `json:"theme"`
+	}
+	var body _body
+
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v := validate.New()
+
+	v.Text("theme", &body.Theme, true, maxThemeLength)
+
+	if !v.Valid() {
+		sendValidationErrors(w, r, v.Errors())
+
+		return
+	}
+
+	room, err := h.q.UpdateRoomTheme(r.Context(), pgstore.UpdateRoomThemeParams{
+		ID:    room.ID,
+		Theme: body.Theme,
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Room not found")
+
+			return
+		}
+
+		slog.Error("Failed to update room theme", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, toRoomResponse(room))
+
+	h.notifyClients(MessageKindRoomUpdated, rawRoomId, MessageRoomUpdated{
+		ID:    room.ID.String(),
+		Theme: room.Theme,
+	})
+}
+
+func (h apiHandler) handleCloseRoom(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	if room.Closed {
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	err := h.q.WithTx(r.Context(), func(q store.Store) error {
+		if err := q.CloseRoom(r.Context(), room.ID); err != nil {
+			return err
+		}
+
+		return audit(r.Context(), q, r, room, auditActionCloseRoom, room.ID)
+	})
+
+	if err != nil {
+		slog.Error("Failed to close room", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	h.closeRoomSubscribers(rawRoomId, roomClosedByHost, !room.Private)
+}
+
+func (h apiHandler) handleDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	err := h.q.WithTx(r.Context(), func(q store.Store) error {
+		if err := q.DeleteRoom(r.Context(), room.ID); err != nil {
+			return err
+		}
+
+		return audit(r.Context(), q, r, room, auditActionDeleteRoom, room.ID)
+	})
+
+	if err != nil {
+		slog.Error("Failed to delete room", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	h.closeRoomSubscribers(rawRoomId, roomClosedDeleted, !room.Private)
+
+	h.hub.Forget(rawRoomId)
+}
+
+func (h apiHandler) handleMarkMessageAsAnswered(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	type _body struct {
+		Answer *string `json:"answer"`
+	}
+	var body _body
+
+	// The body is optional, hosts can mark a message as answered without
+	// recording what was said.
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+
+	var answer pgtype.Text
+
+	if body.Answer != nil {
+		v := validate.New()
+
+		v.Text("answer", body.Answer, true, maxAnswerLength)
+
+		if !v.Valid() {
+			sendValidationErrors(w, r, v.Errors())
+
+			return
+		}
+
+		// The limit applies to the answer as typed, not as escaped.
+		*body.Answer = sanitize.Markdown(*body.Answer)
+
+		answer = pgtype.Text{String: *body.Answer, Valid: true}
+	}
+
+	// Marking an already answered message without a new answer is a no-op,
+	// so clients can safely retry without getting an error or triggering a
+	// duplicate event.
+	if message.Answered && !answer.Valid {
+		sendJSON(w, toMessageResponse(message))
+
+		return
+	}
+
+	err := h.q.WithTx(r.Context(), func(q store.Store) error {
+		var err error
+
+		message, err = q.MarkMessageAsAnswered(r.Context(), pgstore.MarkMessageAsAnsweredParams{
+			Answer: answer,
+			ID:     message.ID,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return audit(r.Context(), q, r, room, auditActionMarkAnswered, message.ID)
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to mark message as answered", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, toMessageResponse(message))
+
+	h.notifyClients(MessageKindMessageAnswered, rawRoomId, MessageMessageAnswered{
+		ID:     message.ID.String(),
+		Answer: textPtr(message.Answer),
+	})
+}
+
+func (h apiHandler) handleMarkMessagesAsAnswered(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	type _body struct {
+		IDs []string `json:"ids"`
+	}
+	var body _body
+
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v := validate.New()
+
+	v.Check(len(body.IDs) > 0, "ids", "must not be empty")
+	v.Check(len(body.IDs) <= maxBulkMessageIDs, "ids", fmt.Sprintf("must not have more than %d items", maxBulkMessageIDs))
+
+	if !v.Valid() {
+		sendValidationErrors(w, r, v.Errors())
+
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(body.IDs))
+
+	for _, rawId := range body.IDs {
+		id, err := uuid.Parse(rawId)
+
+		if err != nil {
+			apierr.Write(w, r, http.StatusBadRequest, "Invalid message id")
+
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	// A single UPDATE marks every message atomically. Messages that are
+	// already answered, deleted, or belong to another room are skipped, so
+	// the response and the event only list what actually changed.
+	var messages []pgstore.Message
+
+	err := h.q.WithTx(r.Context(), func(q store.Store) error {
+		var err error
+
+		messages, err = q.MarkMessagesAsAnswered(r.Context(), pgstore.MarkMessagesAsAnsweredParams{
+			RoomID: room.ID,
+			Ids:    ids,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			if err := audit(r.Context(), q, r, room, auditActionMarkAnswered, m.ID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.Error("Failed to mark messages as answered", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Messages []messageResponse `json:"messages"`
+	}
+
+	res := response{Messages: make([]messageResponse, 0, len(messages))}
+	answeredIds := make([]string, 0, len(messages))
+
+	for _, m := range messages {
+		res.Messages = append(res.Messages, toMessageResponse(m))
+		answeredIds = append(answeredIds, m.ID.String())
+	}
+
+	sendJSON(w, res)
+
+	if len(answeredIds) == 0 {
+		return
+	}
+
+	h.notifyClients(MessageKindMessagesAnswered, rawRoomId, MessageMessagesAnswered{
+		IDs: answeredIds,
+	})
+}
+
+func (h apiHandler) handlePinMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	type _body struct {
+		Pinned *bool `json:"pinned"`
+	}
+	var body _body
+
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+
+	// An empty body pins the message, {"pinned": false} unpins it.
+	pinned := body.Pinned == nil || *body.Pinned
+
+	if message.Pinned == pinned {
+		sendJSON(w, toMessageResponse(message))
+
+		return
+	}
+
+	message, err := h.q.SetMessagePinned(r.Context(), pgstore.SetMessagePinnedParams{
+		ID:     message.ID,
+		Pinned: pinned,
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to pin message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, toMessageResponse(message))
+
+	if pinned {
+		h.notifyClients(MessageKindMessagePinned, rawRoomId, MessageMessagePinned{ID: message.ID.String()})
+
+		return
+	}
+
+	h.notifyClients(MessageKindMessageUnpinned, rawRoomId, MessageMessageUnpinned{ID: message.ID.String()})
+}
+
+func (h apiHandler) handleMergeMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	duplicate, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	type _body struct {
+		IntoID string `json:"into_id"`
+	}
+	var body _body
+
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	targetId, err := uuid.Parse(body.IntoID)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid target message id")
+
+		return
+	}
+
+	if targetId == duplicate.ID {
+		apierr.Write(w, r, http.StatusBadRequest, "Cannot merge a message into itself")
+
+		return
+	}
+
+	target, err := h.q.GetMessage(r.Context(), targetId)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Target message not found")
+
+			return
+		}
+
+		slog.Error("Failed to get message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	if target.RoomID != room.ID {
+		apierr.Write(w, r, http.StatusNotFound, "Target message not found")
+
+		return
+	}
+
+	if target.ParentMessageID.Valid || duplicate.ParentMessageID.Valid {
+		apierr.Write(w, r, http.StatusBadRequest, "Replies cannot be merged")
+
+		return
+	}
+
+	var merged pgstore.Message
+
+	// A target deleted since it was read is only noticed after deleting the
+	// duplicate and moving its reactions, which the transaction undoes.
+	err = h.q.WithTx(r.Context(), func(q store.Store) error {
+		deleted, err := q.MergeMessages(r.Context(), pgstore.MergeMessagesParams{
+			TargetID:    target.ID,
+			DuplicateID: duplicate.ID,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return pgx.ErrNoRows
+		}
+
+		// The target is read back for the reaction count the moved
+		// reactions added to.
+		merged, err = q.GetMessage(r.Context(), target.ID)
+
+		return err
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to merge messages", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, toMessageResponse(merged))
+
+	h.notifyClients(MessageKindMessageMerged, rawRoomId, MessageMessageMerged{
+		ID:            duplicate.ID.String(),
+		IntoID:        merged.ID.String(),
+		ReactionCount: merged.ReactionCount,
+	})
+}
+
+func (h apiHandler) handleRemoveReactFromMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	if !h.checkNotBanned(w, r, room) {
+		return
+	}
+
+	if room.Closed {
+		apierr.Write(w, r, http.StatusConflict, "Room is closed")
+
+		return
+	}
+
+	if !checkRoomLive(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	participantId, ok := readParticipantID(w, r)
+
+	if !ok {
+		return
+	}
+
+	removed, err := h.q.RemoveReactionFromMessage(r.Context(), pgstore.RemoveReactionFromMessageParams{
+		ID:            message.ID,
+		ParticipantID: participantId,
+	})
+
+	if err != nil {
+		// No rows means this participant has no reaction on the message,
+		// which leaves the counts untouched rather than failing.
+		if errors.Is(err, pgx.ErrNoRows) {
+			sendJSON(w, reactionResponse{Count: message.ReactionCount})
+
+			return
+		}
+
+		slog.Error("Failed to remove reaction from message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, reactionResponse{Count: removed.ReactionCount, Type: removed.Type, TypeCount: removed.Count})
+
+	h.notifyReactionDecreased(rawRoomId, message, removed)
+}
+
+func (h apiHandler) handleCreateRoomMessage(w http.ResponseWriter, r *http.Request) {
+	h.createRoomMessage(w, r, false)
+}
+
+func (h apiHandler) handleCreateMessageReply(w http.ResponseWriter, r *http.Request) {
+	h.createRoomMessage(w, r, true)
+}
+
+// createRoomMessage backs both the message and the reply endpoints. Replies
+// are attached to the message_id in the URL and can only go one level deep.
+func (h apiHandler) createRoomMessage(w http.ResponseWriter, r *http.Request, isReply bool) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	if !h.checkNotBanned(w, r, room) {
+		return
+	}
+
+	if room.Closed {
+		apierr.Write(w, r, http.StatusConflict, "Room is closed")
+
+		return
+	}
+
+	if !checkRoomLive(w, r, room) {
+		return
+	}
+
+	var parentId uuid.NullUUID
+
+	if isReply {
+		parent, ok := h.readMessage(w, r, room)
+
+		if !ok {
+			return
+		}
+
+		if parent.ParentMessageID.Valid {
+			apierr.Write(w, r, http.StatusBadRequest, "Cannot reply to a reply")
+
+			return
+		}
+
+		parentId = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	participantId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	type _body struct {
+		Message string `json:"message"`
+	}
+	var body _body
+
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v := validate.New()
+
+	v.Text("message", &body.Message, true, maxMessageLength)
+
+	if !v.Valid() {
+		sendValidationErrors(w, r, v.Errors())
+
+		return
+	}
+
+	// The limit applies to the message as typed, not as escaped.
+	body.Message = sanitize.Markdown(body.Message)
+
+	if !h.checkContent(w, r, room, body.Message) {
+		return
+	}
+
+	message := body.Message
+
+	// In moderated rooms messages wait for the host to approve them, except
+	// the host's own.
+	approved := !room.Moderated || isHost(r, room)
+
+	messageId, err := h.q.InsertMessage(r.Context(), pgstore.InsertMessageParams{
+		RoomID:          room.ID,
+		Message:         message,
+		ParentMessageID: parentId,
+		Approved:        approved,
+		ParticipantID:   participantId,
+	})
+
+	if err != nil {
+		slog.Error("Failed to insert message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		ID         string             `json:"id"`
+		Duplicates []duplicateMessage `json:"duplicates"`
+		Pending    bool               `json:"pending"`
+	}
+
+	if !approved {
+		w.Header().Set("content-type", "application/json")
+
+		w.WriteHeader(http.StatusAccepted)
+
+		sendJSON(w, response{ID: messageId.String(), Duplicates: []duplicateMessage{}, Pending: true})
+
+		h.notifyHosts(MessageKindMessagePending, rawRoomId, MessageMessagePending{
+			ID:       messageId.String(),
+			Message:  message,
+			ParentID: nullUUIDPtr(parentId),
+		})
+
+		return
+	}
+
+	duplicates := []duplicateMessage{}
+
+	// Replies are not listed as top-level questions, so only new questions
+	// are checked for duplicates.
+	if !isReply {
+		duplicates = h.findDuplicateMessages(r.Context(), room.ID, messageId, message)
+	}
+
+	sendJSON(w, response{ID: messageId.String(), Duplicates: duplicates})
+
+	h.notifyClients(MessageKindMessageCreated, rawRoomId, MessageMessageCreated{
+		ID:       messageId.String(),
+		Message:  message,
+		ParentID: nullUUIDPtr(parentId),
+	})
+}
+
+func (h apiHandler) handleGetRoomMessage(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	if (!message.Approved || message.Hidden) && !isHost(r, room) && !isAuthor(r, message) {
+		apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+		return
+	}
+
+	sendJSON(w, toMessageResponse(message))
+}
+
+func (h apiHandler) handleUpdateRoomMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if room.Closed {
+		apierr.Write(w, r, http.StatusConflict, "Room is closed")
+
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeAuthorOrHost(w, r, room, message) {
+		return
+	}
+
+	if time.Since(message.CreatedAt) > h.cfg.MessageEditWindow {
+		apierr.Write(w, r, http.StatusForbidden, "Message can no longer be edited")
+
+		return
+	}
+
+	type _body struct {
+		Message string `json:"message"`
+	}
+	var body _body
+
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v := validate.New()
+
+	v.Text("message", &body.Message, true, maxMessageLength)
+
+	if !v.Valid() {
+		sendValidationErrors(w, r, v.Errors())
+
+		return
+	}
+
+	// The limit applies to the message as typed, not as escaped.
+	body.Message = sanitize.Markdown(body.Message)
+
+	if !h.checkContent(w, r, room, body.Message) {
+		return
+	}
+
+	message, err := h.q.UpdateMessage(r.Context(), pgstore.UpdateMessageParams{
+		ID:      message.ID,
+		Message: body.Message,
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to update message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, toMessageResponse(message))
+
+	// The audience does not see pending or hidden messages, so edits to them
+	// stay between the author and the host.
+	if !message.Approved || message.Hidden {
+		return
+	}
+
+	h.notifyClients(MessageKindMessageEdited, rawRoomId, MessageMessageEdited{
+		ID:       message.ID.String(),
+		Message:  message.Message,
+		EditedAt: message.EditedAt.Time,
+	})
+}
+
+func (h apiHandler) handleDeleteRoomMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeAuthorOrHost(w, r, room, message) {
+		return
+	}
+
+	err := h.q.WithTx(r.Context(), func(q store.Store) error {
+		if err := q.SoftDeleteMessage(r.Context(), message.ID); err != nil {
+			return err
+		}
+
+		return audit(r.Context(), q, r, room, auditActionDeleteMessage, message.ID)
+	})
+
+	if err != nil {
+		slog.Error("Failed to delete message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	h.notifyClients(MessageKindMessageDeleted, rawRoomId, MessageMessageDeleted{
+		ID: message.ID.String(),
+	})
+}
+
+func (h apiHandler) handleGetMessageReplies(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	viewerId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	replies, err := h.q.GetMessageReplies(r.Context(), pgstore.GetMessageRepliesParams{
+		ParentMessageID: uuid.NullUUID{UUID: message.ID, Valid: true},
+		ViewerID:        viewerId,
+	})
+
+	if err != nil {
+		slog.Error("Failed to get message replies", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Message messageResponse   `json:"message"`
+		Replies []messageResponse `json:"replies"`
+	}
+
+	// The parent goes through the same conversion so it carries its own
+	// reaction breakdown alongside the replies.
+	data, err := h.toMessageResponses(r.Context(), append([]pgstore.Message{message}, replies...))
+
+	if err != nil {
+		slog.Error("Failed to get message reactions", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, response{Message: data[0], Replies: data[1:]})
+}
+
+func (h apiHandler) handleGetRoomMessages(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	limit, offset, err := readPagination(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	viewerId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	query := messageQuery{
+		RoomID:   room.ID,
+		ViewerID: viewerId,
+		Sort:     r.URL.Query().Get("sort"),
+		Limit:    limit,
+		Offset:   offset,
+	}
+
+	if query.Sort == "" {
+		query.Sort = sortOldest
+	}
+
+	if !isValidMessageSort(query.Sort) {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid sort")
+
+		return
+	}
+
+	query.Answered, err = readAnsweredFilter(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid answered filter")
+
+		return
+	}
+
+	if rawCursor := r.URL.Query().Get("cursor"); rawCursor != "" {
+		if query.Sort == sortMostReacted {
+			apierr.Write(w, r, http.StatusBadRequest, "Cursor pagination is not supported for this sort")
+
+			return
+		}
+
+		cursor, err := decodeCursor(rawCursor)
+
+		if err != nil {
+			apierr.Write(w, r, http.StatusBadRequest, "Invalid cursor")
+
+			return
+		}
+
+		query.Cursor = &cursor
+	}
+
+	version, err := h.q.GetRoomMessagesVersion(r.Context(), room.ID)
+
+	if err != nil {
+		slog.Error("Failed to get room messages version", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	// Reactions only move the version of the messages, the rest of the room
+	// only its own change_seq.
+	if checkNotModified(w, r, listETag(r, room.ChangeSeq, version.MaxChangeSeq, version.RowCount)) {
+		return
+	}
+
+	messages, err := h.queryRoomMessages(r.Context(), query)
+
+	if err != nil {
+		slog.Error("Failed to get room messages", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
 
-func (h apiHandler) handleGetRoomMessage(w http.ResponseWriter, r *http.Request) {}
+		return
+	}
+
+	type response struct {
+		Messages   []messageResponse `json:"messages"`
+		NextCursor *string           `json:"next_cursor"`
+	}
+
+	data, err := h.toMessageResponses(r.Context(), messages)
+
+	if err != nil {
+		slog.Error("Failed to get message reactions", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	var nextCursor *string
+
+	// A full page means there may be more messages; an empty or partial page
+	// is the end of the room, so clients stop paginating on a null cursor.
+	// Reaction counts change under the reader, so the most reacted view only
+	// supports offsets.
+	if query.Sort != sortMostReacted && len(messages) == int(limit) {
+		last := messages[len(messages)-1]
+
+		cursor := encodeCursor(pageCursor{Pinned: last.Pinned, CreatedAt: last.CreatedAt, ID: last.ID})
+
+		nextCursor = &cursor
+	}
+
+	sendJSON(w, response{Messages: data, NextCursor: nextCursor})
+}
+
+func (h apiHandler) handleGetTopRoomMessages(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	limit := int32(defaultTopMessagesLimit)
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 32)
+
+		if err != nil || v < 1 {
+			apierr.Write(w, r, http.StatusBadRequest, "Invalid limit")
+
+			return
+		}
+
+		limit = int32(min(v, maxTopMessagesLimit))
+	}
+
+	viewerId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	messages, err := h.q.GetTopRoomMessages(r.Context(), pgstore.GetTopRoomMessagesParams{
+		RoomID:   room.ID,
+		ViewerID: viewerId,
+		Limit:    limit,
+	})
+
+	if err != nil {
+		slog.Error("Failed to get top room messages", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	data, err := h.toMessageResponses(r.Context(), messages)
+
+	if err != nil {
+		slog.Error("Failed to get message reactions", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Messages []messageResponse `json:"messages"`
+	}
+
+	sendJSON(w, response{Messages: data})
+}
+
+func (h apiHandler) handleReactToMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
 
-func (h apiHandler) handleGetRoomMessages(w http.ResponseWriter, r *http.Request) {}
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	if !h.checkNotBanned(w, r, room) {
+		return
+	}
+
+	if room.Closed {
+		apierr.Write(w, r, http.StatusConflict, "Room is closed")
+
+		return
+	}
+
+	if !checkRoomLive(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	participantId, ok := readParticipantID(w, r)
+
+	if !ok {
+		return
+	}
+
+	reactionType, ok := readReactionType(w, r)
+
+	if !ok {
+		return
+	}
+
+	params := pgstore.ReactToMessageParams{
+		ID:            message.ID,
+		ParticipantID: participantId,
+		Type:          reactionType,
+	}
+
+	counts, err := h.q.ReactToMessage(r.Context(), params)
+
+	if err == nil {
+		sendJSON(w, reactionResponse{Count: counts.ReactionCount, Type: reactionType, TypeCount: counts.Count, Reacted: true})
+
+		h.notifyReactionIncreased(rawRoomId, message, reactionType, counts)
+
+		return
+	}
 
-func (h apiHandler) handleReactToMessage(w http.ResponseWriter, r *http.Request) {}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		slog.Error("Failed to react to message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	// No rows means the participant already reacted. Reacting again with the
+	// same type toggles the reaction off, a different type replaces it, both
+	// steps in a transaction so the reaction isn't lost in between.
+	var removed pgstore.RemoveReactionFromMessageRow
+
+	err = h.q.WithTx(r.Context(), func(q store.Store) error {
+		var err error
+
+		removed, err = q.RemoveReactionFromMessage(r.Context(), pgstore.RemoveReactionFromMessageParams{
+			ID:            message.ID,
+			ParticipantID: participantId,
+		})
+
+		if err != nil || removed.Type == reactionType {
+			return err
+		}
+
+		counts, err = q.ReactToMessage(r.Context(), params)
+
+		return err
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to change reaction", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	h.notifyReactionDecreased(rawRoomId, message, removed)
+
+	if removed.Type == reactionType {
+		sendJSON(w, reactionResponse{Count: removed.ReactionCount, Type: reactionType, TypeCount: removed.Count})
+
+		return
+	}
+
+	sendJSON(w, reactionResponse{Count: counts.ReactionCount, Type: reactionType, TypeCount: counts.Count, Reacted: true})
+
+	h.notifyReactionIncreased(rawRoomId, message, reactionType, counts)
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"server/internal/storage"
+	"server/internal/store/memstore"
+
+	"github.com/google/uuid"
+)
+
+// testServer serves the API on an in-memory store.
+type testServer struct {
+	t     *testing.T
+	url   string
+	store *memstore.Store
+}
+
+// newTestServer starts a server whose handler drains and stops when the
+// test ends.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cfg := DefaultConfig()
+
+	cfg.UploadsDir = t.TempDir()
+
+	attachments, err := storage.NewDisk(cfg.UploadsDir, cfg.UploadsBaseURL)
+
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+
+	s := memstore.New()
+
+	handler := NewHandler(ctx, s, cfg, attachments)
+
+	srv := httptest.NewServer(handler)
+
+	t.Cleanup(func() {
+		cancel()
+
+		_ = handler.Wait(context.Background())
+
+		srv.Close()
+	})
+
+	return &testServer{t: t, url: srv.URL + "/api/v1", store: s}
+}
+
+// do sends a request with the given headers and JSON body, if any, and
+// decodes the JSON response into out, if any.
+func (s *testServer) do(method, path string, header http.Header, body, out any) *http.Response {
+	s.t.Helper()
+
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+
+		if err != nil {
+			s.t.Fatalf("encode body: %v", err)
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, s.url+path, reader)
+
+	if err != nil {
+		s.t.Fatalf("NewRequest: %v", err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			s.t.Fatalf("decode the response of %s %s: %v", method, path, err)
+		}
+	}
+
+	return resp
+}
+
+// expect sends a request like do, failing the test unless it gets status.
+func (s *testServer) expect(status int, method, path string, header http.Header, body, out any) *http.Response {
+	s.t.Helper()
+
+	resp := s.do(method, path, header, body, out)
+
+	if resp.StatusCode != status {
+		s.t.Fatalf("%s %s = %d, want %d", method, path, resp.StatusCode, status)
+	}
+
+	return resp
+}
+
+type testRoom struct {
+	ID        string `json:"id"`
+	HostToken string `json:"host_token"`
+}
+
+func (s *testServer) createRoom(body map[string]any) testRoom {
+	s.t.Helper()
+
+	var room testRoom
+
+	s.expect(http.StatusOK, http.MethodPost, "/rooms", nil, body, &room)
+
+	return room
+}
+
+func (s *testServer) createMessage(roomID string, header http.Header, message string) string {
+	s.t.Helper()
+
+	var created struct {
+		ID string `json:"id"`
+	}
+
+	s.expect(http.StatusOK, http.MethodPost, "/rooms/"+roomID+"/messages", header, map[string]any{"message": message}, &created)
+
+	return created.ID
+}
+
+// participant returns the headers of a new participant, along with extra
+// pairs of header names and values.
+func participant(pairs ...string) http.Header {
+	header := http.Header{}
+
+	header.Set(participantHeader, uuid.NewString())
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		header.Set(pairs[i], pairs[i+1])
+	}
+
+	return header
+}
+
+func TestReactionsInPrivateRoom(t *testing.T) {
+	s := newTestServer(t)
+
+	room := s.createRoom(map[string]any{"theme": "Private", "private": true, "access_code": "secret"})
+
+	member := participant(accessCodeHeader, "secret")
+
+	message := s.createMessage(room.ID, member, "Hello")
+
+	path := "/rooms/" + room.ID + "/messages/" + message + "/react"
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"without access code", participant()},
+		{"with wrong access code", participant(accessCodeHeader, "wrong")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.expect(http.StatusForbidden, http.MethodPatch, path, tt.header, nil, nil)
+			s.expect(http.StatusForbidden, http.MethodDelete, path, tt.header, nil, nil)
+		})
+	}
+
+	var reaction reactionResponse
+
+	s.expect(http.StatusOK, http.MethodPatch, path, member, nil, &reaction)
+
+	if reaction.Count != 1 || !reaction.Reacted {
+		t.Fatalf("reaction with the access code = %+v, want it counted", reaction)
+	}
+
+	s.expect(http.StatusOK, http.MethodDelete, path, member, nil, &reaction)
+
+	if reaction.Count != 0 {
+		t.Fatalf("reaction removed with the access code = %+v, want none left", reaction)
+	}
+}
@@ -0,0 +1,87 @@
+// Package apierr writes API errors as RFC 7807 problem details, so clients
+// get the same application/problem+json shape from every endpoint and can
+// tell errors apart by status and type instead of parsing messages.
+package apierr
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem types for errors that carry extra members. Other errors use
+// TypeDefault, which RFC 7807 defines as "the status code says it all".
+const (
+	TypeDefault        = "about:blank"
+	TypeValidation     = "/problems/validation"
+	TypeContentBlocked = "/problems/content-blocked"
+	TypeRoomNotLive    = "/problems/room-not-live"
+	TypeEventsGone     = "/problems/events-gone"
+)
+
+// Problem is a problem details object. Extensions are written as extra
+// top-level members next to the standard ones.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	RequestID  string
+	Extensions map[string]any
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]any, len(p.Extensions)+5)
+
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+
+	if p.RequestID != "" {
+		members["request_id"] = p.RequestID
+	}
+
+	return json.Marshal(members)
+}
+
+// Write sends a problem with the default type for status. The detail is
+// the human readable message handlers used to pass to http.Error.
+func Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	WriteProblem(w, r, Problem{Status: status, Detail: detail})
+}
+
+// WriteProblem fills in the type, title and request id of p when they are
+// missing and sends it.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Type == "" {
+		p.Type = TypeDefault
+	}
+
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+
+	if p.RequestID == "" {
+		p.RequestID = middleware.GetReqID(r.Context())
+	}
+
+	data, _ := json.Marshal(p)
+
+	w.Header().Set("content-type", ContentType)
+	w.Header().Set("x-content-type-options", "nosniff")
+
+	w.WriteHeader(p.Status)
+
+	_, _ = w.Write(data)
+}
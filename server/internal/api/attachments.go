@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// attachmentFormField is the multipart field holding the uploaded image.
+const attachmentFormField = "image"
+
+// attachmentExtensions lists the accepted image types. The type is sniffed
+// from the content rather than trusted from the client.
+var attachmentExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+func (h apiHandler) handleUploadMessageAttachment(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	if room.Closed {
+		apierr.Write(w, r, http.StatusConflict, "Room is closed")
+
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeAuthorOrHost(w, r, room, message) {
+		return
+	}
+
+	if !h.checkNotBanned(w, r, room) {
+		return
+	}
+
+	// Leave some room for the multipart headers on top of the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxAttachmentSize+1<<20)
+
+	file, header, err := r.FormFile(attachmentFormField)
+
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			apierr.Write(w, r, http.StatusRequestEntityTooLarge, "Attachment is too large")
+
+			return
+		}
+
+		apierr.Write(w, r, http.StatusBadRequest, "Missing image")
+
+		return
+	}
+
+	defer file.Close()
+
+	if header.Size > h.cfg.MaxAttachmentSize {
+		apierr.Write(w, r, http.StatusRequestEntityTooLarge, "Attachment is too large")
+
+		return
+	}
+
+	head := make([]byte, 512)
+
+	n, err := io.ReadFull(file, head)
+
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid image")
+
+		return
+	}
+
+	head = head[:n]
+
+	ext, ok := attachmentExtensions[http.DetectContentType(head)]
+
+	if !ok {
+		apierr.Write(w, r, http.StatusUnsupportedMediaType, "Unsupported image type")
+
+		return
+	}
+
+	url, err := h.attachments.Save(
+		r.Context(),
+		uuid.NewString()+ext,
+		io.MultiReader(bytes.NewReader(head), file),
+	)
+
+	if err != nil {
+		slog.Error("Failed to save attachment", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	previous := message.AttachmentUrl
+
+	message, err = h.q.SetMessageAttachment(r.Context(), pgstore.SetMessageAttachmentParams{
+		ID:            message.ID,
+		AttachmentUrl: pgtype.Text{String: url, Valid: true},
+	})
+
+	if err != nil {
+		h.deleteAttachment(url)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to set message attachment", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	// The attachment replaced is no longer referenced by anything.
+	if previous.Valid {
+		h.deleteAttachment(previous.String)
+	}
+
+	sendJSON(w, toMessageResponse(message))
+
+	h.notifyClients(MessageKindMessageAttachmentAdded, rawRoomId, MessageMessageAttachmentAdded{
+		ID:            message.ID.String(),
+		AttachmentURL: url,
+	})
+}
+
+// deleteAttachment removes a file no message points to. The outcome of the
+// request is settled by then, so a failure is only logged.
+func (h apiHandler) deleteAttachment(url string) {
+	if err := h.attachments.Delete(context.Background(), url); err != nil {
+		slog.Error("Failed to delete attachment", "url", url, "error", err)
+	}
+}
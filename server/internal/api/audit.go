@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/store"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The actions recorded in the audit log of a room.
+const (
+	auditActionCloseRoom     = "close_room"
+	auditActionDeleteRoom    = "delete_room"
+	auditActionDeleteMessage = "delete_message"
+	auditActionMarkAnswered  = "mark_answered"
+	auditActionHideMessage   = "hide_message"
+	auditActionUnhideMessage = "unhide_message"
+	auditActionBan           = "ban"
+	auditActionUnban         = "unban"
+)
+
+// The actors of the audit log. Every audited action takes the host token of
+// the room, but for deleting a message, which its author can do as well.
+const (
+	auditActorHost   = "host"
+	auditActorAuthor = "author"
+)
+
+// audit records in the audit log of the room that whoever sent r did action
+// to the target, a room, message or ban. It runs on q so the entry commits
+// or rolls back along with the action itself. The handler must have
+// authorized r as the host, or as the author of the target message.
+func audit(ctx context.Context, q store.Store, r *http.Request, room pgstore.Room, action string, targetId uuid.UUID) error {
+	// The author was identified by a valid participant id, and the host may
+	// send theirs too.
+	participantId, _ := readOptionalParticipantID(r)
+
+	actor := auditActorAuthor
+
+	if isHost(r, room) {
+		actor = auditActorHost
+	}
+
+	return q.InsertAuditLogEntry(ctx, pgstore.InsertAuditLogEntryParams{
+		RoomID:        room.ID,
+		Actor:         actor,
+		ParticipantID: participantId,
+		Ip:            pgtype.Text{String: clientIP(r), Valid: true},
+		Action:        action,
+		TargetID:      uuid.NullUUID{UUID: targetId, Valid: true},
+	})
+}
+
+type auditEntryResponse struct {
+	ID            string    `json:"id"`
+	Actor         string    `json:"actor"`
+	ParticipantID *string   `json:"participant_id"`
+	IP            *string   `json:"ip"`
+	Action        string    `json:"action"`
+	TargetID      *string   `json:"target_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func toAuditEntryResponse(entry pgstore.AuditLog) auditEntryResponse {
+	return auditEntryResponse{
+		ID:            entry.ID.String(),
+		Actor:         entry.Actor,
+		ParticipantID: nullUUIDPtr(entry.ParticipantID),
+		IP:            textPtr(entry.Ip),
+		Action:        entry.Action,
+		TargetID:      nullUUIDPtr(entry.TargetID),
+		CreatedAt:     entry.CreatedAt,
+	}
+}
+
+// handleGetRoomAuditLog lists the audit trail of a room to its host, newest
+// first.
+func (h apiHandler) handleGetRoomAuditLog(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	limit, offset, err := readPagination(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	entries, err := h.q.GetRoomAuditLog(r.Context(), pgstore.GetRoomAuditLogParams{
+		RoomID: room.ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+
+	if err != nil {
+		slog.Error("Failed to get room audit log", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Entries []auditEntryResponse `json:"entries"`
+	}
+
+	data := make([]auditEntryResponse, len(entries))
+
+	for i, entry := range entries {
+		data[i] = toAuditEntryResponse(entry)
+	}
+
+	sendJSON(w, response{Entries: data})
+}
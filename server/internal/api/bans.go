@@ -0,0 +1,272 @@
+package api
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/api/validate"
+	"server/internal/store"
+	"server/internal/store/pgstore"
+	"server/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxBanReasonLength mirrors the VARCHAR(500) size of room_bans.reason.
+const maxBanReasonLength = 500
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// checkNotBanned writes a 403 when the participant or the address of the
+// request is banned from the room.
+func (h apiHandler) checkNotBanned(w http.ResponseWriter, r *http.Request, room pgstore.Room) bool {
+	// A malformed participant id is rejected by the handlers that need one;
+	// here it simply cannot match a ban.
+	participantId, _ := readOptionalParticipantID(r)
+
+	return h.checkParticipantNotBanned(w, r, room, participantId)
+}
+
+// checkParticipantNotBanned is checkNotBanned for a participant that was
+// identified some other way than by the request headers.
+func (h apiHandler) checkParticipantNotBanned(w http.ResponseWriter, r *http.Request, room pgstore.Room, participantId uuid.NullUUID) bool {
+	banned, err := h.q.IsBannedFromRoom(r.Context(), pgstore.IsBannedFromRoomParams{
+		RoomID:        room.ID,
+		ParticipantID: participantId,
+		Ip:            pgtype.Text{String: clientIP(r), Valid: true},
+	})
+
+	if err != nil {
+		slog.Error("Failed to check room bans", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return false
+	}
+
+	if banned {
+		apierr.Write(w, r, http.StatusForbidden, "You are banned from this room")
+
+		return false
+	}
+
+	return true
+}
+
+// disconnectBanned closes the connections of the room that match the ban.
+func (h apiHandler) disconnectBanned(rawRoomId string, ban pgstore.RoomBan) {
+	h.hub.Disconnect(rawRoomId, ws.ClientMatch{
+		ParticipantID: ban.ParticipantID,
+		IP:            ban.Ip.String,
+	}, ws.CloseBanned, "Banned from room")
+}
+
+type banResponse struct {
+	ID            string    `json:"id"`
+	ParticipantID *string   `json:"participant_id"`
+	IP            *string   `json:"ip"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func toBanResponse(ban pgstore.RoomBan) banResponse {
+	return banResponse{
+		ID:            ban.ID.String(),
+		ParticipantID: nullUUIDPtr(ban.ParticipantID),
+		IP:            textPtr(ban.Ip),
+		Reason:        ban.Reason,
+		CreatedAt:     ban.CreatedAt,
+	}
+}
+
+func (h apiHandler) handleCreateRoomBan(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	type _body struct {
+		ParticipantID string `json:"participant_id"`
+		IP            string `json:"ip"`
+		Reason        string `json:"reason"`
+	}
+	var body _body
+
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v := validate.New()
+
+	var participantId uuid.NullUUID
+
+	if body.ParticipantID != "" {
+		id, err := uuid.Parse(body.ParticipantID)
+
+		v.Check(err == nil, "participant_id", "must be a valid UUID")
+
+		participantId = uuid.NullUUID{UUID: id, Valid: err == nil}
+	}
+
+	var ip pgtype.Text
+
+	if body.IP != "" {
+		parsed := net.ParseIP(body.IP)
+
+		v.Check(parsed != nil, "ip", "must be a valid IP address")
+
+		if parsed != nil {
+			ip = pgtype.Text{String: parsed.String(), Valid: true}
+		}
+	}
+
+	v.Check(body.ParticipantID != "" || body.IP != "", "participant_id", "participant_id or ip is required")
+	v.Text("reason", &body.Reason, false, maxBanReasonLength)
+
+	if !v.Valid() {
+		sendValidationErrors(w, r, v.Errors())
+
+		return
+	}
+
+	var ban pgstore.RoomBan
+
+	err := h.q.WithTx(r.Context(), func(q store.Store) error {
+		var err error
+
+		ban, err = q.InsertRoomBan(r.Context(), pgstore.InsertRoomBanParams{
+			RoomID:        room.ID,
+			ParticipantID: participantId,
+			Ip:            ip,
+			Reason:        body.Reason,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return audit(r.Context(), q, r, room, auditActionBan, ban.ID)
+	})
+
+	if err != nil {
+		slog.Error("Failed to insert room ban", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	w.WriteHeader(http.StatusCreated)
+
+	sendJSON(w, toBanResponse(ban))
+
+	go h.disconnectBanned(rawRoomId, ban)
+}
+
+func (h apiHandler) handleGetRoomBans(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	bans, err := h.q.GetRoomBans(r.Context(), room.ID)
+
+	if err != nil {
+		slog.Error("Failed to get room bans", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Bans []banResponse `json:"bans"`
+	}
+
+	data := make([]banResponse, len(bans))
+
+	for i, ban := range bans {
+		data[i] = toBanResponse(ban)
+	}
+
+	sendJSON(w, response{Bans: data})
+}
+
+func (h apiHandler) handleDeleteRoomBan(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	banId, err := uuid.Parse(chi.URLParam(r, "ban_id"))
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid ban id")
+
+		return
+	}
+
+	var deleted int64
+
+	err = h.q.WithTx(r.Context(), func(q store.Store) error {
+		var err error
+
+		deleted, err = q.DeleteRoomBan(r.Context(), pgstore.DeleteRoomBanParams{
+			ID:     banId,
+			RoomID: room.ID,
+		})
+
+		if err != nil || deleted == 0 {
+			return err
+		}
+
+		return audit(r.Context(), q, r, room, auditActionUnban, banId)
+	})
+
+	if err != nil {
+		slog.Error("Failed to delete room ban", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	if deleted == 0 {
+		apierr.Write(w, r, http.StatusNotFound, "Ban not found")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
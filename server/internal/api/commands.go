@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+	"server/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CommandKindCreateMessage = "create_message"
+	CommandKindReact         = "react"
+
+	// commandTimeout bounds each command, as the server's write timeout
+	// would for the matching HTTP request.
+	commandTimeout = 10 * time.Second
+)
+
+// CommandReact is the value of react commands. Type defaults to a like, as
+// it does for the endpoint.
+type CommandReact struct {
+	MessageID string `json:"message_id"`
+	Type      string `json:"type,omitempty"`
+}
+
+type subscriberRoomKey struct{}
+
+// subscriberRoom returns the room whose subscriber issued the request, for
+// requests built from websocket commands. Subscribers were authorized when
+// they connected, so these requests don't carry the access code again.
+func subscriberRoom(ctx context.Context) uuid.UUID {
+	id, _ := ctx.Value(subscriberRoomKey{}).(uuid.UUID)
+
+	return id
+}
+
+// commandRecorder keeps the response of a command for its result.
+type commandRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *commandRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *commandRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *commandRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	return rec.body.Write(b)
+}
+
+// runCommands returns the command runner of a subscriber. Each command is
+// turned into the request of the endpoint it stands for and served by the
+// router, so it goes through the same validation, moderation and
+// notifications as if the client had made that request itself.
+func (h apiHandler) runCommands(r *http.Request, room pgstore.Room, info ws.ClientInfo) func(context.Context, ws.Command) ws.CommandResult {
+	// Commands are served by the first version of the API until the
+	// protocol grows a way to pick another.
+	prefix := "/api/v" + strconv.Itoa(apiVersion1) + "/rooms/" + room.ID.String()
+
+	return func(ctx context.Context, cmd ws.Command) ws.CommandResult {
+		var (
+			method string
+			path   string
+			body   []byte
+		)
+
+		switch cmd.Kind {
+		case CommandKindCreateMessage:
+			method, path, body = http.MethodPost, prefix+"/messages", cmd.Value
+		case CommandKindReact:
+			var value CommandReact
+
+			if err := json.Unmarshal(cmd.Value, &value); err != nil {
+				return commandError(cmd, http.StatusBadRequest, "Invalid react command")
+			}
+
+			messageId, err := uuid.Parse(value.MessageID)
+
+			if err != nil {
+				return commandError(cmd, http.StatusBadRequest, "Invalid message id")
+			}
+
+			body, _ = json.Marshal(map[string]string{"type": value.Type})
+
+			method, path = http.MethodPatch, prefix+"/messages/"+messageId.String()+"/react"
+		default:
+			return commandError(cmd, http.StatusBadRequest, "Unknown command")
+		}
+
+		// Commands run with the subscriber's context from the hub rather
+		// than the one of the subscribe request, which carries the routing
+		// state of /subscribe and is not canceled when the client goes.
+		ctx, cancel := context.WithTimeout(context.WithValue(ctx, subscriberRoomKey{}, room.ID), commandTimeout)
+
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(body))
+
+		if err != nil {
+			return commandError(cmd, http.StatusInternalServerError, "Something went wrong")
+		}
+
+		req.Host = r.Host
+		req.RemoteAddr = r.RemoteAddr
+		req.RequestURI = path
+
+		req.Header.Set("content-type", "application/json")
+
+		if info.ParticipantID.Valid {
+			req.Header.Set(participantHeader, info.ParticipantID.UUID.String())
+		}
+
+		rec := &commandRecorder{header: http.Header{}}
+
+		h.r.ServeHTTP(rec, req)
+
+		// Handlers that write nothing leave the status implicit.
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		result := ws.CommandResult{ID: cmd.ID, Status: rec.status}
+
+		if json.Valid(rec.body.Bytes()) {
+			result.Body = rec.body.Bytes()
+		}
+
+		return result
+	}
+}
+
+func commandError(cmd ws.Command, status int, detail string) ws.CommandResult {
+	body, _ := json.Marshal(apierr.Problem{
+		Type:   apierr.TypeDefault,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+
+	return ws.CommandResult{ID: cmd.ID, Status: status, Body: body}
+}
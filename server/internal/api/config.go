@@ -0,0 +1,255 @@
+package api
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/api/filter"
+	"server/internal/ws"
+)
+
+// Config holds the tunables of the API handler. The zero value is not
+// meant to be used directly; start from DefaultConfig or ConfigFromEnv.
+type Config struct {
+	// MessageEditWindow is how long after creation a message can be edited.
+	MessageEditWindow time.Duration
+
+	// UploadsDir is where attachments are written by the disk store.
+	UploadsDir string
+	// UploadsBaseURL is the URL prefix attachments are served from. When it
+	// is a path, the handler serves UploadsDir under it.
+	UploadsBaseURL string
+	// MaxAttachmentSize is the largest accepted upload, in bytes.
+	MaxAttachmentSize int64
+
+	// IdempotencyKeyTTL is how long a stored response is replayed for
+	// retries with the same Idempotency-Key.
+	IdempotencyKeyTTL time.Duration
+
+	// DeletedRetention is how long deleted rooms and messages are kept,
+	// hidden, before they are purged for good.
+	DeletedRetention time.Duration
+
+	// ContentFilter checks messages posted to rooms with the content filter
+	// enabled. A nil filter lets everything through.
+	ContentFilter filter.Filter
+
+	// ValidateRequests checks every API request against the OpenAPI spec
+	// before it reaches a handler. It is meant for development.
+	ValidateRequests bool
+
+	// AllowedOrigins lists the origins allowed to open a websocket besides
+	// the host of the API itself. A * matches any part of an origin except
+	// a slash, so https://*.example.com allows every subdomain.
+	AllowedOrigins []string
+	// AllowAnyOrigin skips the origin check of websocket upgrades. It is
+	// meant for development and must not be set in production.
+	AllowAnyOrigin bool
+
+	// SubscribeTokenSecret signs the tokens clients subscribe with. Every
+	// instance behind the same load balancer needs the same secret; when
+	// empty, a random one is picked at startup.
+	SubscribeTokenSecret string
+	// SubscribeTokenTTL is how long a subscribe token can be used for. It
+	// only has to outlive the time it takes to open the websocket.
+	SubscribeTokenTTL time.Duration
+
+	// MaxRoomSubscribers caps the websocket connections of a single room,
+	// so one viral room cannot take the whole server down. Zero means no
+	// cap.
+	MaxRoomSubscribers int
+	// MaxConnectionsPerIP caps the websocket connections open from a single
+	// IP, across rooms, so one client can't exhaust them. Upgrades past it
+	// get a 429. Zero means no cap.
+	MaxConnectionsPerIP int
+
+	// CompressWebsockets negotiates permessage-deflate with clients that
+	// offer it. Events are small JSON objects that compress well, and each
+	// broadcast is compressed once for the whole room, so it mostly trades
+	// a little CPU for a lot less bandwidth during reaction storms.
+	CompressWebsockets bool
+
+	// ShutdownGracePeriod is how long the server waits on shutdown for
+	// in-flight requests to finish and subscribers to be closed.
+	ShutdownGracePeriod time.Duration
+
+	// ReplicaPinPeriod is how long the reads of a client go to the primary
+	// rather than the read replica after it writes, so that it sees its own
+	// writes. It is to be longer than the replica lags behind.
+	ReplicaPinPeriod time.Duration
+
+	// SlowClientPolicy is what happens to subscribers that can't keep up
+	// with their room once their queue is full.
+	SlowClientPolicy ws.SlowClientPolicy
+
+	// ReactionEventsPerSecond caps the reaction_changed events sent per
+	// message and reaction type. Reactions past it are folded into the
+	// next event, which carries the latest counts. Zero means no cap.
+	ReactionEventsPerSecond int
+
+	// FramesPerSecond caps the frames each subscriber sends, such as typing
+	// frames and commands, with bursts of up to FrameBurst. Subscribers past
+	// it get a rate_limited event, and are disconnected if they keep going.
+	// Zero means no cap.
+	FramesPerSecond int
+	FrameBurst      int
+
+	// EventBufferSize is how many of its latest events each room keeps in
+	// memory, for subscribers resuming with last_event_id and for long
+	// polls. Clients further behind start over from a snapshot.
+	EventBufferSize int
+
+	// Relay shares the events of each room with the other instances of the
+	// server, so subscribers see them whichever instance they are on. It
+	// is only needed with more than one instance.
+	Relay ws.Relay
+
+	// DebugVars serves the expvar metrics of the websocket hub, such as the
+	// connections per room, broadcasts, dropped events and write latencies,
+	// under /debug/vars.
+	DebugVars bool
+
+	// AdminToken, when set, enables the /admin endpoints, which take it as
+	// a bearer token.
+	AdminToken string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MessageEditWindow:       5 * time.Minute,
+		UploadsDir:              "./uploads",
+		UploadsBaseURL:          "/uploads",
+		MaxAttachmentSize:       5 << 20,
+		IdempotencyKeyTTL:       24 * time.Hour,
+		DeletedRetention:        30 * 24 * time.Hour,
+		SubscribeTokenTTL:       time.Minute,
+		MaxRoomSubscribers:      10000,
+		MaxConnectionsPerIP:     50,
+		ShutdownGracePeriod:     15 * time.Second,
+		ReplicaPinPeriod:        5 * time.Second,
+		SlowClientPolicy:        ws.SlowClientDisconnect,
+		ReactionEventsPerSecond: 4,
+		FramesPerSecond:         10,
+		FrameBurst:              20,
+		EventBufferSize:         256,
+		ContentFilter:           filter.NewWordlist(filter.DefaultWords),
+	}
+}
+
+// ConfigFromEnv reads the WS_RS_* environment variables on top of
+// DefaultConfig. Invalid values are logged and the default is kept.
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+
+	cfg.MessageEditWindow = durationFromEnv("WS_RS_MESSAGE_EDIT_WINDOW", cfg.MessageEditWindow)
+	cfg.UploadsDir = stringFromEnv("WS_RS_UPLOADS_DIR", cfg.UploadsDir)
+	cfg.UploadsBaseURL = stringFromEnv("WS_RS_UPLOADS_BASE_URL", cfg.UploadsBaseURL)
+	cfg.MaxAttachmentSize = int64FromEnv("WS_RS_MAX_ATTACHMENT_SIZE", cfg.MaxAttachmentSize)
+	cfg.IdempotencyKeyTTL = durationFromEnv("WS_RS_IDEMPOTENCY_KEY_TTL", cfg.IdempotencyKeyTTL)
+	cfg.DeletedRetention = durationFromEnv("WS_RS_DELETED_RETENTION", cfg.DeletedRetention)
+
+	cfg.ValidateRequests = boolFromEnv("WS_RS_VALIDATE_REQUESTS", cfg.ValidateRequests)
+	cfg.AllowAnyOrigin = boolFromEnv("WS_RS_ALLOW_ANY_ORIGIN", cfg.AllowAnyOrigin)
+	cfg.SubscribeTokenSecret = stringFromEnv("WS_RS_SUBSCRIBE_TOKEN_SECRET", cfg.SubscribeTokenSecret)
+	cfg.SubscribeTokenTTL = durationFromEnv("WS_RS_SUBSCRIBE_TOKEN_TTL", cfg.SubscribeTokenTTL)
+	cfg.CompressWebsockets = boolFromEnv("WS_RS_COMPRESS_WEBSOCKETS", cfg.CompressWebsockets)
+	cfg.MaxRoomSubscribers = int(int64FromEnv("WS_RS_MAX_ROOM_SUBSCRIBERS", int64(cfg.MaxRoomSubscribers)))
+	cfg.MaxConnectionsPerIP = int(int64FromEnv("WS_RS_MAX_CONNECTIONS_PER_IP", int64(cfg.MaxConnectionsPerIP)))
+	cfg.ShutdownGracePeriod = durationFromEnv("WS_RS_SHUTDOWN_GRACE_PERIOD", cfg.ShutdownGracePeriod)
+	cfg.ReplicaPinPeriod = durationFromEnv("WS_RS_REPLICA_PIN_PERIOD", cfg.ReplicaPinPeriod)
+	cfg.ReactionEventsPerSecond = int(int64FromEnv("WS_RS_REACTION_EVENTS_PER_SECOND", int64(cfg.ReactionEventsPerSecond)))
+	cfg.FramesPerSecond = int(int64FromEnv("WS_RS_FRAMES_PER_SECOND", int64(cfg.FramesPerSecond)))
+	cfg.FrameBurst = int(int64FromEnv("WS_RS_FRAME_BURST", int64(cfg.FrameBurst)))
+	cfg.EventBufferSize = int(int64FromEnv("WS_RS_EVENT_BUFFER_SIZE", int64(cfg.EventBufferSize)))
+	cfg.DebugVars = boolFromEnv("WS_RS_DEBUG_VARS", cfg.DebugVars)
+	cfg.AdminToken = stringFromEnv("WS_RS_ADMIN_TOKEN", cfg.AdminToken)
+
+	if raw := os.Getenv("WS_RS_SLOW_CLIENT_POLICY"); raw != "" {
+		policy, err := ws.ParseSlowClientPolicy(raw)
+
+		if err != nil {
+			slog.Warn("Invalid slow client policy in environment, using default", "value", raw, "default", cfg.SlowClientPolicy)
+		} else {
+			cfg.SlowClientPolicy = policy
+		}
+	}
+
+	// WS_RS_ALLOWED_ORIGINS is a comma separated list of origins, such as
+	// https://app.example.com,https://*.example.com.
+	if raw := os.Getenv("WS_RS_ALLOWED_ORIGINS"); raw != "" {
+		cfg.AllowedOrigins = strings.Split(raw, ",")
+	}
+
+	// WS_RS_BLOCKED_WORDS is a comma separated list replacing the default
+	// word list of the built-in filter.
+	if raw := os.Getenv("WS_RS_BLOCKED_WORDS"); raw != "" {
+		cfg.ContentFilter = filter.NewWordlist(strings.Split(raw, ","))
+	}
+
+	return cfg
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+
+	if err != nil {
+		slog.Warn("Invalid duration in environment, using default", "name", name, "value", raw, "default", fallback)
+
+		return fallback
+	}
+
+	return d
+}
+
+func stringFromEnv(name string, fallback string) string {
+	if raw := os.Getenv(name); raw != "" {
+		return raw
+	}
+
+	return fallback
+}
+
+func int64FromEnv(name string, fallback int64) int64 {
+	raw := os.Getenv(name)
+
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseInt(raw, 10, 64)
+
+	if err != nil {
+		slog.Warn("Invalid integer in environment, using default", "name", name, "value", raw, "default", fallback)
+
+		return fallback
+	}
+
+	return n
+}
+
+func boolFromEnv(name string, fallback bool) bool {
+	raw := os.Getenv(name)
+
+	if raw == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(raw)
+
+	if err != nil {
+		slog.Warn("Invalid boolean in environment, using default", "name", name, "value", raw, "default", fallback)
+
+		return fallback
+	}
+
+	return b
+}
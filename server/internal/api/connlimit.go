@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"server/internal/api/apierr"
+)
+
+// ipConnections counts the websocket connections open from each IP.
+type ipConnections struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newIPConnections() *ipConnections {
+	return &ipConnections{counts: make(map[string]int)}
+}
+
+// acquire counts a connection from ip, unless it already has limit of them.
+func (c *ipConnections) acquire(ip string, limit int) bool {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	if c.counts[ip] >= limit {
+		return false
+	}
+
+	c.counts[ip]++
+
+	return true
+}
+
+func (c *ipConnections) release(ip string) {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	if c.counts[ip] <= 1 {
+		delete(c.counts, ip)
+	} else {
+		c.counts[ip]--
+	}
+}
+
+// limitConnectionsPerIP answers 429 to the websocket upgrades of an IP that
+// already has cfg.MaxConnectionsPerIP connections open. A connection counts
+// for as long as its handler runs, which is as long as it stays open.
+func (h apiHandler) limitConnectionsPerIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+
+		if !h.ipConnections.acquire(ip, h.cfg.MaxConnectionsPerIP) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(subscribeRetryAfter.Seconds())))
+
+			apierr.Write(w, r, http.StatusTooManyRequests, "Too many connections")
+
+			return
+		}
+
+		defer h.ipConnections.release(ip)
+
+		next.ServeHTTP(w, r)
+	})
+}
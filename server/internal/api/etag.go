@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listETag builds a weak ETag for a listing from the versions of the data
+// behind it, each kept apart so that two changes cannot cancel out. The
+// query string and the participant are folded in since they change what the
+// same data renders to.
+func listETag(r *http.Request, versions ...int64) string {
+	h := fnv.New64a()
+
+	h.Write([]byte(r.URL.RawQuery))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Header.Get(participantHeader)))
+
+	parts := make([]string, len(versions))
+
+	for i, version := range versions {
+		parts[i] = strconv.FormatInt(version, 10)
+	}
+
+	return fmt.Sprintf(`W/"%s-%x"`, strings.Join(parts, "."), h.Sum64())
+}
+
+// checkNotModified sets the ETag header and writes a 304 when the request's
+// If-None-Match already names it.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", participantHeader)
+
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
+
+// etagMatches implements the weak comparison If-None-Match calls for.
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkNotModifiedSince sets the Last-Modified header and writes a 304 when
+// the request's If-Modified-Since is not older than modifiedAt. HTTP dates
+// have second precision, so modifiedAt is truncated before comparing.
+func checkNotModifiedSince(w http.ResponseWriter, r *http.Request, modifiedAt time.Time) bool {
+	modifiedAt = modifiedAt.UTC().Truncate(time.Second)
+
+	w.Header().Set("Last-Modified", modifiedAt.Format(http.TimeFormat))
+
+	// If-None-Match takes precedence when both are sent.
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+
+	if err != nil || modifiedAt.After(since) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
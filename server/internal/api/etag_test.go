@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// notModified sends a GET with If-None-Match set to etag, reporting whether
+// it got a 304, and returns the ETag of the response.
+func (s *testServer) notModified(path string, header http.Header, etag string) (bool, string) {
+	s.t.Helper()
+
+	header = header.Clone()
+
+	if header == nil {
+		header = http.Header{}
+	}
+
+	header.Set("If-None-Match", etag)
+
+	resp := s.do(http.MethodGet, path, header, nil, nil)
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return true, resp.Header.Get("ETag")
+	case http.StatusOK:
+		return false, resp.Header.Get("ETag")
+	}
+
+	s.t.Fatalf("GET %s = %d, want 200 or 304", path, resp.StatusCode)
+
+	return false, ""
+}
+
+func TestRoomMessagesETag(t *testing.T) {
+	s := newTestServer(t)
+
+	room := s.createRoom(map[string]any{"theme": "Room"})
+
+	viewer := participant()
+
+	message := s.createMessage(room.ID, viewer, "Hello")
+
+	path := "/rooms/" + room.ID + "/messages"
+
+	etag := s.expect(http.StatusOK, http.MethodGet, path, viewer, nil, nil).Header.Get("ETag")
+
+	if etag == "" {
+		t.Fatal("the messages came without an ETag")
+	}
+
+	if ok, _ := s.notModified(path, viewer, etag); !ok {
+		t.Fatal("the messages changed without a write")
+	}
+
+	if ok, _ := s.notModified(path, participant(), etag); ok {
+		t.Fatal("another participant got the 304 of the first")
+	}
+
+	steps := []struct {
+		name  string
+		write func()
+	}{
+		{"a reaction", func() {
+			s.expect(http.StatusOK, http.MethodPatch, path+"/"+message+"/react", viewer, nil, nil)
+		}},
+		{"a new message", func() {
+			s.createMessage(room.ID, viewer, "Again")
+		}},
+		{"a deleted message", func() {
+			s.expect(http.StatusNoContent, http.MethodDelete, path+"/"+message, participant(hostTokenHeader, room.HostToken), nil, nil)
+		}},
+	}
+
+	for _, step := range steps {
+		step.write()
+
+		ok, next := s.notModified(path, viewer, etag)
+
+		if ok {
+			t.Fatalf("the messages were not modified after %s", step.name)
+		}
+
+		etag = next
+	}
+}
+
+func TestRoomListETagAfterPurge(t *testing.T) {
+	s := newTestServer(t)
+
+	room := s.createRoom(map[string]any{"theme": "Room"})
+	other := s.createRoom(map[string]any{"theme": "Other"})
+
+	etag := s.expect(http.StatusOK, http.MethodGet, "/rooms", nil, nil, nil).Header.Get("ETag")
+
+	if ok, _ := s.notModified("/rooms", nil, etag); !ok {
+		t.Fatal("the room list changed without a write")
+	}
+
+	s.expect(http.StatusOK, http.MethodPatch, "/rooms/"+room.ID, participant(hostTokenHeader, room.HostToken), map[string]any{"theme": "Renamed"}, nil)
+
+	s.expect(http.StatusNoContent, http.MethodDelete, "/rooms/"+other.ID, participant(hostTokenHeader, other.HostToken), nil, nil)
+
+	if _, err := s.store.PurgeDeletedRooms(context.Background(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedRooms: %v", err)
+	}
+
+	if ok, _ := s.notModified("/rooms", nil, etag); ok {
+		t.Fatal("the room list was not modified after a rename and a purge")
+	}
+}
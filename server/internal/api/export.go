@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+
+	// exportBatchSize is how many messages are read from the store at once
+	// while streaming an export.
+	exportBatchSize = 500
+)
+
+// exportWriter encodes messages one at a time so an export never holds more
+// than a batch in memory.
+type exportWriter interface {
+	WriteMessage(m messageResponse) error
+	// Flush pushes buffered output to the underlying writer.
+	Flush() error
+	Close() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+var csvExportHeader = []string{
+	"id",
+	"parent_id",
+	"message",
+	"reaction_count",
+	"reactions",
+	"answered",
+	"answer",
+	"pinned",
+	"approved",
+	"hidden",
+	"attachment_url",
+	"created_at",
+	"edited_at",
+}
+
+func newCSVExportWriter(w io.Writer) (*csvExportWriter, error) {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvExportHeader); err != nil {
+		return nil, err
+	}
+
+	return &csvExportWriter{w: cw}, nil
+}
+
+func (e *csvExportWriter) WriteMessage(m messageResponse) error {
+	var editedAt string
+
+	if m.EditedAt != nil {
+		editedAt = m.EditedAt.Format(time.RFC3339)
+	}
+
+	return e.w.Write([]string{
+		m.ID,
+		stringOrEmpty(m.ParentID),
+		m.Message,
+		strconv.FormatInt(m.ReactionCount, 10),
+		formatReactions(m.Reactions),
+		strconv.FormatBool(m.Answered),
+		stringOrEmpty(m.Answer),
+		strconv.FormatBool(m.Pinned),
+		strconv.FormatBool(m.Approved),
+		strconv.FormatBool(m.Hidden),
+		stringOrEmpty(m.AttachmentURL),
+		m.CreatedAt.Format(time.RFC3339),
+		editedAt,
+	})
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+func (e *csvExportWriter) Close() error {
+	return e.Flush()
+}
+
+// jsonExportWriter writes a JSON array, one element per message, without
+// building the array in memory first.
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONExportWriter(w io.Writer) (*jsonExportWriter, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+
+	return &jsonExportWriter{w: w}, nil
+}
+
+func (e *jsonExportWriter) WriteMessage(m messageResponse) error {
+	data, err := json.Marshal(m)
+
+	if err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+
+	e.count++
+
+	if _, err := io.WriteString(e.w, "\n"); err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(data)
+
+	return err
+}
+
+func (e *jsonExportWriter) Flush() error {
+	return nil
+}
+
+func (e *jsonExportWriter) Close() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+
+	return err
+}
+
+// formatReactions renders a reaction breakdown as "heart:2;like:5", sorted by
+// type so exports are stable.
+func formatReactions(reactions map[string]int64) string {
+	types := make([]string, 0, len(reactions))
+
+	for t := range reactions {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	for i, t := range types {
+		types[i] = fmt.Sprintf("%s:%d", t, reactions[t])
+	}
+
+	return strings.Join(types, ";")
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+// forEachExportBatch walks every message of the room, replies included, in
+// creation order and calls fn with each batch.
+func (h apiHandler) forEachExportBatch(ctx context.Context, roomId uuid.UUID, fn func([]messageResponse) error) error {
+	var cursorCreatedAt time.Time
+	var cursorId uuid.UUID
+
+	for {
+		messages, err := h.q.GetRoomMessagesForExport(ctx, pgstore.GetRoomMessagesForExportParams{
+			RoomID:          roomId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			Limit:           exportBatchSize,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if len(messages) == 0 {
+			return nil
+		}
+
+		data, err := h.toMessageResponses(ctx, messages)
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(data); err != nil {
+			return err
+		}
+
+		if len(messages) < exportBatchSize {
+			return nil
+		}
+
+		last := messages[len(messages)-1]
+
+		cursorCreatedAt, cursorId = last.CreatedAt, last.ID
+	}
+}
+
+func (h apiHandler) handleExportRoom(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+
+	if format == "" {
+		format = exportFormatJSON
+	}
+
+	var contentType string
+
+	switch format {
+	case exportFormatCSV:
+		contentType = "text/csv; charset=utf-8"
+	case exportFormatJSON:
+		contentType = "application/json"
+	case exportFormatMarkdown:
+		contentType = "text/markdown; charset=utf-8"
+	default:
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid format")
+
+		return
+	}
+
+	if format == exportFormatMarkdown {
+		h.exportMarkdownTranscript(w, r, room)
+
+		return
+	}
+
+	w.Header().Set("content-type", contentType)
+	w.Header().Set("content-disposition", fmt.Sprintf(`attachment; filename="room-%s.%s"`, room.Code, format))
+
+	var (
+		enc exportWriter
+		err error
+	)
+
+	if format == exportFormatCSV {
+		enc, err = newCSVExportWriter(w)
+	} else {
+		enc, err = newJSONExportWriter(w)
+	}
+
+	// Once the first byte is out the status is sent, so failures past this
+	// point can only be logged and the export is cut short.
+	if err != nil {
+		slog.Error("Failed to start room export", "error", err)
+
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	err = h.forEachExportBatch(r.Context(), room.ID, func(batch []messageResponse) error {
+		for _, m := range batch {
+			if err := enc.WriteMessage(m); err != nil {
+				return err
+			}
+		}
+
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.Error("Failed to export room", "error", err)
+
+		return
+	}
+
+	if err := enc.Close(); err != nil {
+		slog.Error("Failed to finish room export", "error", err)
+	}
+}
+
+// exportMarkdownTranscript cannot stream like the other formats since the
+// transcript is grouped and sorted, so it reads the whole room first. That
+// also means errors can still be reported with a proper status.
+func (h apiHandler) exportMarkdownTranscript(w http.ResponseWriter, r *http.Request, room pgstore.Room) {
+	var messages []messageResponse
+
+	err := h.forEachExportBatch(r.Context(), room.ID, func(batch []messageResponse) error {
+		messages = append(messages, batch...)
+
+		return nil
+	})
+
+	if err != nil {
+		slog.Error("Failed to export room transcript", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	w.Header().Set("content-type", "text/markdown; charset=utf-8")
+	w.Header().Set("content-disposition", fmt.Sprintf(`attachment; filename="room-%s.md"`, room.Code))
+
+	if err := writeMarkdownTranscript(w, room, messages, time.Now()); err != nil {
+		slog.Error("Failed to write room transcript", "error", err)
+	}
+}
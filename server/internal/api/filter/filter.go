@@ -0,0 +1,80 @@
+// Package filter decides whether user submitted text may be posted to a
+// room. Rooms opt into filtering; the handler only consults a Filter for
+// rooms that have it enabled.
+package filter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Reasons reported by the built-in filters. Clients switch on them to show
+// a localized explanation, so they must not change.
+const (
+	ReasonBlockedWord = "blocked_word"
+)
+
+// Violation explains why a text was blocked.
+type Violation struct {
+	// Reason is a stable, machine-readable code such as ReasonBlockedWord.
+	Reason string
+	// Match is the part of the text that triggered the filter.
+	Match string
+}
+
+// Filter checks a text and returns nil when it may be posted.
+type Filter interface {
+	Check(text string) *Violation
+}
+
+// Wordlist blocks texts containing any of its words. Words are matched
+// whole and case-insensitively, so "class" does not trip a filter on "ass".
+type Wordlist struct {
+	words map[string]struct{}
+}
+
+func NewWordlist(words []string) *Wordlist {
+	w := &Wordlist{words: make(map[string]struct{}, len(words))}
+
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+
+		if word != "" {
+			w.words[word] = struct{}{}
+		}
+	}
+
+	return w
+}
+
+func (w *Wordlist) Check(text string) *Violation {
+	if len(w.words) == 0 {
+		return nil
+	}
+
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, token := range tokens {
+		if _, ok := w.words[token]; ok {
+			return &Violation{Reason: ReasonBlockedWord, Match: token}
+		}
+	}
+
+	return nil
+}
+
+// DefaultWords is the list used when no other list is configured. It is
+// deliberately short; deployments are expected to supply their own.
+var DefaultWords = []string{
+	"asshole",
+	"bastard",
+	"bitch",
+	"bullshit",
+	"cunt",
+	"fuck",
+	"fucking",
+	"motherfucker",
+	"shit",
+}
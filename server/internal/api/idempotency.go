@@ -0,0 +1,283 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencyPurgeInterval = time.Hour
+)
+
+// idempotencyRecorder passes the response through to the client while
+// keeping a copy so it can be replayed for retries of the same key.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	rec.body.Write(b)
+
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotentReplayKey holds the *idempotentReplay of a request carrying an
+// Idempotency-Key.
+type idempotentReplayKey struct{}
+
+// idempotentReplay is what retries of a request get back in place of the
+// response it was sent, when that response holds a secret.
+type idempotentReplay struct {
+	body []byte
+}
+
+// setIdempotentReplay has retries of the request replay value rather than
+// the response it is sent, which is then never stored. It does nothing for
+// requests without an Idempotency-Key.
+func setIdempotentReplay(r *http.Request, value any) {
+	if replay, ok := r.Context().Value(idempotentReplayKey{}).(*idempotentReplay); ok {
+		replay.body, _ = json.Marshal(value)
+	}
+}
+
+// idempotencyCaller tells apart the clients keys are scoped to, so a key
+// another client happens to pick never replays its response. Clients are
+// known by the participant id and host token they send, or by their
+// address when they send neither. Only a hash of them is stored.
+func idempotencyCaller(r *http.Request) string {
+	participantId, _ := readOptionalParticipantID(r)
+
+	hostToken := r.Header.Get(hostTokenHeader)
+
+	var caller string
+
+	if participantId.Valid || hostToken != "" {
+		caller = "participant\x00" + participantId.UUID.String() + "\x00" + hostToken
+	} else {
+		caller = "ip\x00" + clientIP(r)
+	}
+
+	sum := sha256.Sum256([]byte(caller))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyRequestHash fingerprints the body of a request, along with its
+// content type, to refuse a key reused for something else.
+func idempotencyRequestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+
+	h.Write([]byte(r.Header.Get("content-type")))
+	h.Write([]byte{0})
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotent makes POST and PATCH requests carrying an Idempotency-Key safe
+// to retry. The first request for a key runs normally and its response is
+// stored; later requests from the same caller with the same key, method,
+// path and body get that response back instead of running the handler
+// again.
+func (h apiHandler) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			apierr.Write(w, r, http.StatusBadRequest, "Idempotency-Key is too long")
+
+			return
+		}
+
+		// No endpoint takes a larger body than an attachment upload.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.cfg.MaxAttachmentSize+1<<20))
+
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+
+			if errors.As(err, &maxBytesErr) {
+				apierr.Write(w, r, http.StatusRequestEntityTooLarge, "Request body is too large")
+
+				return
+			}
+
+			apierr.Write(w, r, http.StatusBadRequest, "Failed to read the request body")
+
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		caller := idempotencyCaller(r)
+
+		requestHash := idempotencyRequestHash(r, body)
+
+		reserved, err := h.q.ReserveIdempotencyKey(r.Context(), pgstore.ReserveIdempotencyKeyParams{
+			Caller:      caller,
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			RequestHash: requestHash,
+		})
+
+		if err != nil {
+			slog.Error("Failed to reserve idempotency key", "error", err)
+
+			apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+			return
+		}
+
+		if reserved == 0 {
+			h.replayIdempotentResponse(w, r, caller, key, requestHash)
+
+			return
+		}
+
+		replay := &idempotentReplay{}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), idempotentReplayKey{}, replay)))
+
+		// The client may already be gone, which is exactly when it will
+		// retry, so the outcome is stored even if the request was cancelled.
+		ctx := context.WithoutCancel(r.Context())
+
+		// Server errors are not stored so the client can retry them for real.
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			err = h.q.DeleteIdempotencyKey(ctx, pgstore.DeleteIdempotencyKeyParams{
+				Caller: caller,
+				Key:    key,
+				Method: r.Method,
+				Path:   r.URL.Path,
+			})
+
+			if err != nil {
+				slog.Error("Failed to release idempotency key", "error", err)
+			}
+
+			return
+		}
+
+		stored := rec.body.Bytes()
+
+		if replay.body != nil {
+			stored = replay.body
+		}
+
+		err = h.q.CompleteIdempotencyKey(ctx, pgstore.CompleteIdempotencyKeyParams{
+			StatusCode:  pgtype.Int4{Int32: int32(rec.status), Valid: true},
+			ContentType: pgtype.Text{String: rec.Header().Get("content-type"), Valid: true},
+			Body:        stored,
+			Caller:      caller,
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+		})
+
+		if err != nil {
+			slog.Error("Failed to store idempotent response", "error", err)
+		}
+	})
+}
+
+func (h apiHandler) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, caller string, key string, requestHash string) {
+	stored, err := h.q.GetIdempotencyKey(r.Context(), pgstore.GetIdempotencyKeyParams{
+		Caller: caller,
+		Key:    key,
+		Method: r.Method,
+		Path:   r.URL.Path,
+	})
+
+	// A missing row means the first request failed and released the key
+	// between our insert and this read, which is as good as in progress.
+	if err != nil {
+		apierr.Write(w, r, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+
+		return
+	}
+
+	if stored.RequestHash != requestHash {
+		apierr.Write(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+
+		return
+	}
+
+	if !stored.StatusCode.Valid {
+		apierr.Write(w, r, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+
+		return
+	}
+
+	if stored.ContentType.Valid && stored.ContentType.String != "" {
+		w.Header().Set("content-type", stored.ContentType.String)
+	}
+
+	w.Header().Set(idempotentReplayedHeader, "true")
+
+	w.WriteHeader(int(stored.StatusCode.Int32))
+
+	_, _ = w.Write(stored.Body)
+}
+
+func (h apiHandler) purgeIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := h.q.DeleteExpiredIdempotencyKeys(ctx, time.Now().Add(-h.cfg.IdempotencyKeyTTL))
+
+			if err != nil {
+				slog.Error("Failed to purge idempotency keys", "error", err)
+
+				continue
+			}
+
+			if purged > 0 {
+				slog.Info("idempotency keys purged", "count", purged)
+			}
+		}
+	}
+}
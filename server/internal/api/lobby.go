@@ -0,0 +1,205 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+// lobbyRoomId is the hub room the lobby connections subscribe to. Room ids
+// are UUIDs, so it can't be mistaken for one.
+const lobbyRoomId = "lobby"
+
+// lobbyViewerCountsInterval is how often the lobby is sent the viewer counts
+// of the public rooms, when they changed.
+const lobbyViewerCountsInterval = 5 * time.Second
+
+// MessageRoomCreated announces a public room to the lobby.
+type MessageRoomCreated struct {
+	Room roomResponse `json:"room"`
+}
+
+// MessageRoomViewerCounts lists the public rooms with subscribers, by id.
+// Rooms left out have none. It is also the snapshot of the lobby.
+type MessageRoomViewerCounts struct {
+	Rooms []RoomViewerCount `json:"rooms"`
+}
+
+type RoomViewerCount struct {
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+}
+
+// handleSubscribeLobby streams the lifecycle of the public rooms, so home
+// pages can list live rooms without polling /api/rooms. Lobby connections
+// only listen, and need no credentials.
+func (h apiHandler) handleSubscribeLobby(w http.ResponseWriter, r *http.Request) {
+	if h.hub.Draining() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(subscribeRetryAfter.Seconds())))
+
+		apierr.Write(w, r, http.StatusServiceUnavailable, "Server is restarting")
+
+		return
+	}
+
+	encoding, err := ws.ParseEncoding(r.URL.Query().Get("encoding"))
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid encoding")
+
+		return
+	}
+
+	c, err := h.upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		slog.Warn("Failed to upgrade connection.", "error", err)
+
+		apierr.Write(w, r, http.StatusBadRequest, "Failed to upgrade to WS connection")
+
+		return
+	}
+
+	defer c.Close()
+
+	slog.Info("new lobby client connected", "client_ip", r.RemoteAddr)
+
+	h.hub.Serve(lobbyRoomId, c, ws.ClientInfo{IP: clientIP(r)}, ws.ServeOptions{
+		Snapshot: func(ctx context.Context) (ws.Message, error) {
+			counts, err := h.lobbyViewerCounts(ctx)
+
+			if err != nil {
+				return ws.Message{}, err
+			}
+
+			return ws.NewMessage(MessageKindRoomViewerCounts, lobbyRoomId, counts)
+		},
+		ReadOnly:         true,
+		SlowClientPolicy: h.cfg.SlowClientPolicy,
+		Encoding:         encoding,
+	})
+
+	slog.Info("lobby client disconnected", "client_ip", r.RemoteAddr)
+}
+
+// announceRoom sends a room_created event to the lobby.
+func (h apiHandler) announceRoom(ctx context.Context, roomId uuid.UUID) {
+	room, err := h.q.GetRoom(ctx, roomId)
+
+	if err != nil {
+		slog.Error("Failed to get created room", "room_id", roomId, "error", err)
+
+		return
+	}
+
+	h.notifyClients(MessageKindRoomCreated, lobbyRoomId, MessageRoomCreated{
+		Room: toRoomResponse(room),
+	})
+}
+
+// sendLobbyViewerCounts sends the viewer counts to the lobby until ctx is
+// done, whenever they changed since the last ones sent.
+func (h apiHandler) sendLobbyViewerCounts(ctx context.Context) {
+	ticker := time.NewTicker(lobbyViewerCountsInterval)
+
+	defer ticker.Stop()
+
+	var last []RoomViewerCount
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Nobody is listening, so there is nothing to count for.
+			if current, _ := h.hub.Stats(lobbyRoomId); current == 0 {
+				continue
+			}
+
+			counts, err := h.lobbyViewerCounts(ctx)
+
+			if err != nil {
+				slog.Error("Failed to count lobby viewers", "error", err)
+
+				continue
+			}
+
+			if slices.Equal(counts.Rooms, last) {
+				continue
+			}
+
+			last = counts.Rooms
+
+			h.notifyClients(MessageKindRoomViewerCounts, lobbyRoomId, counts)
+		}
+	}
+}
+
+func (h apiHandler) lobbyViewerCounts(ctx context.Context) (MessageRoomViewerCounts, error) {
+	counts := h.hub.Counts()
+
+	roomIds := make([]uuid.UUID, 0, len(counts))
+
+	for rawRoomId, count := range counts {
+		if roomId, err := uuid.Parse(rawRoomId); err == nil && count > 0 {
+			roomIds = append(roomIds, roomId)
+		}
+	}
+
+	rooms := []RoomViewerCount{}
+
+	if len(roomIds) == 0 {
+		return MessageRoomViewerCounts{Rooms: rooms}, nil
+	}
+
+	public, err := h.q.GetPublicRoomIDs(ctx, roomIds)
+
+	if err != nil {
+		return MessageRoomViewerCounts{}, err
+	}
+
+	for _, roomId := range public {
+		rawRoomId := roomId.String()
+
+		rooms = append(rooms, RoomViewerCount{ID: rawRoomId, Count: counts[rawRoomId]})
+	}
+
+	slices.SortFunc(rooms, func(a, b RoomViewerCount) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return MessageRoomViewerCounts{Rooms: rooms}, nil
+}
+
+// publicRooms tells which of the rooms are public, for the lobby. Failing
+// to tell leaves them all out.
+func (h apiHandler) publicRooms(ctx context.Context, roomIds []uuid.UUID) map[uuid.UUID]bool {
+	public := make(map[uuid.UUID]bool, len(roomIds))
+
+	if len(roomIds) == 0 {
+		return public
+	}
+
+	ids, err := h.q.GetPublicRoomIDs(ctx, roomIds)
+
+	if err != nil {
+		slog.Error("Failed to get public rooms", "error", err)
+
+		return public
+	}
+
+	for _, roomId := range ids {
+		public[roomId] = true
+	}
+
+	return public
+}
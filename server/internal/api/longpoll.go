@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/ws"
+)
+
+// longPollTimeout is how long GET /rooms/{room_id}/events waits for an
+// event before answering with none.
+const longPollTimeout = 30 * time.Second
+
+// handleGetRoomEvents is the long polling fallback of /subscribe/{room_id},
+// for networks that won't let websockets through. Clients call it without
+// since_seq to learn where to start, load the room over REST, then poll with
+// the seq of each answer. Events are the same as over the websocket.
+func (h apiHandler) handleGetRoomEvents(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	participantId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	if !h.checkParticipantNotBanned(w, r, room, participantId) {
+		return
+	}
+
+	var since uint64
+
+	if raw := r.URL.Query().Get("since_seq"); raw != "" {
+		since, err = strconv.ParseUint(raw, 10, 64)
+
+		if err != nil || since == 0 {
+			apierr.Write(w, r, http.StatusBadRequest, "Invalid since_seq")
+
+			return
+		}
+	}
+
+	info := ws.ClientInfo{ParticipantID: participantId, IP: clientIP(r), Host: isHost(r, room)}
+
+	events, seq, err := h.hub.Events(r.Context(), rawRoomId, info, since, longPollTimeout)
+
+	switch {
+	case errors.Is(err, ws.ErrEventsGone):
+		apierr.WriteProblem(w, r, apierr.Problem{
+			Type:   apierr.TypeEventsGone,
+			Status: http.StatusGone,
+			Detail: "Events since since_seq are no longer available",
+			Extensions: map[string]any{
+				"seq": seq,
+			},
+		})
+
+		return
+	case errors.Is(err, ws.ErrDraining):
+		w.Header().Set("Retry-After", strconv.Itoa(int(subscribeRetryAfter.Seconds())))
+
+		apierr.Write(w, r, http.StatusServiceUnavailable, "Server is restarting")
+
+		return
+	case err != nil:
+		// The client went away, so there is no one to answer.
+		slog.Debug("Long poll ended", "room_id", rawRoomId, "error", err)
+
+		return
+	}
+
+	type response struct {
+		Events []json.RawMessage `json:"events"`
+		Seq    uint64            `json:"seq"`
+	}
+
+	if events == nil {
+		events = []json.RawMessage{}
+	}
+
+	sendJSON(w, response{Events: events, Seq: seq})
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// maxMessageLength mirrors the VARCHAR(255) size of messages.message.
+	maxMessageLength = 255
+	// maxAnswerLength mirrors the VARCHAR(1000) size of messages.answer.
+	maxAnswerLength = 1000
+	// maxBulkMessageIDs caps how many messages a single bulk request can touch.
+	maxBulkMessageIDs = 100
+)
+
+const (
+	// The top messages view backs presenter overlays, which only ever show a
+	// handful of questions, so it has a smaller default page than listings.
+	defaultTopMessagesLimit = 10
+	maxTopMessagesLimit     = 50
+)
+
+const (
+	sortNewest      = "newest"
+	sortOldest      = "oldest"
+	sortMostReacted = "most_reacted"
+)
+
+// checkContent runs the configured content filter over text when the room
+// has it enabled, writing a 422 with the reason when the text is blocked.
+func (h apiHandler) checkContent(w http.ResponseWriter, r *http.Request, room pgstore.Room, text string) bool {
+	if !room.ContentFilter || h.cfg.ContentFilter == nil {
+		return true
+	}
+
+	violation := h.cfg.ContentFilter.Check(text)
+
+	if violation == nil {
+		return true
+	}
+
+	apierr.WriteProblem(w, r, apierr.Problem{
+		Type:   apierr.TypeContentBlocked,
+		Status: http.StatusUnprocessableEntity,
+		Detail: "Message blocked by content filter",
+		Extensions: map[string]any{
+			"reason": violation.Reason,
+			"match":  violation.Match,
+		},
+	})
+
+	return false
+}
+
+func isValidMessageSort(sort string) bool {
+	switch sort {
+	case sortNewest, sortOldest, sortMostReacted:
+		return true
+	default:
+		return false
+	}
+}
+
+type duplicateMessage struct {
+	ID         string  `json:"id"`
+	Message    string  `json:"message"`
+	Similarity float32 `json:"similarity"`
+}
+
+// findDuplicateMessages returns the questions of the room that look like
+// message, using trigram similarity. The check is best effort: failures are
+// logged and reported as no duplicates so they never block posting.
+func (h apiHandler) findDuplicateMessages(ctx context.Context, roomId, messageId uuid.UUID, message string) []duplicateMessage {
+	similar, err := h.q.FindSimilarMessages(ctx, pgstore.FindSimilarMessagesParams{
+		Message:   message,
+		RoomID:    roomId,
+		ExcludeID: messageId,
+	})
+
+	if err != nil {
+		slog.Warn("Failed to find similar messages", "error", err)
+
+		return []duplicateMessage{}
+	}
+
+	duplicates := make([]duplicateMessage, len(similar))
+
+	for i, m := range similar {
+		duplicates[i] = duplicateMessage{
+			ID:         m.ID.String(),
+			Message:    m.Message,
+			Similarity: m.Similarity,
+		}
+	}
+
+	return duplicates
+}
+
+type messageQuery struct {
+	RoomID uuid.UUID
+	// ViewerID is the participant reading the listing. Their own hidden
+	// messages stay in it.
+	ViewerID uuid.NullUUID
+	Sort     string
+	Answered pgtype.Bool
+	Cursor   *pageCursor
+	Limit    int32
+	Offset   int32
+}
+
+// queryRoomMessages picks the store query matching the requested sort and
+// pagination mode. The cursor takes precedence over the offset when set.
+func (h apiHandler) queryRoomMessages(ctx context.Context, mq messageQuery) ([]pgstore.Message, error) {
+	switch {
+	case mq.Sort == sortMostReacted:
+		return h.q.GetRoomMessagesMostReacted(ctx, pgstore.GetRoomMessagesMostReactedParams{
+			RoomID:   mq.RoomID,
+			ViewerID: mq.ViewerID,
+			Answered: mq.Answered,
+			Limit:    mq.Limit,
+			Offset:   mq.Offset,
+		})
+	case mq.Sort == sortNewest && mq.Cursor != nil:
+		return h.q.GetRoomMessagesBeforeCursor(ctx, pgstore.GetRoomMessagesBeforeCursorParams{
+			RoomID:          mq.RoomID,
+			ViewerID:        mq.ViewerID,
+			Answered:        mq.Answered,
+			CursorPinned:    mq.Cursor.Pinned,
+			CursorCreatedAt: mq.Cursor.CreatedAt,
+			CursorID:        mq.Cursor.ID,
+			Limit:           mq.Limit,
+		})
+	case mq.Sort == sortNewest:
+		return h.q.GetRoomMessagesNewest(ctx, pgstore.GetRoomMessagesNewestParams{
+			RoomID:   mq.RoomID,
+			ViewerID: mq.ViewerID,
+			Answered: mq.Answered,
+			Limit:    mq.Limit,
+			Offset:   mq.Offset,
+		})
+	case mq.Cursor != nil:
+		return h.q.GetRoomMessagesAfterCursor(ctx, pgstore.GetRoomMessagesAfterCursorParams{
+			RoomID:          mq.RoomID,
+			ViewerID:        mq.ViewerID,
+			Answered:        mq.Answered,
+			CursorPinned:    mq.Cursor.Pinned,
+			CursorCreatedAt: mq.Cursor.CreatedAt,
+			CursorID:        mq.Cursor.ID,
+			Limit:           mq.Limit,
+		})
+	default:
+		return h.q.GetRoomMessages(ctx, pgstore.GetRoomMessagesParams{
+			RoomID:   mq.RoomID,
+			ViewerID: mq.ViewerID,
+			Answered: mq.Answered,
+			Limit:    mq.Limit,
+			Offset:   mq.Offset,
+		})
+	}
+}
+
+type messageResponse struct {
+	ID            string     `json:"id"`
+	RoomID        string     `json:"room_id"`
+	Message       string     `json:"message"`
+	ReactionCount int64      `json:"reaction_count"`
+	Answered      bool       `json:"answered"`
+	CreatedAt     time.Time  `json:"created_at"`
+	EditedAt      *time.Time `json:"edited_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ParentID      *string    `json:"parent_id"`
+	Answer        *string    `json:"answer"`
+	Pinned        bool       `json:"pinned"`
+	AttachmentURL *string    `json:"attachment_url"`
+	Approved      bool       `json:"approved"`
+	Hidden        bool       `json:"hidden"`
+	// Reactions breaks ReactionCount down by type. It is only filled in by
+	// the listing endpoints.
+	Reactions map[string]int64 `json:"reactions,omitempty"`
+	// Rank is the 1-based position of the message among the room's questions
+	// ordered by reactions, oldest first on ties. Clients sort on it instead
+	// of re-deriving the order from counts that change under them. Like
+	// Reactions it is only filled in by the listing endpoints, and it is
+	// omitted for replies.
+	Rank int64 `json:"rank,omitempty"`
+}
+
+func toMessageResponse(m pgstore.Message) messageResponse {
+	return messageResponse{
+		ID:            m.ID.String(),
+		RoomID:        m.RoomID.String(),
+		Message:       m.Message,
+		ReactionCount: m.ReactionCount,
+		Answered:      m.Answered,
+		CreatedAt:     m.CreatedAt,
+		EditedAt:      timePtr(m.EditedAt),
+		UpdatedAt:     m.UpdatedAt,
+		ParentID:      nullUUIDPtr(m.ParentMessageID),
+		Answer:        textPtr(m.Answer),
+		Pinned:        m.Pinned,
+		AttachmentURL: textPtr(m.AttachmentUrl),
+		Approved:      m.Approved,
+		Hidden:        m.Hidden,
+	}
+}
+
+func textPtr(t pgtype.Text) *string {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.String
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *string {
+	if !id.Valid {
+		return nil
+	}
+
+	s := id.UUID.String()
+
+	return &s
+}
+
+// readAnsweredFilter reads the optional answered query param. An absent param
+// yields an invalid pgtype.Bool, which the store treats as "no filter".
+func readAnsweredFilter(r *http.Request) (pgtype.Bool, error) {
+	raw := r.URL.Query().Get("answered")
+
+	if raw == "" {
+		return pgtype.Bool{}, nil
+	}
+
+	answered, err := strconv.ParseBool(raw)
+
+	if err != nil {
+		return pgtype.Bool{}, err
+	}
+
+	return pgtype.Bool{Bool: answered, Valid: true}, nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"server/internal/api/apierr"
+	"server/internal/store"
+	"server/internal/store/pgstore"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (h apiHandler) handleGetPendingRoomMessages(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	messages, err := h.q.GetRoomPendingMessages(r.Context(), room.ID)
+
+	if err != nil {
+		slog.Error("Failed to get pending room messages", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Messages []messageResponse `json:"messages"`
+	}
+
+	data := make([]messageResponse, len(messages))
+
+	for i, m := range messages {
+		data[i] = toMessageResponse(m)
+	}
+
+	sendJSON(w, response{Messages: data})
+}
+
+func (h apiHandler) handleApproveMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	if message.Approved {
+		sendJSON(w, toMessageResponse(message))
+
+		return
+	}
+
+	message, err := h.q.ApproveMessage(r.Context(), message.ID)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to approve message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, toMessageResponse(message))
+
+	// For the audience the message only exists from now on, so approval is
+	// announced the same way a new message is.
+	h.notifyClients(MessageKindMessageCreated, rawRoomId, MessageMessageCreated{
+		ID:       message.ID.String(),
+		Message:  message.Message,
+		ParentID: nullUUIDPtr(message.ParentMessageID),
+	})
+}
+
+func (h apiHandler) handleRejectMessage(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	if message.Approved {
+		apierr.Write(w, r, http.StatusConflict, "Message is already approved")
+
+		return
+	}
+
+	// Rejected messages were never shown to the audience, so there is
+	// nothing to broadcast.
+	if err := h.q.SoftDeleteMessage(r.Context(), message.ID); err != nil {
+		slog.Error("Failed to reject message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h apiHandler) handleHideMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	type _body struct {
+		Hidden *bool `json:"hidden"`
+	}
+	var body _body
+
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+
+	// An empty body hides the message, {"hidden": false} shows it again.
+	hidden := body.Hidden == nil || *body.Hidden
+
+	if message.Hidden == hidden {
+		sendJSON(w, toMessageResponse(message))
+
+		return
+	}
+
+	action := auditActionHideMessage
+
+	if !hidden {
+		action = auditActionUnhideMessage
+	}
+
+	err := h.q.WithTx(r.Context(), func(q store.Store) error {
+		var err error
+
+		message, err = q.SetMessageHidden(r.Context(), pgstore.SetMessageHiddenParams{
+			ID:     message.ID,
+			Hidden: hidden,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return audit(r.Context(), q, r, room, action, message.ID)
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierr.Write(w, r, http.StatusNotFound, "Message not found")
+
+			return
+		}
+
+		slog.Error("Failed to hide message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	sendJSON(w, toMessageResponse(message))
+
+	// Pending messages were never broadcast, so neither is hiding them.
+	if !message.Approved {
+		return
+	}
+
+	// The author keeps seeing their message as if nothing happened, so they
+	// are left out of the broadcast either way.
+	if hidden {
+		h.notifyClientsExcept(message.ParticipantID, MessageKindMessageHidden, rawRoomId, MessageMessageHidden{ID: message.ID.String()})
+
+		return
+	}
+
+	h.notifyClientsExcept(message.ParticipantID, MessageKindMessageCreated, rawRoomId, MessageMessageCreated{
+		ID:       message.ID.String(),
+		Message:  message.Message,
+		ParentID: nullUUIDPtr(message.ParentMessageID),
+	})
+}
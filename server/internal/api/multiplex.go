@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+	"server/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxMultiplexedRooms caps the rooms one /subscribe connection can watch.
+const maxMultiplexedRooms = 50
+
+// handleSubscribeMany upgrades to a websocket on which the client picks its
+// rooms with subscribe and unsubscribe frames, see ws.ServeMux. Each room is
+// authorized like /subscribe/{room_id} would, with the access code or a
+// subscribe token passed in the frame.
+func (h apiHandler) handleSubscribeMany(w http.ResponseWriter, r *http.Request) {
+	participantId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	if h.hub.Draining() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(subscribeRetryAfter.Seconds())))
+
+		apierr.Write(w, r, http.StatusServiceUnavailable, "Server is restarting")
+
+		return
+	}
+
+	c, err := h.upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		slog.Warn("Failed to upgrade connection.", "error", err)
+
+		apierr.Write(w, r, http.StatusBadRequest, "Failed to upgrade to WS connection")
+
+		return
+	}
+
+	defer c.Close()
+
+	info := ws.ClientInfo{ParticipantID: participantId, IP: clientIP(r)}
+
+	slog.Info("new multiplexed client connected", "client_ip", r.RemoteAddr)
+
+	h.hub.ServeMux(c, info, ws.MuxOptions{
+		Authorize: func(frame ws.SubscribeFrame) error {
+			return h.authorizeSubscription(r.Context(), frame, info)
+		},
+		MaxRooms:         maxMultiplexedRooms,
+		SlowClientPolicy: h.cfg.SlowClientPolicy,
+	})
+
+	slog.Info("multiplexed client disconnected", "client_ip", r.RemoteAddr)
+}
+
+// authorizeSubscription runs the checks of handleSubscribe for a room
+// joined over a multiplexed connection.
+func (h apiHandler) authorizeSubscription(ctx context.Context, frame ws.SubscribeFrame, info ws.ClientInfo) error {
+	roomId, err := uuid.Parse(frame.RoomID)
+
+	if err != nil {
+		return &ws.SubscribeError{Status: http.StatusBadRequest, Detail: "Invalid room id"}
+	}
+
+	room, err := h.q.GetRoom(ctx, roomId)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &ws.SubscribeError{Status: http.StatusNotFound, Detail: "Room not found"}
+		}
+
+		return err
+	}
+
+	if frame.Token != "" {
+		if _, err := h.verifySubscribeToken(frame.Token, room.ID); err != nil {
+			return &ws.SubscribeError{Status: http.StatusUnauthorized, Detail: err.Error()}
+		}
+	} else if room.Private && !validAccessCode(room, frame.AccessCode) {
+		return &ws.SubscribeError{Status: http.StatusForbidden, Detail: "Invalid access code"}
+	}
+
+	banned, err := h.q.IsBannedFromRoom(ctx, pgstore.IsBannedFromRoomParams{
+		RoomID:        room.ID,
+		ParticipantID: info.ParticipantID,
+		Ip:            pgtype.Text{String: info.IP, Valid: true},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if banned {
+		return &ws.SubscribeError{Status: http.StatusForbidden, Detail: "You are banned from this room"}
+	}
+
+	if room.Closed {
+		return &ws.SubscribeError{Status: http.StatusConflict, Detail: "Room is closed"}
+	}
+
+	if current, _ := h.hub.Stats(frame.RoomID); h.cfg.MaxRoomSubscribers > 0 && current >= h.cfg.MaxRoomSubscribers {
+		return &ws.SubscribeError{Status: http.StatusServiceUnavailable, Detail: "Room is full"}
+	}
+
+	return nil
+}
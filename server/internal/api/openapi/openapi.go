@@ -0,0 +1,121 @@
+// Package openapi embeds the hand-maintained OpenAPI document of the API and
+// checks incoming requests against it.
+//
+// The validator only understands the parts of OpenAPI 3 the document uses:
+// path, query and header parameters, JSON request bodies, local $refs, and
+// the type, format, enum, required, properties, additionalProperties, items,
+// nullable, allOf, minimum, maximum and maxLength keywords. It is meant for
+// development, to catch drift between the document and the handlers.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	Nullable             bool               `json:"nullable"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	AllOf                []*schema          `json:"allOf"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MaxLength            *int               `json:"maxLength"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type operation struct {
+	Parameters  []parameter  `json:"parameters"`
+	RequestBody *requestBody `json:"requestBody"`
+}
+
+type document struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type route struct {
+	pattern    *regexp.Regexp
+	params     []string
+	operations map[string]*operation
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^/}]+)\}`)
+
+func compileRoute(path string, operations map[string]*operation) route {
+	rt := route{operations: make(map[string]*operation, len(operations))}
+
+	for method, op := range operations {
+		rt.operations[strings.ToUpper(method)] = op
+	}
+
+	var b strings.Builder
+
+	b.WriteString("^")
+
+	last := 0
+
+	for _, m := range pathParamPattern.FindAllStringSubmatchIndex(path, -1) {
+		b.WriteString(regexp.QuoteMeta(path[last:m[0]]))
+		b.WriteString("([^/]+)")
+
+		rt.params = append(rt.params, path[m[2]:m[3]])
+
+		last = m[1]
+	}
+
+	b.WriteString(regexp.QuoteMeta(path[last:]))
+	b.WriteString("/?$")
+
+	rt.pattern = regexp.MustCompile(b.String())
+
+	return rt
+}
+
+func parse(data []byte) (document, []route, error) {
+	var doc document
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return document{}, nil, fmt.Errorf("openapi: parse spec: %w", err)
+	}
+
+	routes := make([]route, 0, len(doc.Paths))
+
+	for path, operations := range doc.Paths {
+		routes = append(routes, compileRoute(path, operations))
+	}
+
+	return doc, routes, nil
+}
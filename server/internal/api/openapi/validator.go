@@ -0,0 +1,440 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"server/internal/api/apierr"
+
+	"github.com/google/uuid"
+)
+
+// TypeSpecViolation is the problem type of requests the validator rejects.
+const TypeSpecViolation = "/problems/spec-violation"
+
+// maxValidatedBodySize bounds how much of a JSON body the validator buffers.
+// Larger bodies are passed through unchecked for the handler to refuse.
+const maxValidatedBodySize = 1 << 20
+
+type Validator struct {
+	doc      document
+	routes   []route
+	prefixes []string
+}
+
+// NewValidator parses the embedded spec. Request paths are matched after
+// stripping the longest server URL they start with.
+func NewValidator() (*Validator, error) {
+	doc, routes, err := parse(Spec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Validator{doc: doc, routes: routes}
+
+	for _, server := range doc.Servers {
+		v.prefixes = append(v.prefixes, strings.TrimSuffix(server.URL, "/"))
+	}
+
+	sort.Slice(v.prefixes, func(i, j int) bool {
+		return len(v.prefixes[i]) > len(v.prefixes[j])
+	})
+
+	return v, nil
+}
+
+// Middleware rejects requests that don't match the spec with a 400 listing
+// every problem found. Paths outside the servers of the spec are left alone.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := v.trimPrefix(r.URL.Path)
+
+		if !ok {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		errs, err := v.validate(r, path)
+
+		if err != nil {
+			apierr.Write(w, r, http.StatusBadRequest, "Failed to read the request body")
+
+			return
+		}
+
+		if len(errs) > 0 {
+			apierr.WriteProblem(w, r, apierr.Problem{
+				Type:       TypeSpecViolation,
+				Status:     http.StatusBadRequest,
+				Detail:     "Request does not match the API spec",
+				Extensions: map[string]any{"errors": errs},
+			})
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (v *Validator) trimPrefix(path string) (string, bool) {
+	for _, prefix := range v.prefixes {
+		if rest, ok := strings.CutPrefix(path, prefix); ok && (rest == "" || rest[0] == '/') {
+			return rest, true
+		}
+	}
+
+	return "", false
+}
+
+func (v *Validator) validate(r *http.Request, path string) ([]string, error) {
+	var (
+		op     *operation
+		params map[string]string
+		found  bool
+	)
+
+	for _, rt := range v.routes {
+		m := rt.pattern.FindStringSubmatch(path)
+
+		if m == nil {
+			continue
+		}
+
+		found = true
+
+		if op = rt.operations[r.Method]; op == nil {
+			continue
+		}
+
+		params = make(map[string]string, len(rt.params))
+
+		for i, name := range rt.params {
+			params[name] = m[i+1]
+		}
+
+		break
+	}
+
+	switch {
+	case !found:
+		return []string{fmt.Sprintf("path %s is not in the spec", path)}, nil
+	case op == nil && r.Method == http.MethodOptions:
+		return nil, nil
+	case op == nil:
+		return []string{fmt.Sprintf("method %s is not allowed on %s", r.Method, path)}, nil
+	}
+
+	var errs []string
+
+	for _, p := range op.Parameters {
+		var (
+			raw     string
+			present bool
+		)
+
+		switch p.In {
+		case "path":
+			raw, present = params[p.Name]
+		case "query":
+			present = r.URL.Query().Has(p.Name)
+			raw = r.URL.Query().Get(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		}
+
+		field := p.In + " parameter " + p.Name
+
+		if !present {
+			if p.Required {
+				errs = append(errs, field+" is required")
+			}
+
+			continue
+		}
+
+		errs = append(errs, v.checkParameter(field, raw, p.Schema)...)
+	}
+
+	bodyErrs, err := v.checkBody(r, op.RequestBody)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(errs, bodyErrs...), nil
+}
+
+// checkParameter converts raw to the type its schema asks for before
+// checking it, since parameters always arrive as strings.
+func (v *Validator) checkParameter(field, raw string, s *schema) []string {
+	s = v.resolve(s)
+
+	if s == nil {
+		return nil
+	}
+
+	var value any = raw
+
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+
+		if err != nil {
+			return []string{field + " must be an integer"}
+		}
+
+		value = float64(n)
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+
+		if err != nil {
+			return []string{field + " must be a number"}
+		}
+
+		value = n
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+
+		if err != nil {
+			return []string{field + " must be a boolean"}
+		}
+
+		value = b
+	}
+
+	return v.check(field, value, s)
+}
+
+func (v *Validator) checkBody(r *http.Request, rb *requestBody) ([]string, error) {
+	if rb == nil {
+		return nil, nil
+	}
+
+	mediaTypeName, _, _ := mime.ParseMediaType(r.Header.Get("content-type"))
+
+	if mediaTypeName != "" {
+		if _, ok := rb.Content[mediaTypeName]; !ok {
+			return []string{fmt.Sprintf("content type %s is not accepted", mediaTypeName)}, nil
+		}
+	}
+
+	// Only JSON bodies are checked. Multipart uploads are checked for their
+	// content type and left to the handler.
+	media, ok := rb.Content["application/json"]
+
+	if !ok || (mediaTypeName != "" && mediaTypeName != "application/json") {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedBodySize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The handler still reads the body, so it is put back whole, including
+	// whatever was left past the limit.
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+
+	if len(data) > maxValidatedBodySize {
+		return nil, nil
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if rb.Required {
+			return []string{"request body is required"}, nil
+		}
+
+		return nil, nil
+	}
+
+	var value any
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return []string{"request body must be valid JSON"}, nil
+	}
+
+	return v.check("body", value, media.Schema), nil
+}
+
+func (v *Validator) resolve(s *schema) *schema {
+	for s != nil && s.Ref != "" {
+		s = v.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+
+	return s
+}
+
+// check validates a decoded JSON value against s. Numbers are float64 as
+// encoding/json decodes them into any.
+func (v *Validator) check(field string, value any, s *schema) []string {
+	s = v.resolve(s)
+
+	if s == nil {
+		return nil
+	}
+
+	var errs []string
+
+	for _, sub := range s.AllOf {
+		errs = append(errs, v.check(field, value, sub)...)
+	}
+
+	if value == nil {
+		if s.Type != "" && !s.Nullable {
+			errs = append(errs, field+" must not be null")
+		}
+
+		return errs
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := value.(string)
+
+		if !ok {
+			return append(errs, field+" must be a string")
+		}
+
+		if s.MaxLength != nil && utf8.RuneCountInString(str) > *s.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s must be at most %d characters", field, *s.MaxLength))
+		}
+
+		if msg := checkFormat(s.Format, str); msg != "" {
+			errs = append(errs, field+" "+msg)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+
+		if !ok || (s.Type == "integer" && n != float64(int64(n))) {
+			return append(errs, field+" must be "+map[string]string{"integer": "an integer", "number": "a number"}[s.Type])
+		}
+
+		if s.Minimum != nil && n < *s.Minimum {
+			errs = append(errs, fmt.Sprintf("%s must be at least %v", field, *s.Minimum))
+		}
+
+		if s.Maximum != nil && n > *s.Maximum {
+			errs = append(errs, fmt.Sprintf("%s must be at most %v", field, *s.Maximum))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return append(errs, field+" must be a boolean")
+		}
+	case "array":
+		items, ok := value.([]any)
+
+		if !ok {
+			return append(errs, field+" must be an array")
+		}
+
+		for i, item := range items {
+			errs = append(errs, v.check(fmt.Sprintf("%s[%d]", field, i), item, s.Items)...)
+		}
+	case "object":
+		obj, ok := value.(map[string]any)
+
+		if !ok {
+			return append(errs, field+" must be an object")
+		}
+
+		errs = append(errs, v.checkObject(field, obj, s)...)
+	}
+
+	if len(s.Enum) > 0 && !containsValue(s.Enum, value) {
+		errs = append(errs, fmt.Sprintf("%s must be one of %v", field, s.Enum))
+	}
+
+	return errs
+}
+
+func (v *Validator) checkObject(field string, obj map[string]any, s *schema) []string {
+	var errs []string
+
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			errs = append(errs, field+"."+name+" is required")
+		}
+	}
+
+	// Map order is random, so properties are walked sorted to keep the
+	// error list stable between requests.
+	names := make([]string, 0, len(obj))
+
+	for name := range obj {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	closed := string(s.AdditionalProperties) == "false"
+
+	var additional *schema
+
+	if !closed && len(s.AdditionalProperties) > 0 && string(s.AdditionalProperties) != "true" {
+		additional = &schema{}
+
+		_ = json.Unmarshal(s.AdditionalProperties, additional)
+	}
+
+	for _, name := range names {
+		prop, ok := s.Properties[name]
+
+		switch {
+		case ok:
+			errs = append(errs, v.check(field+"."+name, obj[name], prop)...)
+		case closed:
+			errs = append(errs, field+"."+name+" is not allowed")
+		case additional != nil:
+			errs = append(errs, v.check(field+"."+name, obj[name], additional)...)
+		}
+	}
+
+	return errs
+}
+
+func checkFormat(format, value string) string {
+	switch format {
+	case "uuid":
+		if _, err := uuid.Parse(value); err != nil {
+			return "must be a UUID"
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return "must be an RFC 3339 date-time"
+		}
+	case "ipv4", "ipv6":
+		if _, err := netip.ParseAddr(value); err != nil {
+			return "must be an IP address"
+		}
+	}
+
+	return ""
+}
+
+func containsValue(values []any, value any) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
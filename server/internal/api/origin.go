@@ -0,0 +1,58 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// checkOrigin returns the CheckOrigin of the websocket upgrader. Requests
+// without an Origin header don't come from a browser and are let through,
+// as are origins on the same host as the API. Anything else has to match
+// one of allowed, where * stands for any run of characters other than a
+// slash, as in https://*.example.com.
+func checkOrigin(allowed []string, allowAny bool) func(r *http.Request) bool {
+	patterns := make([]string, 0, len(allowed))
+
+	for _, origin := range allowed {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			patterns = append(patterns, strings.ToLower(strings.TrimSuffix(origin, "/")))
+		}
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+
+		if origin == "" || allowAny {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+
+		if err != nil || u.Host == "" {
+			return false
+		}
+
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+
+		origin = strings.ToLower(u.Scheme + "://" + u.Host)
+
+		for _, pattern := range patterns {
+			if pattern == "*" {
+				return true
+			}
+
+			if ok, _ := path.Match(pattern, origin); ok {
+				return true
+			}
+		}
+
+		slog.Warn("Rejected websocket origin", "origin", origin)
+
+		return false
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// readPagination reads the limit and offset query params, falling back to
+// defaultPageLimit and clamping the limit to maxPageLimit.
+func readPagination(r *http.Request) (limit, offset int32, err error) {
+	limit = defaultPageLimit
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 32)
+
+		if err != nil || v < 1 {
+			return 0, 0, errors.New("Invalid limit")
+		}
+
+		limit = int32(min(v, maxPageLimit))
+	}
+
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 32)
+
+		if err != nil || v < 0 {
+			return 0, 0, errors.New("Invalid offset")
+		}
+
+		offset = int32(v)
+	}
+
+	return limit, offset, nil
+}
+
+// pageCursor points at the last item of a keyset page. Items are ordered by
+// (created_at, id), so the id breaks ties between items created at the same
+// instant. Message pages sort pinned messages first, so their cursors also
+// carry the pinned flag of the last item.
+type pageCursor struct {
+	Pinned    bool
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func encodeCursor(c pageCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+
+	if c.Pinned {
+		raw += "|pinned"
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return pageCursor{}, err
+	}
+
+	parts := strings.Split(string(raw), "|")
+
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "pinned") {
+		return pageCursor{}, errors.New("malformed cursor")
+	}
+
+	rawCreatedAt, rawId := parts[0], parts[1]
+
+	createdAt, err := time.Parse(time.RFC3339Nano, rawCreatedAt)
+
+	if err != nil {
+		return pageCursor{}, err
+	}
+
+	id, err := uuid.Parse(rawId)
+
+	if err != nil {
+		return pageCursor{}, err
+	}
+
+	return pageCursor{Pinned: len(parts) == 3, CreatedAt: createdAt, ID: id}, nil
+}
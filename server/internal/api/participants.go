@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// participantHeader carries the anonymous participant id a browser
+	// generates once and keeps in local storage. WebSocket clients cannot
+	// set headers, so the query param is accepted as a fallback.
+	participantHeader     = "X-Participant-Id"
+	participantQueryParam = "participant_id"
+)
+
+// readOptionalParticipantID returns a null id when the request does not
+// identify its participant, and an error when it does so with something
+// other than a UUID.
+func readOptionalParticipantID(r *http.Request) (uuid.NullUUID, error) {
+	raw := r.Header.Get(participantHeader)
+
+	if raw == "" {
+		raw = r.URL.Query().Get(participantQueryParam)
+	}
+
+	if raw == "" {
+		return uuid.NullUUID{}, nil
+	}
+
+	id, err := uuid.Parse(raw)
+
+	if err != nil {
+		return uuid.NullUUID{}, errors.New("Invalid participant id")
+	}
+
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
+
+// readParticipantID writes a 400 when the request does not identify its
+// participant with a valid UUID.
+func readParticipantID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return uuid.UUID{}, false
+	}
+
+	if !id.Valid {
+		apierr.Write(w, r, http.StatusBadRequest, "Missing participant id")
+
+		return uuid.UUID{}, false
+	}
+
+	return id.UUID, true
+}
+
+// isAuthor reports whether the request comes from the participant that
+// wrote the message.
+func isAuthor(r *http.Request, message pgstore.Message) bool {
+	id, err := readOptionalParticipantID(r)
+
+	return err == nil && id.Valid && message.ParticipantID == id
+}
+
+// authorizeAuthorOrHost writes a 403 unless the request comes from the
+// participant that wrote the message or carries the host token of the room.
+func authorizeAuthorOrHost(w http.ResponseWriter, r *http.Request, room pgstore.Room, message pgstore.Message) bool {
+	if !isAuthor(r, message) && !isHost(r, room) {
+		apierr.Write(w, r, http.StatusForbidden, "Only the author or the room host can do this")
+
+		return false
+	}
+
+	return true
+}
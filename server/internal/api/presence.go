@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// handleGetRoomPresence lists the participants connected to the room, by
+// their anonymous ids, for its host. participant_joined and
+// participant_left events keep the list up to date.
+func (h apiHandler) handleGetRoomPresence(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	presence := h.hub.Presence(rawRoomId)
+
+	type participant struct {
+		ParticipantID string    `json:"participant_id"`
+		Connections   int       `json:"connections"`
+		JoinedAt      time.Time `json:"joined_at"`
+	}
+
+	type response struct {
+		Participants []participant `json:"participants"`
+		Anonymous    int           `json:"anonymous"`
+	}
+
+	data := make([]participant, len(presence.Participants))
+
+	for i, p := range presence.Participants {
+		data[i] = participant{
+			ParticipantID: p.ParticipantID.String(),
+			Connections:   p.Connections,
+			JoinedAt:      p.JoinedAt.UTC().Truncate(time.Second),
+		}
+	}
+
+	sendJSON(w, response{Participants: data, Anonymous: presence.Anonymous})
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const deletedPurgeInterval = time.Hour
+
+// purgeDeleted removes the rooms and messages deleted longer than
+// DeletedRetention ago until ctx is done. Until then they are only hidden,
+// so a deletion can be undone or looked into by a moderator.
+func (h apiHandler) purgeDeleted(ctx context.Context) {
+	ticker := time.NewTicker(deletedPurgeInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deletedAt := time.Now().Add(-h.cfg.DeletedRetention)
+
+			messages, err := h.q.PurgeDeletedMessages(ctx, deletedAt)
+
+			if err != nil {
+				slog.Error("Failed to purge deleted messages", "error", err)
+			} else if messages > 0 {
+				slog.Info("deleted messages purged", "count", messages)
+			}
+
+			rooms, err := h.q.PurgeDeletedRooms(ctx, deletedAt)
+
+			if err != nil {
+				slog.Error("Failed to purge deleted rooms", "error", err)
+			} else if rooms > 0 {
+				slog.Info("deleted rooms purged", "count", rooms)
+			}
+		}
+	}
+}
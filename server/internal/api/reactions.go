@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+const (
+	reactionLike     = "like"
+	reactionHeart    = "heart"
+	reactionLaugh    = "laugh"
+	reactionWow      = "wow"
+	reactionClap     = "clap"
+	reactionThinking = "thinking"
+)
+
+func isValidReactionType(t string) bool {
+	switch t {
+	case reactionLike, reactionHeart, reactionLaugh, reactionWow, reactionClap, reactionThinking:
+		return true
+	default:
+		return false
+	}
+}
+
+// reactionResponse is returned by the reaction endpoints. Count is the total
+// across every type, TypeCount only covers Type, and Reacted tells the
+// participant whether they now have a reaction on the message.
+type reactionResponse struct {
+	Count     int64  `json:"count"`
+	Type      string `json:"type,omitempty"`
+	TypeCount int64  `json:"type_count"`
+	Reacted   bool   `json:"reacted"`
+}
+
+// readReactionType reads the reaction type from the request body. The body
+// is optional so clients written before typed reactions keep sending likes.
+func readReactionType(w http.ResponseWriter, r *http.Request) (string, bool) {
+	type _body struct {
+		Type string `json:"type"`
+	}
+	var body _body
+
+	if !decodeOptionalBody(w, r, &body) {
+		return "", false
+	}
+
+	if body.Type == "" {
+		return reactionLike, true
+	}
+
+	if !isValidReactionType(body.Type) {
+		apierr.Write(w, r, http.StatusBadRequest, "Invalid reaction type")
+
+		return "", false
+	}
+
+	return body.Type, true
+}
+
+// toMessageResponses converts messages and fills in their per-type reaction
+// breakdown and their rank. Every message must belong to the same room.
+func (h apiHandler) toMessageResponses(ctx context.Context, messages []pgstore.Message) ([]messageResponse, error) {
+	data := make([]messageResponse, len(messages))
+	ids := make([]uuid.UUID, len(messages))
+
+	for i, m := range messages {
+		data[i] = toMessageResponse(m)
+		data[i].Reactions = map[string]int64{}
+		ids[i] = m.ID
+	}
+
+	if len(messages) == 0 {
+		return data, nil
+	}
+
+	rows, err := h.q.GetMessagesReactions(ctx, ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[uuid.UUID]int, len(messages))
+
+	for i, m := range messages {
+		index[m.ID] = i
+	}
+
+	for _, row := range rows {
+		if i, ok := index[row.MessageID]; ok {
+			data[i].Reactions[row.Type] = row.Count
+		}
+	}
+
+	ranks, err := h.q.GetMessageRanks(ctx, pgstore.GetMessageRanksParams{
+		RoomID:     messages[0].RoomID,
+		MessageIds: ids,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range ranks {
+		if i, ok := index[row.ID]; ok {
+			data[i].Rank = row.Rank
+		}
+	}
+
+	return data, nil
+}
+
+// messageRank returns the position of the message in the room ordered by
+// reactions, or 0 for replies and messages the audience cannot see.
+func (h apiHandler) messageRank(ctx context.Context, message pgstore.Message) int64 {
+	ranks, err := h.q.GetMessageRanks(ctx, pgstore.GetMessageRanksParams{
+		RoomID:     message.RoomID,
+		MessageIds: []uuid.UUID{message.ID},
+	})
+
+	if err != nil {
+		slog.Error("Failed to get message rank", "error", err)
+
+		return 0
+	}
+
+	if len(ranks) == 0 {
+		return 0
+	}
+
+	return ranks[0].Rank
+}
+
+// notifyReactionIncreased and notifyReactionDecreased send a reaction_changed
+// event. They look the new rank up before broadcasting, so they run in their
+// own goroutine.
+func (h apiHandler) notifyReactionIncreased(rawRoomId string, message pgstore.Message, reactionType string, counts pgstore.ReactToMessageRow) {
+	go func() {
+		h.notifyClients(MessageKindReactionChanged, rawRoomId, MessageReactionChanged{
+			ID:        message.ID.String(),
+			Count:     counts.ReactionCount,
+			Type:      reactionType,
+			TypeCount: counts.Count,
+			Delta:     1,
+			Rank:      h.messageRank(context.Background(), message),
+		})
+	}()
+}
+
+func (h apiHandler) notifyReactionDecreased(rawRoomId string, message pgstore.Message, removed pgstore.RemoveReactionFromMessageRow) {
+	go func() {
+		h.notifyClients(MessageKindReactionChanged, rawRoomId, MessageReactionChanged{
+			ID:        message.ID.String(),
+			Count:     removed.ReactionCount,
+			Type:      removed.Type,
+			TypeCount: removed.Count,
+			Delta:     -1,
+			Rank:      h.messageRank(context.Background(), message),
+		})
+	}()
+}
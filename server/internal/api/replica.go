@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"server/internal/store"
+)
+
+// readFromReplica lets the store serve GET requests from its read replica,
+// if it has one. They only read, and a client polling a room can do with
+// its listings lagging a moment behind the writes of others. Not behind its
+// own though: once a client writes, its reads go to the primary for
+// ReplicaPinPeriod.
+func (a apiHandler) readFromReplica(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Clients are told apart the way idempotency keys tell them apart.
+		caller := idempotencyCaller(r)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+
+			// The period starts once the write is done, since the replica
+			// only lags behind it from then on.
+			a.replicaPins.pin(caller, time.Now().Add(a.cfg.ReplicaPinPeriod))
+
+			return
+		}
+
+		if !a.replicaPins.pinned(caller, time.Now()) {
+			r = r.WithContext(store.PreferReplica(r.Context()))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// replicaPins keeps the callers whose reads stay on the primary, and until
+// when.
+type replicaPins struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+
+	// sweepAt is the number of pins past which the expired ones are
+	// removed.
+	sweepAt int
+}
+
+const minReplicaPinSweep = 1024
+
+func newReplicaPins() *replicaPins {
+	return &replicaPins{until: make(map[string]time.Time), sweepAt: minReplicaPinSweep}
+}
+
+func (p *replicaPins) pin(caller string, until time.Time) {
+	p.mu.Lock()
+
+	defer p.mu.Unlock()
+
+	p.until[caller] = until
+
+	if len(p.until) < p.sweepAt {
+		return
+	}
+
+	now := time.Now()
+
+	for caller, until := range p.until {
+		if !now.Before(until) {
+			delete(p.until, caller)
+		}
+	}
+
+	p.sweepAt = max(2*len(p.until), minReplicaPinSweep)
+}
+
+func (p *replicaPins) pinned(caller string, now time.Time) bool {
+	p.mu.Lock()
+
+	defer p.mu.Unlock()
+
+	until, ok := p.until[caller]
+
+	return ok && now.Before(until)
+}
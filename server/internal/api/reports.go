@@ -0,0 +1,132 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/api/validate"
+	"server/internal/store/pgstore"
+)
+
+// maxReportReasonLength mirrors the VARCHAR(500) size of message_reports.reason.
+const maxReportReasonLength = 500
+
+func (h apiHandler) handleReportMessage(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	message, ok := h.readMessage(w, r, room)
+
+	if !ok {
+		return
+	}
+
+	participantId, ok := readParticipantID(w, r)
+
+	if !ok {
+		return
+	}
+
+	type _body struct {
+		Reason string `json:"reason"`
+	}
+	var body _body
+
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v := validate.New()
+
+	v.Text("reason", &body.Reason, true, maxReportReasonLength)
+
+	if !v.Valid() {
+		sendValidationErrors(w, r, v.Errors())
+
+		return
+	}
+
+	// Reporting the same message twice is a no-op so a participant cannot
+	// push a message up the moderation list on their own.
+	inserted, err := h.q.InsertMessageReport(r.Context(), pgstore.InsertMessageReportParams{
+		MessageID:     message.ID,
+		ParticipantID: participantId,
+		Reason:        body.Reason,
+	})
+
+	if err != nil {
+		slog.Error("Failed to report message", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	if inserted > 0 {
+		h.notifyHosts(MessageKindMessageReported, rawRoomId, MessageMessageReported{
+			ID:     message.ID.String(),
+			Reason: body.Reason,
+		})
+	}
+}
+
+func (h apiHandler) handleGetRoomReports(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeHost(w, r, room) {
+		return
+	}
+
+	reported, err := h.q.GetRoomReportedMessages(r.Context(), room.ID)
+
+	if err != nil {
+		slog.Error("Failed to get room reports", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type reportedMessage struct {
+		ID             string    `json:"id"`
+		Message        string    `json:"message"`
+		CreatedAt      time.Time `json:"created_at"`
+		ReportCount    int64     `json:"report_count"`
+		Reasons        []string  `json:"reasons"`
+		LastReportedAt time.Time `json:"last_reported_at"`
+	}
+
+	type response struct {
+		Messages []reportedMessage `json:"messages"`
+	}
+
+	data := make([]reportedMessage, len(reported))
+
+	for i, m := range reported {
+		data[i] = reportedMessage{
+			ID:             m.ID.String(),
+			Message:        m.Message,
+			CreatedAt:      m.CreatedAt,
+			ReportCount:    m.ReportCount,
+			Reasons:        m.Reasons,
+			LastReportedAt: m.LastReportedAt,
+		}
+	}
+
+	sendJSON(w, response{Messages: data})
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// roomScheduleInterval is how often scheduled rooms are opened and expired
+// rooms are closed.
+const roomScheduleInterval = 30 * time.Second
+
+const (
+	roomCodeLength = 6
+	// roomCodeAlphabet leaves out characters that are easy to confuse when
+	// read aloud or typed from a slide, such as 0/O and 1/I.
+	roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// roomCodeAttempts bounds the retries when a generated code collides
+	// with an existing room.
+	roomCodeAttempts = 5
+)
+
+const (
+	accessCodeHeader     = "X-Room-Access-Code"
+	accessCodeQueryParam = "access_code"
+
+	minAccessCodeLength = 4
+	// maxAccessCodeLength is the most bcrypt will hash; longer inputs are
+	// rejected rather than silently truncated.
+	maxAccessCodeLength = 72
+)
+
+func hashAccessCode(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// authorizeRoomAccess checks the access code of private rooms, read from the
+// X-Room-Access-Code header or the access_code query param, and writes a 403
+// when it is missing or wrong. Public rooms are always authorized, and so
+// are the commands of the room's subscribers.
+func authorizeRoomAccess(w http.ResponseWriter, r *http.Request, room pgstore.Room) bool {
+	if !room.Private || subscriberRoom(r.Context()) == room.ID {
+		return true
+	}
+
+	code := r.Header.Get(accessCodeHeader)
+
+	if code == "" {
+		code = r.URL.Query().Get(accessCodeQueryParam)
+	}
+
+	if !validAccessCode(room, code) {
+		apierr.Write(w, r, http.StatusForbidden, "Invalid access code")
+
+		return false
+	}
+
+	return true
+}
+
+func validAccessCode(room pgstore.Room, code string) bool {
+	return code != "" && room.AccessCodeHash.Valid &&
+		bcrypt.CompareHashAndPassword([]byte(room.AccessCodeHash.String), []byte(code)) == nil
+}
+
+// checkRoomLive writes a 425 Too Early with the room schedule when the room
+// has not started yet.
+func checkRoomLive(w http.ResponseWriter, r *http.Request, room pgstore.Room) bool {
+	if room.Live {
+		return true
+	}
+
+	apierr.WriteProblem(w, r, apierr.Problem{
+		Type:   apierr.TypeRoomNotLive,
+		Status: http.StatusTooEarly,
+		Detail: "Room has not started yet",
+		Extensions: map[string]any{
+			"starts_at": timePtr(room.StartsAt),
+			"ends_at":   timePtr(room.EndsAt),
+		},
+	})
+
+	return false
+}
+
+// hostTokenHeader carries the token handed out to the room creator, which
+// unlocks the host-only endpoints.
+const hostTokenHeader = "X-Host-Token"
+
+func generateHostToken() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashHostToken uses a plain SHA-256 since host tokens are random and long,
+// unlike user chosen access codes.
+func hashHostToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// authorizeHost writes a 403 unless the request carries the host token of
+// the room.
+func authorizeHost(w http.ResponseWriter, r *http.Request, room pgstore.Room) bool {
+	if !isHost(r, room) {
+		apierr.Write(w, r, http.StatusForbidden, "Only the room host can do this")
+
+		return false
+	}
+
+	return true
+}
+
+// isHost reports whether the request carries the room's host token, for
+// endpoints that serve both the host and the audience.
+func isHost(r *http.Request, room pgstore.Room) bool {
+	token := r.Header.Get(hostTokenHeader)
+
+	return token != "" && room.HostTokenHash.Valid &&
+		subtle.ConstantTimeCompare([]byte(hashHostToken(token)), []byte(room.HostTokenHash.String)) == 1
+}
+
+func generateRoomCode() (string, error) {
+	b := make([]byte, roomCodeLength)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	for i := range b {
+		b[i] = roomCodeAlphabet[int(b[i])%len(roomCodeAlphabet)]
+	}
+
+	return string(b), nil
+}
+
+func normalizeRoomCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// likePatternEscaper escapes the ILIKE wildcards so user input is matched
+// literally inside the '%' || q || '%' search pattern.
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLikePattern(s string) string {
+	return likePatternEscaper.Replace(s)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// insertRoom inserts a room with a freshly generated join code, retrying with
+// a new code when it collides with an existing one.
+func (h apiHandler) insertRoom(ctx context.Context, arg pgstore.InsertRoomParams) (roomId uuid.UUID, code string, err error) {
+	for range roomCodeAttempts {
+		arg.Code, err = generateRoomCode()
+
+		if err != nil {
+			return uuid.UUID{}, "", err
+		}
+
+		roomId, err = h.q.InsertRoom(ctx, arg)
+
+		if err == nil {
+			return roomId, arg.Code, nil
+		}
+
+		if !isUniqueViolation(err) {
+			return uuid.UUID{}, "", err
+		}
+	}
+
+	return uuid.UUID{}, "", err
+}
+
+// maxThemeLength mirrors the VARCHAR(255) size of rooms.theme.
+const maxThemeLength = 255
+
+const (
+	maxDescriptionLength = 1000
+	maxHostNameLength    = 100
+	maxTags              = 10
+	maxTagLength         = 30
+)
+
+type roomQuery struct {
+	Query  pgtype.Text
+	Sort   string
+	Cursor *pageCursor
+	Limit  int32
+	Offset int32
+}
+
+// queryRooms picks the store query matching the requested sort and
+// pagination mode. The cursor takes precedence over the offset when set.
+func (h apiHandler) queryRooms(ctx context.Context, rq roomQuery) ([]pgstore.Room, error) {
+	switch {
+	case rq.Sort == sortOldest && rq.Cursor != nil:
+		return h.q.GetRoomsAfterCursor(ctx, pgstore.GetRoomsAfterCursorParams{
+			Query:           rq.Query,
+			CursorCreatedAt: rq.Cursor.CreatedAt,
+			CursorID:        rq.Cursor.ID,
+			Limit:           rq.Limit,
+		})
+	case rq.Sort == sortOldest:
+		return h.q.GetRoomsOldest(ctx, pgstore.GetRoomsOldestParams{
+			Query:  rq.Query,
+			Limit:  rq.Limit,
+			Offset: rq.Offset,
+		})
+	case rq.Cursor != nil:
+		return h.q.GetRoomsBeforeCursor(ctx, pgstore.GetRoomsBeforeCursorParams{
+			Query:           rq.Query,
+			CursorCreatedAt: rq.Cursor.CreatedAt,
+			CursorID:        rq.Cursor.ID,
+			Limit:           rq.Limit,
+		})
+	default:
+		return h.q.GetRooms(ctx, pgstore.GetRoomsParams{
+			Query:  rq.Query,
+			Limit:  rq.Limit,
+			Offset: rq.Offset,
+		})
+	}
+}
+
+type roomResponse struct {
+	ID            string     `json:"id"`
+	Theme         string     `json:"theme"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Closed        bool       `json:"closed"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	Code          string     `json:"code"`
+	Private       bool       `json:"private"`
+	Description   string     `json:"description"`
+	HostName      string     `json:"host_name"`
+	Tags          []string   `json:"tags"`
+	StartsAt      *time.Time `json:"starts_at"`
+	EndsAt        *time.Time `json:"ends_at"`
+	Live          bool       `json:"live"`
+	Moderated     bool       `json:"moderated"`
+	ContentFilter bool       `json:"content_filter"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func toRoomResponse(room pgstore.Room) roomResponse {
+	return roomResponse{
+		ID:            room.ID.String(),
+		Theme:         room.Theme,
+		CreatedAt:     room.CreatedAt,
+		Closed:        room.Closed,
+		ExpiresAt:     timePtr(room.ExpiresAt),
+		Code:          room.Code,
+		Private:       room.Private,
+		Description:   room.Description,
+		HostName:      room.HostName,
+		Tags:          nonNilTags(room.Tags),
+		StartsAt:      timePtr(room.StartsAt),
+		EndsAt:        timePtr(room.EndsAt),
+		Live:          room.Live,
+		Moderated:     room.Moderated,
+		ContentFilter: room.ContentFilter,
+		UpdatedAt:     room.UpdatedAt,
+	}
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+
+	return tags
+}
+
+func timePtr(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.Time
+}
+
+// scheduleRooms runs the room lifecycle until ctx is done: scheduled rooms
+// whose starts_at has passed go live, and rooms whose expires_at or ends_at
+// has passed are closed.
+func (h apiHandler) scheduleRooms(ctx context.Context) {
+	ticker := time.NewTicker(roomScheduleInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.openScheduledRooms(ctx)
+			h.closeExpiredRooms(ctx)
+		}
+	}
+}
+
+func (h apiHandler) openScheduledRooms(ctx context.Context) {
+	roomIds, err := h.q.OpenScheduledRooms(ctx)
+
+	if err != nil {
+		slog.Error("Failed to open scheduled rooms", "error", err)
+
+		return
+	}
+
+	public := h.publicRooms(ctx, roomIds)
+
+	for _, roomId := range roomIds {
+		rawRoomId := roomId.String()
+
+		slog.Info("room opened", "room_id", rawRoomId)
+
+		opened := MessageRoomOpened{
+			ID: rawRoomId,
+		}
+
+		h.notifyClients(MessageKindRoomOpened, rawRoomId, opened)
+
+		if public[roomId] {
+			h.notifyClients(MessageKindRoomOpened, lobbyRoomId, opened)
+		}
+	}
+}
+
+// closeExpiredRooms closes the rooms past their expiry. Subscribers of an
+// expired room get a room_closed event and are then disconnected, so the room
+// no longer holds any memory in the hub.
+func (h apiHandler) closeExpiredRooms(ctx context.Context) {
+	roomIds, err := h.q.CloseExpiredRooms(ctx)
+
+	if err != nil {
+		slog.Error("Failed to close expired rooms", "error", err)
+
+		return
+	}
+
+	public := h.publicRooms(ctx, roomIds)
+
+	for _, roomId := range roomIds {
+		rawRoomId := roomId.String()
+
+		slog.Info("room expired", "room_id", rawRoomId)
+
+		h.closeRoomSubscribers(rawRoomId, roomClosedExpired, public[roomId])
+	}
+}
@@ -0,0 +1,319 @@
+// Package sanitize cleans user submitted text before it is stored or
+// broadcast.
+//
+// Messages support a small Markdown subset (emphasis, inline code, code
+// blocks, lists and links) that the React client renders itself. Raw HTML is
+// never part of that subset, so outside of code its angle brackets are
+// escaped and it shows as the text it was typed as, and links are limited to
+// schemes that cannot run code in the browser. Code is kept as typed, since
+// the client renders it as text anyway.
+package sanitize
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// linkDestinations matches the start of the destination of Markdown
+	// links and images, "](", and of link reference definitions, "]:",
+	// whose destination may be on the next line. The destination runs to
+	// the closing parenthesis or the end of the line, which is more than
+	// Markdown would take but always includes the scheme.
+	linkDestinations = regexp.MustCompile(`\]\(([^)\n]*)|\]:[ \t]*\n?[ \t]*([^\s]*)`)
+
+	// backslashEscapes matches the escaped punctuation Markdown unescapes
+	// in link destinations, so that javascript\: is seen as javascript:.
+	backslashEscapes = regexp.MustCompile(`\\([!-/:-@\[-` + "`" + `{-~])`)
+
+	// tableDelimiter matches the rows under the header of GFM tables, along
+	// with a few lines that are not.
+	tableDelimiter = regexp.MustCompile(`(?m)^[ \t|:-]*(\|[ \t|:-]*-|-[ \t|:-]*\|)[ \t|:-]*\r?$`)
+
+	urlScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+	allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+	angleBrackets = strings.NewReplacer("<", "&lt;", ">", "&gt;")
+)
+
+// Markdown escapes the HTML in s and neutralizes links with unsafe schemes,
+// keeping the Markdown syntax and the code intact.
+func Markdown(s string) string {
+	s = strings.TrimSpace(s)
+
+	var b strings.Builder
+
+	for _, part := range split(s) {
+		if part.code {
+			b.WriteString(part.text)
+
+			continue
+		}
+
+		b.WriteString(neutralize(part.text))
+	}
+
+	return b.String()
+}
+
+// neutralize escapes the HTML and the backticks in the text s, and
+// neutralizes its links with unsafe schemes.
+func neutralize(s string) string {
+	// Escaping instead of stripping leaves no tag behind whatever the input
+	// is nested like, and also turns autolinks into plain text.
+	s = angleBrackets.Replace(s)
+
+	s = linkDestinations.ReplaceAllStringFunc(s, func(match string) string {
+		groups := linkDestinations.FindStringSubmatchIndex(match)
+
+		start, end := groups[2], groups[3]
+
+		if start < 0 {
+			start, end = groups[4], groups[5]
+		}
+
+		if safeLink(match[start:end]) {
+			return match
+		}
+
+		return match[:start] + "#" + match[end:]
+	})
+
+	// The backticks left outside of code would let the renderer pair them
+	// otherwise than split did, and see code where HTML was kept, or HTML
+	// where it was escaped.
+	var b strings.Builder
+
+	backslashes := 0
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '`' && backslashes%2 == 0 {
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(s[i])
+
+		if s[i] == '\\' {
+			backslashes++
+		} else {
+			backslashes = 0
+		}
+	}
+
+	return b.String()
+}
+
+// part is a piece of a message, code or not.
+type part struct {
+	text string
+	code bool
+}
+
+// split splits s into code and the text around it.
+//
+// Only the code the renderer cannot see otherwise counts: fenced code blocks
+// whose fence starts the line, which no container can hold, and code spans
+// that start and end on the same line. Other code is taken as text, which
+// shows it escaped but never lets HTML through.
+func split(s string) []part {
+	var parts []part
+
+	// The cells of table rows are split at the pipes before code spans are
+	// looked for.
+	table := tableDelimiter.MatchString(s)
+
+	lines := strings.SplitAfter(s, "\n")
+
+	text, offset := 0, 0
+
+	for i := 0; i < len(lines); {
+		fence, ok := openingFence(lines[i])
+
+		if !ok {
+			offset += len(lines[i])
+			i++
+
+			continue
+		}
+
+		parts = append(parts, spans(s[text:offset], table)...)
+
+		start := offset
+
+		offset += len(lines[i])
+		i++
+
+		// A block left open runs to the end of the message.
+		for i < len(lines) {
+			line := lines[i]
+
+			offset += len(line)
+			i++
+
+			if closesFence(line, fence) {
+				break
+			}
+		}
+
+		parts = append(parts, part{text: s[start:offset], code: true})
+
+		text = offset
+	}
+
+	return append(parts, spans(s[text:], table)...)
+}
+
+// openingFence returns the fence line opens a code block with, if it does.
+func openingFence(line string) (string, bool) {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return "", false
+	}
+
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+
+	if n < 3 {
+		return "", false
+	}
+
+	// The info string of a backtick fence cannot hold backticks.
+	if line[0] == '`' && strings.Contains(line[n:], "`") {
+		return "", false
+	}
+
+	return line[:n], true
+}
+
+// closesFence reports whether line closes the code block opened by fence.
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+
+	rest := strings.TrimLeft(trimmed, fence[:1])
+
+	return len(trimmed)-len(rest) >= len(fence) && strings.Trim(rest, " \t\r\n") == ""
+}
+
+// spans splits the text s into code spans and the text around them. In the
+// rows of a table, a span holding a pipe is taken as text.
+func spans(s string, table bool) []part {
+	var parts []part
+
+	start := 0
+
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+
+			continue
+		}
+
+		open, n := i, backticks(s[i:])
+
+		i += n
+
+		// An escaped backtick leaves the rest of its run to open the span.
+		if escaped(s[start:open]) {
+			open++
+			n--
+
+			if n == 0 {
+				continue
+			}
+		}
+
+		end := closingBackticks(s[i:], n)
+
+		if end < 0 {
+			continue
+		}
+
+		end += i
+
+		if table && strings.Contains(s[i:end], "|") {
+			i = end + n
+
+			continue
+		}
+
+		if open > start {
+			parts = append(parts, part{text: s[start:open]})
+		}
+
+		i = end + n
+
+		parts = append(parts, part{text: s[open:i], code: true})
+
+		start = i
+	}
+
+	if start < len(s) {
+		parts = append(parts, part{text: s[start:]})
+	}
+
+	return parts
+}
+
+// backticks returns the length of the run of backticks s starts with.
+func backticks(s string) int {
+	return len(s) - len(strings.TrimLeft(s, "`"))
+}
+
+// escaped reports whether the text s ends with an odd number of
+// backslashes, which escape what follows.
+func escaped(s string) bool {
+	return (len(s)-len(strings.TrimRight(s, `\`)))%2 == 1
+}
+
+// closingBackticks returns the index in s of the first run of n backticks
+// before the end of the line, or -1 if there is none.
+func closingBackticks(s string, n int) int {
+	for i := 0; i < len(s) && s[i] != '\n'; {
+		if s[i] != '`' {
+			i++
+
+			continue
+		}
+
+		m := backticks(s[i:])
+
+		if m == n {
+			return i
+		}
+
+		i += m
+	}
+
+	return -1
+}
+
+// safeLink reports whether the link destination dest is relative or uses
+// one of allowedSchemes, once undone what the Markdown renderer and the
+// browser would undo: backslash escapes, character references, and the
+// whitespace and control characters browsers skip.
+func safeLink(dest string) bool {
+	dest = backslashEscapes.ReplaceAllString(dest, "$1")
+	dest = html.UnescapeString(dest)
+
+	dest = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == '<' || r == '>' {
+			return -1
+		}
+
+		return r
+	}, dest)
+
+	scheme, _, found := strings.Cut(dest, ":")
+
+	// A colon after a path, query or fragment doesn't start a scheme.
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+
+	return urlScheme.MatchString(scheme) && allowedSchemes[strings.ToLower(scheme)]
+}
@@ -0,0 +1,53 @@
+package sanitize
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "  How does **this** work?  ", "How does **this** work?"},
+		{"markdown kept", "- `a < b`\n- [docs](https://example.com/a_(b))", "- `a < b`\n- [docs](https://example.com/a_(b))"},
+		{"html after code span", "`<b>` <b>", "`<b>` &lt;b&gt;"},
+		{"longer code span", "``a ` <b>`` <b>", "``a ` <b>`` &lt;b&gt;"},
+		{"unclosed code span", "`<b>", "\\`&lt;b&gt;"},
+		{"escaped backtick", "\\`<b>`", "\\`&lt;b&gt;\\`"},
+		{"code span after unclosed one", "a ` b\nc ` <b> `", "a \\` b\nc ` <b> `"},
+		{"link in code span", "`[x](javascript:alert(1))`", "`[x](javascript:alert(1))`"},
+		{"code block", "```html\n<script>alert(1)</script>\n```\n<b>", "```html\n<script>alert(1)</script>\n```\n&lt;b&gt;"},
+		{"unclosed code block", "~~~\n<b>", "~~~\n<b>"},
+		{"indented fence", "- ```\n  <b>\n  ```", "- \\`\\`\\`\n  &lt;b&gt;\n  \\`\\`\\`"},
+		{"pipe in code span", "`a || b`", "`a || b`"},
+		{"pipe in table", "a | b\n--|--\n`<b> | x` `<i>`", "a | b\n--|--\n\\`&lt;b&gt; | x\\` `<i>`"},
+		{"script", "<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"nested tag", "<<a>img src=x onerror=alert(1)>", "&lt;&lt;a&gt;img src=x onerror=alert(1)&gt;"},
+		{"unclosed tag", "<img src=x onerror=alert(1)", "&lt;img src=x onerror=alert(1)"},
+		{"comment", "<!-- <script> -->", "&lt;!-- &lt;script&gt; --&gt;"},
+		{"autolink", "<javascript:alert(1)>", "&lt;javascript:alert(1)&gt;"},
+		{"relative link", "[room](/rooms/1#top)", "[room](/rooms/1#top)"},
+		{"mailto link", "[mail](mailto:host@example.com)", "[mail](mailto:host@example.com)"},
+		{"javascript link", "[x](javascript:alert(1))", "[x](#))"},
+		{"uppercase scheme", "[x](JavaScript:alert(1))", "[x](#))"},
+		{"image", "![x](data:text/html;base64,PHNjcmlwdD4=)", "![x](#)"},
+		{"padded scheme", "[x](  javascript:alert(1))", "[x](#))"},
+		{"decimal reference", "[x](&#106;avascript:alert(1))", "[x](#))"},
+		{"hex reference", "[x](&#x6A;avascript&#x3A;alert(1))", "[x](#))"},
+		{"named reference", "[x](javascript&colon;alert(1))", "[x](#))"},
+		{"backslash escape", "[x](javascript\\:alert(1))", "[x](#))"},
+		{"tab in scheme", "[x](java\tscript:alert(1))", "[x](#))"},
+		{"bracketed destination", "[x](<javascript:alert(1)>)", "[x](#)&gt;)"},
+		{"reference definition", "[x]\n\n[x]: javascript:alert(1)", "[x]\n\n[x]: #"},
+		{"reference definition on next line", "[x]\n\n[x]:\n  vbscript:msgbox", "[x]\n\n[x]:\n  #"},
+		{"safe reference definition", "[x]\n\n[x]: https://example.com \"Title\"", "[x]\n\n[x]: https://example.com \"Title\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Markdown(tt.in); got != tt.want {
+				t.Errorf("Markdown(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
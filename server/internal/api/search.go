@@ -0,0 +1,90 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"server/internal/api/apierr"
+	"server/internal/store/pgstore"
+)
+
+// maxSearchQueryLength keeps search terms to a sensible size; longer input
+// is almost certainly a pasted message rather than a query.
+const maxSearchQueryLength = 200
+
+func (h apiHandler) handleSearchRoomMessages(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if query == "" {
+		apierr.Write(w, r, http.StatusBadRequest, "Missing search query")
+
+		return
+	}
+
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		apierr.Write(w, r, http.StatusBadRequest, "Search query is too long")
+
+		return
+	}
+
+	limit, _, err := readPagination(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	viewerId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	// The query goes through websearch_to_tsquery, which accepts free text
+	// with quotes and minus signs and never fails on malformed input.
+	messages, err := h.q.SearchRoomMessages(r.Context(), pgstore.SearchRoomMessagesParams{
+		RoomID:   room.ID,
+		ViewerID: viewerId,
+		Query:    query,
+		Limit:    limit,
+	})
+
+	if err != nil {
+		slog.Error("Failed to search room messages", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	data, err := h.toMessageResponses(r.Context(), messages)
+
+	if err != nil {
+		slog.Error("Failed to get message reactions", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Messages []messageResponse `json:"messages"`
+	}
+
+	sendJSON(w, response{Messages: data})
+}
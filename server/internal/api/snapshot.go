@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+
+	"server/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+// snapshotMessageLimit is how many of the newest messages a subscriber gets
+// in its snapshot, the same as the first page of the listing.
+const snapshotMessageLimit = defaultPageLimit
+
+// roomSnapshot builds the snapshot sent to new subscribers, so they can
+// render the room without a separate REST fetch. Messages are newest first,
+// as they are listed with sort=newest, and hidden ones are filtered for
+// viewerId the same way.
+//
+// The room is read again rather than taken from the subscribe request, which
+// read it before the client was subscribed: an update published in between
+// would be in neither the snapshot nor the events that follow it.
+func (h apiHandler) roomSnapshot(roomId uuid.UUID, viewerId uuid.NullUUID) ws.Snapshot {
+	return func(ctx context.Context) (ws.Message, error) {
+		room, err := h.q.GetRoom(ctx, roomId)
+
+		if err != nil {
+			return ws.Message{}, err
+		}
+
+		messages, err := h.queryRoomMessages(ctx, messageQuery{
+			RoomID:   room.ID,
+			ViewerID: viewerId,
+			Sort:     sortNewest,
+			Limit:    snapshotMessageLimit,
+		})
+
+		if err != nil {
+			return ws.Message{}, err
+		}
+
+		data, err := h.toMessageResponses(ctx, messages)
+
+		if err != nil {
+			return ws.Message{}, err
+		}
+
+		return ws.NewMessage(MessageKindSnapshot, room.ID.String(), MessageSnapshot{
+			Room:     toRoomResponse(room),
+			Messages: data,
+		})
+	}
+}
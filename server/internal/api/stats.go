@@ -0,0 +1,79 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"server/internal/api/apierr"
+)
+
+func (h apiHandler) handleGetRoomStats(w http.ResponseWriter, r *http.Request) {
+	room, rawRoomId, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	stats, err := h.q.GetRoomStats(r.Context(), room.ID)
+
+	if err != nil {
+		slog.Error("Failed to get room stats", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	perMinute, err := h.q.GetRoomMessagesPerMinute(r.Context(), room.ID)
+
+	if err != nil {
+		slog.Error("Failed to get room messages per minute", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	currentSubscribers, peakSubscribers := h.hub.Stats(rawRoomId)
+
+	type minuteBucket struct {
+		Minute       time.Time `json:"minute"`
+		MessageCount int64     `json:"message_count"`
+	}
+
+	type response struct {
+		MessageCount  int64   `json:"message_count"`
+		AnsweredCount int64   `json:"answered_count"`
+		AnsweredRatio float64 `json:"answered_ratio"`
+		ReactionCount int64   `json:"reaction_count"`
+		// Subscriber counts live in memory, so they start over when the
+		// server restarts.
+		CurrentSubscribers int            `json:"current_subscribers"`
+		PeakSubscribers    int            `json:"peak_subscribers"`
+		MessagesPerMinute  []minuteBucket `json:"messages_per_minute"`
+	}
+
+	res := response{
+		MessageCount:       stats.MessageCount,
+		AnsweredCount:      stats.AnsweredCount,
+		ReactionCount:      stats.ReactionCount,
+		CurrentSubscribers: currentSubscribers,
+		PeakSubscribers:    peakSubscribers,
+		MessagesPerMinute:  make([]minuteBucket, len(perMinute)),
+	}
+
+	if stats.MessageCount > 0 {
+		res.AnsweredRatio = float64(stats.AnsweredCount) / float64(stats.MessageCount)
+	}
+
+	for i, bucket := range perMinute {
+		res.MessagesPerMinute[i] = minuteBucket{Minute: bucket.Minute, MessageCount: bucket.MessageCount}
+	}
+
+	sendJSON(w, res)
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/api/apierr"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// subscribeTokenQueryParam and subscribeTokenProtocol are the two ways
+	// to hand a subscribe token to /subscribe/{room_id}. Browsers cannot set
+	// headers on a websocket, but they can offer subprotocols, so a client
+	// that would rather keep the token out of the URL offers
+	// subscribeTokenProtocol followed by the token.
+	subscribeTokenQueryParam = "token"
+	subscribeTokenProtocol   = "wsrs.token"
+)
+
+var errInvalidSubscribeToken = errors.New("Invalid subscribe token")
+
+// subscribeClaims is what a subscribe token vouches for: the room it opens,
+// and who the connection belongs to.
+type subscribeClaims struct {
+	RoomID        uuid.UUID     `json:"room_id"`
+	ParticipantID uuid.NullUUID `json:"participant_id"`
+	Host          bool          `json:"host"`
+	ExpiresAt     int64         `json:"exp"`
+}
+
+// subscribeTokenKey returns the key subscribe tokens are signed with. When
+// none is configured a random one is used, so tokens only work against the
+// instance that issued them.
+func subscribeTokenKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+
+	key := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	slog.Info("No subscribe token secret configured, using a random one")
+
+	return key
+}
+
+// signSubscribeToken encodes the claims and their HMAC-SHA256 as two
+// base64url parts separated by a dot.
+func (h apiHandler) signSubscribeToken(claims subscribeClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, h.tokenKey)
+
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifySubscribeToken returns the claims of token when it is signed by this
+// server, has not expired and was issued for roomId.
+func (h apiHandler) verifySubscribeToken(token string, roomId uuid.UUID) (subscribeClaims, error) {
+	rawPayload, rawSignature, ok := strings.Cut(token, ".")
+
+	if !ok {
+		return subscribeClaims{}, errInvalidSubscribeToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(rawPayload)
+
+	if err != nil {
+		return subscribeClaims{}, errInvalidSubscribeToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(rawSignature)
+
+	if err != nil {
+		return subscribeClaims{}, errInvalidSubscribeToken
+	}
+
+	mac := hmac.New(sha256.New, h.tokenKey)
+
+	mac.Write(payload)
+
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return subscribeClaims{}, errInvalidSubscribeToken
+	}
+
+	var claims subscribeClaims
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return subscribeClaims{}, errInvalidSubscribeToken
+	}
+
+	if claims.RoomID != roomId || time.Now().Unix() >= claims.ExpiresAt {
+		return subscribeClaims{}, errInvalidSubscribeToken
+	}
+
+	return claims, nil
+}
+
+// readSubscribeToken returns the token passed in the query or offered as the
+// subprotocol following subscribeTokenProtocol, or "" when there is none.
+func readSubscribeToken(r *http.Request) string {
+	if token := r.URL.Query().Get(subscribeTokenQueryParam); token != "" {
+		return token
+	}
+
+	protocols := websocket.Subprotocols(r)
+
+	for i, protocol := range protocols {
+		if protocol == subscribeTokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	return ""
+}
+
+// handleCreateSubscribeToken trades the credentials of the room, checked the
+// same way as for any other endpoint, for a short lived token to subscribe
+// with. The token carries the participant id and whether they host the room,
+// so neither the access code nor the host token end up in a websocket URL.
+func (h apiHandler) handleCreateSubscribeToken(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.readRoom(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !authorizeRoomAccess(w, r, room) {
+		return
+	}
+
+	participantId, err := readOptionalParticipantID(r)
+
+	if err != nil {
+		apierr.Write(w, r, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	if !h.checkParticipantNotBanned(w, r, room, participantId) {
+		return
+	}
+
+	expiresAt := time.Now().Add(h.cfg.SubscribeTokenTTL)
+
+	token, err := h.signSubscribeToken(subscribeClaims{
+		RoomID:        room.ID,
+		ParticipantID: participantId,
+		Host:          isHost(r, room),
+		ExpiresAt:     expiresAt.Unix(),
+	})
+
+	if err != nil {
+		slog.Error("Failed to sign subscribe token", "error", err)
+
+		apierr.Write(w, r, http.StatusInternalServerError, "Something went wrong")
+
+		return
+	}
+
+	type response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	sendJSON(w, response{Token: token, ExpiresAt: expiresAt.UTC().Truncate(time.Second)})
+}
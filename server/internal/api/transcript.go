@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"server/internal/store/pgstore"
+)
+
+const exportFormatMarkdown = "markdown"
+
+// writeMarkdownTranscript renders the public part of a room as Markdown that
+// hosts can paste into release notes or a blog post. Questions are grouped by
+// whether they were answered and sorted by reactions, most reacted first,
+// with their replies nested under them.
+func writeMarkdownTranscript(w io.Writer, room pgstore.Room, messages []messageResponse, now time.Time) error {
+	var answered, unanswered []messageResponse
+
+	replies := make(map[string][]messageResponse)
+
+	for _, m := range messages {
+		// Transcripts are meant to be published, so anything the audience
+		// could not see in the room stays out of them too.
+		if !m.Approved || m.Hidden {
+			continue
+		}
+
+		switch {
+		case m.ParentID != nil:
+			replies[*m.ParentID] = append(replies[*m.ParentID], m)
+		case m.Answered:
+			answered = append(answered, m)
+		default:
+			unanswered = append(unanswered, m)
+		}
+	}
+
+	byReactions := func(list []messageResponse) {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].ReactionCount > list[j].ReactionCount
+		})
+	}
+
+	byReactions(answered)
+	byReactions(unanswered)
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", room.Theme)
+
+	if room.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", room.Description)
+	}
+
+	if room.HostName != "" {
+		fmt.Fprintf(&b, "Hosted by %s. ", room.HostName)
+	}
+
+	fmt.Fprintf(&b, "%d questions, exported on %s.\n", len(answered)+len(unanswered), now.Format("January 2, 2006"))
+
+	writeTranscriptSection(&b, "Answered", answered, replies)
+	writeTranscriptSection(&b, "Unanswered", unanswered, replies)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func writeTranscriptSection(b *strings.Builder, title string, questions []messageResponse, replies map[string][]messageResponse) {
+	fmt.Fprintf(b, "\n## %s (%d)\n", title, len(questions))
+
+	if len(questions) == 0 {
+		b.WriteString("\n_None._\n")
+
+		return
+	}
+
+	for i, q := range questions {
+		fmt.Fprintf(b, "\n### %d. %s\n\n", i+1, reactionLabel(q.ReactionCount))
+		fmt.Fprintf(b, "%s\n", q.Message)
+
+		if q.Answer != nil {
+			fmt.Fprintf(b, "\n%s\n", quoteMarkdown("**Answer:** "+*q.Answer))
+		}
+
+		for _, reply := range replies[q.ID] {
+			fmt.Fprintf(b, "\n- %s\n", indentMarkdown(reply.Message, "  "))
+		}
+	}
+}
+
+func reactionLabel(count int64) string {
+	if count == 1 {
+		return "1 reaction"
+	}
+
+	return fmt.Sprintf("%d reactions", count)
+}
+
+// quoteMarkdown turns s into a blockquote, quoting every line so multi-line
+// answers stay inside it.
+func quoteMarkdown(s string) string {
+	return "> " + strings.ReplaceAll(s, "\n", "\n> ")
+}
+
+func indentMarkdown(s string, indent string) string {
+	return strings.ReplaceAll(s, "\n", "\n"+indent)
+}
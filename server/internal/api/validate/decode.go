@@ -0,0 +1,50 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// bodyField names the whole request body in Errors, for decoding failures
+// that can't be pinned on a single field.
+const bodyField = "body"
+
+// DecodeErrors turns an error from decoding a JSON body into field errors,
+// naming the offending field when the decoder reports one.
+func DecodeErrors(err error) Errors {
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return Errors{bodyField: "is required"}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return Errors{typeErr.Field: "must be " + kindName(typeErr.Type)}
+	default:
+		return Errors{bodyField: "must be valid JSON"}
+	}
+}
+
+func kindName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Pointer:
+		return kindName(t.Elem())
+	default:
+		return fmt.Sprintf("of type %s", t)
+	}
+}
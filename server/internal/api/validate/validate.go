@@ -0,0 +1,77 @@
+// Package validate collects field level errors while checking request bodies,
+// so handlers can report every invalid field at once instead of failing on
+// the first one.
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors maps a field name, as it appears in the JSON body, to the reason it
+// was rejected.
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+
+	for field := range e {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	for i, field := range fields {
+		fields[i] = field + ": " + e[field]
+	}
+
+	return strings.Join(fields, "; ")
+}
+
+type Validator struct {
+	errors Errors
+}
+
+func New() *Validator {
+	return &Validator{errors: Errors{}}
+}
+
+// Check records reason for field when ok is false. Only the first failure of
+// a field is kept.
+func (v *Validator) Check(ok bool, field, reason string) {
+	if ok {
+		return
+	}
+
+	if _, exists := v.errors[field]; !exists {
+		v.errors[field] = reason
+	}
+}
+
+// Text trims the surrounding whitespace of *value in place and checks that
+// it is valid UTF-8 without NUL bytes, which Postgres refuses to store, and
+// at most maxLength characters long. Required values must not be empty once
+// trimmed.
+func (v *Validator) Text(field string, value *string, required bool, maxLength int) {
+	*value = strings.TrimSpace(*value)
+
+	v.Check(utf8.ValidString(*value), field, "must be valid UTF-8")
+	v.Check(!strings.ContainsRune(*value, 0), field, "must not contain NUL characters")
+	v.Check(!required || *value != "", field, "is required")
+	v.Check(utf8.RuneCountInString(*value) <= maxLength, field, fmt.Sprintf("must be at most %d characters", maxLength))
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.errors) == 0
+}
+
+// Errors returns the collected errors, or nil when everything is valid.
+func (v *Validator) Errors() Errors {
+	if v.Valid() {
+		return nil
+	}
+
+	return v.errors
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/api/apierr"
+)
+
+// apiVersionHeader lets clients of the unversioned /api alias pick the
+// version they were written against. Responses echo the version served.
+const apiVersionHeader = "API-Version"
+
+const (
+	apiVersion1 = 1
+
+	latestAPIVersion = apiVersion1
+)
+
+// supportedAPIVersions lists every version with a /api/vN mount. A version
+// is only added when a breaking response change ships; handlers branch on
+// apiVersion(r) to keep serving the older shape.
+var supportedAPIVersions = []int{apiVersion1}
+
+type apiVersionKey struct{}
+
+// apiVersion returns the version negotiated for r, defaulting to the oldest
+// one for requests that never went through withAPIVersion.
+func apiVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+
+	return apiVersion1
+}
+
+// withAPIVersion pins the requests of a /api/vN mount to version.
+func withAPIVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(apiVersionHeader, strconv.Itoa(version))
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+		})
+	}
+}
+
+// legacyAPIAlias serves the old unversioned /api paths for one more release.
+// The version comes from the API-Version header, defaulting to v1 which
+// matches what these paths always returned, and responses point clients to
+// the versioned path.
+func legacyAPIAlias(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := apiVersion1
+
+		if raw := r.Header.Get(apiVersionHeader); raw != "" {
+			v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(raw), "v"))
+
+			if err != nil || !isSupportedAPIVersion(v) {
+				apierr.Write(w, r, http.StatusBadRequest, "Unsupported API version")
+
+				return
+			}
+
+			version = v
+		}
+
+		successor := "/api/v" + strconv.Itoa(version) + strings.TrimPrefix(r.URL.Path, "/api")
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+
+		withAPIVersion(version)(next).ServeHTTP(w, r)
+	})
+}
+
+func isSupportedAPIVersion(version int) bool {
+	for _, v := range supportedAPIVersions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
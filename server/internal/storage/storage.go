@@ -0,0 +1,88 @@
+// Package storage saves uploaded files and hands back the URL they are served
+// from.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store persists uploaded files. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	// Save writes the content of r under name and returns its public URL.
+	Save(ctx context.Context, name string, r io.Reader) (url string, err error)
+
+	// Delete removes the file Save returned url for. A file that is already
+	// gone, or that the store never saved, is not an error.
+	Delete(ctx context.Context, url string) error
+}
+
+// Disk stores files in a local directory, served by the API under BaseURL.
+type Disk struct {
+	Dir     string
+	BaseURL string
+}
+
+func NewDisk(dir, baseURL string) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Disk{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (d *Disk) Save(ctx context.Context, name string, r io.Reader) (string, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", errors.New("storage: invalid file name")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(d.Dir, name)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+
+		return "", err
+	}
+
+	return d.BaseURL + "/" + name, nil
+}
+
+func (d *Disk) Delete(ctx context.Context, url string) error {
+	name, ok := strings.CutPrefix(url, d.BaseURL+"/")
+
+	if !ok || name != filepath.Base(name) || name == "." || name == ".." {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(filepath.Join(d.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
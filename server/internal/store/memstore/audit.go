@@ -0,0 +1,57 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) InsertAuditLogEntry(ctx context.Context, arg pgstore.InsertAuditLogEntryParams) error {
+	s.lock()
+
+	defer s.unlock()
+
+	if _, ok := s.rooms[arg.RoomID]; !ok {
+		return foreignKeyViolation("audit_log_room_id_fkey")
+	}
+
+	entry := pgstore.AuditLog{
+		ID:            uuid.New(),
+		RoomID:        arg.RoomID,
+		Actor:         arg.Actor,
+		ParticipantID: arg.ParticipantID,
+		Ip:            arg.Ip,
+		Action:        arg.Action,
+		TargetID:      arg.TargetID,
+		CreatedAt:     now(),
+	}
+
+	saveRow(s, s.audit, entry.ID, nil)
+
+	s.audit[entry.ID] = entry
+
+	return nil
+}
+
+func (s *Store) GetRoomAuditLog(ctx context.Context, arg pgstore.GetRoomAuditLogParams) ([]pgstore.AuditLog, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	var entries []pgstore.AuditLog
+
+	for _, entry := range s.audit {
+		if entry.RoomID == arg.RoomID {
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b pgstore.AuditLog) int {
+		return compareCreated(b.CreatedAt, b.ID, a.CreatedAt, a.ID)
+	})
+
+	return page(entries, arg.Limit, arg.Offset), nil
+}
@@ -0,0 +1,116 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"server/internal/store/pgstore"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Store) ReserveIdempotencyKey(ctx context.Context, arg pgstore.ReserveIdempotencyKeyParams) (int64, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	key := idempotencyKey{caller: arg.Caller, key: arg.Key, method: arg.Method, path: arg.Path}
+
+	if _, ok := s.idempotency[key]; ok {
+		return 0, nil
+	}
+
+	saveRow(s, s.idempotency, key, nil)
+
+	s.idempotency[key] = &pgstore.IdempotencyKey{
+		Key:         arg.Key,
+		Method:      arg.Method,
+		Path:        arg.Path,
+		CreatedAt:   now(),
+		Caller:      arg.Caller,
+		RequestHash: arg.RequestHash,
+	}
+
+	return 1, nil
+}
+
+func (s *Store) GetIdempotencyKey(ctx context.Context, arg pgstore.GetIdempotencyKeyParams) (pgstore.IdempotencyKey, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	key, ok := s.idempotency[idempotencyKey{caller: arg.Caller, key: arg.Key, method: arg.Method, path: arg.Path}]
+
+	if !ok {
+		return pgstore.IdempotencyKey{}, pgx.ErrNoRows
+	}
+
+	row := *key
+
+	row.Body = slices.Clone(key.Body)
+
+	return row, nil
+}
+
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, arg pgstore.CompleteIdempotencyKeyParams) error {
+	s.lock()
+
+	defer s.unlock()
+
+	id := idempotencyKey{caller: arg.Caller, key: arg.Key, method: arg.Method, path: arg.Path}
+
+	key, ok := s.idempotency[id]
+
+	if !ok {
+		return nil
+	}
+
+	// Body is replaced rather than changed in place, so the copy can share
+	// it.
+	saveRow(s, s.idempotency, id, func(key *pgstore.IdempotencyKey) *pgstore.IdempotencyKey {
+		row := *key
+
+		return &row
+	})
+
+	key.StatusCode = arg.StatusCode
+	key.ContentType = arg.ContentType
+	key.Body = slices.Clone(arg.Body)
+
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyKey(ctx context.Context, arg pgstore.DeleteIdempotencyKeyParams) error {
+	s.lock()
+
+	defer s.unlock()
+
+	key := idempotencyKey{caller: arg.Caller, key: arg.Key, method: arg.Method, path: arg.Path}
+
+	saveRow(s, s.idempotency, key, nil)
+
+	delete(s.idempotency, key)
+
+	return nil
+}
+
+func (s *Store) DeleteExpiredIdempotencyKeys(ctx context.Context, createdAt time.Time) (int64, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	var deleted int64
+
+	for key, row := range s.idempotency {
+		if row.CreatedAt.Before(createdAt) {
+			saveRow(s, s.idempotency, key, nil)
+
+			delete(s.idempotency, key)
+
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,309 @@
+// Package memstore keeps the store in memory, for running the server without
+// Postgres in demos, frontend development and tests. Nothing survives a
+// restart.
+//
+// Queries behave like their SQL in pgstore, constraints and triggers
+// included, down to the errors: missing rows are pgx.ErrNoRows and violated
+// constraints are *pgconn.PgError with the Postgres codes.
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"server/internal/store"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type participantKey struct {
+	messageID     uuid.UUID
+	participantID uuid.UUID
+}
+
+type idempotencyKey struct {
+	caller string
+	key    string
+	method string
+	path   string
+}
+
+// Store is an in-memory store.Store. The zero value is not usable, use New.
+type Store struct {
+	mu *sync.RWMutex
+
+	*tables
+
+	// inTx is set on the Store a transaction runs its queries on, whose
+	// WithTx already holds mu, and undo on it logs how to undo the
+	// transaction.
+	inTx bool
+	undo *undoLog
+}
+
+// tables holds the rows of the store.
+type tables struct {
+	rooms    map[uuid.UUID]*pgstore.Room
+	messages map[uuid.UUID]*pgstore.Message
+
+	// reactions holds the reactions to each message by participant, so
+	// those of a message are counted without going through the others.
+	reactions map[uuid.UUID]map[uuid.UUID]pgstore.MessageReaction
+
+	reports     map[participantKey]pgstore.MessageReport
+	bans        map[uuid.UUID]pgstore.RoomBan
+	audit       map[uuid.UUID]pgstore.AuditLog
+	idempotency map[idempotencyKey]*pgstore.IdempotencyKey
+
+	// changeSeq is the last value taken from room_change_seq. Like nextval,
+	// a transaction that fails doesn't give back the values it took.
+	changeSeq int64
+}
+
+var _ store.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		mu: &sync.RWMutex{},
+		tables: &tables{
+			rooms:       make(map[uuid.UUID]*pgstore.Room),
+			messages:    make(map[uuid.UUID]*pgstore.Message),
+			reactions:   make(map[uuid.UUID]map[uuid.UUID]pgstore.MessageReaction),
+			reports:     make(map[participantKey]pgstore.MessageReport),
+			bans:        make(map[uuid.UUID]pgstore.RoomBan),
+			audit:       make(map[uuid.UUID]pgstore.AuditLog),
+			idempotency: make(map[idempotencyKey]*pgstore.IdempotencyKey),
+		},
+	}
+}
+
+// WithTx runs fn with the store locked, and puts the rows fn changed back
+// the way they were when it fails. Transactions of the store are therefore
+// serializable. Queries on s rather than on the Store given to fn block
+// until fn returns. Nested in a transaction, WithTx undoes what fn did
+// alone, like a savepoint.
+func (s *Store) WithTx(ctx context.Context, fn func(q store.Store) error) error {
+	s.lock()
+
+	defer s.unlock()
+
+	undo := s.undo
+
+	if undo == nil {
+		undo = &undoLog{}
+	}
+
+	savepoint := len(*undo)
+
+	committed := false
+
+	defer func() {
+		if !committed {
+			undo.rollbackTo(savepoint)
+		}
+	}()
+
+	if err := fn(&Store{mu: s.mu, tables: s.tables, inTx: true, undo: undo}); err != nil {
+		return err
+	}
+
+	committed = true
+
+	return nil
+}
+
+func (s *Store) lock() {
+	if !s.inTx {
+		s.mu.Lock()
+	}
+}
+
+func (s *Store) unlock() {
+	if !s.inTx {
+		s.mu.Unlock()
+	}
+}
+
+func (s *Store) rlock() {
+	if !s.inTx {
+		s.mu.RLock()
+	}
+}
+
+func (s *Store) runlock() {
+	if !s.inTx {
+		s.mu.RUnlock()
+	}
+}
+
+// undoLog holds, in order, the functions that put back the rows a
+// transaction changed.
+type undoLog []func()
+
+// rollbackTo undoes the changes logged after the first n, latest first.
+func (l *undoLog) rollbackTo(n int) {
+	for i := len(*l) - 1; i >= n; i-- {
+		(*l)[i]()
+	}
+
+	*l = (*l)[:n]
+}
+
+// saveRow logs how to put the row of key in rows back the way it is now, or
+// to remove it if there is none, for a transaction to undo the changes it is
+// about to get. copyRow copies the rows that are changed in place, and is
+// nil for the others. Outside of transactions, it does nothing.
+func saveRow[K comparable, V any](s *Store, rows map[K]V, key K, copyRow func(V) V) {
+	if s.undo == nil {
+		return
+	}
+
+	row, ok := rows[key]
+
+	if !ok {
+		*s.undo = append(*s.undo, func() { delete(rows, key) })
+
+		return
+	}
+
+	if copyRow != nil {
+		row = copyRow(row)
+	}
+
+	*s.undo = append(*s.undo, func() { rows[key] = row })
+}
+
+// saveRoom saves the room for the transaction before it is changed.
+func (s *Store) saveRoom(id uuid.UUID) {
+	saveRow(s, s.rooms, id, func(room *pgstore.Room) *pgstore.Room {
+		row := roomRow(room)
+
+		return &row
+	})
+}
+
+// saveMessage saves the message for the transaction before it is changed.
+func (s *Store) saveMessage(id uuid.UUID) {
+	saveRow(s, s.messages, id, func(message *pgstore.Message) *pgstore.Message {
+		row := *message
+
+		return &row
+	})
+}
+
+// now is the current time at the precision of a timestamptz.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// nextChangeSeq takes the next value of room_change_seq.
+func (s *Store) nextChangeSeq() int64 {
+	s.changeSeq++
+
+	return s.changeSeq
+}
+
+// touchRoom does what the triggers do to a room when it is updated.
+func (s *Store) touchRoom(room *pgstore.Room) {
+	room.UpdatedAt = now()
+	room.ChangeSeq = s.nextChangeSeq()
+}
+
+// touchMessage does what the triggers do when a message is updated.
+func (s *Store) touchMessage(message *pgstore.Message) {
+	s.touchMessageRow(message)
+
+	s.touchMessageRoom(message.RoomID)
+}
+
+// touchMessageRow does what the triggers do to a message whose reaction
+// count alone changed, which leaves its room be.
+func (s *Store) touchMessageRow(message *pgstore.Message) {
+	message.UpdatedAt = now()
+	message.ChangeSeq = s.nextChangeSeq()
+}
+
+// touchMessageRoom does what the triggers do to the room of a message that
+// was inserted, updated or deleted.
+func (s *Store) touchMessageRoom(roomID uuid.UUID) {
+	if room, ok := s.rooms[roomID]; ok {
+		s.saveRoom(roomID)
+
+		room.ChangeSeq = s.nextChangeSeq()
+	}
+}
+
+func uniqueViolation(constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23505",
+		Message:        "duplicate key value violates unique constraint \"" + constraint + "\"",
+		ConstraintName: constraint,
+	}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23503",
+		Message:        "insert or update violates foreign key constraint \"" + constraint + "\"",
+		ConstraintName: constraint,
+	}
+}
+
+func checkViolation(constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23514",
+		Message:        "new row violates check constraint \"" + constraint + "\"",
+		ConstraintName: constraint,
+	}
+}
+
+func compareUUID(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// compareCreated orders by creation time, then id, both ascending.
+func compareCreated(aCreatedAt time.Time, aID uuid.UUID, bCreatedAt time.Time, bID uuid.UUID) int {
+	if c := aCreatedAt.Compare(bCreatedAt); c != 0 {
+		return c
+	}
+
+	return compareUUID(aID, bID)
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// page applies LIMIT and OFFSET to sorted rows. Like sqlc, it returns nil
+// rather than an empty slice.
+func page[T any](rows []T, limit, offset int32) []T {
+	if int(offset) >= len(rows) {
+		return nil
+	}
+
+	rows = rows[offset:]
+
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return rows
+}
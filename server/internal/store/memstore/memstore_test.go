@@ -0,0 +1,275 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+
+	"server/internal/store"
+	"server/internal/store/pgstore"
+	"server/internal/store/storetest"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return New()
+	})
+}
+
+// snapshot copies the rows of the tables, down to those changed in place.
+func snapshot(t *tables) *tables {
+	c := &tables{
+		rooms:       make(map[uuid.UUID]*pgstore.Room, len(t.rooms)),
+		messages:    make(map[uuid.UUID]*pgstore.Message, len(t.messages)),
+		reactions:   make(map[uuid.UUID]map[uuid.UUID]pgstore.MessageReaction, len(t.reactions)),
+		reports:     maps.Clone(t.reports),
+		bans:        maps.Clone(t.bans),
+		audit:       maps.Clone(t.audit),
+		idempotency: make(map[idempotencyKey]*pgstore.IdempotencyKey, len(t.idempotency)),
+	}
+
+	for id, room := range t.rooms {
+		row := roomRow(room)
+
+		c.rooms[id] = &row
+	}
+
+	for id, message := range t.messages {
+		row := *message
+
+		c.messages[id] = &row
+	}
+
+	for id, reactions := range t.reactions {
+		// A reaction removed leaves the map of its message, empty or
+		// not, which makes no difference to the queries.
+		if len(reactions) > 0 {
+			c.reactions[id] = maps.Clone(reactions)
+		}
+	}
+
+	for key, idempotency := range t.idempotency {
+		row := *idempotency
+
+		c.idempotency[key] = &row
+	}
+
+	return c
+}
+
+func TestWithTxRollback(t *testing.T) {
+	ctx := context.Background()
+
+	s := New()
+
+	room, err := s.InsertRoom(ctx, pgstore.InsertRoomParams{Theme: "Room", Code: "AAAAAA"})
+
+	if err != nil {
+		t.Fatalf("InsertRoom: %v", err)
+	}
+
+	var messages []uuid.UUID
+
+	for range 3 {
+		id, err := s.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: room, Message: "Message", Approved: true})
+
+		if err != nil {
+			t.Fatalf("InsertMessage: %v", err)
+		}
+
+		messages = append(messages, id)
+	}
+
+	participant := uuid.New()
+
+	for _, id := range messages {
+		if _, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: id, ParticipantID: participant, Type: "like"}); err != nil {
+			t.Fatalf("ReactToMessage: %v", err)
+		}
+	}
+
+	if _, err := s.InsertMessageReport(ctx, pgstore.InsertMessageReportParams{MessageID: messages[0], ParticipantID: participant, Reason: "spam"}); err != nil {
+		t.Fatalf("InsertMessageReport: %v", err)
+	}
+
+	ban, err := s.InsertRoomBan(ctx, pgstore.InsertRoomBanParams{RoomID: room, ParticipantID: uuid.NullUUID{UUID: participant, Valid: true}})
+
+	if err != nil {
+		t.Fatalf("InsertRoomBan: %v", err)
+	}
+
+	if _, err := s.ReserveIdempotencyKey(ctx, pgstore.ReserveIdempotencyKeyParams{Caller: "c", Key: "k", Method: "POST", Path: "/"}); err != nil {
+		t.Fatalf("ReserveIdempotencyKey: %v", err)
+	}
+
+	before := snapshot(s.tables)
+
+	errRollback := errors.New("rollback")
+
+	err = s.WithTx(ctx, func(q store.Store) error {
+		// Every table is written to, in place and not.
+		steps := []func() error{
+			func() error {
+				_, err := q.InsertRoom(ctx, pgstore.InsertRoomParams{Theme: "Other", Code: "BBBBBB"})
+
+				return err
+			},
+			func() error {
+				_, err := q.UpdateRoomTheme(ctx, pgstore.UpdateRoomThemeParams{ID: room, Theme: "Renamed"})
+
+				return err
+			},
+			func() error {
+				_, err := q.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: room, Message: "New", Approved: true})
+
+				return err
+			},
+			func() error {
+				_, err := q.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: messages[0], ParticipantID: uuid.New(), Type: "heart"})
+
+				return err
+			},
+			func() error {
+				_, err := q.RemoveReactionFromMessage(ctx, pgstore.RemoveReactionFromMessageParams{ID: messages[1], ParticipantID: participant})
+
+				return err
+			},
+			func() error {
+				_, err := q.MergeMessages(ctx, pgstore.MergeMessagesParams{TargetID: messages[0], DuplicateID: messages[2]})
+
+				return err
+			},
+			func() error {
+				_, err := q.MarkMessagesAsAnswered(ctx, pgstore.MarkMessagesAsAnsweredParams{RoomID: room, Ids: messages})
+
+				return err
+			},
+			func() error {
+				_, err := q.DeleteRoomBan(ctx, pgstore.DeleteRoomBanParams{ID: ban.ID, RoomID: room})
+
+				return err
+			},
+			func() error {
+				return q.InsertAuditLogEntry(ctx, pgstore.InsertAuditLogEntryParams{RoomID: room, Actor: "host", Action: "ban"})
+			},
+			func() error {
+				return q.CompleteIdempotencyKey(ctx, pgstore.CompleteIdempotencyKeyParams{
+					StatusCode: pgtype.Int4{Int32: 200, Valid: true},
+					Body:       []byte("{}"),
+					Caller:     "c",
+					Key:        "k",
+					Method:     "POST",
+					Path:       "/",
+				})
+			},
+			func() error {
+				return q.DeleteRoom(ctx, room)
+			},
+			func() error {
+				_, err := q.PurgeDeletedRooms(ctx, time.Now().Add(time.Minute))
+
+				return err
+			},
+		}
+
+		for _, step := range steps {
+			if err := step(); err != nil {
+				t.Fatalf("step of the transaction: %v", err)
+			}
+		}
+
+		if len(s.rooms) != 1 {
+			t.Fatalf("%d rooms left in the transaction, want the other one", len(s.rooms))
+		}
+
+		return errRollback
+	})
+
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx = %v, want the error of fn", err)
+	}
+
+	if after := snapshot(s.tables); !reflect.DeepEqual(after, before) {
+		t.Fatal("the tables changed after a rolled back transaction")
+	}
+}
+
+func TestNestedWithTxRollback(t *testing.T) {
+	ctx := context.Background()
+
+	s := New()
+
+	room, err := s.InsertRoom(ctx, pgstore.InsertRoomParams{Theme: "Room", Code: "AAAAAA"})
+
+	if err != nil {
+		t.Fatalf("InsertRoom: %v", err)
+	}
+
+	errRollback := errors.New("rollback")
+
+	err = s.WithTx(ctx, func(q store.Store) error {
+		if _, err := q.UpdateRoomTheme(ctx, pgstore.UpdateRoomThemeParams{ID: room, Theme: "Kept"}); err != nil {
+			return err
+		}
+
+		err := q.WithTx(ctx, func(q store.Store) error {
+			if _, err := q.UpdateRoomTheme(ctx, pgstore.UpdateRoomThemeParams{ID: room, Theme: "Rolled back"}); err != nil {
+				return err
+			}
+
+			return errRollback
+		})
+
+		if !errors.Is(err, errRollback) {
+			t.Errorf("nested WithTx = %v, want the error of fn", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if got, _ := s.GetRoom(ctx, room); got.Theme != "Kept" {
+		t.Fatalf("theme = %q, want the one set outside the rolled back savepoint", got.Theme)
+	}
+}
+
+func BenchmarkWithTx(b *testing.B) {
+	ctx := context.Background()
+
+	s := New()
+
+	room, err := s.InsertRoom(ctx, pgstore.InsertRoomParams{Theme: "Room", Code: "AAAAAA"})
+
+	if err != nil {
+		b.Fatalf("InsertRoom: %v", err)
+	}
+
+	for range 10000 {
+		if _, err := s.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: room, Message: "Message", Approved: true}); err != nil {
+			b.Fatalf("InsertMessage: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+
+	for range b.N {
+		err := s.WithTx(ctx, func(q store.Store) error {
+			_, err := q.UpdateRoomTheme(ctx, pgstore.UpdateRoomThemeParams{ID: room, Theme: "Room"})
+
+			return err
+		})
+
+		if err != nil {
+			b.Fatalf("WithTx: %v", err)
+		}
+	}
+}
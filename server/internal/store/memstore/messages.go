@@ -0,0 +1,647 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"server/internal/store/pgstore"
+	"server/internal/store/textsearch"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// visibleTo tells whether the message is shown to viewer: deleted and pending
+// messages never are, hidden ones only to their author.
+func visibleTo(message *pgstore.Message, viewer uuid.NullUUID) bool {
+	if message.DeletedAt.Valid || !message.Approved {
+		return false
+	}
+
+	return !message.Hidden || (viewer.Valid && message.ParticipantID.Valid && message.ParticipantID.UUID == viewer.UUID)
+}
+
+// listedIn is the filter shared by the message listings of a room, which
+// leave replies to their thread.
+func listedIn(message *pgstore.Message, roomID uuid.UUID, viewer uuid.NullUUID, answered pgtype.Bool) bool {
+	if message.RoomID != roomID || message.ParentMessageID.Valid || !visibleTo(message, viewer) {
+		return false
+	}
+
+	return !answered.Valid || message.Answered == answered.Bool
+}
+
+// countedIn is the filter of the room stats, which only count what everyone
+// sees.
+func countedIn(message *pgstore.Message, roomID uuid.UUID) bool {
+	return message.RoomID == roomID && !message.DeletedAt.Valid && message.Approved && !message.Hidden
+}
+
+// compareOldest is ORDER BY pinned DESC, created_at ASC, id ASC.
+func compareOldest(a, b pgstore.Message) int {
+	if c := compareBool(b.Pinned, a.Pinned); c != 0 {
+		return c
+	}
+
+	return compareCreated(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+}
+
+// compareNewest is ORDER BY pinned DESC, created_at DESC, id DESC.
+func compareNewest(a, b pgstore.Message) int {
+	if c := compareBool(b.Pinned, a.Pinned); c != 0 {
+		return c
+	}
+
+	return compareCreated(b.CreatedAt, b.ID, a.CreatedAt, a.ID)
+}
+
+// compareTop is ORDER BY reaction_count DESC, created_at ASC, id ASC.
+func compareTop(a, b pgstore.Message) int {
+	if c := cmp.Compare(b.ReactionCount, a.ReactionCount); c != 0 {
+		return c
+	}
+
+	return compareCreated(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+}
+
+// selectMessages returns the messages kept by keep, sorted by compare.
+func (s *Store) selectMessages(keep func(*pgstore.Message) bool, compare func(a, b pgstore.Message) int) []pgstore.Message {
+	var messages []pgstore.Message
+
+	for _, message := range s.messages {
+		if keep(message) {
+			messages = append(messages, *message)
+		}
+	}
+
+	slices.SortFunc(messages, compare)
+
+	return messages
+}
+
+// liveMessage returns the message unless it is missing or deleted, which
+// the updates on messages treat alike.
+func (s *Store) liveMessage(id uuid.UUID) (*pgstore.Message, bool) {
+	message, ok := s.messages[id]
+
+	if !ok || message.DeletedAt.Valid {
+		return nil, false
+	}
+
+	return message, true
+}
+
+// updateMessage applies update to a message that isn't deleted, and returns
+// the updated row.
+func (s *Store) updateMessage(id uuid.UUID, update func(*pgstore.Message)) (pgstore.Message, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	message, ok := s.liveMessage(id)
+
+	if !ok {
+		return pgstore.Message{}, pgx.ErrNoRows
+	}
+
+	s.saveMessage(id)
+
+	update(message)
+
+	s.touchMessage(message)
+
+	return *message, nil
+}
+
+// deleteMessageRows deletes the message and the rows that cascade from it,
+// replies included.
+func (s *Store) deleteMessageRows(id uuid.UUID) {
+	message, ok := s.messages[id]
+
+	if !ok {
+		return
+	}
+
+	s.saveMessage(id)
+
+	delete(s.messages, id)
+
+	s.touchMessageRoom(message.RoomID)
+
+	saveRow(s, s.reactions, id, nil)
+
+	delete(s.reactions, id)
+
+	for key := range s.reports {
+		if key.messageID == id {
+			saveRow(s, s.reports, key, nil)
+
+			delete(s.reports, key)
+		}
+	}
+
+	for replyID, reply := range s.messages {
+		if reply.ParentMessageID.Valid && reply.ParentMessageID.UUID == id {
+			s.deleteMessageRows(replyID)
+		}
+	}
+
+	for _, message := range s.messages {
+		if message.MergedIntoID.Valid && message.MergedIntoID.UUID == id {
+			s.saveMessage(message.ID)
+
+			message.MergedIntoID = uuid.NullUUID{}
+		}
+	}
+}
+
+// PurgeDeletedMessages deletes the messages, and their replies with them.
+func (s *Store) PurgeDeletedMessages(ctx context.Context, deletedAt time.Time) (int64, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	var purged int64
+
+	for id, message := range s.messages {
+		if message.DeletedAt.Valid && message.DeletedAt.Time.Before(deletedAt) {
+			s.deleteMessageRows(id)
+
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (s *Store) GetMessage(ctx context.Context, id uuid.UUID) (pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	message, ok := s.liveMessage(id)
+
+	if !ok {
+		return pgstore.Message{}, pgx.ErrNoRows
+	}
+
+	return *message, nil
+}
+
+func (s *Store) GetRoomMessagesVersion(ctx context.Context, roomID uuid.UUID) (pgstore.GetRoomMessagesVersionRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	var version pgstore.GetRoomMessagesVersionRow
+
+	for _, message := range s.messages {
+		if message.RoomID == roomID {
+			version.MaxChangeSeq = max(version.MaxChangeSeq, message.ChangeSeq)
+			version.RowCount++
+		}
+	}
+
+	return version, nil
+}
+
+func (s *Store) GetRoomMessages(ctx context.Context, arg pgstore.GetRoomMessagesParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	messages := s.selectMessages(func(message *pgstore.Message) bool {
+		return listedIn(message, arg.RoomID, arg.ViewerID, arg.Answered)
+	}, compareOldest)
+
+	return page(messages, arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) GetRoomMessagesAfterCursor(ctx context.Context, arg pgstore.GetRoomMessagesAfterCursorParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	cursor := pgstore.Message{Pinned: arg.CursorPinned, CreatedAt: arg.CursorCreatedAt, ID: arg.CursorID}
+
+	messages := s.selectMessages(func(message *pgstore.Message) bool {
+		return listedIn(message, arg.RoomID, arg.ViewerID, arg.Answered) && compareOldest(*message, cursor) > 0
+	}, compareOldest)
+
+	return page(messages, arg.Limit, 0), nil
+}
+
+func (s *Store) GetRoomMessagesNewest(ctx context.Context, arg pgstore.GetRoomMessagesNewestParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	messages := s.selectMessages(func(message *pgstore.Message) bool {
+		return listedIn(message, arg.RoomID, arg.ViewerID, arg.Answered)
+	}, compareNewest)
+
+	return page(messages, arg.Limit, arg.Offset), nil
+}
+
+// GetRoomMessagesBeforeCursor compares (pinned, created_at, id) with the
+// cursor as the SQL does, so unlike after the cursor, pinned messages come
+// before the cursor of an unpinned one.
+func (s *Store) GetRoomMessagesBeforeCursor(ctx context.Context, arg pgstore.GetRoomMessagesBeforeCursorParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	messages := s.selectMessages(func(message *pgstore.Message) bool {
+		if !listedIn(message, arg.RoomID, arg.ViewerID, arg.Answered) {
+			return false
+		}
+
+		if c := compareBool(message.Pinned, arg.CursorPinned); c != 0 {
+			return c < 0
+		}
+
+		return compareCreated(message.CreatedAt, message.ID, arg.CursorCreatedAt, arg.CursorID) < 0
+	}, compareNewest)
+
+	return page(messages, arg.Limit, 0), nil
+}
+
+func (s *Store) GetRoomMessagesMostReacted(ctx context.Context, arg pgstore.GetRoomMessagesMostReactedParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	messages := s.selectMessages(func(message *pgstore.Message) bool {
+		return listedIn(message, arg.RoomID, arg.ViewerID, arg.Answered)
+	}, func(a, b pgstore.Message) int {
+		if c := compareBool(b.Pinned, a.Pinned); c != 0 {
+			return c
+		}
+
+		return compareTop(a, b)
+	})
+
+	return page(messages, arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) GetTopRoomMessages(ctx context.Context, arg pgstore.GetTopRoomMessagesParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	messages := s.selectMessages(func(message *pgstore.Message) bool {
+		return !message.Answered && listedIn(message, arg.RoomID, arg.ViewerID, pgtype.Bool{})
+	}, compareTop)
+
+	return page(messages, arg.Limit, 0), nil
+}
+
+func (s *Store) GetRoomMessagesForExport(ctx context.Context, arg pgstore.GetRoomMessagesForExportParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	messages := s.selectMessages(func(message *pgstore.Message) bool {
+		if message.RoomID != arg.RoomID || message.DeletedAt.Valid {
+			return false
+		}
+
+		return compareCreated(message.CreatedAt, message.ID, arg.CursorCreatedAt, arg.CursorID) > 0
+	}, func(a, b pgstore.Message) int {
+		return compareCreated(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+
+	return page(messages, arg.Limit, 0), nil
+}
+
+func (s *Store) GetMessageReplies(ctx context.Context, arg pgstore.GetMessageRepliesParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	if !arg.ParentMessageID.Valid {
+		return nil, nil
+	}
+
+	return s.selectMessages(func(message *pgstore.Message) bool {
+		return message.ParentMessageID == arg.ParentMessageID && visibleTo(message, arg.ViewerID)
+	}, func(a, b pgstore.Message) int {
+		return compareCreated(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	}), nil
+}
+
+func (s *Store) GetRoomPendingMessages(ctx context.Context, roomID uuid.UUID) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	return s.selectMessages(func(message *pgstore.Message) bool {
+		return message.RoomID == roomID && !message.Approved && !message.DeletedAt.Valid
+	}, func(a, b pgstore.Message) int {
+		return compareCreated(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	}), nil
+}
+
+func (s *Store) InsertMessage(ctx context.Context, arg pgstore.InsertMessageParams) (uuid.UUID, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	if _, ok := s.rooms[arg.RoomID]; !ok {
+		return uuid.UUID{}, foreignKeyViolation("messages_room_id_fkey")
+	}
+
+	if arg.ParentMessageID.Valid {
+		if _, ok := s.messages[arg.ParentMessageID.UUID]; !ok {
+			return uuid.UUID{}, foreignKeyViolation("messages_parent_message_id_fkey")
+		}
+	}
+
+	createdAt := now()
+
+	message := &pgstore.Message{
+		ID:              uuid.New(),
+		RoomID:          arg.RoomID,
+		Message:         arg.Message,
+		CreatedAt:       createdAt,
+		ParentMessageID: arg.ParentMessageID,
+		Approved:        arg.Approved,
+		ParticipantID:   arg.ParticipantID,
+		UpdatedAt:       createdAt,
+		ChangeSeq:       s.nextChangeSeq(),
+	}
+
+	saveRow(s, s.messages, message.ID, nil)
+
+	s.messages[message.ID] = message
+
+	s.touchMessageRoom(message.RoomID)
+
+	return message.ID, nil
+}
+
+func (s *Store) UpdateMessage(ctx context.Context, arg pgstore.UpdateMessageParams) (pgstore.Message, error) {
+	return s.updateMessage(arg.ID, func(message *pgstore.Message) {
+		message.Message = arg.Message
+		message.EditedAt = pgtype.Timestamptz{Time: now(), Valid: true}
+	})
+}
+
+func (s *Store) SoftDeleteMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := s.updateMessage(id, func(message *pgstore.Message) {
+		message.DeletedAt = pgtype.Timestamptz{Time: now(), Valid: true}
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Store) SetMessagePinned(ctx context.Context, arg pgstore.SetMessagePinnedParams) (pgstore.Message, error) {
+	return s.updateMessage(arg.ID, func(message *pgstore.Message) {
+		message.Pinned = arg.Pinned
+	})
+}
+
+func (s *Store) ApproveMessage(ctx context.Context, id uuid.UUID) (pgstore.Message, error) {
+	return s.updateMessage(id, func(message *pgstore.Message) {
+		message.Approved = true
+	})
+}
+
+func (s *Store) SetMessageHidden(ctx context.Context, arg pgstore.SetMessageHiddenParams) (pgstore.Message, error) {
+	return s.updateMessage(arg.ID, func(message *pgstore.Message) {
+		message.Hidden = arg.Hidden
+	})
+}
+
+func (s *Store) SetMessageAttachment(ctx context.Context, arg pgstore.SetMessageAttachmentParams) (pgstore.Message, error) {
+	return s.updateMessage(arg.ID, func(message *pgstore.Message) {
+		message.AttachmentUrl = arg.AttachmentUrl
+	})
+}
+
+func (s *Store) MarkMessageAsAnswered(ctx context.Context, arg pgstore.MarkMessageAsAnsweredParams) (pgstore.Message, error) {
+	return s.updateMessage(arg.ID, func(message *pgstore.Message) {
+		message.Answered = true
+
+		if arg.Answer.Valid {
+			message.Answer = arg.Answer
+		}
+	})
+}
+
+func (s *Store) MarkMessagesAsAnswered(ctx context.Context, arg pgstore.MarkMessagesAsAnsweredParams) ([]pgstore.Message, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	var answered []pgstore.Message
+
+	for _, message := range s.messages {
+		if message.RoomID != arg.RoomID || message.DeletedAt.Valid || message.Answered || !slices.Contains(arg.Ids, message.ID) {
+			continue
+		}
+
+		s.saveMessage(message.ID)
+
+		message.Answered = true
+
+		s.touchMessage(message)
+
+		answered = append(answered, *message)
+	}
+
+	return answered, nil
+}
+
+// MergeMessages moves the reactions of the duplicate to the target, but for
+// those of participants that reacted to both, and deletes the duplicate.
+func (s *Store) MergeMessages(ctx context.Context, arg pgstore.MergeMessagesParams) (int64, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	duplicate, ok := s.liveMessage(arg.DuplicateID)
+
+	if !ok {
+		return 0, nil
+	}
+
+	var moved []pgstore.MessageReaction
+
+	for _, reaction := range s.reactions[arg.DuplicateID] {
+		moved = append(moved, reaction)
+	}
+
+	if _, ok := s.messages[arg.TargetID]; !ok && len(moved) > 0 {
+		return 0, foreignKeyViolation("message_reactions_message_id_fkey")
+	}
+
+	for _, reaction := range moved {
+		s.deleteReaction(arg.DuplicateID, reaction.ParticipantID)
+
+		if _, ok := s.reactions[arg.TargetID][reaction.ParticipantID]; ok {
+			continue
+		}
+
+		reaction.MessageID = arg.TargetID
+
+		s.insertReaction(reaction)
+	}
+
+	s.saveMessage(duplicate.ID)
+
+	duplicate.DeletedAt = pgtype.Timestamptz{Time: now(), Valid: true}
+	duplicate.MergedIntoID = uuid.NullUUID{UUID: arg.TargetID, Valid: true}
+
+	s.touchMessage(duplicate)
+
+	return 1, nil
+}
+
+func (s *Store) FindSimilarMessages(ctx context.Context, arg pgstore.FindSimilarMessagesParams) ([]pgstore.FindSimilarMessagesRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	needle := textsearch.Trigrams(arg.Message)
+
+	var rows []pgstore.FindSimilarMessagesRow
+
+	for _, message := range s.messages {
+		if !countedIn(message, arg.RoomID) || message.ParentMessageID.Valid || message.ID == arg.ExcludeID {
+			continue
+		}
+
+		similarity := textsearch.TrigramSimilarity(needle, textsearch.Trigrams(message.Message))
+
+		if similarity < textsearch.SimilarityThreshold {
+			continue
+		}
+
+		rows = append(rows, pgstore.FindSimilarMessagesRow{ID: message.ID, Message: message.Message, Similarity: similarity})
+	}
+
+	slices.SortFunc(rows, func(a, b pgstore.FindSimilarMessagesRow) int {
+		return cmp.Compare(b.Similarity, a.Similarity)
+	})
+
+	return page(rows, 5, 0), nil
+}
+
+func (s *Store) SearchRoomMessages(ctx context.Context, arg pgstore.SearchRoomMessagesParams) ([]pgstore.Message, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	query := textsearch.ParseWebSearch(arg.Query)
+
+	type ranked struct {
+		message pgstore.Message
+		rank    int
+	}
+
+	var matches []ranked
+
+	for _, message := range s.messages {
+		if message.RoomID != arg.RoomID || message.ParentMessageID.Valid || !visibleTo(message, arg.ViewerID) {
+			continue
+		}
+
+		if rank, ok := query.Match(message.Message); ok {
+			matches = append(matches, ranked{message: *message, rank: rank})
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b ranked) int {
+		if c := cmp.Compare(b.rank, a.rank); c != 0 {
+			return c
+		}
+
+		return compareCreated(a.message.CreatedAt, a.message.ID, b.message.CreatedAt, b.message.ID)
+	})
+
+	var messages []pgstore.Message
+
+	for _, match := range page(matches, arg.Limit, 0) {
+		messages = append(messages, match.message)
+	}
+
+	return messages, nil
+}
+
+func (s *Store) GetRoomStats(ctx context.Context, roomID uuid.UUID) (pgstore.GetRoomStatsRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	var stats pgstore.GetRoomStatsRow
+
+	for _, message := range s.messages {
+		if !countedIn(message, roomID) || message.ParentMessageID.Valid {
+			continue
+		}
+
+		stats.MessageCount++
+		stats.ReactionCount += message.ReactionCount
+
+		if message.Answered {
+			stats.AnsweredCount++
+		}
+	}
+
+	return stats, nil
+}
+
+func (s *Store) GetRoomMessagesPerMinute(ctx context.Context, roomID uuid.UUID) ([]pgstore.GetRoomMessagesPerMinuteRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	counts := make(map[time.Time]int64)
+
+	for _, message := range s.messages {
+		if countedIn(message, roomID) {
+			counts[message.CreatedAt.Truncate(time.Minute)]++
+		}
+	}
+
+	var rows []pgstore.GetRoomMessagesPerMinuteRow
+
+	for minute, count := range counts {
+		rows = append(rows, pgstore.GetRoomMessagesPerMinuteRow{Minute: minute, MessageCount: count})
+	}
+
+	slices.SortFunc(rows, func(a, b pgstore.GetRoomMessagesPerMinuteRow) int {
+		return a.Minute.Compare(b.Minute)
+	})
+
+	return rows, nil
+}
+
+func (s *Store) GetMessageRanks(ctx context.Context, arg pgstore.GetMessageRanksParams) ([]pgstore.GetMessageRanksRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	ranked := s.selectMessages(func(message *pgstore.Message) bool {
+		return countedIn(message, arg.RoomID) && !message.ParentMessageID.Valid
+	}, compareTop)
+
+	var rows []pgstore.GetMessageRanksRow
+
+	for i, message := range ranked {
+		if slices.Contains(arg.MessageIds, message.ID) {
+			rows = append(rows, pgstore.GetMessageRanksRow{ID: message.ID, Rank: int64(i + 1)})
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,176 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) InsertMessageReport(ctx context.Context, arg pgstore.InsertMessageReportParams) (int64, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	if _, ok := s.messages[arg.MessageID]; !ok {
+		return 0, foreignKeyViolation("message_reports_message_id_fkey")
+	}
+
+	key := participantKey{messageID: arg.MessageID, participantID: arg.ParticipantID}
+
+	if _, ok := s.reports[key]; ok {
+		return 0, nil
+	}
+
+	saveRow(s, s.reports, key, nil)
+
+	s.reports[key] = pgstore.MessageReport{
+		ID:            uuid.New(),
+		MessageID:     arg.MessageID,
+		ParticipantID: arg.ParticipantID,
+		Reason:        arg.Reason,
+		CreatedAt:     now(),
+	}
+
+	return 1, nil
+}
+
+func (s *Store) GetRoomReportedMessages(ctx context.Context, roomID uuid.UUID) ([]pgstore.GetRoomReportedMessagesRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	reports := make(map[uuid.UUID][]pgstore.MessageReport)
+
+	for key, report := range s.reports {
+		if message, ok := s.liveMessage(key.messageID); ok && message.RoomID == roomID {
+			reports[key.messageID] = append(reports[key.messageID], report)
+		}
+	}
+
+	var rows []pgstore.GetRoomReportedMessagesRow
+
+	for messageID, messageReports := range reports {
+		slices.SortFunc(messageReports, func(a, b pgstore.MessageReport) int {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+
+		message := s.messages[messageID]
+
+		row := pgstore.GetRoomReportedMessagesRow{
+			ID:          message.ID,
+			Message:     message.Message,
+			CreatedAt:   message.CreatedAt,
+			ReportCount: int64(len(messageReports)),
+		}
+
+		for _, report := range messageReports {
+			row.Reasons = append(row.Reasons, report.Reason)
+			row.LastReportedAt = report.CreatedAt
+		}
+
+		rows = append(rows, row)
+	}
+
+	slices.SortFunc(rows, func(a, b pgstore.GetRoomReportedMessagesRow) int {
+		if c := cmp.Compare(b.ReportCount, a.ReportCount); c != 0 {
+			return c
+		}
+
+		return b.LastReportedAt.Compare(a.LastReportedAt)
+	})
+
+	return rows, nil
+}
+
+func (s *Store) InsertRoomBan(ctx context.Context, arg pgstore.InsertRoomBanParams) (pgstore.RoomBan, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	if !arg.ParticipantID.Valid && !arg.Ip.Valid {
+		return pgstore.RoomBan{}, checkViolation("room_bans_check")
+	}
+
+	if _, ok := s.rooms[arg.RoomID]; !ok {
+		return pgstore.RoomBan{}, foreignKeyViolation("room_bans_room_id_fkey")
+	}
+
+	ban := pgstore.RoomBan{
+		ID:            uuid.New(),
+		RoomID:        arg.RoomID,
+		ParticipantID: arg.ParticipantID,
+		Ip:            arg.Ip,
+		Reason:        arg.Reason,
+		CreatedAt:     now(),
+	}
+
+	saveRow(s, s.bans, ban.ID, nil)
+
+	s.bans[ban.ID] = ban
+
+	return ban, nil
+}
+
+func (s *Store) GetRoomBans(ctx context.Context, roomID uuid.UUID) ([]pgstore.RoomBan, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	var bans []pgstore.RoomBan
+
+	for _, ban := range s.bans {
+		if ban.RoomID == roomID {
+			bans = append(bans, ban)
+		}
+	}
+
+	slices.SortFunc(bans, func(a, b pgstore.RoomBan) int {
+		return compareCreated(b.CreatedAt, b.ID, a.CreatedAt, a.ID)
+	})
+
+	return bans, nil
+}
+
+func (s *Store) DeleteRoomBan(ctx context.Context, arg pgstore.DeleteRoomBanParams) (int64, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	ban, ok := s.bans[arg.ID]
+
+	if !ok || ban.RoomID != arg.RoomID {
+		return 0, nil
+	}
+
+	saveRow(s, s.bans, arg.ID, nil)
+
+	delete(s.bans, arg.ID)
+
+	return 1, nil
+}
+
+func (s *Store) IsBannedFromRoom(ctx context.Context, arg pgstore.IsBannedFromRoomParams) (bool, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	for _, ban := range s.bans {
+		if ban.RoomID != arg.RoomID {
+			continue
+		}
+
+		if arg.ParticipantID.Valid && ban.ParticipantID == arg.ParticipantID {
+			return true, nil
+		}
+
+		if arg.Ip.Valid && ban.Ip == arg.Ip {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,177 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// insertReaction adds the reaction and, like the trigger, counts it in the
+// reaction_count of its message.
+func (s *Store) insertReaction(reaction pgstore.MessageReaction) {
+	reactions, ok := s.reactions[reaction.MessageID]
+
+	if !ok {
+		saveRow(s, s.reactions, reaction.MessageID, nil)
+
+		reactions = make(map[uuid.UUID]pgstore.MessageReaction)
+
+		s.reactions[reaction.MessageID] = reactions
+	}
+
+	saveRow(s, reactions, reaction.ParticipantID, nil)
+
+	reactions[reaction.ParticipantID] = reaction
+
+	if message, ok := s.messages[reaction.MessageID]; ok {
+		s.saveMessage(message.ID)
+
+		message.ReactionCount++
+
+		s.touchMessageRow(message)
+	}
+}
+
+// deleteReaction removes the reaction of the participant to the message
+// and, like the trigger, uncounts it from the reaction_count of the message.
+func (s *Store) deleteReaction(messageID, participantID uuid.UUID) {
+	reactions := s.reactions[messageID]
+
+	saveRow(s, reactions, participantID, nil)
+
+	delete(reactions, participantID)
+
+	if message, ok := s.messages[messageID]; ok {
+		s.saveMessage(messageID)
+
+		message.ReactionCount--
+
+		s.touchMessageRow(message)
+	}
+}
+
+// countReactions counts the reactions to the message, in all and of type.
+func (s *Store) countReactions(messageID uuid.UUID, typ string) (total, ofType int64) {
+	for _, reaction := range s.reactions[messageID] {
+		total++
+
+		if reaction.Type == typ {
+			ofType++
+		}
+	}
+
+	return total, ofType
+}
+
+// ReactToMessage returns pgx.ErrNoRows when the message is gone or the
+// participant already reacted to it, with whatever type.
+func (s *Store) ReactToMessage(ctx context.Context, arg pgstore.ReactToMessageParams) (pgstore.ReactToMessageRow, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	if _, ok := s.liveMessage(arg.ID); !ok {
+		return pgstore.ReactToMessageRow{}, pgx.ErrNoRows
+	}
+
+	if _, ok := s.reactions[arg.ID][arg.ParticipantID]; ok {
+		return pgstore.ReactToMessageRow{}, pgx.ErrNoRows
+	}
+
+	s.insertReaction(pgstore.MessageReaction{
+		MessageID:     arg.ID,
+		ParticipantID: arg.ParticipantID,
+		Type:          arg.Type,
+		CreatedAt:     now(),
+	})
+
+	total, ofType := s.countReactions(arg.ID, arg.Type)
+
+	return pgstore.ReactToMessageRow{ReactionCount: total, Count: ofType}, nil
+}
+
+// RemoveReactionFromMessage returns pgx.ErrNoRows when the message is gone
+// or the participant has no reaction to it.
+func (s *Store) RemoveReactionFromMessage(ctx context.Context, arg pgstore.RemoveReactionFromMessageParams) (pgstore.RemoveReactionFromMessageRow, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	if _, ok := s.liveMessage(arg.ID); !ok {
+		return pgstore.RemoveReactionFromMessageRow{}, pgx.ErrNoRows
+	}
+
+	reaction, ok := s.reactions[arg.ID][arg.ParticipantID]
+
+	if !ok {
+		return pgstore.RemoveReactionFromMessageRow{}, pgx.ErrNoRows
+	}
+
+	s.deleteReaction(arg.ID, arg.ParticipantID)
+
+	total, ofType := s.countReactions(arg.ID, reaction.Type)
+
+	return pgstore.RemoveReactionFromMessageRow{
+		ReactionCount: total,
+		Type:          reaction.Type,
+		Count:         ofType,
+	}, nil
+}
+
+// LockMessage does nothing: reactions are counted with the store locked.
+func (s *Store) LockMessage(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (s *Store) GetMessagesReactions(ctx context.Context, messageIds []uuid.UUID) ([]pgstore.GetMessagesReactionsRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	type typeKey struct {
+		messageID uuid.UUID
+		typ       string
+	}
+
+	counts := make(map[typeKey]int64)
+
+	// Like = ANY, ids given twice count once.
+	seen := make(map[uuid.UUID]struct{})
+
+	for _, messageID := range messageIds {
+		if _, ok := seen[messageID]; ok {
+			continue
+		}
+
+		seen[messageID] = struct{}{}
+
+		for _, reaction := range s.reactions[messageID] {
+			counts[typeKey{messageID: messageID, typ: reaction.Type}]++
+		}
+	}
+
+	var rows []pgstore.GetMessagesReactionsRow
+
+	for key, count := range counts {
+		rows = append(rows, pgstore.GetMessagesReactionsRow{MessageID: key.messageID, Type: key.typ, Count: count})
+	}
+
+	slices.SortFunc(rows, func(a, b pgstore.GetMessagesReactionsRow) int {
+		if c := compareUUID(a.MessageID, b.MessageID); c != 0 {
+			return c
+		}
+
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.Type, b.Type)
+	})
+
+	return rows, nil
+}
@@ -0,0 +1,410 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"server/internal/store/pgstore"
+	"server/internal/store/textsearch"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// roomRow copies a room out of the store.
+func roomRow(room *pgstore.Room) pgstore.Room {
+	row := *room
+
+	row.Tags = slices.Clone(room.Tags)
+
+	return row
+}
+
+// matchesRoomQuery is the theme ILIKE '%' || query || '%' filter of the room
+// listings.
+func matchesRoomQuery(room *pgstore.Room, query pgtype.Text) bool {
+	return !query.Valid || textsearch.ILike(room.Theme, "%"+query.String+"%")
+}
+
+// liveRoom returns the room unless it is missing or deleted, which every
+// query but the purge treats alike.
+func (s *Store) liveRoom(id uuid.UUID) (*pgstore.Room, bool) {
+	room, ok := s.rooms[id]
+
+	if !ok || room.DeletedAt.Valid {
+		return nil, false
+	}
+
+	return room, true
+}
+
+func timestampReached(ts pgtype.Timestamptz, t time.Time) bool {
+	return ts.Valid && !ts.Time.After(t)
+}
+
+func (s *Store) GetRoom(ctx context.Context, id uuid.UUID) (pgstore.Room, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	room, ok := s.liveRoom(id)
+
+	if !ok {
+		return pgstore.Room{}, pgx.ErrNoRows
+	}
+
+	return roomRow(room), nil
+}
+
+func (s *Store) GetRoomByCode(ctx context.Context, code string) (pgstore.Room, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	for _, room := range s.rooms {
+		if room.Code == code && !room.DeletedAt.Valid {
+			return roomRow(room), nil
+		}
+	}
+
+	return pgstore.Room{}, pgx.ErrNoRows
+}
+
+// filterRooms returns the rooms matching query and keep, sorted by creation
+// time then id, ascending.
+func (s *Store) filterRooms(query pgtype.Text, keep func(*pgstore.Room) bool) []pgstore.Room {
+	var rooms []pgstore.Room
+
+	for _, room := range s.rooms {
+		if !room.DeletedAt.Valid && matchesRoomQuery(room, query) && (keep == nil || keep(room)) {
+			rooms = append(rooms, roomRow(room))
+		}
+	}
+
+	slices.SortFunc(rooms, func(a, b pgstore.Room) int {
+		return compareCreated(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+
+	return rooms
+}
+
+func (s *Store) GetRooms(ctx context.Context, arg pgstore.GetRoomsParams) ([]pgstore.Room, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	rooms := s.filterRooms(arg.Query, nil)
+
+	slices.Reverse(rooms)
+
+	return page(rooms, arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) GetRoomsOldest(ctx context.Context, arg pgstore.GetRoomsOldestParams) ([]pgstore.Room, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	return page(s.filterRooms(arg.Query, nil), arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) GetRoomsBeforeCursor(ctx context.Context, arg pgstore.GetRoomsBeforeCursorParams) ([]pgstore.Room, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	rooms := s.filterRooms(arg.Query, func(room *pgstore.Room) bool {
+		return compareCreated(room.CreatedAt, room.ID, arg.CursorCreatedAt, arg.CursorID) < 0
+	})
+
+	slices.Reverse(rooms)
+
+	return page(rooms, arg.Limit, 0), nil
+}
+
+func (s *Store) GetRoomsAfterCursor(ctx context.Context, arg pgstore.GetRoomsAfterCursorParams) ([]pgstore.Room, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	rooms := s.filterRooms(arg.Query, func(room *pgstore.Room) bool {
+		return compareCreated(room.CreatedAt, room.ID, arg.CursorCreatedAt, arg.CursorID) > 0
+	})
+
+	return page(rooms, arg.Limit, 0), nil
+}
+
+func (s *Store) CountRooms(ctx context.Context, query pgtype.Text) (int64, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	var count int64
+
+	for _, room := range s.rooms {
+		if !room.DeletedAt.Valid && matchesRoomQuery(room, query) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *Store) GetRoomMessageCounts(ctx context.Context, roomIds []uuid.UUID) ([]pgstore.GetRoomMessageCountsRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	counts := make(map[uuid.UUID]int64)
+
+	for _, message := range s.messages {
+		if message.DeletedAt.Valid || !message.Approved || message.Hidden {
+			continue
+		}
+
+		if slices.Contains(roomIds, message.RoomID) {
+			counts[message.RoomID]++
+		}
+	}
+
+	var rows []pgstore.GetRoomMessageCountsRow
+
+	for roomID, count := range counts {
+		rows = append(rows, pgstore.GetRoomMessageCountsRow{RoomID: roomID, MessageCount: count})
+	}
+
+	return rows, nil
+}
+
+func (s *Store) GetPublicRoomIDs(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	var public []uuid.UUID
+
+	for _, room := range s.rooms {
+		if !room.Private && !room.DeletedAt.Valid && slices.Contains(ids, room.ID) {
+			public = append(public, room.ID)
+		}
+	}
+
+	return public, nil
+}
+
+func (s *Store) InsertRoom(ctx context.Context, arg pgstore.InsertRoomParams) (uuid.UUID, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	for _, room := range s.rooms {
+		if room.Code == arg.Code {
+			return uuid.UUID{}, uniqueViolation("rooms_code_key")
+		}
+	}
+
+	tags := slices.Clone(arg.Tags)
+
+	if tags == nil {
+		tags = []string{}
+	}
+
+	createdAt := now()
+
+	room := &pgstore.Room{
+		ID:             uuid.New(),
+		Theme:          arg.Theme,
+		CreatedAt:      createdAt,
+		ExpiresAt:      arg.ExpiresAt,
+		Code:           arg.Code,
+		Private:        arg.Private,
+		AccessCodeHash: arg.AccessCodeHash,
+		Description:    arg.Description,
+		HostName:       arg.HostName,
+		Tags:           tags,
+		StartsAt:       arg.StartsAt,
+		EndsAt:         arg.EndsAt,
+		Live:           arg.Live,
+		HostTokenHash:  arg.HostTokenHash,
+		Moderated:      arg.Moderated,
+		ContentFilter:  arg.ContentFilter,
+		ChangeSeq:      s.nextChangeSeq(),
+		UpdatedAt:      createdAt,
+	}
+
+	saveRow(s, s.rooms, room.ID, nil)
+
+	s.rooms[room.ID] = room
+
+	return room.ID, nil
+}
+
+func (s *Store) CloseRoom(ctx context.Context, id uuid.UUID) error {
+	s.lock()
+
+	defer s.unlock()
+
+	if room, ok := s.liveRoom(id); ok {
+		s.saveRoom(id)
+
+		room.Closed = true
+
+		s.touchRoom(room)
+	}
+
+	return nil
+}
+
+func (s *Store) CloseExpiredRooms(ctx context.Context) ([]uuid.UUID, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	t := now()
+
+	var closed []uuid.UUID
+
+	for _, room := range s.rooms {
+		if room.Closed || room.DeletedAt.Valid || !(timestampReached(room.ExpiresAt, t) || timestampReached(room.EndsAt, t)) {
+			continue
+		}
+
+		s.saveRoom(room.ID)
+
+		room.Closed = true
+
+		s.touchRoom(room)
+
+		closed = append(closed, room.ID)
+	}
+
+	return closed, nil
+}
+
+func (s *Store) OpenScheduledRooms(ctx context.Context) ([]uuid.UUID, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	t := now()
+
+	var opened []uuid.UUID
+
+	for _, room := range s.rooms {
+		if room.Live || room.DeletedAt.Valid || !timestampReached(room.StartsAt, t) {
+			continue
+		}
+
+		s.saveRoom(room.ID)
+
+		room.Live = true
+
+		s.touchRoom(room)
+
+		opened = append(opened, room.ID)
+	}
+
+	return opened, nil
+}
+
+func (s *Store) DeleteRoom(ctx context.Context, id uuid.UUID) error {
+	s.lock()
+
+	defer s.unlock()
+
+	if room, ok := s.liveRoom(id); ok {
+		s.saveRoom(id)
+
+		room.DeletedAt = pgtype.Timestamptz{Time: now(), Valid: true}
+
+		s.touchRoom(room)
+	}
+
+	return nil
+}
+
+// PurgeDeletedRooms deletes the rooms along with everything that cascades
+// from them: their messages, the reactions and reports of those, their bans
+// and their audit log.
+func (s *Store) PurgeDeletedRooms(ctx context.Context, deletedAt time.Time) (int64, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	var purged int64
+
+	for id, room := range s.rooms {
+		if !room.DeletedAt.Valid || !room.DeletedAt.Time.Before(deletedAt) {
+			continue
+		}
+
+		s.saveRoom(id)
+
+		delete(s.rooms, id)
+
+		s.nextChangeSeq()
+
+		for messageID, message := range s.messages {
+			if message.RoomID == id {
+				s.deleteMessageRows(messageID)
+			}
+		}
+
+		for banID, ban := range s.bans {
+			if ban.RoomID == id {
+				saveRow(s, s.bans, banID, nil)
+
+				delete(s.bans, banID)
+			}
+		}
+
+		for entryID, entry := range s.audit {
+			if entry.RoomID == id {
+				saveRow(s, s.audit, entryID, nil)
+
+				delete(s.audit, entryID)
+			}
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *Store) UpdateRoomTheme(ctx context.Context, arg pgstore.UpdateRoomThemeParams) (pgstore.Room, error) {
+	s.lock()
+
+	defer s.unlock()
+
+	room, ok := s.liveRoom(arg.ID)
+
+	if !ok {
+		return pgstore.Room{}, pgx.ErrNoRows
+	}
+
+	s.saveRoom(room.ID)
+
+	room.Theme = arg.Theme
+
+	s.touchRoom(room)
+
+	return roomRow(room), nil
+}
+
+func (s *Store) GetRoomListVersion(ctx context.Context) (pgstore.GetRoomListVersionRow, error) {
+	s.rlock()
+
+	defer s.runlock()
+
+	var version pgstore.GetRoomListVersionRow
+
+	for _, room := range s.rooms {
+		version.MaxChangeSeq = max(version.MaxChangeSeq, room.ChangeSeq)
+		version.RowCount++
+	}
+
+	return version, nil
+}
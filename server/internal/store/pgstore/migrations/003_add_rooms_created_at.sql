@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "created_at" TIMESTAMPTZ NOT NULL DEFAULT now();
+
+---- create above / drop below ----
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "created_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD CONSTRAINT "messages_reaction_count_non_negative" CHECK ("reaction_count" >= 0);
+
+---- create above / drop below ----
+ALTER TABLE messages
+  DROP CONSTRAINT IF EXISTS "messages_reaction_count_non_negative";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,9 @@
+-- Write your migrate up statements here
+CREATE INDEX IF NOT EXISTS "messages_room_id_created_at_id_idx"
+  ON messages ("room_id", "created_at", "id");
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_room_id_created_at_id_idx";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,9 @@
+-- Write your migrate up statements here
+CREATE INDEX IF NOT EXISTS "messages_room_id_reaction_count_idx"
+  ON messages ("room_id", "reaction_count" DESC, "created_at", "id");
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_room_id_reaction_count_idx";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,14 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  DROP CONSTRAINT IF EXISTS "messages_room_id_fkey",
+  ADD CONSTRAINT "messages_room_id_fkey"
+    FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE;
+
+---- create above / drop below ----
+ALTER TABLE messages
+  DROP CONSTRAINT IF EXISTS "messages_room_id_fkey",
+  ADD CONSTRAINT "messages_room_id_fkey"
+    FOREIGN KEY (room_id) REFERENCES rooms (id);
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
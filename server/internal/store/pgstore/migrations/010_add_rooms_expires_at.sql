@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "expires_at" TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS "rooms_open_expires_at_idx"
+  ON rooms ("expires_at")
+  WHERE "closed" = false AND "expires_at" IS NOT NULL;
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "rooms_open_expires_at_idx";
+
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "expires_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
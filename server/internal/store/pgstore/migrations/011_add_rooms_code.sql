@@ -0,0 +1,18 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "code" VARCHAR(6);
+
+UPDATE rooms
+SET "code" = upper(substr(md5(random()::text || "id"::text), 1, 6))
+WHERE "code" IS NULL;
+
+ALTER TABLE rooms
+  ALTER COLUMN "code" SET NOT NULL,
+  ADD CONSTRAINT "rooms_code_key" UNIQUE ("code");
+
+---- create above / drop below ----
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "code";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,11 @@
+-- Write your migrate up statements here
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS "rooms_theme_trgm_idx"
+  ON rooms USING gin ("theme" gin_trgm_ops);
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "rooms_theme_trgm_idx";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,9 @@
+-- Write your migrate up statements here
+CREATE INDEX IF NOT EXISTS "rooms_created_at_id_idx"
+  ON rooms ("created_at", "id");
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "rooms_created_at_id_idx";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "private"          BOOLEAN NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS "access_code_hash" VARCHAR(255);
+
+---- create above / drop below ----
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "access_code_hash",
+  DROP COLUMN IF EXISTS "private";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
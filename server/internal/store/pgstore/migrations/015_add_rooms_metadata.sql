@@ -0,0 +1,14 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "description" VARCHAR(1000) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS "host_name"   VARCHAR(100)  NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS "tags"        TEXT[]        NOT NULL DEFAULT '{}';
+
+---- create above / drop below ----
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "tags",
+  DROP COLUMN IF EXISTS "host_name",
+  DROP COLUMN IF EXISTS "description";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,20 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "starts_at" TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS "ends_at"   TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS "live"      BOOLEAN NOT NULL DEFAULT true;
+
+CREATE INDEX IF NOT EXISTS "rooms_pending_starts_at_idx"
+  ON rooms ("starts_at")
+  WHERE "live" = false;
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "rooms_pending_starts_at_idx";
+
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "live",
+  DROP COLUMN IF EXISTS "ends_at",
+  DROP COLUMN IF EXISTS "starts_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ;
+
+---- create above / drop below ----
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "deleted_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,17 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "parent_message_id" uuid
+    REFERENCES messages (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS "messages_parent_message_id_idx"
+  ON messages ("parent_message_id", "created_at", "id")
+  WHERE "parent_message_id" IS NOT NULL;
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_parent_message_id_idx";
+
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "parent_message_id";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "answer" VARCHAR(1000);
+
+---- create above / drop below ----
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "answer";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "host_token_hash" VARCHAR(64);
+
+---- create above / drop below ----
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "host_token_hash";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
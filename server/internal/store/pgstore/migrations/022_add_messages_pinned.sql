@@ -0,0 +1,15 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "pinned" BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS "messages_room_id_pinned_created_at_id_idx"
+  ON messages ("room_id", "pinned" DESC, "created_at", "id");
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_room_id_pinned_created_at_id_idx";
+
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "pinned";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "merged_into_id" uuid
+    REFERENCES messages (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS "messages_message_trgm_idx"
+  ON messages USING gin ("message" gin_trgm_ops);
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_message_trgm_idx";
+
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "merged_into_id";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "attachment_url" VARCHAR(2048);
+
+---- create above / drop below ----
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "attachment_url";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
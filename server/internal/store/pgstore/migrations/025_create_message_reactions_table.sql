@@ -0,0 +1,24 @@
+-- Write your migrate up statements here
+
+CREATE TABLE IF NOT EXISTS message_reactions (
+  "message_id"  uuid          NOT NULL,
+  "type"        VARCHAR(20)   NOT NULL,
+  "count"       BIGINT        NOT NULL  DEFAULT 0  CHECK ("count" >= 0),
+
+  PRIMARY KEY (message_id, type),
+  FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+);
+
+-- Reactions recorded before typed reactions existed become likes, so the
+-- breakdown still adds up to messages.reaction_count.
+INSERT INTO message_reactions ("message_id", "type", "count")
+SELECT "id", 'like', "reaction_count"
+FROM messages
+WHERE "reaction_count" > 0
+ON CONFLICT DO NOTHING;
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS message_reactions;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,17 @@
+-- Write your migrate up statements here
+
+CREATE TABLE IF NOT EXISTS message_reaction_participants (
+  "message_id"      uuid          NOT NULL,
+  "participant_id"  uuid          NOT NULL,
+  "type"            VARCHAR(20)   NOT NULL,
+  "created_at"      TIMESTAMPTZ   NOT NULL  DEFAULT now(),
+
+  PRIMARY KEY (message_id, participant_id),
+  FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+);
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS message_reaction_participants;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+CREATE INDEX IF NOT EXISTS "messages_room_id_top_idx"
+  ON messages ("room_id", "reaction_count" DESC, "created_at", "id")
+  WHERE "answered" = false AND "deleted_at" IS NULL AND "parent_message_id" IS NULL;
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_room_id_top_idx";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
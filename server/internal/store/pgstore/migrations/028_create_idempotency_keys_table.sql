@@ -0,0 +1,22 @@
+-- Write your migrate up statements here
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  "key"           VARCHAR(255)  NOT NULL,
+  "method"        VARCHAR(10)   NOT NULL,
+  "path"          TEXT          NOT NULL,
+  "status_code"   INTEGER,
+  "content_type"  TEXT,
+  "body"          BYTEA,
+  "created_at"    TIMESTAMPTZ   NOT NULL  DEFAULT now(),
+
+  PRIMARY KEY (key, method, path)
+);
+
+CREATE INDEX IF NOT EXISTS "idempotency_keys_created_at_idx"
+  ON idempotency_keys ("created_at");
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS idempotency_keys;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
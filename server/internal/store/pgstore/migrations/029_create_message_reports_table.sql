@@ -0,0 +1,18 @@
+-- Write your migrate up statements here
+
+CREATE TABLE IF NOT EXISTS message_reports (
+  "id"              uuid          PRIMARY KEY   NOT NULL  DEFAULT gen_random_uuid(),
+  "message_id"      uuid                        NOT NULL,
+  "participant_id"  uuid                        NOT NULL,
+  "reason"          VARCHAR(500)                NOT NULL,
+  "created_at"      TIMESTAMPTZ                 NOT NULL  DEFAULT now(),
+
+  UNIQUE (message_id, participant_id),
+  FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+);
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS message_reports;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
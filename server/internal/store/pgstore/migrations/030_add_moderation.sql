@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "moderated" BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "approved" BOOLEAN NOT NULL DEFAULT true;
+
+---- create above / drop below ----
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "approved";
+
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "moderated";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
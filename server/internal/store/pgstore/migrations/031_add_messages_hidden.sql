@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "participant_id" uuid,
+  ADD COLUMN IF NOT EXISTS "hidden" BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "hidden",
+  DROP COLUMN IF EXISTS "participant_id";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,22 @@
+-- Write your migrate up statements here
+
+CREATE TABLE IF NOT EXISTS room_bans (
+  "id"              uuid          PRIMARY KEY   NOT NULL  DEFAULT gen_random_uuid(),
+  "room_id"         uuid                        NOT NULL,
+  "participant_id"  uuid,
+  "ip"              VARCHAR(45),
+  "reason"          VARCHAR(500)                NOT NULL  DEFAULT '',
+  "created_at"      TIMESTAMPTZ                 NOT NULL  DEFAULT now(),
+
+  CHECK ("participant_id" IS NOT NULL OR "ip" IS NOT NULL),
+  FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "room_bans_room_id_idx"
+  ON room_bans ("room_id");
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS room_bans;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "content_filter" BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "content_filter";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,9 @@
+-- Write your migrate up statements here
+CREATE INDEX IF NOT EXISTS "messages_search_idx"
+  ON messages USING gin (to_tsvector('simple', "message"));
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_search_idx";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
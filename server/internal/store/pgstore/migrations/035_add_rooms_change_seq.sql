@@ -0,0 +1,60 @@
+-- Write your migrate up statements here
+
+-- Every change to a room or to one of its messages takes a new value from
+-- room_change_seq. Listings derive their ETags from it: a room's change_seq
+-- covers its messages, and the sequence's last value covers the room list.
+CREATE SEQUENCE IF NOT EXISTS room_change_seq;
+
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "change_seq" BIGINT NOT NULL DEFAULT nextval('room_change_seq');
+
+CREATE OR REPLACE FUNCTION bump_room_change_seq() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    PERFORM nextval('room_change_seq');
+
+    RETURN OLD;
+  END IF;
+
+  NEW.change_seq := nextval('room_change_seq');
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION bump_message_room_change_seq() RETURNS trigger AS $$
+BEGIN
+  UPDATE rooms
+  SET change_seq = nextval('room_change_seq')
+  WHERE id = COALESCE(NEW.room_id, OLD.room_id);
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER rooms_change_seq
+  BEFORE UPDATE ON rooms
+  FOR EACH ROW EXECUTE FUNCTION bump_room_change_seq();
+
+CREATE TRIGGER rooms_delete_change_seq
+  AFTER DELETE ON rooms
+  FOR EACH ROW EXECUTE FUNCTION bump_room_change_seq();
+
+CREATE TRIGGER messages_room_change_seq
+  AFTER INSERT OR UPDATE OR DELETE ON messages
+  FOR EACH ROW EXECUTE FUNCTION bump_message_room_change_seq();
+
+---- create above / drop below ----
+DROP TRIGGER IF EXISTS messages_room_change_seq ON messages;
+DROP TRIGGER IF EXISTS rooms_delete_change_seq ON rooms;
+DROP TRIGGER IF EXISTS rooms_change_seq ON rooms;
+DROP FUNCTION IF EXISTS bump_message_room_change_seq();
+DROP FUNCTION IF EXISTS bump_room_change_seq();
+
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "change_seq";
+
+DROP SEQUENCE IF EXISTS room_change_seq;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,44 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Message changes bump change_seq through an UPDATE of the room as well, so
+-- updated_at only moves when that UPDATE came from somewhere else.
+CREATE OR REPLACE FUNCTION bump_room_change_seq() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    PERFORM nextval('room_change_seq');
+
+    RETURN OLD;
+  END IF;
+
+  IF NEW.change_seq IS NOT DISTINCT FROM OLD.change_seq THEN
+    NEW.updated_at := now();
+  END IF;
+
+  NEW.change_seq := nextval('room_change_seq');
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+---- create above / drop below ----
+CREATE OR REPLACE FUNCTION bump_room_change_seq() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    PERFORM nextval('room_change_seq');
+
+    RETURN OLD;
+  END IF;
+
+  NEW.change_seq := nextval('room_change_seq');
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "updated_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,24 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ;
+
+-- Soft deleted rows wait there for the purge job, which looks them up by
+-- deletion time.
+CREATE INDEX IF NOT EXISTS "rooms_deleted_at_idx"
+  ON rooms ("deleted_at")
+  WHERE "deleted_at" IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS "messages_deleted_at_idx"
+  ON messages ("deleted_at")
+  WHERE "deleted_at" IS NOT NULL;
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_deleted_at_idx";
+
+DROP INDEX IF EXISTS "rooms_deleted_at_idx";
+
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS "deleted_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
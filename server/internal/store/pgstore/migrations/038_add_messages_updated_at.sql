@@ -0,0 +1,30 @@
+-- Write your migrate up statements here
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE messages
+SET updated_at = GREATEST(created_at, edited_at, deleted_at);
+
+-- Any change to a message moves updated_at, reactions included, since the
+-- reaction count is part of the message clients show.
+CREATE OR REPLACE FUNCTION set_message_updated_at() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at := now();
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER messages_updated_at
+  BEFORE UPDATE ON messages
+  FOR EACH ROW EXECUTE FUNCTION set_message_updated_at();
+
+---- create above / drop below ----
+DROP TRIGGER IF EXISTS messages_updated_at ON messages;
+DROP FUNCTION IF EXISTS set_message_updated_at();
+
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "updated_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,22 @@
+-- Write your migrate up statements here
+CREATE TABLE IF NOT EXISTS audit_log (
+  "id"              uuid          PRIMARY KEY   NOT NULL  DEFAULT gen_random_uuid(),
+  "room_id"         uuid                        NOT NULL,
+  "actor"           VARCHAR(20)                 NOT NULL,
+  "participant_id"  uuid,
+  "ip"              VARCHAR(45),
+  "action"          VARCHAR(50)                 NOT NULL,
+  "target_id"       uuid,
+  "created_at"      TIMESTAMPTZ                 NOT NULL  DEFAULT now(),
+
+  FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "audit_log_room_id_created_at_idx"
+  ON audit_log ("room_id", "created_at" DESC, "id" DESC);
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS audit_log;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,86 @@
+-- Write your migrate up statements here
+
+-- Reactions become one row per participant, and counts are computed from
+-- the rows. Reactions from before participants were tracked have no row, so
+-- each gets one under a made up participant id to keep the counts.
+INSERT INTO message_reaction_participants ("message_id", "participant_id", "type")
+SELECT r."message_id", gen_random_uuid(), r."type"
+FROM message_reactions r
+CROSS JOIN LATERAL generate_series(1, r."count" - (
+    SELECT count(*)
+    FROM message_reaction_participants p
+    WHERE p."message_id" = r."message_id" AND p."type" = r."type"
+));
+
+DROP TABLE message_reactions;
+
+ALTER TABLE message_reaction_participants RENAME TO message_reactions;
+
+ALTER TABLE message_reactions
+  RENAME CONSTRAINT "message_reaction_participants_pkey" TO "message_reactions_pkey";
+
+ALTER TABLE message_reactions
+  RENAME CONSTRAINT "message_reaction_participants_message_id_fkey" TO "message_reactions_message_id_fkey";
+
+-- messages.reaction_count stays, as a cache of the rows the listings sort
+-- on, but only the trigger below writes it.
+UPDATE messages m
+SET reaction_count = counted.count
+FROM (
+    SELECT m2."id", count(r."message_id") AS count
+    FROM messages m2
+    LEFT JOIN message_reactions r ON r."message_id" = m2."id"
+    GROUP BY m2."id"
+) counted
+WHERE
+    counted."id" = m."id"
+    AND m."reaction_count" <> counted.count;
+
+CREATE OR REPLACE FUNCTION count_message_reactions() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE messages
+    SET reaction_count = reaction_count + 1
+    WHERE id = NEW.message_id;
+  ELSE
+    UPDATE messages
+    SET reaction_count = reaction_count - 1
+    WHERE id = OLD.message_id;
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER message_reactions_count
+  AFTER INSERT OR DELETE ON message_reactions
+  FOR EACH ROW EXECUTE FUNCTION count_message_reactions();
+
+---- create above / drop below ----
+DROP TRIGGER IF EXISTS message_reactions_count ON message_reactions;
+DROP FUNCTION IF EXISTS count_message_reactions();
+
+ALTER TABLE message_reactions
+  RENAME CONSTRAINT "message_reactions_message_id_fkey" TO "message_reaction_participants_message_id_fkey";
+
+ALTER TABLE message_reactions
+  RENAME CONSTRAINT "message_reactions_pkey" TO "message_reaction_participants_pkey";
+
+ALTER TABLE message_reactions RENAME TO message_reaction_participants;
+
+CREATE TABLE IF NOT EXISTS message_reactions (
+  "message_id"  uuid          NOT NULL,
+  "type"        VARCHAR(20)   NOT NULL,
+  "count"       BIGINT        NOT NULL  DEFAULT 0  CHECK ("count" >= 0),
+
+  PRIMARY KEY (message_id, type),
+  FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+);
+
+INSERT INTO message_reactions ("message_id", "type", "count")
+SELECT "message_id", "type", count(*)
+FROM message_reaction_participants
+GROUP BY "message_id", "type";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,55 @@
+-- Write your migrate up statements here
+
+-- Listing ETags were built from the last value of room_change_seq, which
+-- moves as soon as a writer takes a value, before it commits. They are now
+-- read from the committed rows instead, summing their change_seq so that a
+-- change shows up whatever order the transactions commit in.
+--
+-- Messages get a change_seq of their own for the message listings, so that
+-- reactions, which only change the reaction_count of a message, no longer
+-- bump the room and queue up on its row. The room list doesn't show them.
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS "change_seq" BIGINT NOT NULL DEFAULT nextval('room_change_seq');
+
+CREATE OR REPLACE FUNCTION set_message_updated_at() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at := now();
+  NEW.change_seq := nextval('room_change_seq');
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS messages_room_change_seq ON messages;
+
+CREATE TRIGGER messages_room_change_seq
+  AFTER INSERT OR DELETE ON messages
+  FOR EACH ROW EXECUTE FUNCTION bump_message_room_change_seq();
+
+CREATE TRIGGER messages_update_room_change_seq
+  AFTER UPDATE ON messages
+  FOR EACH ROW
+  WHEN (OLD.reaction_count IS NOT DISTINCT FROM NEW.reaction_count)
+  EXECUTE FUNCTION bump_message_room_change_seq();
+
+---- create above / drop below ----
+DROP TRIGGER IF EXISTS messages_update_room_change_seq ON messages;
+DROP TRIGGER IF EXISTS messages_room_change_seq ON messages;
+
+CREATE TRIGGER messages_room_change_seq
+  AFTER INSERT OR UPDATE OR DELETE ON messages
+  FOR EACH ROW EXECUTE FUNCTION bump_message_room_change_seq();
+
+CREATE OR REPLACE FUNCTION set_message_updated_at() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at := now();
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS "change_seq";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,30 @@
+-- Write your migrate up statements here
+
+-- Keys are scoped to the caller that sent them, and remember a hash of the
+-- request so a key reused for another request is refused rather than given
+-- the response of the first. The keys stored so far have neither, and some
+-- hold the host token of the room they created, so they are dropped; they
+-- only lived for a day anyway.
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys
+  ADD COLUMN "caller"        TEXT  NOT NULL,
+  ADD COLUMN "request_hash"  TEXT  NOT NULL;
+
+ALTER TABLE idempotency_keys
+  DROP CONSTRAINT "idempotency_keys_pkey",
+  ADD PRIMARY KEY (caller, key, method, path);
+
+---- create above / drop below ----
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys
+  DROP CONSTRAINT "idempotency_keys_pkey",
+  ADD PRIMARY KEY (key, method, path);
+
+ALTER TABLE idempotency_keys
+  DROP COLUMN IF EXISTS "request_hash",
+  DROP COLUMN IF EXISTS "caller";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,24 @@
+-- Write your migrate up statements here
+
+-- Listings put the pinned messages first. The oldest first compare
+-- (NOT pinned, created_at, id) with their cursor, and the newest first
+-- (pinned, created_at, id) read backwards, so each gets an index in its
+-- order and a page no longer sorts the whole room.
+DROP INDEX IF EXISTS "messages_room_id_pinned_created_at_id_idx";
+
+CREATE INDEX IF NOT EXISTS "messages_room_id_not_pinned_created_at_id_idx"
+  ON messages ("room_id", (NOT "pinned"), "created_at", "id");
+
+CREATE INDEX IF NOT EXISTS "messages_room_id_pinned_created_at_id_idx"
+  ON messages ("room_id", "pinned", "created_at", "id");
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS "messages_room_id_pinned_created_at_id_idx";
+
+DROP INDEX IF EXISTS "messages_room_id_not_pinned_created_at_id_idx";
+
+CREATE INDEX IF NOT EXISTS "messages_room_id_pinned_created_at_id_idx"
+  ON messages ("room_id", "pinned" DESC, "created_at", "id");
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,53 @@
+// Package migrations embeds the SQL migrations of the database and applies
+// them with tern's migrate package, so the server and the tern command line
+// share the schema_version table and the advisory lock they migrate under.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/tern/v2/migrate"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// versionTable is the table tern keeps the version of the database in.
+const versionTable = "public.schema_version"
+
+// Run applies the migrations the database doesn't have yet.
+func Run(ctx context.Context, pool *pgxpool.Pool) error {
+	// The advisory lock belongs to a session, so everything runs on the
+	// same connection.
+	conn, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	migrator, err := migrate.NewMigrator(ctx, conn.Conn(), versionTable)
+
+	if err != nil {
+		return fmt.Errorf("failed to create the migrator: %w", err)
+	}
+
+	if err := migrator.LoadMigrations(files); err != nil {
+		return fmt.Errorf("failed to load the migrations: %w", err)
+	}
+
+	migrator.OnStart = func(sequence int32, name, direction, sql string) {
+		slog.Info("Applying migration", "name", name)
+	}
+
+	if err := migrator.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+
+	"github.com/jackc/tern/v2/migrate"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	// A migrator without a connection loads migrations, and only that.
+	migrator, err := migrate.NewMigrator(context.Background(), nil, versionTable)
+
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+
+	if err := migrator.LoadMigrations(files); err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+
+	names, _ := fs.Glob(files, "*.sql")
+
+	if len(migrator.Migrations) != len(names) {
+		t.Fatalf("loaded %d migrations out of %d files", len(migrator.Migrations), len(names))
+	}
+}
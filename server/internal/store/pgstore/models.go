@@ -5,18 +5,99 @@
 package pgstore
 
 import (
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type Message struct {
+type AuditLog struct {
 	ID            uuid.UUID
 	RoomID        uuid.UUID
-	Message       string
-	ReactionCount int64
-	Answered      bool
+	Actor         string
+	ParticipantID uuid.NullUUID
+	Ip            pgtype.Text
+	Action        string
+	TargetID      uuid.NullUUID
+	CreatedAt     time.Time
+}
+
+type IdempotencyKey struct {
+	Key         string
+	Method      string
+	Path        string
+	StatusCode  pgtype.Int4
+	ContentType pgtype.Text
+	Body        []byte
+	CreatedAt   time.Time
+	Caller      string
+	RequestHash string
+}
+
+type Message struct {
+	ID              uuid.UUID
+	RoomID          uuid.UUID
+	Message         string
+	ReactionCount   int64
+	Answered        bool
+	CreatedAt       time.Time
+	EditedAt        pgtype.Timestamptz
+	DeletedAt       pgtype.Timestamptz
+	ParentMessageID uuid.NullUUID
+	Answer          pgtype.Text
+	Pinned          bool
+	MergedIntoID    uuid.NullUUID
+	AttachmentUrl   pgtype.Text
+	Approved        bool
+	ParticipantID   uuid.NullUUID
+	Hidden          bool
+	UpdatedAt       time.Time
+	ChangeSeq       int64
+}
+
+type MessageReaction struct {
+	MessageID     uuid.UUID
+	ParticipantID uuid.UUID
+	Type          string
+	CreatedAt     time.Time
+}
+
+type MessageReport struct {
+	ID            uuid.UUID
+	MessageID     uuid.UUID
+	ParticipantID uuid.UUID
+	Reason        string
+	CreatedAt     time.Time
 }
 
 type Room struct {
-	ID    uuid.UUID
-	Theme string
+	ID             uuid.UUID
+	Theme          string
+	CreatedAt      time.Time
+	Closed         bool
+	ExpiresAt      pgtype.Timestamptz
+	Code           string
+	Private        bool
+	AccessCodeHash pgtype.Text
+	Description    string
+	HostName       string
+	Tags           []string
+	StartsAt       pgtype.Timestamptz
+	EndsAt         pgtype.Timestamptz
+	Live           bool
+	HostTokenHash  pgtype.Text
+	Moderated      bool
+	ContentFilter  bool
+	ChangeSeq      int64
+	UpdatedAt      time.Time
+	DeletedAt      pgtype.Timestamptz
+}
+
+type RoomBan struct {
+	ID            uuid.UUID
+	RoomID        uuid.UUID
+	ParticipantID uuid.NullUUID
+	Ip            pgtype.Text
+	Reason        string
+	CreatedAt     time.Time
 }
@@ -7,55 +7,1878 @@ package pgstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const approveMessage = `-- name: ApproveMessage :one
+UPDATE messages
+SET
+    approved = true
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+`
+
+func (q *Queries) ApproveMessage(ctx context.Context, id uuid.UUID) (Message, error) {
+	row := q.db.QueryRow(ctx, approveMessage, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		&i.CreatedAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		&i.UpdatedAt,
+		&i.ChangeSeq,
+	)
+	return i, err
+}
+
+const closeExpiredRooms = `-- name: CloseExpiredRooms :many
+UPDATE rooms
+SET
+    closed = true
+WHERE
+    closed = false
+    AND deleted_at IS NULL
+    AND (expires_at <= now() OR ends_at <= now())
+RETURNING "id"
+`
+
+func (q *Queries) CloseExpiredRooms(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, closeExpiredRooms)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const closeRoom = `-- name: CloseRoom :exec
+UPDATE rooms
+SET
+    closed = true
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) CloseRoom(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, closeRoom, id)
+	return err
+}
+
+const completeIdempotencyKey = `-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET
+    status_code = $1,
+    content_type = $2,
+    body = $3
+WHERE
+    caller = $4
+    AND key = $5
+    AND method = $6
+    AND path = $7
+`
+
+type CompleteIdempotencyKeyParams struct {
+	StatusCode  pgtype.Int4
+	ContentType pgtype.Text
+	Body        []byte
+	Caller      string
+	Key         string
+	Method      string
+	Path        string
+}
+
+func (q *Queries) CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) error {
+	_, err := q.db.Exec(ctx, completeIdempotencyKey,
+		arg.StatusCode,
+		arg.ContentType,
+		arg.Body,
+		arg.Caller,
+		arg.Key,
+		arg.Method,
+		arg.Path,
+	)
+	return err
+}
+
+const countRooms = `-- name: CountRooms :one
+SELECT
+    COUNT(*)
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND ($1::text IS NULL OR "theme" ILIKE '%' || $1 || '%')
+`
+
+func (q *Queries) CountRooms(ctx context.Context, query pgtype.Text) (int64, error) {
+	row := q.db.QueryRow(ctx, countRooms, query)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteExpiredIdempotencyKeys = `-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE created_at < $1
+`
+
+func (q *Queries) DeleteExpiredIdempotencyKeys(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredIdempotencyKeys, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteIdempotencyKey = `-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE
+    caller = $1
+    AND key = $2
+    AND method = $3
+    AND path = $4
+`
+
+type DeleteIdempotencyKeyParams struct {
+	Caller string
+	Key    string
+	Method string
+	Path   string
+}
+
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error {
+	_, err := q.db.Exec(ctx, deleteIdempotencyKey,
+		arg.Caller,
+		arg.Key,
+		arg.Method,
+		arg.Path,
+	)
+	return err
+}
+
+const deleteRoom = `-- name: DeleteRoom :exec
+UPDATE rooms
+SET
+    deleted_at = now()
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) DeleteRoom(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteRoom, id)
+	return err
+}
+
+const deleteRoomBan = `-- name: DeleteRoomBan :execrows
+DELETE FROM room_bans
+WHERE
+    id = $1
+    AND room_id = $2
+`
+
+type DeleteRoomBanParams struct {
+	ID     uuid.UUID
+	RoomID uuid.UUID
+}
+
+func (q *Queries) DeleteRoomBan(ctx context.Context, arg DeleteRoomBanParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteRoomBan, arg.ID, arg.RoomID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const findSimilarMessages = `-- name: FindSimilarMessages :many
+SELECT
+    "id", "message", similarity("message", $1::text) AS "similarity"
+FROM messages
+WHERE
+    room_id = $2
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+    AND parent_message_id IS NULL
+    AND id <> $3
+    AND "message" % $1::text
+ORDER BY "similarity" DESC
+LIMIT 5
+`
+
+type FindSimilarMessagesParams struct {
+	Message   string
+	RoomID    uuid.UUID
+	ExcludeID uuid.UUID
+}
+
+type FindSimilarMessagesRow struct {
+	ID         uuid.UUID
+	Message    string
+	Similarity float32
+}
+
+func (q *Queries) FindSimilarMessages(ctx context.Context, arg FindSimilarMessagesParams) ([]FindSimilarMessagesRow, error) {
+	rows, err := q.db.Query(ctx, findSimilarMessages, arg.Message, arg.RoomID, arg.ExcludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FindSimilarMessagesRow
+	for rows.Next() {
+		var i FindSimilarMessagesRow
+		if err := rows.Scan(&i.ID, &i.Message, &i.Similarity); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getIdempotencyKey = `-- name: GetIdempotencyKey :one
+SELECT
+    "key", "method", "path", "status_code", "content_type", "body", "created_at", "caller", "request_hash"
+FROM idempotency_keys
+WHERE
+    caller = $1
+    AND key = $2
+    AND method = $3
+    AND path = $4
+`
+
+type GetIdempotencyKeyParams struct {
+	Caller string
+	Key    string
+	Method string
+	Path   string
+}
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRow(ctx, getIdempotencyKey,
+		arg.Caller,
+		arg.Key,
+		arg.Method,
+		arg.Path,
+	)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Key,
+		&i.Method,
+		&i.Path,
+		&i.StatusCode,
+		&i.ContentType,
+		&i.Body,
+		&i.CreatedAt,
+		&i.Caller,
+		&i.RequestHash,
+	)
+	return i, err
+}
+
 const getMessage = `-- name: GetMessage :one
 SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) GetMessage(ctx context.Context, id uuid.UUID) (Message, error) {
+	row := q.db.QueryRow(ctx, getMessage, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		&i.CreatedAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		&i.UpdatedAt,
+		&i.ChangeSeq,
+	)
+	return i, err
+}
+
+const getMessageRanks = `-- name: GetMessageRanks :many
+WITH ranked AS (
+    SELECT
+        "id",
+        ROW_NUMBER() OVER (ORDER BY "reaction_count" DESC, "created_at" ASC, "id" ASC) AS rank
+    FROM messages
+    WHERE
+        room_id = $2
+        AND deleted_at IS NULL
+        AND approved = true
+        AND hidden = false
+        AND parent_message_id IS NULL
+)
+SELECT "id", rank
+FROM ranked
+WHERE id = ANY($1::uuid[])
+`
+
+type GetMessageRanksParams struct {
+	MessageIds []uuid.UUID
+	RoomID     uuid.UUID
+}
+
+type GetMessageRanksRow struct {
+	ID   uuid.UUID
+	Rank int64
+}
+
+func (q *Queries) GetMessageRanks(ctx context.Context, arg GetMessageRanksParams) ([]GetMessageRanksRow, error) {
+	rows, err := q.db.Query(ctx, getMessageRanks, arg.MessageIds, arg.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessageRanksRow
+	for rows.Next() {
+		var i GetMessageRanksRow
+		if err := rows.Scan(&i.ID, &i.Rank); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessageReplies = `-- name: GetMessageReplies :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
 FROM messages
+WHERE
+    parent_message_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+ORDER BY "created_at" ASC, "id" ASC
+`
+
+type GetMessageRepliesParams struct {
+	ParentMessageID uuid.NullUUID
+	ViewerID        uuid.NullUUID
+}
+
+func (q *Queries) GetMessageReplies(ctx context.Context, arg GetMessageRepliesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getMessageReplies, arg.ParentMessageID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesReactions = `-- name: GetMessagesReactions :many
+SELECT
+    "message_id", "type", count(*) AS count
+FROM message_reactions
+WHERE message_id = ANY($1::uuid[])
+GROUP BY message_id, type
+ORDER BY message_id, count DESC, type
+`
+
+type GetMessagesReactionsRow struct {
+	MessageID uuid.UUID
+	Type      string
+	Count     int64
+}
+
+func (q *Queries) GetMessagesReactions(ctx context.Context, messageIds []uuid.UUID) ([]GetMessagesReactionsRow, error) {
+	rows, err := q.db.Query(ctx, getMessagesReactions, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessagesReactionsRow
+	for rows.Next() {
+		var i GetMessagesReactionsRow
+		if err := rows.Scan(&i.MessageID, &i.Type, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPublicRoomIDs = `-- name: GetPublicRoomIDs :many
+SELECT "id" FROM rooms
+WHERE
+    id = ANY($1::uuid[])
+    AND private = false
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) GetPublicRoomIDs(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getPublicRoomIDs, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoom = `-- name: GetRoom :one
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
 WHERE
     id = $1
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) GetRoom(ctx context.Context, id uuid.UUID) (Room, error) {
+	row := q.db.QueryRow(ctx, getRoom, id)
+	var i Room
+	err := row.Scan(
+		&i.ID,
+		&i.Theme,
+		&i.CreatedAt,
+		&i.Closed,
+		&i.ExpiresAt,
+		&i.Code,
+		&i.Private,
+		&i.AccessCodeHash,
+		&i.Description,
+		&i.HostName,
+		&i.Tags,
+		&i.StartsAt,
+		&i.EndsAt,
+		&i.Live,
+		&i.HostTokenHash,
+		&i.Moderated,
+		&i.ContentFilter,
+		&i.ChangeSeq,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getRoomAuditLog = `-- name: GetRoomAuditLog :many
+SELECT
+    "id", "room_id", "actor", "participant_id", "ip", "action", "target_id", "created_at"
+FROM audit_log
+WHERE room_id = $1
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT $2 OFFSET $3
+`
+
+type GetRoomAuditLogParams struct {
+	RoomID uuid.UUID
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) GetRoomAuditLog(ctx context.Context, arg GetRoomAuditLogParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, getRoomAuditLog, arg.RoomID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Actor,
+			&i.ParticipantID,
+			&i.Ip,
+			&i.Action,
+			&i.TargetID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomBans = `-- name: GetRoomBans :many
+SELECT
+    "id", "room_id", "participant_id", "ip", "reason", "created_at"
+FROM room_bans
+WHERE room_id = $1
+ORDER BY "created_at" DESC, "id" DESC
+`
+
+func (q *Queries) GetRoomBans(ctx context.Context, roomID uuid.UUID) ([]RoomBan, error) {
+	rows, err := q.db.Query(ctx, getRoomBans, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RoomBan
+	for rows.Next() {
+		var i RoomBan
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.ParticipantID,
+			&i.Ip,
+			&i.Reason,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomByCode = `-- name: GetRoomByCode :one
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    code = $1
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) GetRoomByCode(ctx context.Context, code string) (Room, error) {
+	row := q.db.QueryRow(ctx, getRoomByCode, code)
+	var i Room
+	err := row.Scan(
+		&i.ID,
+		&i.Theme,
+		&i.CreatedAt,
+		&i.Closed,
+		&i.ExpiresAt,
+		&i.Code,
+		&i.Private,
+		&i.AccessCodeHash,
+		&i.Description,
+		&i.HostName,
+		&i.Tags,
+		&i.StartsAt,
+		&i.EndsAt,
+		&i.Live,
+		&i.HostTokenHash,
+		&i.Moderated,
+		&i.ContentFilter,
+		&i.ChangeSeq,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getRoomListVersion = `-- name: GetRoomListVersion :one
+SELECT COALESCE(max("change_seq"), 0)::bigint AS max_change_seq, count(*) AS row_count
+FROM rooms
+`
+
+type GetRoomListVersionRow struct {
+	MaxChangeSeq int64
+	RowCount     int64
+}
+
+// Every change takes a change_seq past all those taken before, and deleting
+// a row lowers the count, so the pair doesn't come back to an earlier value
+// the way a sum would once rows are purged.
+func (q *Queries) GetRoomListVersion(ctx context.Context) (GetRoomListVersionRow, error) {
+	row := q.db.QueryRow(ctx, getRoomListVersion)
+	var i GetRoomListVersionRow
+	err := row.Scan(&i.MaxChangeSeq, &i.RowCount)
+	return i, err
+}
+
+const getRoomMessageCounts = `-- name: GetRoomMessageCounts :many
+SELECT
+    "room_id", COUNT(*) AS "message_count"
+FROM messages
+WHERE
+    room_id = ANY($1::uuid[])
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+GROUP BY "room_id"
+`
+
+type GetRoomMessageCountsRow struct {
+	RoomID       uuid.UUID
+	MessageCount int64
+}
+
+func (q *Queries) GetRoomMessageCounts(ctx context.Context, roomIds []uuid.UUID) ([]GetRoomMessageCountsRow, error) {
+	rows, err := q.db.Query(ctx, getRoomMessageCounts, roomIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRoomMessageCountsRow
+	for rows.Next() {
+		var i GetRoomMessageCountsRow
+		if err := rows.Scan(&i.RoomID, &i.MessageCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessages = `-- name: GetRoomMessages :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+    AND parent_message_id IS NULL
+    AND ($3::boolean IS NULL OR answered = $3)
+ORDER BY NOT "pinned", "created_at", "id"
+LIMIT $5 OFFSET $4
+`
+
+type GetRoomMessagesParams struct {
+	RoomID   uuid.UUID
+	ViewerID uuid.NullUUID
+	Answered pgtype.Bool
+	Offset   int32
+	Limit    int32
+}
+
+func (q *Queries) GetRoomMessages(ctx context.Context, arg GetRoomMessagesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessages,
+		arg.RoomID,
+		arg.ViewerID,
+		arg.Answered,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesAfterCursor = `-- name: GetRoomMessagesAfterCursor :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+    AND parent_message_id IS NULL
+    AND ($3::boolean IS NULL OR answered = $3)
+    AND (NOT "pinned", "created_at", "id") > (NOT $4::boolean, $5::timestamptz, $6::uuid)
+ORDER BY NOT "pinned", "created_at", "id"
+LIMIT $7
+`
+
+type GetRoomMessagesAfterCursorParams struct {
+	RoomID          uuid.UUID
+	ViewerID        uuid.NullUUID
+	Answered        pgtype.Bool
+	CursorPinned    bool
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) GetRoomMessagesAfterCursor(ctx context.Context, arg GetRoomMessagesAfterCursorParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesAfterCursor,
+		arg.RoomID,
+		arg.ViewerID,
+		arg.Answered,
+		arg.CursorPinned,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesBeforeCursor = `-- name: GetRoomMessagesBeforeCursor :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+    AND parent_message_id IS NULL
+    AND ($3::boolean IS NULL OR answered = $3)
+    AND ("pinned", "created_at", "id") < ($4::boolean, $5::timestamptz, $6::uuid)
+ORDER BY "pinned" DESC, "created_at" DESC, "id" DESC
+LIMIT $7
+`
+
+type GetRoomMessagesBeforeCursorParams struct {
+	RoomID          uuid.UUID
+	ViewerID        uuid.NullUUID
+	Answered        pgtype.Bool
+	CursorPinned    bool
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) GetRoomMessagesBeforeCursor(ctx context.Context, arg GetRoomMessagesBeforeCursorParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesBeforeCursor,
+		arg.RoomID,
+		arg.ViewerID,
+		arg.Answered,
+		arg.CursorPinned,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesForExport = `-- name: GetRoomMessagesForExport :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND ("created_at", "id") > ($2::timestamptz, $3::uuid)
+ORDER BY "created_at" ASC, "id" ASC
+LIMIT $4
+`
+
+type GetRoomMessagesForExportParams struct {
+	RoomID          uuid.UUID
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) GetRoomMessagesForExport(ctx context.Context, arg GetRoomMessagesForExportParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesForExport,
+		arg.RoomID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesMostReacted = `-- name: GetRoomMessagesMostReacted :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+    AND parent_message_id IS NULL
+    AND ($3::boolean IS NULL OR answered = $3)
+ORDER BY "pinned" DESC, "reaction_count" DESC, "created_at" ASC, "id" ASC
+LIMIT $5 OFFSET $4
+`
+
+type GetRoomMessagesMostReactedParams struct {
+	RoomID   uuid.UUID
+	ViewerID uuid.NullUUID
+	Answered pgtype.Bool
+	Offset   int32
+	Limit    int32
+}
+
+func (q *Queries) GetRoomMessagesMostReacted(ctx context.Context, arg GetRoomMessagesMostReactedParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesMostReacted,
+		arg.RoomID,
+		arg.ViewerID,
+		arg.Answered,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesNewest = `-- name: GetRoomMessagesNewest :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+    AND parent_message_id IS NULL
+    AND ($3::boolean IS NULL OR answered = $3)
+ORDER BY "pinned" DESC, "created_at" DESC, "id" DESC
+LIMIT $5 OFFSET $4
+`
+
+type GetRoomMessagesNewestParams struct {
+	RoomID   uuid.UUID
+	ViewerID uuid.NullUUID
+	Answered pgtype.Bool
+	Offset   int32
+	Limit    int32
+}
+
+func (q *Queries) GetRoomMessagesNewest(ctx context.Context, arg GetRoomMessagesNewestParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesNewest,
+		arg.RoomID,
+		arg.ViewerID,
+		arg.Answered,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesPerMinute = `-- name: GetRoomMessagesPerMinute :many
+SELECT
+    date_trunc('minute', created_at)::timestamptz AS minute,
+    COUNT(*) AS message_count
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+GROUP BY minute
+ORDER BY minute ASC
+`
+
+type GetRoomMessagesPerMinuteRow struct {
+	Minute       time.Time
+	MessageCount int64
+}
+
+func (q *Queries) GetRoomMessagesPerMinute(ctx context.Context, roomID uuid.UUID) ([]GetRoomMessagesPerMinuteRow, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesPerMinute, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRoomMessagesPerMinuteRow
+	for rows.Next() {
+		var i GetRoomMessagesPerMinuteRow
+		if err := rows.Scan(&i.Minute, &i.MessageCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesVersion = `-- name: GetRoomMessagesVersion :one
+SELECT COALESCE(max("change_seq"), 0)::bigint AS max_change_seq, count(*) AS row_count
+FROM messages
+WHERE room_id = $1
+`
+
+type GetRoomMessagesVersionRow struct {
+	MaxChangeSeq int64
+	RowCount     int64
+}
+
+// See GetRoomListVersion.
+func (q *Queries) GetRoomMessagesVersion(ctx context.Context, roomID uuid.UUID) (GetRoomMessagesVersionRow, error) {
+	row := q.db.QueryRow(ctx, getRoomMessagesVersion, roomID)
+	var i GetRoomMessagesVersionRow
+	err := row.Scan(&i.MaxChangeSeq, &i.RowCount)
+	return i, err
+}
+
+const getRoomPendingMessages = `-- name: GetRoomPendingMessages :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND approved = false
+    AND deleted_at IS NULL
+ORDER BY "created_at" ASC, "id" ASC
+`
+
+func (q *Queries) GetRoomPendingMessages(ctx context.Context, roomID uuid.UUID) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomPendingMessages, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomReportedMessages = `-- name: GetRoomReportedMessages :many
+SELECT
+    m."id",
+    m."message",
+    m."created_at",
+    COUNT(r."id") AS report_count,
+    array_agg(r."reason" ORDER BY r."created_at")::text[] AS reasons,
+    MAX(r."created_at")::timestamptz AS last_reported_at
+FROM message_reports r
+JOIN messages m ON m."id" = r."message_id"
+WHERE
+    m."room_id" = $1
+    AND m."deleted_at" IS NULL
+GROUP BY m."id"
+ORDER BY report_count DESC, last_reported_at DESC
+`
+
+type GetRoomReportedMessagesRow struct {
+	ID             uuid.UUID
+	Message        string
+	CreatedAt      time.Time
+	ReportCount    int64
+	Reasons        []string
+	LastReportedAt time.Time
+}
+
+func (q *Queries) GetRoomReportedMessages(ctx context.Context, roomID uuid.UUID) ([]GetRoomReportedMessagesRow, error) {
+	rows, err := q.db.Query(ctx, getRoomReportedMessages, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRoomReportedMessagesRow
+	for rows.Next() {
+		var i GetRoomReportedMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Message,
+			&i.CreatedAt,
+			&i.ReportCount,
+			&i.Reasons,
+			&i.LastReportedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomStats = `-- name: GetRoomStats :one
+SELECT
+    COUNT(*) AS message_count,
+    COUNT(*) FILTER (WHERE answered) AS answered_count,
+    COALESCE(SUM(reaction_count), 0)::bigint AS reaction_count
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+    AND parent_message_id IS NULL
+`
+
+type GetRoomStatsRow struct {
+	MessageCount  int64
+	AnsweredCount int64
+	ReactionCount int64
+}
+
+func (q *Queries) GetRoomStats(ctx context.Context, roomID uuid.UUID) (GetRoomStatsRow, error) {
+	row := q.db.QueryRow(ctx, getRoomStats, roomID)
+	var i GetRoomStatsRow
+	err := row.Scan(&i.MessageCount, &i.AnsweredCount, &i.ReactionCount)
+	return i, err
+}
+
+const getRooms = `-- name: GetRooms :many
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND ($1::text IS NULL OR "theme" ILIKE '%' || $1 || '%')
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT $3 OFFSET $2
+`
+
+type GetRoomsParams struct {
+	Query  pgtype.Text
+	Offset int32
+	Limit  int32
+}
+
+func (q *Queries) GetRooms(ctx context.Context, arg GetRoomsParams) ([]Room, error) {
+	rows, err := q.db.Query(ctx, getRooms, arg.Query, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Room
+	for rows.Next() {
+		var i Room
+		if err := rows.Scan(
+			&i.ID,
+			&i.Theme,
+			&i.CreatedAt,
+			&i.Closed,
+			&i.ExpiresAt,
+			&i.Code,
+			&i.Private,
+			&i.AccessCodeHash,
+			&i.Description,
+			&i.HostName,
+			&i.Tags,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.Live,
+			&i.HostTokenHash,
+			&i.Moderated,
+			&i.ContentFilter,
+			&i.ChangeSeq,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomsAfterCursor = `-- name: GetRoomsAfterCursor :many
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND ($1::text IS NULL OR "theme" ILIKE '%' || $1 || '%')
+    AND ("created_at", "id") > ($2::timestamptz, $3::uuid)
+ORDER BY "created_at" ASC, "id" ASC
+LIMIT $4
+`
+
+type GetRoomsAfterCursorParams struct {
+	Query           pgtype.Text
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) GetRoomsAfterCursor(ctx context.Context, arg GetRoomsAfterCursorParams) ([]Room, error) {
+	rows, err := q.db.Query(ctx, getRoomsAfterCursor,
+		arg.Query,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Room
+	for rows.Next() {
+		var i Room
+		if err := rows.Scan(
+			&i.ID,
+			&i.Theme,
+			&i.CreatedAt,
+			&i.Closed,
+			&i.ExpiresAt,
+			&i.Code,
+			&i.Private,
+			&i.AccessCodeHash,
+			&i.Description,
+			&i.HostName,
+			&i.Tags,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.Live,
+			&i.HostTokenHash,
+			&i.Moderated,
+			&i.ContentFilter,
+			&i.ChangeSeq,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomsBeforeCursor = `-- name: GetRoomsBeforeCursor :many
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND ($1::text IS NULL OR "theme" ILIKE '%' || $1 || '%')
+    AND ("created_at", "id") < ($2::timestamptz, $3::uuid)
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT $4
+`
+
+type GetRoomsBeforeCursorParams struct {
+	Query           pgtype.Text
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) GetRoomsBeforeCursor(ctx context.Context, arg GetRoomsBeforeCursorParams) ([]Room, error) {
+	rows, err := q.db.Query(ctx, getRoomsBeforeCursor,
+		arg.Query,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Room
+	for rows.Next() {
+		var i Room
+		if err := rows.Scan(
+			&i.ID,
+			&i.Theme,
+			&i.CreatedAt,
+			&i.Closed,
+			&i.ExpiresAt,
+			&i.Code,
+			&i.Private,
+			&i.AccessCodeHash,
+			&i.Description,
+			&i.HostName,
+			&i.Tags,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.Live,
+			&i.HostTokenHash,
+			&i.Moderated,
+			&i.ContentFilter,
+			&i.ChangeSeq,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomsOldest = `-- name: GetRoomsOldest :many
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND ($1::text IS NULL OR "theme" ILIKE '%' || $1 || '%')
+ORDER BY "created_at" ASC, "id" ASC
+LIMIT $3 OFFSET $2
+`
+
+type GetRoomsOldestParams struct {
+	Query  pgtype.Text
+	Offset int32
+	Limit  int32
+}
+
+func (q *Queries) GetRoomsOldest(ctx context.Context, arg GetRoomsOldestParams) ([]Room, error) {
+	rows, err := q.db.Query(ctx, getRoomsOldest, arg.Query, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Room
+	for rows.Next() {
+		var i Room
+		if err := rows.Scan(
+			&i.ID,
+			&i.Theme,
+			&i.CreatedAt,
+			&i.Closed,
+			&i.ExpiresAt,
+			&i.Code,
+			&i.Private,
+			&i.AccessCodeHash,
+			&i.Description,
+			&i.HostName,
+			&i.Tags,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.Live,
+			&i.HostTokenHash,
+			&i.Moderated,
+			&i.ContentFilter,
+			&i.ChangeSeq,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopRoomMessages = `-- name: GetTopRoomMessages :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND answered = false
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+    AND parent_message_id IS NULL
+ORDER BY "reaction_count" DESC, "created_at" ASC, "id" ASC
+LIMIT $3
+`
+
+type GetTopRoomMessagesParams struct {
+	RoomID   uuid.UUID
+	ViewerID uuid.NullUUID
+	Limit    int32
+}
+
+func (q *Queries) GetTopRoomMessages(ctx context.Context, arg GetTopRoomMessagesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getTopRoomMessages, arg.RoomID, arg.ViewerID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertAuditLogEntry = `-- name: InsertAuditLogEntry :exec
+INSERT INTO audit_log
+    ( "room_id", "actor", "participant_id", "ip", "action", "target_id" ) VALUES
+    ( $1, $2, $3, $4, $5, $6 )
+`
+
+type InsertAuditLogEntryParams struct {
+	RoomID        uuid.UUID
+	Actor         string
+	ParticipantID uuid.NullUUID
+	Ip            pgtype.Text
+	Action        string
+	TargetID      uuid.NullUUID
+}
+
+func (q *Queries) InsertAuditLogEntry(ctx context.Context, arg InsertAuditLogEntryParams) error {
+	_, err := q.db.Exec(ctx, insertAuditLogEntry,
+		arg.RoomID,
+		arg.Actor,
+		arg.ParticipantID,
+		arg.Ip,
+		arg.Action,
+		arg.TargetID,
+	)
+	return err
+}
+
+const insertMessage = `-- name: InsertMessage :one
+INSERT INTO messages
+    ( "room_id", "message", "parent_message_id", "approved", "participant_id" ) VALUES
+    ( $1, $2, $3, $4, $5 )
+RETURNING "id"
+`
+
+type InsertMessageParams struct {
+	RoomID          uuid.UUID
+	Message         string
+	ParentMessageID uuid.NullUUID
+	Approved        bool
+	ParticipantID   uuid.NullUUID
+}
+
+func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertMessage,
+		arg.RoomID,
+		arg.Message,
+		arg.ParentMessageID,
+		arg.Approved,
+		arg.ParticipantID,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertMessageReport = `-- name: InsertMessageReport :execrows
+INSERT INTO message_reports
+    ( "message_id", "participant_id", "reason" ) VALUES
+    ( $1, $2, $3 )
+ON CONFLICT ("message_id", "participant_id") DO NOTHING
 `
 
-func (q *Queries) GetMessage(ctx context.Context, id uuid.UUID) (Message, error) {
-	row := q.db.QueryRow(ctx, getMessage, id)
-	var i Message
+type InsertMessageReportParams struct {
+	MessageID     uuid.UUID
+	ParticipantID uuid.UUID
+	Reason        string
+}
+
+func (q *Queries) InsertMessageReport(ctx context.Context, arg InsertMessageReportParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertMessageReport, arg.MessageID, arg.ParticipantID, arg.Reason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const insertRoom = `-- name: InsertRoom :one
+INSERT INTO rooms
+    ( "theme", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter" ) VALUES
+    ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14 )
+RETURNING "id"
+`
+
+type InsertRoomParams struct {
+	Theme          string
+	ExpiresAt      pgtype.Timestamptz
+	Code           string
+	Private        bool
+	AccessCodeHash pgtype.Text
+	Description    string
+	HostName       string
+	Tags           []string
+	StartsAt       pgtype.Timestamptz
+	EndsAt         pgtype.Timestamptz
+	Live           bool
+	HostTokenHash  pgtype.Text
+	Moderated      bool
+	ContentFilter  bool
+}
+
+func (q *Queries) InsertRoom(ctx context.Context, arg InsertRoomParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertRoom,
+		arg.Theme,
+		arg.ExpiresAt,
+		arg.Code,
+		arg.Private,
+		arg.AccessCodeHash,
+		arg.Description,
+		arg.HostName,
+		arg.Tags,
+		arg.StartsAt,
+		arg.EndsAt,
+		arg.Live,
+		arg.HostTokenHash,
+		arg.Moderated,
+		arg.ContentFilter,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertRoomBan = `-- name: InsertRoomBan :one
+INSERT INTO room_bans
+    ( "room_id", "participant_id", "ip", "reason" ) VALUES
+    ( $1, $2, $3, $4 )
+RETURNING "id", "room_id", "participant_id", "ip", "reason", "created_at"
+`
+
+type InsertRoomBanParams struct {
+	RoomID        uuid.UUID
+	ParticipantID uuid.NullUUID
+	Ip            pgtype.Text
+	Reason        string
+}
+
+func (q *Queries) InsertRoomBan(ctx context.Context, arg InsertRoomBanParams) (RoomBan, error) {
+	row := q.db.QueryRow(ctx, insertRoomBan,
+		arg.RoomID,
+		arg.ParticipantID,
+		arg.Ip,
+		arg.Reason,
+	)
+	var i RoomBan
 	err := row.Scan(
 		&i.ID,
 		&i.RoomID,
-		&i.Message,
-		&i.ReactionCount,
-		&i.Answered,
+		&i.ParticipantID,
+		&i.Ip,
+		&i.Reason,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const getRoom = `-- name: GetRoom :one
-SELECT
-    "id", "theme"
-FROM rooms
-WHERE id = $1
+const isBannedFromRoom = `-- name: IsBannedFromRoom :one
+SELECT EXISTS (
+    SELECT 1
+    FROM room_bans
+    WHERE
+        room_id = $1
+        AND (
+            participant_id = $2
+            OR ip = $3
+        )
+) AS banned
 `
 
-func (q *Queries) GetRoom(ctx context.Context, id uuid.UUID) (Room, error) {
-	row := q.db.QueryRow(ctx, getRoom, id)
-	var i Room
-	err := row.Scan(&i.ID, &i.Theme)
+type IsBannedFromRoomParams struct {
+	RoomID        uuid.UUID
+	ParticipantID uuid.NullUUID
+	Ip            pgtype.Text
+}
+
+func (q *Queries) IsBannedFromRoom(ctx context.Context, arg IsBannedFromRoomParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isBannedFromRoom, arg.RoomID, arg.ParticipantID, arg.Ip)
+	var banned bool
+	err := row.Scan(&banned)
+	return banned, err
+}
+
+const lockMessage = `-- name: LockMessage :exec
+SELECT 1 FROM messages WHERE id = $1 FOR NO KEY UPDATE
+`
+
+// Reactions to the message wait on the lock until the transaction that
+// holds it ends, as the trigger counting them would.
+func (q *Queries) LockMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, lockMessage, id)
+	return err
+}
+
+const markMessageAsAnswered = `-- name: MarkMessageAsAnswered :one
+UPDATE messages
+SET
+    answered = true,
+    answer = COALESCE($1, answer)
+WHERE
+    id = $2
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+`
+
+type MarkMessageAsAnsweredParams struct {
+	Answer pgtype.Text
+	ID     uuid.UUID
+}
+
+func (q *Queries) MarkMessageAsAnswered(ctx context.Context, arg MarkMessageAsAnsweredParams) (Message, error) {
+	row := q.db.QueryRow(ctx, markMessageAsAnswered, arg.Answer, arg.ID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		&i.CreatedAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		&i.UpdatedAt,
+		&i.ChangeSeq,
+	)
 	return i, err
 }
 
-const getRoomMessages = `-- name: GetRoomMessages :many
-SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
-FROM messages
+const markMessagesAsAnswered = `-- name: MarkMessagesAsAnswered :many
+UPDATE messages
+SET
+    answered = true
 WHERE
     room_id = $1
+    AND id = ANY($2::uuid[])
+    AND deleted_at IS NULL
+    AND answered = false
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
 `
 
-func (q *Queries) GetRoomMessages(ctx context.Context, roomID uuid.UUID) ([]Message, error) {
-	rows, err := q.db.Query(ctx, getRoomMessages, roomID)
+type MarkMessagesAsAnsweredParams struct {
+	RoomID uuid.UUID
+	Ids    []uuid.UUID
+}
+
+func (q *Queries) MarkMessagesAsAnswered(ctx context.Context, arg MarkMessagesAsAnsweredParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, markMessagesAsAnswered, arg.RoomID, arg.Ids)
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +1892,19 @@ func (q *Queries) GetRoomMessages(ctx context.Context, roomID uuid.UUID) ([]Mess
 			&i.Message,
 			&i.ReactionCount,
 			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
 		); err != nil {
 			return nil, err
 		}
@@ -80,22 +1916,264 @@ func (q *Queries) GetRoomMessages(ctx context.Context, roomID uuid.UUID) ([]Mess
 	return items, nil
 }
 
-const getRooms = `-- name: GetRooms :many
+const mergeMessages = `-- name: MergeMessages :execrows
+WITH moved AS (
+    DELETE FROM message_reactions
+    WHERE
+        message_id = $2
+        AND EXISTS (
+            SELECT 1 FROM messages WHERE id = $2 AND deleted_at IS NULL
+        )
+    RETURNING participant_id, type, created_at
+), inserted AS (
+    INSERT INTO message_reactions ("message_id", "participant_id", "type", "created_at")
+    SELECT $1::uuid, participant_id, type, created_at
+    FROM moved
+    ON CONFLICT ("message_id", "participant_id") DO NOTHING
+)
+UPDATE messages
+SET
+    deleted_at = now(),
+    merged_into_id = $1::uuid
+WHERE
+    messages.id = $2
+    AND messages.deleted_at IS NULL
+`
+
+type MergeMessagesParams struct {
+	TargetID    uuid.UUID
+	DuplicateID uuid.UUID
+}
+
+func (q *Queries) MergeMessages(ctx context.Context, arg MergeMessagesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, mergeMessages, arg.TargetID, arg.DuplicateID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const openScheduledRooms = `-- name: OpenScheduledRooms :many
+UPDATE rooms
+SET
+    live = true
+WHERE
+    live = false
+    AND deleted_at IS NULL
+    AND starts_at <= now()
+RETURNING "id"
+`
+
+func (q *Queries) OpenScheduledRooms(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, openScheduledRooms)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedMessages = `-- name: PurgeDeletedMessages :execrows
+DELETE FROM messages
+WHERE deleted_at < $1::timestamptz
+`
+
+func (q *Queries) PurgeDeletedMessages(ctx context.Context, deletedAt time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDeletedMessages, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeDeletedRooms = `-- name: PurgeDeletedRooms :execrows
+DELETE FROM rooms
+WHERE deleted_at < $1::timestamptz
+`
+
+func (q *Queries) PurgeDeletedRooms(ctx context.Context, deletedAt time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDeletedRooms, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const reactToMessage = `-- name: ReactToMessage :one
+WITH reaction AS (
+    INSERT INTO message_reactions ("message_id", "participant_id", "type")
+    SELECT $1::uuid, $2::uuid, $3::text
+    WHERE EXISTS (
+        SELECT 1 FROM messages WHERE id = $1 AND deleted_at IS NULL
+    )
+    ON CONFLICT ("message_id", "participant_id") DO NOTHING
+    RETURNING type
+)
 SELECT
-    "id", "theme"
-FROM rooms
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = $1) + 1)::bigint AS reaction_count,
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = $1 AND r.type = reaction.type) + 1)::bigint AS count
+FROM reaction
+`
+
+type ReactToMessageParams struct {
+	ID            uuid.UUID
+	ParticipantID uuid.UUID
+	Type          string
+}
+
+type ReactToMessageRow struct {
+	ReactionCount int64
+	Count         int64
+}
+
+// The counts are read on the snapshot the statement started from, which
+// does not have the new reaction yet. They are only current when the
+// transaction took LockMessage before, as store.Postgres does.
+func (q *Queries) ReactToMessage(ctx context.Context, arg ReactToMessageParams) (ReactToMessageRow, error) {
+	row := q.db.QueryRow(ctx, reactToMessage, arg.ID, arg.ParticipantID, arg.Type)
+	var i ReactToMessageRow
+	err := row.Scan(&i.ReactionCount, &i.Count)
+	return i, err
+}
+
+const removeReactionFromMessage = `-- name: RemoveReactionFromMessage :one
+WITH reaction AS (
+    DELETE FROM message_reactions
+    WHERE
+        message_reactions.message_id = $1
+        AND message_reactions.participant_id = $2
+        AND EXISTS (
+            SELECT 1 FROM messages WHERE id = $1 AND deleted_at IS NULL
+        )
+    RETURNING type
+)
+SELECT
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = $1) - 1)::bigint AS reaction_count,
+    reaction.type::text AS type,
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = $1 AND r.type = reaction.type) - 1)::bigint AS count
+FROM reaction
+`
+
+type RemoveReactionFromMessageParams struct {
+	ID            uuid.UUID
+	ParticipantID uuid.UUID
+}
+
+type RemoveReactionFromMessageRow struct {
+	ReactionCount int64
+	Type          string
+	Count         int64
+}
+
+// The counts are read on the snapshot the statement started from, which
+// still has the removed reaction. They are only current when the
+// transaction took LockMessage before, as store.Postgres does.
+func (q *Queries) RemoveReactionFromMessage(ctx context.Context, arg RemoveReactionFromMessageParams) (RemoveReactionFromMessageRow, error) {
+	row := q.db.QueryRow(ctx, removeReactionFromMessage, arg.ID, arg.ParticipantID)
+	var i RemoveReactionFromMessageRow
+	err := row.Scan(&i.ReactionCount, &i.Type, &i.Count)
+	return i, err
+}
+
+const reserveIdempotencyKey = `-- name: ReserveIdempotencyKey :execrows
+INSERT INTO idempotency_keys
+    ( "caller", "key", "method", "path", "request_hash" ) VALUES
+    ( $1, $2, $3, $4, $5 )
+ON CONFLICT ("caller", "key", "method", "path") DO NOTHING
 `
 
-func (q *Queries) GetRooms(ctx context.Context) ([]Room, error) {
-	rows, err := q.db.Query(ctx, getRooms)
+type ReserveIdempotencyKeyParams struct {
+	Caller      string
+	Key         string
+	Method      string
+	Path        string
+	RequestHash string
+}
+
+func (q *Queries) ReserveIdempotencyKey(ctx context.Context, arg ReserveIdempotencyKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, reserveIdempotencyKey,
+		arg.Caller,
+		arg.Key,
+		arg.Method,
+		arg.Path,
+		arg.RequestHash,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const searchRoomMessages = `-- name: SearchRoomMessages :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND parent_message_id IS NULL
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = $2)
+    AND to_tsvector('simple', "message") @@ websearch_to_tsquery('simple', $3::text)
+ORDER BY
+    ts_rank(to_tsvector('simple', "message"), websearch_to_tsquery('simple', $3::text)) DESC,
+    "created_at" ASC,
+    "id" ASC
+LIMIT $4
+`
+
+type SearchRoomMessagesParams struct {
+	RoomID   uuid.UUID
+	ViewerID uuid.NullUUID
+	Query    string
+	Limit    int32
+}
+
+func (q *Queries) SearchRoomMessages(ctx context.Context, arg SearchRoomMessagesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, searchRoomMessages,
+		arg.RoomID,
+		arg.ViewerID,
+		arg.Query,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Room
+	var items []Message
 	for rows.Next() {
-		var i Room
-		if err := rows.Scan(&i.ID, &i.Theme); err != nil {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ParentMessageID,
+			&i.Answer,
+			&i.Pinned,
+			&i.MergedIntoID,
+			&i.AttachmentUrl,
+			&i.Approved,
+			&i.ParticipantID,
+			&i.Hidden,
+			&i.UpdatedAt,
+			&i.ChangeSeq,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -106,80 +2184,224 @@ func (q *Queries) GetRooms(ctx context.Context) ([]Room, error) {
 	return items, nil
 }
 
-const insertMessage = `-- name: InsertMessage :one
-INSERT INTO messages
-    ( "room_id", "message" ) VALUES
-    ( $1, $2 )
-RETURNING "id"
+const setMessageAttachment = `-- name: SetMessageAttachment :one
+UPDATE messages
+SET
+    attachment_url = $2
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
 `
 
-type InsertMessageParams struct {
-	RoomID  uuid.UUID
-	Message string
+type SetMessageAttachmentParams struct {
+	ID            uuid.UUID
+	AttachmentUrl pgtype.Text
 }
 
-func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertMessage, arg.RoomID, arg.Message)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) SetMessageAttachment(ctx context.Context, arg SetMessageAttachmentParams) (Message, error) {
+	row := q.db.QueryRow(ctx, setMessageAttachment, arg.ID, arg.AttachmentUrl)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		&i.CreatedAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		&i.UpdatedAt,
+		&i.ChangeSeq,
+	)
+	return i, err
 }
 
-const insertRoom = `-- name: InsertRoom :one
-INSERT INTO rooms
-    ( "theme" ) VALUES
-    ( $1 )
-RETURNING "id"
+const setMessageHidden = `-- name: SetMessageHidden :one
+UPDATE messages
+SET
+    hidden = $2
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
 `
 
-func (q *Queries) InsertRoom(ctx context.Context, theme string) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertRoom, theme)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+type SetMessageHiddenParams struct {
+	ID     uuid.UUID
+	Hidden bool
+}
+
+func (q *Queries) SetMessageHidden(ctx context.Context, arg SetMessageHiddenParams) (Message, error) {
+	row := q.db.QueryRow(ctx, setMessageHidden, arg.ID, arg.Hidden)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		&i.CreatedAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		&i.UpdatedAt,
+		&i.ChangeSeq,
+	)
+	return i, err
 }
 
-const markMessageAsAnswered = `-- name: MarkMessageAsAnswered :exec
+const setMessagePinned = `-- name: SetMessagePinned :one
 UPDATE messages
 SET
-    answered = true
+    pinned = $2
 WHERE
     id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
 `
 
-func (q *Queries) MarkMessageAsAnswered(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.Exec(ctx, markMessageAsAnswered, id)
-	return err
+type SetMessagePinnedParams struct {
+	ID     uuid.UUID
+	Pinned bool
 }
 
-const reactToMessage = `-- name: ReactToMessage :one
+func (q *Queries) SetMessagePinned(ctx context.Context, arg SetMessagePinnedParams) (Message, error) {
+	row := q.db.QueryRow(ctx, setMessagePinned, arg.ID, arg.Pinned)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		&i.CreatedAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		&i.UpdatedAt,
+		&i.ChangeSeq,
+	)
+	return i, err
+}
+
+const softDeleteMessage = `-- name: SoftDeleteMessage :exec
 UPDATE messages
 SET
-    reaction_count = reaction_count + 1
+    deleted_at = now()
 WHERE
     id = $1
-RETURNING reaction_count
+    AND deleted_at IS NULL
 `
 
-func (q *Queries) ReactToMessage(ctx context.Context, id uuid.UUID) (int64, error) {
-	row := q.db.QueryRow(ctx, reactToMessage, id)
-	var reaction_count int64
-	err := row.Scan(&reaction_count)
-	return reaction_count, err
+func (q *Queries) SoftDeleteMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, softDeleteMessage, id)
+	return err
 }
 
-const removeReactionFromMessage = `-- name: RemoveReactionFromMessage :one
+const updateMessage = `-- name: UpdateMessage :one
 UPDATE messages
 SET
-    reaction_count = reaction_count - 1
+    message = $2,
+    edited_at = now()
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+`
+
+type UpdateMessageParams struct {
+	ID      uuid.UUID
+	Message string
+}
+
+func (q *Queries) UpdateMessage(ctx context.Context, arg UpdateMessageParams) (Message, error) {
+	row := q.db.QueryRow(ctx, updateMessage, arg.ID, arg.Message)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		&i.CreatedAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		&i.UpdatedAt,
+		&i.ChangeSeq,
+	)
+	return i, err
+}
+
+const updateRoomTheme = `-- name: UpdateRoomTheme :one
+UPDATE rooms
+SET
+    theme = $2
 WHERE
     id = $1
-RETURNING reaction_count
+    AND deleted_at IS NULL
+RETURNING "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
 `
 
-func (q *Queries) RemoveReactionFromMessage(ctx context.Context, id uuid.UUID) (int64, error) {
-	row := q.db.QueryRow(ctx, removeReactionFromMessage, id)
-	var reaction_count int64
-	err := row.Scan(&reaction_count)
-	return reaction_count, err
+type UpdateRoomThemeParams struct {
+	ID    uuid.UUID
+	Theme string
+}
+
+func (q *Queries) UpdateRoomTheme(ctx context.Context, arg UpdateRoomThemeParams) (Room, error) {
+	row := q.db.QueryRow(ctx, updateRoomTheme, arg.ID, arg.Theme)
+	var i Room
+	err := row.Scan(
+		&i.ID,
+		&i.Theme,
+		&i.CreatedAt,
+		&i.Closed,
+		&i.ExpiresAt,
+		&i.Code,
+		&i.Private,
+		&i.AccessCodeHash,
+		&i.Description,
+		&i.HostName,
+		&i.Tags,
+		&i.StartsAt,
+		&i.EndsAt,
+		&i.Live,
+		&i.HostTokenHash,
+		&i.Moderated,
+		&i.ContentFilter,
+		&i.ChangeSeq,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
 }
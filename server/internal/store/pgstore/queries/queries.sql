@@ -1,59 +1,617 @@
 -- name: GetRoom :one
 SELECT
-    "id", "theme"
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
 FROM rooms
-WHERE id = $1;
+WHERE
+    id = $1
+    AND deleted_at IS NULL;
+
+-- name: GetRoomByCode :one
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    code = $1
+    AND deleted_at IS NULL;
 
 -- name: GetRooms :many
 SELECT
-    "id", "theme"
-FROM rooms;
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND (sqlc.narg('query')::text IS NULL OR "theme" ILIKE '%' || sqlc.narg('query') || '%')
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetRoomsOldest :many
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND (sqlc.narg('query')::text IS NULL OR "theme" ILIKE '%' || sqlc.narg('query') || '%')
+ORDER BY "created_at" ASC, "id" ASC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetRoomsBeforeCursor :many
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND (sqlc.narg('query')::text IS NULL OR "theme" ILIKE '%' || sqlc.narg('query') || '%')
+    AND ("created_at", "id") < (sqlc.arg('cursor_created_at')::timestamptz, sqlc.arg('cursor_id')::uuid)
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetRoomsAfterCursor :many
+SELECT
+    "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND (sqlc.narg('query')::text IS NULL OR "theme" ILIKE '%' || sqlc.narg('query') || '%')
+    AND ("created_at", "id") > (sqlc.arg('cursor_created_at')::timestamptz, sqlc.arg('cursor_id')::uuid)
+ORDER BY "created_at" ASC, "id" ASC
+LIMIT sqlc.arg('limit');
+
+-- name: CountRooms :one
+SELECT
+    COUNT(*)
+FROM rooms
+WHERE
+    deleted_at IS NULL
+    AND (sqlc.narg('query')::text IS NULL OR "theme" ILIKE '%' || sqlc.narg('query') || '%');
+
+-- name: GetRoomMessageCounts :many
+SELECT
+    "room_id", COUNT(*) AS "message_count"
+FROM messages
+WHERE
+    room_id = ANY(sqlc.arg('room_ids')::uuid[])
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+GROUP BY "room_id";
+
+-- name: GetPublicRoomIDs :many
+SELECT "id" FROM rooms
+WHERE
+    id = ANY(sqlc.arg('ids')::uuid[])
+    AND private = false
+    AND deleted_at IS NULL;
 
 -- name: InsertRoom :one
 INSERT INTO rooms
-    ( "theme" ) VALUES
-    ( $1 )
+    ( "theme", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter" ) VALUES
+    ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14 )
+RETURNING "id";
+
+-- name: CloseRoom :exec
+UPDATE rooms
+SET
+    closed = true
+WHERE
+    id = $1
+    AND deleted_at IS NULL;
+
+-- name: CloseExpiredRooms :many
+UPDATE rooms
+SET
+    closed = true
+WHERE
+    closed = false
+    AND deleted_at IS NULL
+    AND (expires_at <= now() OR ends_at <= now())
+RETURNING "id";
+
+-- name: OpenScheduledRooms :many
+UPDATE rooms
+SET
+    live = true
+WHERE
+    live = false
+    AND deleted_at IS NULL
+    AND starts_at <= now()
 RETURNING "id";
 
+-- name: DeleteRoom :exec
+UPDATE rooms
+SET
+    deleted_at = now()
+WHERE
+    id = $1
+    AND deleted_at IS NULL;
+
+-- name: PurgeDeletedRooms :execrows
+DELETE FROM rooms
+WHERE deleted_at < sqlc.arg('deleted_at')::timestamptz;
+
+-- name: UpdateRoomTheme :one
+UPDATE rooms
+SET
+    theme = $2
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at";
+
 -- name: GetMessage :one
 SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
 FROM messages
 WHERE
-    id = $1;
+    id = $1
+    AND deleted_at IS NULL;
 
 -- name: GetRoomMessages :many
 SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+    AND parent_message_id IS NULL
+    AND (sqlc.narg('answered')::boolean IS NULL OR answered = sqlc.narg('answered'))
+ORDER BY NOT "pinned", "created_at", "id"
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetRoomMessagesAfterCursor :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+    AND parent_message_id IS NULL
+    AND (sqlc.narg('answered')::boolean IS NULL OR answered = sqlc.narg('answered'))
+    AND (NOT "pinned", "created_at", "id") > (NOT sqlc.arg('cursor_pinned')::boolean, sqlc.arg('cursor_created_at')::timestamptz, sqlc.arg('cursor_id')::uuid)
+ORDER BY NOT "pinned", "created_at", "id"
+LIMIT sqlc.arg('limit');
+
+-- name: GetRoomMessagesNewest :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+    AND parent_message_id IS NULL
+    AND (sqlc.narg('answered')::boolean IS NULL OR answered = sqlc.narg('answered'))
+ORDER BY "pinned" DESC, "created_at" DESC, "id" DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetRoomMessagesBeforeCursor :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+    AND parent_message_id IS NULL
+    AND (sqlc.narg('answered')::boolean IS NULL OR answered = sqlc.narg('answered'))
+    AND ("pinned", "created_at", "id") < (sqlc.arg('cursor_pinned')::boolean, sqlc.arg('cursor_created_at')::timestamptz, sqlc.arg('cursor_id')::uuid)
+ORDER BY "pinned" DESC, "created_at" DESC, "id" DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetRoomMessagesMostReacted :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+    AND parent_message_id IS NULL
+    AND (sqlc.narg('answered')::boolean IS NULL OR answered = sqlc.narg('answered'))
+ORDER BY "pinned" DESC, "reaction_count" DESC, "created_at" ASC, "id" ASC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetTopRoomMessages :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND answered = false
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+    AND parent_message_id IS NULL
+ORDER BY "reaction_count" DESC, "created_at" ASC, "id" ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetRoomMessagesForExport :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND deleted_at IS NULL
+    AND ("created_at", "id") > (sqlc.arg('cursor_created_at')::timestamptz, sqlc.arg('cursor_id')::uuid)
+ORDER BY "created_at" ASC, "id" ASC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchRoomMessages :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND parent_message_id IS NULL
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+    AND to_tsvector('simple', "message") @@ websearch_to_tsquery('simple', sqlc.arg('query')::text)
+ORDER BY
+    ts_rank(to_tsvector('simple', "message"), websearch_to_tsquery('simple', sqlc.arg('query')::text)) DESC,
+    "created_at" ASC,
+    "id" ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetMessageReplies :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
 FROM messages
 WHERE
-    room_id = $1;
+    parent_message_id = sqlc.arg('parent_message_id')
+    AND deleted_at IS NULL
+    AND approved = true
+    AND (hidden = false OR participant_id = sqlc.narg('viewer_id'))
+ORDER BY "created_at" ASC, "id" ASC;
 
 -- name: InsertMessage :one
 INSERT INTO messages
-    ( "room_id", "message" ) VALUES
-    ( $1, $2 )
+    ( "room_id", "message", "parent_message_id", "approved", "participant_id" ) VALUES
+    ( $1, $2, $3, $4, $5 )
 RETURNING "id";
 
--- name: ReactToMessage :one
+-- name: UpdateMessage :one
 UPDATE messages
 SET
-    reaction_count = reaction_count + 1
+    message = $2,
+    edited_at = now()
 WHERE
     id = $1
-RETURNING reaction_count;
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq";
 
--- name: RemoveReactionFromMessage :one
+-- name: SoftDeleteMessage :exec
 UPDATE messages
 SET
-    reaction_count = reaction_count - 1
+    deleted_at = now()
 WHERE
     id = $1
-RETURNING reaction_count;
+    AND deleted_at IS NULL;
+
+-- name: PurgeDeletedMessages :execrows
+DELETE FROM messages
+WHERE deleted_at < sqlc.arg('deleted_at')::timestamptz;
+
+-- name: SetMessagePinned :one
+UPDATE messages
+SET
+    pinned = $2
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq";
+
+-- name: FindSimilarMessages :many
+SELECT
+    "id", "message", similarity("message", sqlc.arg('message')::text) AS "similarity"
+FROM messages
+WHERE
+    room_id = sqlc.arg('room_id')
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+    AND parent_message_id IS NULL
+    AND id <> sqlc.arg('exclude_id')
+    AND "message" % sqlc.arg('message')::text
+ORDER BY "similarity" DESC
+LIMIT 5;
+
+-- name: MergeMessages :execrows
+WITH moved AS (
+    DELETE FROM message_reactions
+    WHERE
+        message_id = sqlc.arg('duplicate_id')
+        AND EXISTS (
+            SELECT 1 FROM messages WHERE id = sqlc.arg('duplicate_id') AND deleted_at IS NULL
+        )
+    RETURNING participant_id, type, created_at
+), inserted AS (
+    INSERT INTO message_reactions ("message_id", "participant_id", "type", "created_at")
+    SELECT sqlc.arg('target_id')::uuid, participant_id, type, created_at
+    FROM moved
+    ON CONFLICT ("message_id", "participant_id") DO NOTHING
+)
+UPDATE messages
+SET
+    deleted_at = now(),
+    merged_into_id = sqlc.arg('target_id')::uuid
+WHERE
+    messages.id = sqlc.arg('duplicate_id')
+    AND messages.deleted_at IS NULL;
 
--- name: MarkMessageAsAnswered :exec
+-- name: ApproveMessage :one
+UPDATE messages
+SET
+    approved = true
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq";
+
+-- name: GetRoomPendingMessages :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"
+FROM messages
+WHERE
+    room_id = $1
+    AND approved = false
+    AND deleted_at IS NULL
+ORDER BY "created_at" ASC, "id" ASC;
+
+-- name: SetMessageHidden :one
+UPDATE messages
+SET
+    hidden = $2
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq";
+
+-- name: SetMessageAttachment :one
+UPDATE messages
+SET
+    attachment_url = $2
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq";
+
+-- name: LockMessage :exec
+-- Reactions to the message wait on the lock until the transaction that
+-- holds it ends, as the trigger counting them would.
+SELECT 1 FROM messages WHERE id = $1 FOR NO KEY UPDATE;
+
+-- name: ReactToMessage :one
+WITH reaction AS (
+    INSERT INTO message_reactions ("message_id", "participant_id", "type")
+    SELECT sqlc.arg('id')::uuid, sqlc.arg('participant_id')::uuid, sqlc.arg('type')::text
+    WHERE EXISTS (
+        SELECT 1 FROM messages WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+    )
+    ON CONFLICT ("message_id", "participant_id") DO NOTHING
+    RETURNING type
+)
+-- The counts are read on the snapshot the statement started from, which
+-- does not have the new reaction yet. They are only current when the
+-- transaction took LockMessage before, as store.Postgres does.
+SELECT
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = sqlc.arg('id')) + 1)::bigint AS reaction_count,
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = sqlc.arg('id') AND r.type = reaction.type) + 1)::bigint AS count
+FROM reaction;
+
+-- name: RemoveReactionFromMessage :one
+WITH reaction AS (
+    DELETE FROM message_reactions
+    WHERE
+        message_reactions.message_id = sqlc.arg('id')
+        AND message_reactions.participant_id = sqlc.arg('participant_id')
+        AND EXISTS (
+            SELECT 1 FROM messages WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+        )
+    RETURNING type
+)
+-- The counts are read on the snapshot the statement started from, which
+-- still has the removed reaction. They are only current when the
+-- transaction took LockMessage before, as store.Postgres does.
+SELECT
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = sqlc.arg('id')) - 1)::bigint AS reaction_count,
+    reaction.type::text AS type,
+    ((SELECT count(*) FROM message_reactions r WHERE r.message_id = sqlc.arg('id') AND r.type = reaction.type) - 1)::bigint AS count
+FROM reaction;
+
+-- name: GetMessagesReactions :many
+SELECT
+    "message_id", "type", count(*) AS count
+FROM message_reactions
+WHERE message_id = ANY(sqlc.arg('message_ids')::uuid[])
+GROUP BY message_id, type
+ORDER BY message_id, count DESC, type;
+
+-- name: MarkMessageAsAnswered :one
+UPDATE messages
+SET
+    answered = true,
+    answer = COALESCE(sqlc.narg('answer'), answer)
+WHERE
+    id = sqlc.arg('id')
+    AND deleted_at IS NULL
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq";
+
+-- name: MarkMessagesAsAnswered :many
 UPDATE messages
 SET
     answered = true
 WHERE
-    id = $1;
\ No newline at end of file
+    room_id = sqlc.arg('room_id')
+    AND id = ANY(sqlc.arg('ids')::uuid[])
+    AND deleted_at IS NULL
+    AND answered = false
+RETURNING "id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq";
+
+-- name: ReserveIdempotencyKey :execrows
+INSERT INTO idempotency_keys
+    ( "caller", "key", "method", "path", "request_hash" ) VALUES
+    ( $1, $2, $3, $4, $5 )
+ON CONFLICT ("caller", "key", "method", "path") DO NOTHING;
+
+-- name: GetIdempotencyKey :one
+SELECT
+    "key", "method", "path", "status_code", "content_type", "body", "created_at", "caller", "request_hash"
+FROM idempotency_keys
+WHERE
+    caller = $1
+    AND key = $2
+    AND method = $3
+    AND path = $4;
+
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET
+    status_code = sqlc.arg('status_code'),
+    content_type = sqlc.arg('content_type'),
+    body = sqlc.arg('body')
+WHERE
+    caller = sqlc.arg('caller')
+    AND key = sqlc.arg('key')
+    AND method = sqlc.arg('method')
+    AND path = sqlc.arg('path');
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE
+    caller = $1
+    AND key = $2
+    AND method = $3
+    AND path = $4;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE created_at < $1;
+
+-- name: InsertMessageReport :execrows
+INSERT INTO message_reports
+    ( "message_id", "participant_id", "reason" ) VALUES
+    ( $1, $2, $3 )
+ON CONFLICT ("message_id", "participant_id") DO NOTHING;
+
+-- name: GetRoomReportedMessages :many
+SELECT
+    m."id",
+    m."message",
+    m."created_at",
+    COUNT(r."id") AS report_count,
+    array_agg(r."reason" ORDER BY r."created_at")::text[] AS reasons,
+    MAX(r."created_at")::timestamptz AS last_reported_at
+FROM message_reports r
+JOIN messages m ON m."id" = r."message_id"
+WHERE
+    m."room_id" = $1
+    AND m."deleted_at" IS NULL
+GROUP BY m."id"
+ORDER BY report_count DESC, last_reported_at DESC;
+
+-- name: InsertRoomBan :one
+INSERT INTO room_bans
+    ( "room_id", "participant_id", "ip", "reason" ) VALUES
+    ( $1, $2, $3, $4 )
+RETURNING "id", "room_id", "participant_id", "ip", "reason", "created_at";
+
+-- name: GetRoomBans :many
+SELECT
+    "id", "room_id", "participant_id", "ip", "reason", "created_at"
+FROM room_bans
+WHERE room_id = $1
+ORDER BY "created_at" DESC, "id" DESC;
+
+-- name: DeleteRoomBan :execrows
+DELETE FROM room_bans
+WHERE
+    id = $1
+    AND room_id = $2;
+
+-- name: IsBannedFromRoom :one
+SELECT EXISTS (
+    SELECT 1
+    FROM room_bans
+    WHERE
+        room_id = sqlc.arg('room_id')
+        AND (
+            participant_id = sqlc.narg('participant_id')
+            OR ip = sqlc.narg('ip')
+        )
+) AS banned;
+
+-- name: InsertAuditLogEntry :exec
+INSERT INTO audit_log
+    ( "room_id", "actor", "participant_id", "ip", "action", "target_id" ) VALUES
+    ( $1, $2, $3, $4, $5, $6 );
+
+-- name: GetRoomAuditLog :many
+SELECT
+    "id", "room_id", "actor", "participant_id", "ip", "action", "target_id", "created_at"
+FROM audit_log
+WHERE room_id = $1
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetRoomStats :one
+SELECT
+    COUNT(*) AS message_count,
+    COUNT(*) FILTER (WHERE answered) AS answered_count,
+    COALESCE(SUM(reaction_count), 0)::bigint AS reaction_count
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+    AND parent_message_id IS NULL;
+
+-- name: GetRoomMessagesPerMinute :many
+SELECT
+    date_trunc('minute', created_at)::timestamptz AS minute,
+    COUNT(*) AS message_count
+FROM messages
+WHERE
+    room_id = $1
+    AND deleted_at IS NULL
+    AND approved = true
+    AND hidden = false
+GROUP BY minute
+ORDER BY minute ASC;
+
+-- name: GetMessageRanks :many
+WITH ranked AS (
+    SELECT
+        "id",
+        ROW_NUMBER() OVER (ORDER BY "reaction_count" DESC, "created_at" ASC, "id" ASC) AS rank
+    FROM messages
+    WHERE
+        room_id = sqlc.arg('room_id')
+        AND deleted_at IS NULL
+        AND approved = true
+        AND hidden = false
+        AND parent_message_id IS NULL
+)
+SELECT "id", rank
+FROM ranked
+WHERE id = ANY(sqlc.arg('message_ids')::uuid[]);
+
+-- name: GetRoomListVersion :one
+-- Every change takes a change_seq past all those taken before, and deleting
+-- a row lowers the count, so the pair doesn't come back to an earlier value
+-- the way a sum would once rows are purged.
+SELECT COALESCE(max("change_seq"), 0)::bigint AS max_change_seq, count(*) AS row_count
+FROM rooms;
+
+-- name: GetRoomMessagesVersion :one
+-- See GetRoomListVersion.
+SELECT COALESCE(max("change_seq"), 0)::bigint AS max_change_seq, count(*) AS row_count
+FROM messages
+WHERE room_id = $1;
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres is the Store of a Postgres database.
+type Postgres struct {
+	*pgstore.Queries
+
+	// db is the pool, or the transaction of a Postgres given to WithTx.
+	db interface {
+		Begin(ctx context.Context) (pgx.Tx, error)
+	}
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{Queries: pgstore.New(pool), db: pool}
+}
+
+func (p *Postgres) WithTx(ctx context.Context, fn func(q Store) error) error {
+	return pgx.BeginFunc(ctx, p.db, func(tx pgx.Tx) error {
+		return fn(&Postgres{Queries: p.Queries.WithTx(tx), db: tx})
+	})
+}
+
+// ReactToMessage locks the message before reacting to it, so the counts are
+// read on a snapshot taken once the reactions committed before are all in,
+// and no other reaction to the message commits before this one does.
+func (p *Postgres) ReactToMessage(ctx context.Context, arg pgstore.ReactToMessageParams) (pgstore.ReactToMessageRow, error) {
+	var row pgstore.ReactToMessageRow
+
+	err := p.withLockedMessage(ctx, arg.ID, func(q *pgstore.Queries) (err error) {
+		row, err = q.ReactToMessage(ctx, arg)
+
+		return err
+	})
+
+	return row, err
+}
+
+// RemoveReactionFromMessage locks the message first, like ReactToMessage.
+func (p *Postgres) RemoveReactionFromMessage(ctx context.Context, arg pgstore.RemoveReactionFromMessageParams) (pgstore.RemoveReactionFromMessageRow, error) {
+	var row pgstore.RemoveReactionFromMessageRow
+
+	err := p.withLockedMessage(ctx, arg.ID, func(q *pgstore.Queries) (err error) {
+		row, err = q.RemoveReactionFromMessage(ctx, arg)
+
+		return err
+	})
+
+	return row, err
+}
+
+// withLockedMessage runs fn in a transaction, or a savepoint, that holds the
+// lock of the message.
+func (p *Postgres) withLockedMessage(ctx context.Context, id uuid.UUID, fn func(q *pgstore.Queries) error) error {
+	return pgx.BeginFunc(ctx, p.db, func(tx pgx.Tx) error {
+		q := p.Queries.WithTx(tx)
+
+		if err := q.LockMessage(ctx, id); err != nil {
+			return err
+		}
+
+		return fn(q)
+	})
+}
@@ -0,0 +1,241 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"server/internal/store/pgstore"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replicaRetryDelay is how long reads stay on the primary once the replica
+// failed to serve one, before it is given another try.
+const replicaRetryDelay = 30 * time.Second
+
+type preferReplicaKey struct{}
+
+// PreferReplica returns a copy of ctx whose reads a Postgres with a replica
+// runs there. It is meant for requests that only read and can do with rows
+// a little behind the primary's.
+func PreferReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, preferReplicaKey{}, true)
+}
+
+func prefersReplica(ctx context.Context) bool {
+	prefer, _ := ctx.Value(preferReplicaKey{}).(bool)
+
+	return prefer
+}
+
+// NewPostgresWithReplica returns a Postgres that reads from replica for the
+// contexts of PreferReplica, and from primary when the replica can't be
+// reached. Writes, and transactions altogether, always run on primary.
+func NewPostgresWithReplica(primary, replica *pgxpool.Pool) *Postgres {
+	return &Postgres{
+		Queries: pgstore.New(&routedDB{primary: primary, replica: replica}),
+		db:      primary,
+	}
+}
+
+// routedDB sends the queries of pgstore to the primary or the replica.
+// Statements run through Exec don't return rows, so they are all writes;
+// Query and QueryRow are both reads and writes with RETURNING, which is why
+// the caller tells them apart with PreferReplica.
+type routedDB struct {
+	primary *pgxpool.Pool
+	replica *pgxpool.Pool
+
+	// retryAt is when, in Unix nanoseconds, the replica is tried again
+	// after failing.
+	retryAt atomic.Int64
+}
+
+var _ pgstore.DBTX = (*routedDB)(nil)
+
+func (d *routedDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return d.primary.Exec(ctx, sql, args...)
+}
+
+func (d *routedDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if d.useReplica(ctx) {
+		rows, err := d.replica.Query(ctx, sql, args...)
+
+		if !d.failedOver(ctx, err) {
+			if err != nil {
+				return nil, err
+			}
+
+			return &replicaRows{Rows: rows, db: d, ctx: ctx, sql: sql, args: args}, nil
+		}
+	}
+
+	return d.primary.Query(ctx, sql, args...)
+}
+
+func (d *routedDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if d.useReplica(ctx) {
+		return replicaRow{db: d, ctx: ctx, sql: sql, args: args, row: d.replica.QueryRow(ctx, sql, args...)}
+	}
+
+	return d.primary.QueryRow(ctx, sql, args...)
+}
+
+func (d *routedDB) useReplica(ctx context.Context) bool {
+	return prefersReplica(ctx) && time.Now().UnixNano() >= d.retryAt.Load()
+}
+
+// failedOver reports whether err means the replica is unavailable, in which
+// case the query is to be run again on the primary, and so are the reads
+// that follow for replicaRetryDelay.
+func (d *routedDB) failedOver(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || !replicaUnavailable(err) {
+		return false
+	}
+
+	retryAt := d.retryAt.Load()
+
+	if d.retryAt.CompareAndSwap(retryAt, time.Now().Add(replicaRetryDelay).UnixNano()) {
+		slog.Warn("Read replica unavailable, reading from the primary", "error", err, "retry_in", replicaRetryDelay)
+	}
+
+	return true
+}
+
+// replicaUnavailable tells the errors of a replica that can't be reached,
+// or is shutting down or starting up, from those of the query itself.
+func replicaUnavailable(err error) bool {
+	var connectErr *pgconn.ConnectError
+
+	var netErr net.Error
+
+	var pgErr *pgconn.PgError
+
+	switch {
+	case errors.As(err, &connectErr), errors.As(err, &netErr), pgconn.SafeToRetry(err):
+		return true
+	case errors.As(err, &pgErr):
+		// admin_shutdown, crash_shutdown and cannot_connect_now.
+		return pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+
+	return false
+}
+
+// replicaRow is a row read from the replica, read again from the primary if
+// the replica turns out to be unavailable, which QueryRow only reports on
+// Scan.
+type replicaRow struct {
+	db   *routedDB
+	ctx  context.Context
+	sql  string
+	args []interface{}
+	row  pgx.Row
+}
+
+func (r replicaRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+
+	if r.db.failedOver(r.ctx, err) {
+		return r.db.primary.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	}
+
+	return err
+}
+
+// replicaRows are rows read from the replica, read again from the primary if
+// the replica turns out to be unavailable while they are read, which the
+// query itself only reports once its first rows come in. The rows already
+// read are skipped on the primary, which lists them in the same order.
+type replicaRows struct {
+	pgx.Rows
+
+	db   *routedDB
+	ctx  context.Context
+	sql  string
+	args []interface{}
+
+	// read is the number of rows Next moved to on the replica, and
+	// onPrimary whether the rows are now read from the primary.
+	read      int
+	onPrimary bool
+
+	// err is the error of the query on the primary, if it failed.
+	err error
+}
+
+func (r *replicaRows) Next() bool {
+	if r.Rows.Next() {
+		if !r.onPrimary {
+			r.read++
+		}
+
+		return true
+	}
+
+	if r.onPrimary || !r.db.failedOver(r.ctx, r.Rows.Err()) {
+		return false
+	}
+
+	return r.failOver(r.read) && r.Rows.Next()
+}
+
+func (r *replicaRows) Scan(dest ...any) error {
+	err := r.Rows.Scan(dest...)
+
+	if r.onPrimary || !r.db.failedOver(r.ctx, err) {
+		return err
+	}
+
+	// The row being scanned is read again. Should the primary not have it,
+	// the error of the replica stands.
+	if !r.failOver(r.read-1) || !r.Rows.Next() {
+		if primaryErr := r.Err(); primaryErr != nil {
+			return primaryErr
+		}
+
+		return err
+	}
+
+	return r.Rows.Scan(dest...)
+}
+
+func (r *replicaRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.Rows.Err()
+}
+
+// failOver runs the query again on the primary and skips its first skip
+// rows. It reports whether there are rows left to read.
+func (r *replicaRows) failOver(skip int) bool {
+	r.Rows.Close()
+
+	r.onPrimary = true
+
+	rows, err := r.db.primary.Query(r.ctx, r.sql, r.args...)
+
+	if err != nil {
+		r.err = err
+
+		return false
+	}
+
+	r.Rows = rows
+
+	for range skip {
+		if !rows.Next() {
+			return false
+		}
+	}
+
+	return true
+}
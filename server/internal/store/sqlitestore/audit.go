@@ -0,0 +1,45 @@
+package sqlitestore
+
+import (
+	"context"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) InsertAuditLogEntry(ctx context.Context, arg pgstore.InsertAuditLogEntryParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO audit_log
+			( "id", "created_at", "room_id", "actor", "participant_id", "ip", "action", "target_id" ) VALUES
+			( $1, $2, $3, $4, $5, $6, $7, $8 )
+	`, uuid.New(), micros(now()), arg.RoomID, arg.Actor, arg.ParticipantID, arg.Ip, arg.Action, arg.TargetID)
+
+	return dbError(err)
+}
+
+func (s *Store) GetRoomAuditLog(ctx context.Context, arg pgstore.GetRoomAuditLogParams) ([]pgstore.AuditLog, error) {
+	return queryRows(ctx, s.q, func(row scanner) (pgstore.AuditLog, error) {
+		var i pgstore.AuditLog
+
+		err := row.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Actor,
+			&i.ParticipantID,
+			&i.Ip,
+			&i.Action,
+			&i.TargetID,
+			timestamp{&i.CreatedAt},
+		)
+
+		return i, dbError(err)
+	}, `
+		SELECT
+			"id", "room_id", "actor", "participant_id", "ip", "action", "target_id", "created_at"
+		FROM audit_log
+		WHERE room_id = $1
+		ORDER BY "created_at" DESC, "id" DESC
+		LIMIT $2 OFFSET $3
+	`, arg.RoomID, arg.Limit, arg.Offset)
+}
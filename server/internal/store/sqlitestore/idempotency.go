@@ -0,0 +1,81 @@
+package sqlitestore
+
+import (
+	"context"
+	"time"
+
+	"server/internal/store/pgstore"
+)
+
+func (s *Store) ReserveIdempotencyKey(ctx context.Context, arg pgstore.ReserveIdempotencyKeyParams) (int64, error) {
+	return execRows(ctx, s.q, `
+		INSERT INTO idempotency_keys
+			( "caller", "key", "method", "path", "request_hash", "created_at" ) VALUES
+			( $1, $2, $3, $4, $5, $6 )
+		ON CONFLICT ("caller", "key", "method", "path") DO NOTHING
+	`, arg.Caller, arg.Key, arg.Method, arg.Path, arg.RequestHash, micros(now()))
+}
+
+func (s *Store) GetIdempotencyKey(ctx context.Context, arg pgstore.GetIdempotencyKeyParams) (pgstore.IdempotencyKey, error) {
+	var i pgstore.IdempotencyKey
+
+	err := s.q.QueryRowContext(ctx, `
+		SELECT
+			"key", "method", "path", "status_code", "content_type", "body", "created_at", "caller", "request_hash"
+		FROM idempotency_keys
+		WHERE
+			caller = $1
+			AND key = $2
+			AND method = $3
+			AND path = $4
+	`, arg.Caller, arg.Key, arg.Method, arg.Path).Scan(
+		&i.Key,
+		&i.Method,
+		&i.Path,
+		&i.StatusCode,
+		&i.ContentType,
+		&i.Body,
+		timestamp{&i.CreatedAt},
+		&i.Caller,
+		&i.RequestHash,
+	)
+
+	return i, dbError(err)
+}
+
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, arg pgstore.CompleteIdempotencyKeyParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET
+			status_code = $1,
+			content_type = $2,
+			body = $3
+		WHERE
+			caller = $4
+			AND key = $5
+			AND method = $6
+			AND path = $7
+	`, arg.StatusCode, arg.ContentType, nullBytes(arg.Body), arg.Caller, arg.Key, arg.Method, arg.Path)
+
+	return dbError(err)
+}
+
+func (s *Store) DeleteIdempotencyKey(ctx context.Context, arg pgstore.DeleteIdempotencyKeyParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE
+			caller = $1
+			AND key = $2
+			AND method = $3
+			AND path = $4
+	`, arg.Caller, arg.Key, arg.Method, arg.Path)
+
+	return dbError(err)
+}
+
+func (s *Store) DeleteExpiredIdempotencyKeys(ctx context.Context, createdAt time.Time) (int64, error) {
+	return execRows(ctx, s.q, `
+		DELETE FROM idempotency_keys
+		WHERE created_at < $1
+	`, micros(createdAt))
+}
@@ -0,0 +1,508 @@
+package sqlitestore
+
+import (
+	"context"
+	"time"
+
+	"server/internal/store/pgstore"
+	"server/internal/store/textsearch"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const messageColumns = `"id", "room_id", "message", "reaction_count", "answered", "created_at", "edited_at", "deleted_at", "parent_message_id", "answer", "pinned", "merged_into_id", "attachment_url", "approved", "participant_id", "hidden", "updated_at", "change_seq"`
+
+// listedIn is the filter shared by the message listings of a room, for
+// the room in $1, the viewer in $2 and the answered filter in $3. Replies
+// are left to their thread, and hidden messages shown to their author
+// alone.
+const listedIn = `
+	room_id = $1
+	AND deleted_at IS NULL
+	AND approved = 1
+	AND (hidden = 0 OR participant_id = $2)
+	AND parent_message_id IS NULL
+	AND ($3 IS NULL OR answered = $3)
+`
+
+func scanMessage(row scanner) (pgstore.Message, error) {
+	var i pgstore.Message
+
+	err := row.Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Message,
+		&i.ReactionCount,
+		&i.Answered,
+		timestamp{&i.CreatedAt},
+		nullTimestamp{&i.EditedAt},
+		nullTimestamp{&i.DeletedAt},
+		&i.ParentMessageID,
+		&i.Answer,
+		&i.Pinned,
+		&i.MergedIntoID,
+		&i.AttachmentUrl,
+		&i.Approved,
+		&i.ParticipantID,
+		&i.Hidden,
+		timestamp{&i.UpdatedAt},
+		&i.ChangeSeq,
+	)
+
+	return i, dbError(err)
+}
+
+// updateMessages runs an UPDATE of messages returning their ids, and reads
+// the messages back in the same order. RETURNING would give the rows as the
+// UPDATE left them, before the triggers bumped their change_seq and
+// updated_at.
+func (s *Store) updateMessages(ctx context.Context, query string, args ...any) ([]pgstore.Message, error) {
+	var messages []pgstore.Message
+
+	err := s.inTx(ctx, func(q querier) error {
+		ids, err := queryRows(ctx, q, scanUUID, query, args...)
+
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			message, err := scanMessage(q.QueryRowContext(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = $1`, id))
+
+			if err != nil {
+				return err
+			}
+
+			messages = append(messages, message)
+		}
+
+		return nil
+	})
+
+	return messages, err
+}
+
+// updateMessage is updateMessages for an UPDATE of a single message, which
+// returns pgx.ErrNoRows when the UPDATE finds none.
+func (s *Store) updateMessage(ctx context.Context, query string, args ...any) (pgstore.Message, error) {
+	messages, err := s.updateMessages(ctx, query, args...)
+
+	if err != nil {
+		return pgstore.Message{}, err
+	}
+
+	if len(messages) == 0 {
+		return pgstore.Message{}, pgx.ErrNoRows
+	}
+
+	return messages[0], nil
+}
+
+func (s *Store) PurgeDeletedMessages(ctx context.Context, deletedAt time.Time) (int64, error) {
+	return execRows(ctx, s.q, `
+		DELETE FROM messages
+		WHERE deleted_at < $1
+	`, micros(deletedAt))
+}
+
+func (s *Store) GetMessage(ctx context.Context, id uuid.UUID) (pgstore.Message, error) {
+	return scanMessage(s.q.QueryRowContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+	`, id))
+}
+
+func (s *Store) GetRoomMessagesVersion(ctx context.Context, roomID uuid.UUID) (pgstore.GetRoomMessagesVersionRow, error) {
+	var version pgstore.GetRoomMessagesVersionRow
+
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COALESCE(max("change_seq"), 0) AS max_change_seq, count(*) AS row_count
+		FROM messages
+		WHERE room_id = $1
+	`, roomID).Scan(&version.MaxChangeSeq, &version.RowCount)
+
+	return version, dbError(err)
+}
+
+func (s *Store) GetRoomMessages(ctx context.Context, arg pgstore.GetRoomMessagesParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+listedIn+`
+		ORDER BY NOT "pinned", "created_at", "id"
+		LIMIT $4 OFFSET $5
+	`, arg.RoomID, arg.ViewerID, arg.Answered, arg.Limit, arg.Offset)
+}
+
+func (s *Store) GetRoomMessagesAfterCursor(ctx context.Context, arg pgstore.GetRoomMessagesAfterCursorParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+listedIn+`
+			AND (NOT "pinned", "created_at", "id") > (NOT $4, $5, $6)
+		ORDER BY NOT "pinned", "created_at", "id"
+		LIMIT $7
+	`, arg.RoomID, arg.ViewerID, arg.Answered, arg.CursorPinned, micros(arg.CursorCreatedAt), arg.CursorID, arg.Limit)
+}
+
+func (s *Store) GetRoomMessagesNewest(ctx context.Context, arg pgstore.GetRoomMessagesNewestParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+listedIn+`
+		ORDER BY "pinned" DESC, "created_at" DESC, "id" DESC
+		LIMIT $4 OFFSET $5
+	`, arg.RoomID, arg.ViewerID, arg.Answered, arg.Limit, arg.Offset)
+}
+
+func (s *Store) GetRoomMessagesBeforeCursor(ctx context.Context, arg pgstore.GetRoomMessagesBeforeCursorParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+listedIn+`
+			AND ("pinned", "created_at", "id") < ($4, $5, $6)
+		ORDER BY "pinned" DESC, "created_at" DESC, "id" DESC
+		LIMIT $7
+	`, arg.RoomID, arg.ViewerID, arg.Answered, arg.CursorPinned, micros(arg.CursorCreatedAt), arg.CursorID, arg.Limit)
+}
+
+func (s *Store) GetRoomMessagesMostReacted(ctx context.Context, arg pgstore.GetRoomMessagesMostReactedParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+listedIn+`
+		ORDER BY "pinned" DESC, "reaction_count" DESC, "created_at" ASC, "id" ASC
+		LIMIT $4 OFFSET $5
+	`, arg.RoomID, arg.ViewerID, arg.Answered, arg.Limit, arg.Offset)
+}
+
+func (s *Store) GetTopRoomMessages(ctx context.Context, arg pgstore.GetTopRoomMessagesParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+listedIn+`
+			AND answered = 0
+		ORDER BY "reaction_count" DESC, "created_at" ASC, "id" ASC
+		LIMIT $4
+	`, arg.RoomID, arg.ViewerID, nil, arg.Limit)
+}
+
+func (s *Store) GetRoomMessagesForExport(ctx context.Context, arg pgstore.GetRoomMessagesForExportParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE
+			room_id = $1
+			AND deleted_at IS NULL
+			AND ("created_at", "id") > ($2, $3)
+		ORDER BY "created_at" ASC, "id" ASC
+		LIMIT $4
+	`, arg.RoomID, micros(arg.CursorCreatedAt), arg.CursorID, arg.Limit)
+}
+
+func (s *Store) SearchRoomMessages(ctx context.Context, arg pgstore.SearchRoomMessagesParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+listedIn+`
+			AND websearch_rank("message", $4) IS NOT NULL
+		ORDER BY
+			websearch_rank("message", $4) DESC,
+			"created_at" ASC,
+			"id" ASC
+		LIMIT $5
+	`, arg.RoomID, arg.ViewerID, nil, arg.Query, arg.Limit)
+}
+
+func (s *Store) GetMessageReplies(ctx context.Context, arg pgstore.GetMessageRepliesParams) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE
+			parent_message_id = $1
+			AND deleted_at IS NULL
+			AND approved = 1
+			AND (hidden = 0 OR participant_id = $2)
+		ORDER BY "created_at" ASC, "id" ASC
+	`, arg.ParentMessageID, arg.ViewerID)
+}
+
+func (s *Store) GetRoomPendingMessages(ctx context.Context, roomID uuid.UUID) ([]pgstore.Message, error) {
+	return queryRows(ctx, s.q, scanMessage, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE
+			room_id = $1
+			AND approved = 0
+			AND deleted_at IS NULL
+		ORDER BY "created_at" ASC, "id" ASC
+	`, roomID)
+}
+
+func (s *Store) InsertMessage(ctx context.Context, arg pgstore.InsertMessageParams) (uuid.UUID, error) {
+	createdAt := micros(now())
+
+	return scanUUID(s.q.QueryRowContext(ctx, `
+		INSERT INTO messages
+			( "id", "created_at", "updated_at", "room_id", "message", "parent_message_id", "approved", "participant_id" ) VALUES
+			( $1, $2, $2, $3, $4, $5, $6, $7 )
+		RETURNING "id"
+	`, uuid.New(), createdAt, arg.RoomID, arg.Message, arg.ParentMessageID, arg.Approved, arg.ParticipantID))
+}
+
+func (s *Store) UpdateMessage(ctx context.Context, arg pgstore.UpdateMessageParams) (pgstore.Message, error) {
+	return s.updateMessage(ctx, `
+		UPDATE messages
+		SET
+			message = $2,
+			edited_at = $3
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+		RETURNING "id"
+	`, arg.ID, arg.Message, micros(now()))
+}
+
+func (s *Store) SoftDeleteMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE messages
+		SET
+			deleted_at = $2
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+	`, id, micros(now()))
+
+	return dbError(err)
+}
+
+func (s *Store) SetMessagePinned(ctx context.Context, arg pgstore.SetMessagePinnedParams) (pgstore.Message, error) {
+	return s.updateMessage(ctx, `
+		UPDATE messages
+		SET
+			pinned = $2
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+		RETURNING "id"
+	`, arg.ID, arg.Pinned)
+}
+
+func (s *Store) ApproveMessage(ctx context.Context, id uuid.UUID) (pgstore.Message, error) {
+	return s.updateMessage(ctx, `
+		UPDATE messages
+		SET
+			approved = 1
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+		RETURNING "id"
+	`, id)
+}
+
+func (s *Store) SetMessageHidden(ctx context.Context, arg pgstore.SetMessageHiddenParams) (pgstore.Message, error) {
+	return s.updateMessage(ctx, `
+		UPDATE messages
+		SET
+			hidden = $2
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+		RETURNING "id"
+	`, arg.ID, arg.Hidden)
+}
+
+func (s *Store) SetMessageAttachment(ctx context.Context, arg pgstore.SetMessageAttachmentParams) (pgstore.Message, error) {
+	return s.updateMessage(ctx, `
+		UPDATE messages
+		SET
+			attachment_url = $2
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+		RETURNING "id"
+	`, arg.ID, arg.AttachmentUrl)
+}
+
+func (s *Store) MarkMessageAsAnswered(ctx context.Context, arg pgstore.MarkMessageAsAnsweredParams) (pgstore.Message, error) {
+	return s.updateMessage(ctx, `
+		UPDATE messages
+		SET
+			answered = 1,
+			answer = COALESCE($1, answer)
+		WHERE
+			id = $2
+			AND deleted_at IS NULL
+		RETURNING "id"
+	`, arg.Answer, arg.ID)
+}
+
+func (s *Store) MarkMessagesAsAnswered(ctx context.Context, arg pgstore.MarkMessagesAsAnsweredParams) ([]pgstore.Message, error) {
+	return s.updateMessages(ctx, `
+		UPDATE messages
+		SET
+			answered = 1
+		WHERE
+			room_id = $1
+			AND id IN (SELECT value FROM json_each($2))
+			AND deleted_at IS NULL
+			AND answered = 0
+		RETURNING "id"
+	`, arg.RoomID, uuidList(arg.Ids))
+}
+
+// MergeMessages moves the reactions of the duplicate to the target, but for
+// those of participants that reacted to both, and deletes the duplicate.
+// The statements of the Postgres query, which runs them as one, run in a
+// transaction.
+func (s *Store) MergeMessages(ctx context.Context, arg pgstore.MergeMessagesParams) (int64, error) {
+	var merged int64
+
+	err := s.inTx(ctx, func(q querier) error {
+		var live bool
+
+		err := q.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM messages WHERE id = $1 AND deleted_at IS NULL
+			)
+		`, arg.DuplicateID).Scan(&live)
+
+		if err != nil || !live {
+			return dbError(err)
+		}
+
+		_, err = q.ExecContext(ctx, `
+			INSERT INTO message_reactions ("message_id", "participant_id", "type", "created_at")
+			SELECT $1, participant_id, type, created_at
+			FROM message_reactions
+			WHERE message_id = $2
+			ON CONFLICT ("message_id", "participant_id") DO NOTHING
+		`, arg.TargetID, arg.DuplicateID)
+
+		if err != nil {
+			return dbError(err)
+		}
+
+		_, err = q.ExecContext(ctx, `
+			DELETE FROM message_reactions
+			WHERE message_id = $1
+		`, arg.DuplicateID)
+
+		if err != nil {
+			return dbError(err)
+		}
+
+		merged, err = execRows(ctx, q, `
+			UPDATE messages
+			SET
+				deleted_at = $3,
+				merged_into_id = $1
+			WHERE
+				id = $2
+				AND deleted_at IS NULL
+		`, arg.TargetID, arg.DuplicateID, micros(now()))
+
+		return err
+	})
+
+	return merged, err
+}
+
+func (s *Store) FindSimilarMessages(ctx context.Context, arg pgstore.FindSimilarMessagesParams) ([]pgstore.FindSimilarMessagesRow, error) {
+	return queryRows(ctx, s.q, func(row scanner) (pgstore.FindSimilarMessagesRow, error) {
+		var i pgstore.FindSimilarMessagesRow
+
+		err := row.Scan(&i.ID, &i.Message, &i.Similarity)
+
+		return i, dbError(err)
+	}, `
+		SELECT *
+		FROM (
+			SELECT
+				"id", "message", similarity("message", $1) AS "similarity"
+			FROM messages
+			WHERE
+				room_id = $2
+				AND deleted_at IS NULL
+				AND approved = 1
+				AND hidden = 0
+				AND parent_message_id IS NULL
+				AND id <> $3
+		)
+		WHERE "similarity" >= $4
+		ORDER BY "similarity" DESC
+		LIMIT 5
+	`, arg.Message, arg.RoomID, arg.ExcludeID, textsearch.SimilarityThreshold)
+}
+
+func (s *Store) GetRoomStats(ctx context.Context, roomID uuid.UUID) (pgstore.GetRoomStatsRow, error) {
+	var i pgstore.GetRoomStatsRow
+
+	err := s.q.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) AS message_count,
+			COUNT(*) FILTER (WHERE answered) AS answered_count,
+			COALESCE(SUM(reaction_count), 0) AS reaction_count
+		FROM messages
+		WHERE
+			room_id = $1
+			AND deleted_at IS NULL
+			AND approved = 1
+			AND hidden = 0
+			AND parent_message_id IS NULL
+	`, roomID).Scan(&i.MessageCount, &i.AnsweredCount, &i.ReactionCount)
+
+	return i, dbError(err)
+}
+
+func (s *Store) GetRoomMessagesPerMinute(ctx context.Context, roomID uuid.UUID) ([]pgstore.GetRoomMessagesPerMinuteRow, error) {
+	return queryRows(ctx, s.q, func(row scanner) (pgstore.GetRoomMessagesPerMinuteRow, error) {
+		var i pgstore.GetRoomMessagesPerMinuteRow
+
+		err := row.Scan(timestamp{&i.Minute}, &i.MessageCount)
+
+		return i, dbError(err)
+	}, `
+		SELECT
+			created_at - created_at % 60000000 AS minute,
+			COUNT(*) AS message_count
+		FROM messages
+		WHERE
+			room_id = $1
+			AND deleted_at IS NULL
+			AND approved = 1
+			AND hidden = 0
+		GROUP BY minute
+		ORDER BY minute ASC
+	`, roomID)
+}
+
+func (s *Store) GetMessageRanks(ctx context.Context, arg pgstore.GetMessageRanksParams) ([]pgstore.GetMessageRanksRow, error) {
+	return queryRows(ctx, s.q, func(row scanner) (pgstore.GetMessageRanksRow, error) {
+		var i pgstore.GetMessageRanksRow
+
+		err := row.Scan(&i.ID, &i.Rank)
+
+		return i, dbError(err)
+	}, `
+		WITH ranked AS (
+			SELECT
+				"id",
+				ROW_NUMBER() OVER (ORDER BY "reaction_count" DESC, "created_at" ASC, "id" ASC) AS rank
+			FROM messages
+			WHERE
+				room_id = $1
+				AND deleted_at IS NULL
+				AND approved = 1
+				AND hidden = 0
+				AND parent_message_id IS NULL
+		)
+		SELECT "id", rank
+		FROM ranked
+		WHERE id IN (SELECT value FROM json_each($2))
+	`, arg.RoomID, uuidList(arg.MessageIds))
+}
@@ -0,0 +1,269 @@
+-- The schema of the Postgres migrations as of their latest version, in
+-- SQLite's types: timestamps are Unix microseconds, uuids are text, booleans
+-- are 0 or 1 and the tags of a room are a JSON array. The triggers do what
+-- the Postgres ones do, so the queries can stay the same.
+
+-- room_change_seq stands in for the Postgres sequence of the same name.
+-- Every change to a room or to one of its messages takes a new value from
+-- it, and listings derive their ETags from the change_seq of the rows.
+CREATE TABLE room_change_seq (
+  "last_value"  INTEGER  NOT NULL
+);
+
+INSERT INTO room_change_seq ("last_value") VALUES (0);
+
+CREATE TABLE rooms (
+  "id"                TEXT     PRIMARY KEY  NOT NULL,
+  "theme"             TEXT                  NOT NULL,
+  "created_at"        INTEGER               NOT NULL,
+  "closed"            INTEGER               NOT NULL  DEFAULT 0,
+  "expires_at"        INTEGER,
+  "code"              TEXT                  NOT NULL,
+  "private"           INTEGER               NOT NULL  DEFAULT 0,
+  "access_code_hash"  TEXT,
+  "description"       TEXT                  NOT NULL  DEFAULT '',
+  "host_name"         TEXT                  NOT NULL  DEFAULT '',
+  "tags"              TEXT                  NOT NULL  DEFAULT '[]',
+  "starts_at"         INTEGER,
+  "ends_at"           INTEGER,
+  "live"              INTEGER               NOT NULL  DEFAULT 1,
+  "host_token_hash"   TEXT,
+  "moderated"         INTEGER               NOT NULL  DEFAULT 0,
+  "content_filter"    INTEGER               NOT NULL  DEFAULT 0,
+  "change_seq"        INTEGER               NOT NULL  DEFAULT 0,
+  "updated_at"        INTEGER               NOT NULL,
+  "deleted_at"        INTEGER,
+  CONSTRAINT "rooms_code_key" UNIQUE ("code")
+);
+
+CREATE INDEX "rooms_created_at_id_idx"
+  ON rooms ("created_at", "id");
+
+CREATE INDEX "rooms_open_expires_at_idx"
+  ON rooms ("expires_at")
+  WHERE "closed" = 0 AND "expires_at" IS NOT NULL;
+
+CREATE INDEX "rooms_pending_starts_at_idx"
+  ON rooms ("starts_at")
+  WHERE "live" = 0;
+
+CREATE INDEX "rooms_deleted_at_idx"
+  ON rooms ("deleted_at")
+  WHERE "deleted_at" IS NOT NULL;
+
+CREATE TABLE messages (
+  "id"                 TEXT     PRIMARY KEY  NOT NULL,
+  "room_id"            TEXT                  NOT NULL,
+  "message"            TEXT                  NOT NULL,
+  "reaction_count"     INTEGER               NOT NULL  DEFAULT 0,
+  "answered"           INTEGER               NOT NULL  DEFAULT 0,
+  "created_at"         INTEGER               NOT NULL,
+  "edited_at"          INTEGER,
+  "deleted_at"         INTEGER,
+  "parent_message_id"  TEXT,
+  "answer"             TEXT,
+  "pinned"             INTEGER               NOT NULL  DEFAULT 0,
+  "merged_into_id"     TEXT,
+  "attachment_url"     TEXT,
+  "approved"           INTEGER               NOT NULL  DEFAULT 1,
+  "participant_id"     TEXT,
+  "hidden"             INTEGER               NOT NULL  DEFAULT 0,
+  "updated_at"         INTEGER               NOT NULL,
+  "change_seq"         INTEGER               NOT NULL  DEFAULT 0,
+  CONSTRAINT "messages_reaction_count_non_negative" CHECK ("reaction_count" >= 0),
+  CONSTRAINT "messages_room_id_fkey"
+    FOREIGN KEY ("room_id") REFERENCES rooms ("id") ON DELETE CASCADE,
+  CONSTRAINT "messages_parent_message_id_fkey"
+    FOREIGN KEY ("parent_message_id") REFERENCES messages ("id") ON DELETE CASCADE,
+  CONSTRAINT "messages_merged_into_id_fkey"
+    FOREIGN KEY ("merged_into_id") REFERENCES messages ("id") ON DELETE SET NULL
+);
+
+CREATE INDEX "messages_room_id_pinned_created_at_id_idx"
+  ON messages ("room_id", "pinned" DESC, "created_at", "id");
+
+CREATE INDEX "messages_room_id_reaction_count_idx"
+  ON messages ("room_id", "reaction_count" DESC, "created_at", "id");
+
+CREATE INDEX "messages_parent_message_id_idx"
+  ON messages ("parent_message_id", "created_at", "id")
+  WHERE "parent_message_id" IS NOT NULL;
+
+CREATE INDEX "messages_merged_into_id_idx"
+  ON messages ("merged_into_id")
+  WHERE "merged_into_id" IS NOT NULL;
+
+CREATE INDEX "messages_deleted_at_idx"
+  ON messages ("deleted_at")
+  WHERE "deleted_at" IS NOT NULL;
+
+CREATE TABLE message_reactions (
+  "message_id"      TEXT     NOT NULL,
+  "participant_id"  TEXT     NOT NULL,
+  "type"            TEXT     NOT NULL,
+  "created_at"      INTEGER  NOT NULL,
+  PRIMARY KEY ("message_id", "participant_id"),
+  CONSTRAINT "message_reactions_message_id_fkey"
+    FOREIGN KEY ("message_id") REFERENCES messages ("id") ON DELETE CASCADE
+);
+
+CREATE TABLE message_reports (
+  "id"              TEXT     PRIMARY KEY  NOT NULL,
+  "message_id"      TEXT                  NOT NULL,
+  "participant_id"  TEXT                  NOT NULL,
+  "reason"          TEXT                  NOT NULL,
+  "created_at"      INTEGER               NOT NULL,
+  UNIQUE ("message_id", "participant_id"),
+  CONSTRAINT "message_reports_message_id_fkey"
+    FOREIGN KEY ("message_id") REFERENCES messages ("id") ON DELETE CASCADE
+);
+
+CREATE TABLE room_bans (
+  "id"              TEXT     PRIMARY KEY  NOT NULL,
+  "room_id"         TEXT                  NOT NULL,
+  "participant_id"  TEXT,
+  "ip"              TEXT,
+  "reason"          TEXT                  NOT NULL  DEFAULT '',
+  "created_at"      INTEGER               NOT NULL,
+  CONSTRAINT "room_bans_check" CHECK ("participant_id" IS NOT NULL OR "ip" IS NOT NULL),
+  CONSTRAINT "room_bans_room_id_fkey"
+    FOREIGN KEY ("room_id") REFERENCES rooms ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX "room_bans_room_id_idx"
+  ON room_bans ("room_id");
+
+CREATE TABLE audit_log (
+  "id"              TEXT     PRIMARY KEY  NOT NULL,
+  "room_id"         TEXT                  NOT NULL,
+  "actor"           TEXT                  NOT NULL,
+  "participant_id"  TEXT,
+  "ip"              TEXT,
+  "action"          TEXT                  NOT NULL,
+  "target_id"       TEXT,
+  "created_at"      INTEGER               NOT NULL,
+  CONSTRAINT "audit_log_room_id_fkey"
+    FOREIGN KEY ("room_id") REFERENCES rooms ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX "audit_log_room_id_created_at_idx"
+  ON audit_log ("room_id", "created_at" DESC, "id" DESC);
+
+CREATE TABLE idempotency_keys (
+  "caller"        TEXT     NOT NULL,
+  "key"           TEXT     NOT NULL,
+  "method"        TEXT     NOT NULL,
+  "path"          TEXT     NOT NULL,
+  "request_hash"  TEXT     NOT NULL,
+  "status_code"   INTEGER,
+  "content_type"  TEXT,
+  "body"          BLOB,
+  "created_at"    INTEGER  NOT NULL,
+  PRIMARY KEY ("caller", "key", "method", "path")
+);
+
+CREATE INDEX "idempotency_keys_created_at_idx"
+  ON idempotency_keys ("created_at");
+
+-- A trigger's own UPDATE of the row sets change_seq, which the WHEN of the
+-- UPDATE triggers tells apart from the UPDATEs of the queries. Message
+-- changes bump change_seq through an UPDATE of the room as well, so the
+-- updated_at of a room only moves when that UPDATE came from somewhere else.
+CREATE TRIGGER rooms_insert_change_seq
+  AFTER INSERT ON rooms
+BEGIN
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+
+  UPDATE rooms
+  SET "change_seq" = (SELECT "last_value" FROM room_change_seq)
+  WHERE "id" = NEW."id";
+END;
+
+CREATE TRIGGER rooms_change_seq
+  AFTER UPDATE ON rooms
+  WHEN NEW."change_seq" IS OLD."change_seq"
+BEGIN
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+
+  UPDATE rooms
+  SET
+    "change_seq" = (SELECT "last_value" FROM room_change_seq),
+    "updated_at" = CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000
+  WHERE "id" = NEW."id";
+END;
+
+CREATE TRIGGER rooms_delete_change_seq
+  AFTER DELETE ON rooms
+BEGIN
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+END;
+
+CREATE TRIGGER messages_insert_change_seq
+  AFTER INSERT ON messages
+BEGIN
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+
+  UPDATE messages
+  SET "change_seq" = (SELECT "last_value" FROM room_change_seq)
+  WHERE "id" = NEW."id";
+
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+
+  UPDATE rooms
+  SET "change_seq" = (SELECT "last_value" FROM room_change_seq)
+  WHERE "id" = NEW."room_id";
+END;
+
+-- Any change to a message moves updated_at, reactions included, but
+-- reactions leave the room be: the room list doesn't show them.
+CREATE TRIGGER messages_change_seq
+  AFTER UPDATE ON messages
+  WHEN NEW."change_seq" IS OLD."change_seq"
+BEGIN
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+
+  UPDATE messages
+  SET
+    "change_seq" = (SELECT "last_value" FROM room_change_seq),
+    "updated_at" = CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000
+  WHERE "id" = NEW."id";
+END;
+
+CREATE TRIGGER messages_update_room_change_seq
+  AFTER UPDATE ON messages
+  WHEN NEW."change_seq" IS OLD."change_seq" AND NEW."reaction_count" IS OLD."reaction_count"
+BEGIN
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+
+  UPDATE rooms
+  SET "change_seq" = (SELECT "last_value" FROM room_change_seq)
+  WHERE "id" = NEW."room_id";
+END;
+
+CREATE TRIGGER messages_delete_room_change_seq
+  AFTER DELETE ON messages
+BEGIN
+  UPDATE room_change_seq SET "last_value" = "last_value" + 1;
+
+  UPDATE rooms
+  SET "change_seq" = (SELECT "last_value" FROM room_change_seq)
+  WHERE "id" = OLD."room_id";
+END;
+
+-- messages.reaction_count is a cache of the rows of message_reactions the
+-- listings sort on, which only these triggers write.
+CREATE TRIGGER message_reactions_insert_count
+  AFTER INSERT ON message_reactions
+BEGIN
+  UPDATE messages
+  SET "reaction_count" = "reaction_count" + 1
+  WHERE "id" = NEW."message_id";
+END;
+
+CREATE TRIGGER message_reactions_delete_count
+  AFTER DELETE ON message_reactions
+BEGIN
+  UPDATE messages
+  SET "reaction_count" = "reaction_count" - 1
+  WHERE "id" = OLD."message_id";
+END;
@@ -0,0 +1,139 @@
+// Package migrations embeds the SQL migrations of the SQLite database and
+// applies them in order, one transaction per migration. The version of the
+// last migration applied is the database's user_version.
+//
+// Unlike those of Postgres, these migrations have no down part: the first
+// one creates the schema the Postgres migrations ended up with, and the
+// next ones follow the Postgres migrations added after it.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"strconv"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+var migrationName = regexp.MustCompile(`\A(\d+)_.+\.sql\z`)
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// load reads the embedded migrations in order, expecting their numbers to
+// run from 1 without gaps.
+func load() ([]migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration %s: %w", entry.Name(), err)
+		}
+
+		if version != len(migrations)+1 {
+			return nil, fmt.Errorf("missing migration %d before %s", len(migrations)+1, entry.Name())
+		}
+
+		data, err := fs.ReadFile(files, entry.Name())
+
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version: version, name: entry.Name(), sql: string(data)})
+	}
+
+	return migrations, nil
+}
+
+// Run applies the migrations the database doesn't have yet. db must begin
+// its transactions with BEGIN IMMEDIATE, so that two processes starting on
+// the same file take turns: each migration reads the version in the
+// transaction that applies it.
+func Run(ctx context.Context, db *sql.DB) error {
+	migrations, err := load()
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		applied, err := apply(ctx, db, migrations)
+
+		if err != nil {
+			return err
+		}
+
+		if applied == nil {
+			return nil
+		}
+
+		slog.Info("Applied migration", "name", applied.name)
+	}
+}
+
+// apply applies the migration that follows the version of the database, and
+// returns it, or nil when there is none left.
+func apply(ctx context.Context, db *sql.DB, migrations []migration) (*migration, error) {
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var current int
+
+	if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current); err != nil {
+		return nil, fmt.Errorf("failed to read the schema version: %w", err)
+	}
+
+	if current > len(migrations) {
+		return nil, fmt.Errorf("the database is at version %d, past the %d migrations of this build", current, len(migrations))
+	}
+
+	if current == len(migrations) {
+		return nil, nil
+	}
+
+	m := migrations[current]
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return nil, fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+	}
+
+	// PRAGMA takes no parameters, and m.version is a number.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+		return nil, fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+	}
+
+	return &m, nil
+}
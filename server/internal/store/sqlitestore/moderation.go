@@ -0,0 +1,105 @@
+package sqlitestore
+
+import (
+	"context"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) InsertMessageReport(ctx context.Context, arg pgstore.InsertMessageReportParams) (int64, error) {
+	return execRows(ctx, s.q, `
+		INSERT INTO message_reports
+			( "id", "created_at", "message_id", "participant_id", "reason" ) VALUES
+			( $1, $2, $3, $4, $5 )
+		ON CONFLICT ("message_id", "participant_id") DO NOTHING
+	`, uuid.New(), micros(now()), arg.MessageID, arg.ParticipantID, arg.Reason)
+}
+
+func (s *Store) GetRoomReportedMessages(ctx context.Context, roomID uuid.UUID) ([]pgstore.GetRoomReportedMessagesRow, error) {
+	return queryRows(ctx, s.q, func(row scanner) (pgstore.GetRoomReportedMessagesRow, error) {
+		var i pgstore.GetRoomReportedMessagesRow
+
+		err := row.Scan(
+			&i.ID,
+			&i.Message,
+			timestamp{&i.CreatedAt},
+			&i.ReportCount,
+			textArray{&i.Reasons},
+			timestamp{&i.LastReportedAt},
+		)
+
+		return i, dbError(err)
+	}, `
+		SELECT
+			m."id",
+			m."message",
+			m."created_at",
+			COUNT(r."id") AS report_count,
+			json_group_array(r."reason" ORDER BY r."created_at") AS reasons,
+			MAX(r."created_at") AS last_reported_at
+		FROM message_reports r
+		JOIN messages m ON m."id" = r."message_id"
+		WHERE
+			m."room_id" = $1
+			AND m."deleted_at" IS NULL
+		GROUP BY m."id"
+		ORDER BY report_count DESC, last_reported_at DESC
+	`, roomID)
+}
+
+func scanRoomBan(row scanner) (pgstore.RoomBan, error) {
+	var i pgstore.RoomBan
+
+	err := row.Scan(&i.ID, &i.RoomID, &i.ParticipantID, &i.Ip, &i.Reason, timestamp{&i.CreatedAt})
+
+	return i, dbError(err)
+}
+
+func (s *Store) InsertRoomBan(ctx context.Context, arg pgstore.InsertRoomBanParams) (pgstore.RoomBan, error) {
+	return scanRoomBan(s.q.QueryRowContext(ctx, `
+		INSERT INTO room_bans
+			( "id", "created_at", "room_id", "participant_id", "ip", "reason" ) VALUES
+			( $1, $2, $3, $4, $5, $6 )
+		RETURNING "id", "room_id", "participant_id", "ip", "reason", "created_at"
+	`, uuid.New(), micros(now()), arg.RoomID, arg.ParticipantID, arg.Ip, arg.Reason))
+}
+
+func (s *Store) GetRoomBans(ctx context.Context, roomID uuid.UUID) ([]pgstore.RoomBan, error) {
+	return queryRows(ctx, s.q, scanRoomBan, `
+		SELECT
+			"id", "room_id", "participant_id", "ip", "reason", "created_at"
+		FROM room_bans
+		WHERE room_id = $1
+		ORDER BY "created_at" DESC, "id" DESC
+	`, roomID)
+}
+
+func (s *Store) DeleteRoomBan(ctx context.Context, arg pgstore.DeleteRoomBanParams) (int64, error) {
+	return execRows(ctx, s.q, `
+		DELETE FROM room_bans
+		WHERE
+			id = $1
+			AND room_id = $2
+	`, arg.ID, arg.RoomID)
+}
+
+func (s *Store) IsBannedFromRoom(ctx context.Context, arg pgstore.IsBannedFromRoomParams) (bool, error) {
+	var banned bool
+
+	err := s.q.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM room_bans
+			WHERE
+				room_id = $1
+				AND (
+					participant_id = $2
+					OR ip = $3
+				)
+		) AS banned
+	`, arg.RoomID, arg.ParticipantID, arg.Ip).Scan(&banned)
+
+	return banned, dbError(err)
+}
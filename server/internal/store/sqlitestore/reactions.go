@@ -0,0 +1,104 @@
+package sqlitestore
+
+import (
+	"context"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+// countReactions counts the reactions to the message, in all and of type.
+func countReactions(ctx context.Context, q querier, messageID uuid.UUID, typ string) (total, ofType int64, err error) {
+	err = q.QueryRowContext(ctx, `
+		SELECT
+			(SELECT count(*) FROM message_reactions r WHERE r.message_id = $1),
+			(SELECT count(*) FROM message_reactions r WHERE r.message_id = $1 AND r.type = $2)
+	`, messageID, typ).Scan(&total, &ofType)
+
+	return total, ofType, dbError(err)
+}
+
+// ReactToMessage returns pgx.ErrNoRows when the message is gone or the
+// participant already reacted to it, with whatever type.
+func (s *Store) ReactToMessage(ctx context.Context, arg pgstore.ReactToMessageParams) (pgstore.ReactToMessageRow, error) {
+	var i pgstore.ReactToMessageRow
+
+	err := s.inTx(ctx, func(q querier) error {
+		var typ string
+
+		// The WHERE of the SELECT also keeps SQLite from reading ON
+		// CONFLICT as a join constraint.
+		err := q.QueryRowContext(ctx, `
+			INSERT INTO message_reactions ("message_id", "participant_id", "type", "created_at")
+			SELECT $1, $2, $3, $4
+			WHERE EXISTS (
+				SELECT 1 FROM messages WHERE id = $1 AND deleted_at IS NULL
+			)
+			ON CONFLICT ("message_id", "participant_id") DO NOTHING
+			RETURNING type
+		`, arg.ID, arg.ParticipantID, arg.Type, micros(now())).Scan(&typ)
+
+		if err != nil {
+			return dbError(err)
+		}
+
+		i.ReactionCount, i.Count, err = countReactions(ctx, q, arg.ID, typ)
+
+		return err
+	})
+
+	return i, err
+}
+
+// RemoveReactionFromMessage returns pgx.ErrNoRows when the message is gone
+// or the participant has no reaction to it.
+func (s *Store) RemoveReactionFromMessage(ctx context.Context, arg pgstore.RemoveReactionFromMessageParams) (pgstore.RemoveReactionFromMessageRow, error) {
+	var i pgstore.RemoveReactionFromMessageRow
+
+	err := s.inTx(ctx, func(q querier) error {
+		err := q.QueryRowContext(ctx, `
+			DELETE FROM message_reactions
+			WHERE
+				message_id = $1
+				AND participant_id = $2
+				AND EXISTS (
+					SELECT 1 FROM messages WHERE id = $1 AND deleted_at IS NULL
+				)
+			RETURNING type
+		`, arg.ID, arg.ParticipantID).Scan(&i.Type)
+
+		if err != nil {
+			return dbError(err)
+		}
+
+		i.ReactionCount, i.Count, err = countReactions(ctx, q, arg.ID, i.Type)
+
+		return err
+	})
+
+	return i, err
+}
+
+// LockMessage does nothing: SQLite runs one write transaction at a time, so
+// reactions are counted in the order they commit already.
+func (s *Store) LockMessage(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (s *Store) GetMessagesReactions(ctx context.Context, messageIds []uuid.UUID) ([]pgstore.GetMessagesReactionsRow, error) {
+	return queryRows(ctx, s.q, func(row scanner) (pgstore.GetMessagesReactionsRow, error) {
+		var i pgstore.GetMessagesReactionsRow
+
+		err := row.Scan(&i.MessageID, &i.Type, &i.Count)
+
+		return i, dbError(err)
+	}, `
+		SELECT
+			"message_id", "type", count(*) AS count
+		FROM message_reactions
+		WHERE message_id IN (SELECT value FROM json_each($1))
+		GROUP BY message_id, type
+		ORDER BY message_id, count DESC, type
+	`, uuidList(messageIds))
+}
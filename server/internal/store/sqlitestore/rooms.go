@@ -0,0 +1,303 @@
+package sqlitestore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const roomColumns = `"id", "theme", "created_at", "closed", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter", "change_seq", "updated_at", "deleted_at"`
+
+func scanRoom(row scanner) (pgstore.Room, error) {
+	var i pgstore.Room
+
+	err := row.Scan(
+		&i.ID,
+		&i.Theme,
+		timestamp{&i.CreatedAt},
+		&i.Closed,
+		nullTimestamp{&i.ExpiresAt},
+		&i.Code,
+		&i.Private,
+		&i.AccessCodeHash,
+		&i.Description,
+		&i.HostName,
+		textArray{&i.Tags},
+		nullTimestamp{&i.StartsAt},
+		nullTimestamp{&i.EndsAt},
+		&i.Live,
+		&i.HostTokenHash,
+		&i.Moderated,
+		&i.ContentFilter,
+		&i.ChangeSeq,
+		timestamp{&i.UpdatedAt},
+		nullTimestamp{&i.DeletedAt},
+	)
+
+	return i, dbError(err)
+}
+
+// updateRoom runs an UPDATE of a room returning its id, and reads the room
+// back. RETURNING would give the row as the UPDATE left it, before the
+// triggers bumped its change_seq and updated_at.
+func (s *Store) updateRoom(ctx context.Context, query string, args ...any) (pgstore.Room, error) {
+	var room pgstore.Room
+
+	err := s.inTx(ctx, func(q querier) error {
+		id, err := scanUUID(q.QueryRowContext(ctx, query, args...))
+
+		if err != nil {
+			return err
+		}
+
+		room, err = scanRoom(q.QueryRowContext(ctx, `SELECT `+roomColumns+` FROM rooms WHERE id = $1`, id))
+
+		return err
+	})
+
+	return room, err
+}
+
+func (s *Store) GetRoom(ctx context.Context, id uuid.UUID) (pgstore.Room, error) {
+	return scanRoom(s.q.QueryRowContext(ctx, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+	`, id))
+}
+
+func (s *Store) GetRoomByCode(ctx context.Context, code string) (pgstore.Room, error) {
+	return scanRoom(s.q.QueryRowContext(ctx, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE
+			code = $1
+			AND deleted_at IS NULL
+	`, code))
+}
+
+// matchesRoomQuery is the theme ILIKE '%' || query || '%' filter of the room
+// listings, for the query in $1.
+const matchesRoomQuery = `($1 IS NULL OR ilike("theme", '%' || $1 || '%'))`
+
+func (s *Store) GetRooms(ctx context.Context, arg pgstore.GetRoomsParams) ([]pgstore.Room, error) {
+	return queryRows(ctx, s.q, scanRoom, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE
+			deleted_at IS NULL
+			AND `+matchesRoomQuery+`
+		ORDER BY "created_at" DESC, "id" DESC
+		LIMIT $2 OFFSET $3
+	`, arg.Query, arg.Limit, arg.Offset)
+}
+
+func (s *Store) GetRoomsOldest(ctx context.Context, arg pgstore.GetRoomsOldestParams) ([]pgstore.Room, error) {
+	return queryRows(ctx, s.q, scanRoom, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE
+			deleted_at IS NULL
+			AND `+matchesRoomQuery+`
+		ORDER BY "created_at" ASC, "id" ASC
+		LIMIT $2 OFFSET $3
+	`, arg.Query, arg.Limit, arg.Offset)
+}
+
+func (s *Store) GetRoomsBeforeCursor(ctx context.Context, arg pgstore.GetRoomsBeforeCursorParams) ([]pgstore.Room, error) {
+	return queryRows(ctx, s.q, scanRoom, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE
+			deleted_at IS NULL
+			AND `+matchesRoomQuery+`
+			AND ("created_at", "id") < ($2, $3)
+		ORDER BY "created_at" DESC, "id" DESC
+		LIMIT $4
+	`, arg.Query, micros(arg.CursorCreatedAt), arg.CursorID, arg.Limit)
+}
+
+func (s *Store) GetRoomsAfterCursor(ctx context.Context, arg pgstore.GetRoomsAfterCursorParams) ([]pgstore.Room, error) {
+	return queryRows(ctx, s.q, scanRoom, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE
+			deleted_at IS NULL
+			AND `+matchesRoomQuery+`
+			AND ("created_at", "id") > ($2, $3)
+		ORDER BY "created_at" ASC, "id" ASC
+		LIMIT $4
+	`, arg.Query, micros(arg.CursorCreatedAt), arg.CursorID, arg.Limit)
+}
+
+func (s *Store) CountRooms(ctx context.Context, query pgtype.Text) (int64, error) {
+	var count int64
+
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM rooms
+		WHERE
+			deleted_at IS NULL
+			AND `+matchesRoomQuery+`
+	`, query).Scan(&count)
+
+	return count, dbError(err)
+}
+
+func (s *Store) GetRoomMessageCounts(ctx context.Context, roomIds []uuid.UUID) ([]pgstore.GetRoomMessageCountsRow, error) {
+	return queryRows(ctx, s.q, func(row scanner) (pgstore.GetRoomMessageCountsRow, error) {
+		var i pgstore.GetRoomMessageCountsRow
+
+		err := row.Scan(&i.RoomID, &i.MessageCount)
+
+		return i, dbError(err)
+	}, `
+		SELECT "room_id", COUNT(*) AS "message_count"
+		FROM messages
+		WHERE
+			room_id IN (SELECT value FROM json_each($1))
+			AND deleted_at IS NULL
+			AND approved = 1
+			AND hidden = 0
+		GROUP BY "room_id"
+	`, uuidList(roomIds))
+}
+
+func (s *Store) GetPublicRoomIDs(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	return queryRows(ctx, s.q, scanUUID, `
+		SELECT "id" FROM rooms
+		WHERE
+			id IN (SELECT value FROM json_each($1))
+			AND private = 0
+			AND deleted_at IS NULL
+	`, uuidList(ids))
+}
+
+func (s *Store) InsertRoom(ctx context.Context, arg pgstore.InsertRoomParams) (uuid.UUID, error) {
+	tags := arg.Tags
+
+	if tags == nil {
+		tags = []string{}
+	}
+
+	tagList, err := json.Marshal(tags)
+
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	createdAt := micros(now())
+
+	return scanUUID(s.q.QueryRowContext(ctx, `
+		INSERT INTO rooms
+			( "id", "created_at", "updated_at", "theme", "expires_at", "code", "private", "access_code_hash", "description", "host_name", "tags", "starts_at", "ends_at", "live", "host_token_hash", "moderated", "content_filter" ) VALUES
+			( $1, $2, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16 )
+		RETURNING "id"
+	`,
+		uuid.New(),
+		createdAt,
+		arg.Theme,
+		nullMicros(arg.ExpiresAt),
+		arg.Code,
+		arg.Private,
+		arg.AccessCodeHash,
+		arg.Description,
+		arg.HostName,
+		string(tagList),
+		nullMicros(arg.StartsAt),
+		nullMicros(arg.EndsAt),
+		arg.Live,
+		arg.HostTokenHash,
+		arg.Moderated,
+		arg.ContentFilter,
+	))
+}
+
+func (s *Store) CloseRoom(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE rooms
+		SET
+			closed = 1
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+	`, id)
+
+	return dbError(err)
+}
+
+func (s *Store) CloseExpiredRooms(ctx context.Context) ([]uuid.UUID, error) {
+	return queryRows(ctx, s.q, scanUUID, `
+		UPDATE rooms
+		SET
+			closed = 1
+		WHERE
+			closed = 0
+			AND deleted_at IS NULL
+			AND (expires_at <= $1 OR ends_at <= $1)
+		RETURNING "id"
+	`, micros(now()))
+}
+
+func (s *Store) OpenScheduledRooms(ctx context.Context) ([]uuid.UUID, error) {
+	return queryRows(ctx, s.q, scanUUID, `
+		UPDATE rooms
+		SET
+			live = 1
+		WHERE
+			live = 0
+			AND deleted_at IS NULL
+			AND starts_at <= $1
+		RETURNING "id"
+	`, micros(now()))
+}
+
+func (s *Store) DeleteRoom(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE rooms
+		SET
+			deleted_at = $2
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+	`, id, micros(now()))
+
+	return dbError(err)
+}
+
+func (s *Store) PurgeDeletedRooms(ctx context.Context, deletedAt time.Time) (int64, error) {
+	return execRows(ctx, s.q, `
+		DELETE FROM rooms
+		WHERE deleted_at < $1
+	`, micros(deletedAt))
+}
+
+func (s *Store) UpdateRoomTheme(ctx context.Context, arg pgstore.UpdateRoomThemeParams) (pgstore.Room, error) {
+	return s.updateRoom(ctx, `
+		UPDATE rooms
+		SET
+			theme = $2
+		WHERE
+			id = $1
+			AND deleted_at IS NULL
+		RETURNING "id"
+	`, arg.ID, arg.Theme)
+}
+
+func (s *Store) GetRoomListVersion(ctx context.Context) (pgstore.GetRoomListVersionRow, error) {
+	var version pgstore.GetRoomListVersionRow
+
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COALESCE(max("change_seq"), 0) AS max_change_seq, count(*) AS row_count
+		FROM rooms
+	`).Scan(&version.MaxChangeSeq, &version.RowCount)
+
+	return version, dbError(err)
+}
@@ -0,0 +1,432 @@
+// Package sqlitestore keeps the store in a SQLite database, for small
+// self-hosted deployments that would rather not run Postgres.
+//
+// Its schema is the Postgres one, triggers included, and its queries those
+// of pgstore, down to the errors: missing rows are pgx.ErrNoRows and
+// violated constraints are *pgconn.PgError with the Postgres codes. ILIKE,
+// pg_trgm similarity and the websearch_to_tsquery search are functions
+// registered with the driver, which match text the way memstore does.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"server/internal/store"
+	"server/internal/store/sqlitestore/migrations"
+	"server/internal/store/textsearch"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// busyTimeout is how long a write waits for the one that holds the
+// database, since SQLite runs a single writer at a time.
+const busyTimeout = 5 * time.Second
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("ilike", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok := args[0].(string)
+
+		pattern, patternOK := args[1].(string)
+
+		if !ok || !patternOK {
+			return nil, nil
+		}
+
+		return textsearch.ILike(s, pattern), nil
+	})
+
+	sqlite.MustRegisterDeterministicScalarFunction("similarity", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		a, ok := args[0].(string)
+
+		b, bOK := args[1].(string)
+
+		if !ok || !bOK {
+			return nil, nil
+		}
+
+		return float64(textsearch.TrigramSimilarity(textsearch.Trigrams(a), textsearch.Trigrams(b))), nil
+	})
+
+	// websearch_rank(text, query) is the rank of text for the
+	// websearch_to_tsquery query, or NULL when it doesn't match.
+	sqlite.MustRegisterDeterministicScalarFunction("websearch_rank", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		text, ok := args[0].(string)
+
+		query, queryOK := args[1].(string)
+
+		if !ok || !queryOK {
+			return nil, nil
+		}
+
+		rank, matched := textsearch.ParseWebSearch(query).Match(text)
+
+		if !matched {
+			return nil, nil
+		}
+
+		return int64(rank), nil
+	})
+}
+
+// Store is a store.Store on a SQLite database. The zero value is not
+// usable, use Open.
+type Store struct {
+	db *sql.DB
+
+	// q runs the queries: db, or the transaction of a Store given to
+	// WithTx.
+	q querier
+
+	// tx is the transaction of a Store given to WithTx, and depth the
+	// number of savepoints it is nested in.
+	tx    *sql.Tx
+	depth int
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var _ store.Store = (*Store)(nil)
+
+// Open opens the SQLite database at path, creating it if need be, and
+// applies the migrations it doesn't have yet.
+func Open(ctx context.Context, path string) (*Store, error) {
+	// Foreign keys are off unless asked for, on every connection. WAL lets
+	// reads go on while a write runs, and transactions take the write lock
+	// up front, so that two of them never deadlock upgrading their read
+	// locks.
+	params := url.Values{}
+
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	if err := migrations.Run(ctx, db); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return &Store{db: db, q: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) WithTx(ctx context.Context, fn func(q store.Store) error) error {
+	if s.tx != nil {
+		return s.withSavepoint(ctx, fn)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return dbError(err)
+	}
+
+	// Rolling back after the commit does nothing, and covers fn panicking.
+	defer tx.Rollback()
+
+	if err := fn(&Store{db: s.db, q: tx, tx: tx}); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+// withSavepoint nests fn in a savepoint of the transaction of s, named
+// after its depth like pgx names its own.
+func (s *Store) withSavepoint(ctx context.Context, fn func(q store.Store) error) (err error) {
+	name := fmt.Sprintf("sp_%d", s.depth+1)
+
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return dbError(err)
+	}
+
+	released := false
+
+	defer func() {
+		if !released {
+			// ROLLBACK TO leaves the savepoint in place, RELEASE removes it.
+			_, _ = s.tx.ExecContext(context.Background(), "ROLLBACK TO "+name)
+			_, _ = s.tx.ExecContext(context.Background(), "RELEASE "+name)
+		}
+	}()
+
+	if err := fn(&Store{db: s.db, q: s.tx, tx: s.tx, depth: s.depth + 1}); err != nil {
+		return err
+	}
+
+	if _, err := s.tx.ExecContext(ctx, "RELEASE "+name); err != nil {
+		return dbError(err)
+	}
+
+	released = true
+
+	return nil
+}
+
+// inTx runs fn on the transaction of s, or on a transaction of its own for
+// the queries that take more than one statement.
+func (s *Store) inTx(ctx context.Context, fn func(q querier) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return dbError(err)
+	}
+
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+// now is the current time at the precision the store keeps.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// micros is the column value of a timestamp.
+func micros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// nullMicros is the column value of a nullable timestamp.
+func nullMicros(t pgtype.Timestamptz) any {
+	if !t.Valid {
+		return nil
+	}
+
+	return micros(t.Time)
+}
+
+// nullBytes keeps a nil slice NULL, which the driver would store as an
+// empty blob.
+func nullBytes(b []byte) any {
+	if b == nil {
+		return nil
+	}
+
+	return b
+}
+
+// uuidList is the JSON array that queries read ids from with json_each,
+// in place of the uuid[] parameters of Postgres.
+func uuidList(ids []uuid.UUID) string {
+	if ids == nil {
+		ids = []uuid.UUID{}
+	}
+
+	list, _ := json.Marshal(ids)
+
+	return string(list)
+}
+
+// timestamp scans a timestamp column into t.
+type timestamp struct {
+	t *time.Time
+}
+
+func (s timestamp) Scan(src any) error {
+	us, ok := src.(int64)
+
+	if !ok {
+		return fmt.Errorf("sqlitestore: cannot scan %T into a timestamp", src)
+	}
+
+	*s.t = time.UnixMicro(us)
+
+	return nil
+}
+
+// nullTimestamp scans a nullable timestamp column into t.
+type nullTimestamp struct {
+	t *pgtype.Timestamptz
+}
+
+func (s nullTimestamp) Scan(src any) error {
+	if src == nil {
+		*s.t = pgtype.Timestamptz{}
+
+		return nil
+	}
+
+	var t time.Time
+
+	if err := (timestamp{&t}).Scan(src); err != nil {
+		return err
+	}
+
+	*s.t = pgtype.Timestamptz{Time: t, Valid: true}
+
+	return nil
+}
+
+// textArray scans a JSON array of strings into a.
+type textArray struct {
+	a *[]string
+}
+
+func (s textArray) Scan(src any) error {
+	var data []byte
+
+	switch src := src.(type) {
+	case string:
+		data = []byte(src)
+	case []byte:
+		data = src
+	default:
+		return fmt.Errorf("sqlitestore: cannot scan %T into a text array", src)
+	}
+
+	*s.a = []string{}
+
+	return json.Unmarshal(data, s.a)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// queryRows runs a query and scans its rows with scan. Like sqlc, it
+// returns nil rather than an empty slice.
+func queryRows[T any](ctx context.Context, q querier, scan func(scanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	defer rows.Close()
+
+	var items []T
+
+	for rows.Next() {
+		item, err := scan(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return items, nil
+}
+
+// execRows runs a statement and returns the number of rows it changed.
+func execRows(ctx context.Context, q querier, query string, args ...any) (int64, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	n, err := result.RowsAffected()
+
+	return n, dbError(err)
+}
+
+func scanUUID(row scanner) (uuid.UUID, error) {
+	var id uuid.UUID
+
+	err := row.Scan(&id)
+
+	return id, dbError(err)
+}
+
+// uniqueConstraints names the unique constraints of the columns SQLite
+// reports instead.
+var uniqueConstraints = map[string]string{
+	"rooms.code": "rooms_code_key",
+}
+
+// constraintFailed matches what SQLite says after "constraint failed:",
+// the columns of a unique constraint or the name of a check constraint.
+var constraintFailed = regexp.MustCompile(`constraint failed: (.+?)(?: \(\d+\))?$`)
+
+// dbError reports missing rows and violated constraints the way pgx does.
+func dbError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+
+	var sqliteErr *sqlite.Error
+
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	var code, constraint string
+
+	if match := constraintFailed.FindStringSubmatch(sqliteErr.Error()); match != nil {
+		constraint = match[1]
+	}
+
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		code = "23505"
+
+		if name, ok := uniqueConstraints[constraint]; ok {
+			constraint = name
+		}
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		// SQLite doesn't tell which foreign key failed.
+		code, constraint = "23503", ""
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		code = "23514"
+	default:
+		return err
+	}
+
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           code,
+		Message:        strings.TrimPrefix(sqliteErr.Error(), "constraint failed: "),
+		ConstraintName: constraint,
+	}
+}
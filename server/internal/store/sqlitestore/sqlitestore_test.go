@@ -0,0 +1,38 @@
+package sqlitestore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"server/internal/store"
+	"server/internal/store/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := Open(context.Background(), filepath.Join(t.TempDir(), "wsrs.db"))
+
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+
+		t.Cleanup(func() { s.Close() })
+
+		return s
+	})
+}
+
+func TestOpenTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wsrs.db")
+
+	for range 2 {
+		s, err := Open(context.Background(), path)
+
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+
+		s.Close()
+	}
+}
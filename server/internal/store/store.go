@@ -0,0 +1,28 @@
+// Package store is the persistence the API handlers run on, whatever the
+// database behind it.
+package store
+
+import (
+	"context"
+
+	"server/internal/store/pgstore"
+)
+
+// Store runs every query of the API handlers. Queries take and return the
+// params and rows of pgstore, whose Queries runs them on Postgres and which
+// Postgres wraps with transactions; other backends, and mocks, implement the
+// same methods.
+//
+// The handlers tell errors apart the way pgx reports them, so other backends
+// report missing rows with pgx.ErrNoRows and unique violations with a
+// *pgconn.PgError of code 23505. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	pgstore.Querier
+
+	// WithTx runs fn in a transaction, committed when fn returns nil and
+	// rolled back otherwise, or when it panics. fn must run its queries on
+	// the Store it is given, which like a pgx.Tx is not safe for concurrent
+	// use. Calling WithTx on that Store nests a savepoint.
+	WithTx(ctx context.Context, fn func(q Store) error) error
+}
@@ -0,0 +1,800 @@
+// Package storetest checks that a store.Store behaves like the Postgres
+// queries of pgstore, for the backends that stand in for them.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"server/internal/store"
+	"server/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Run runs the tests on the stores newStore returns, a new empty one for
+// each test.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.Store)
+	}{
+		{"Rooms", testRooms},
+		{"RoomCodeUnique", testRoomCodeUnique},
+		{"RoomListVersion", testRoomListVersion},
+		{"RoomListVersionAfterPurge", testRoomListVersionAfterPurge},
+		{"Messages", testMessages},
+		{"MessageForeignKeys", testMessageForeignKeys},
+		{"MessageCursors", testMessageCursors},
+		{"Reactions", testReactions},
+		{"MergeMessages", testMergeMessages},
+		{"Search", testSearch},
+		{"Moderation", testModeration},
+		{"Purge", testPurge},
+		{"Idempotency", testIdempotency},
+		{"Tx", testTx},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func insertRoom(t *testing.T, s store.Store, code string) pgstore.Room {
+	t.Helper()
+
+	ctx := context.Background()
+
+	id, err := s.InsertRoom(ctx, pgstore.InsertRoomParams{
+		Theme: "Theme " + code,
+		Code:  code,
+		Tags:  []string{"go", "sql"},
+		Live:  true,
+	})
+
+	if err != nil {
+		t.Fatalf("InsertRoom: %v", err)
+	}
+
+	room, err := s.GetRoom(ctx, id)
+
+	if err != nil {
+		t.Fatalf("GetRoom: %v", err)
+	}
+
+	return room
+}
+
+func insertMessage(t *testing.T, s store.Store, roomID uuid.UUID, text string) pgstore.Message {
+	t.Helper()
+
+	ctx := context.Background()
+
+	id, err := s.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: roomID, Message: text, Approved: true})
+
+	if err != nil {
+		t.Fatalf("InsertMessage: %v", err)
+	}
+
+	message, err := s.GetMessage(ctx, id)
+
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+
+	// Messages of the same microsecond would be listed by id rather than in
+	// the order they were inserted.
+	time.Sleep(time.Millisecond)
+
+	return message
+}
+
+func pgCode(err error) string {
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+
+	return ""
+}
+
+func ids[T any](rows []T, id func(T) uuid.UUID) []uuid.UUID {
+	var list []uuid.UUID
+
+	for _, row := range rows {
+		list = append(list, id(row))
+	}
+
+	return list
+}
+
+func messageID(m pgstore.Message) uuid.UUID {
+	return m.ID
+}
+
+func equalIDs(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func testRooms(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	if room.Theme != "Theme AAAAAA" || len(room.Tags) != 2 || !room.Live || room.Closed || room.DeletedAt.Valid {
+		t.Fatalf("GetRoom = %+v", room)
+	}
+
+	if got, err := s.GetRoomByCode(ctx, "AAAAAA"); err != nil || got.ID != room.ID {
+		t.Fatalf("GetRoomByCode = %v, %v", got.ID, err)
+	}
+
+	other := insertRoom(t, s, "BBBBBB")
+
+	rooms, err := s.GetRooms(ctx, pgstore.GetRoomsParams{Query: pgtype.Text{String: "theme bb", Valid: true}, Limit: 10})
+
+	if err != nil || !equalIDs(ids(rooms, func(r pgstore.Room) uuid.UUID { return r.ID }), []uuid.UUID{other.ID}) {
+		t.Fatalf("GetRooms matching \"theme bb\" = %v, %v", rooms, err)
+	}
+
+	if count, err := s.CountRooms(ctx, pgtype.Text{}); err != nil || count != 2 {
+		t.Fatalf("CountRooms = %d, %v, want 2", count, err)
+	}
+
+	updated, err := s.UpdateRoomTheme(ctx, pgstore.UpdateRoomThemeParams{ID: room.ID, Theme: "New theme"})
+
+	if err != nil {
+		t.Fatalf("UpdateRoomTheme: %v", err)
+	}
+
+	if updated.Theme != "New theme" || updated.ChangeSeq <= room.ChangeSeq {
+		t.Fatalf("UpdateRoomTheme = %+v, want a new theme and change_seq", updated)
+	}
+
+	if err := s.DeleteRoom(ctx, room.ID); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+
+	if _, err := s.GetRoom(ctx, room.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("GetRoom of a deleted room = %v, want pgx.ErrNoRows", err)
+	}
+
+	if _, err := s.UpdateRoomTheme(ctx, pgstore.UpdateRoomThemeParams{ID: room.ID, Theme: "x"}); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("UpdateRoomTheme of a deleted room = %v, want pgx.ErrNoRows", err)
+	}
+
+	public, err := s.GetPublicRoomIDs(ctx, []uuid.UUID{room.ID, other.ID})
+
+	if err != nil || !equalIDs(public, []uuid.UUID{other.ID}) {
+		t.Fatalf("GetPublicRoomIDs = %v, %v", public, err)
+	}
+}
+
+func testRoomCodeUnique(t *testing.T, s store.Store) {
+	insertRoom(t, s, "AAAAAA")
+
+	_, err := s.InsertRoom(context.Background(), pgstore.InsertRoomParams{Theme: "Other", Code: "AAAAAA"})
+
+	if pgCode(err) != "23505" {
+		t.Fatalf("InsertRoom with a taken code = %v, want a unique violation", err)
+	}
+}
+
+func testRoomListVersion(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	version := func() pgstore.GetRoomListVersionRow {
+		t.Helper()
+
+		v, err := s.GetRoomListVersion(ctx)
+
+		if err != nil {
+			t.Fatalf("GetRoomListVersion: %v", err)
+		}
+
+		return v
+	}
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	before := version()
+
+	message := insertMessage(t, s, room.ID, "Hello")
+
+	afterMessage := version()
+
+	if afterMessage == before {
+		t.Fatal("inserting a message left the room list version be")
+	}
+
+	messagesBefore, err := s.GetRoomMessagesVersion(ctx, room.ID)
+
+	if err != nil {
+		t.Fatalf("GetRoomMessagesVersion: %v", err)
+	}
+
+	if _, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: message.ID, ParticipantID: uuid.New(), Type: "like"}); err != nil {
+		t.Fatalf("ReactToMessage: %v", err)
+	}
+
+	if version() != afterMessage {
+		t.Fatal("a reaction changed the room list version")
+	}
+
+	if messagesAfter, _ := s.GetRoomMessagesVersion(ctx, room.ID); messagesAfter == messagesBefore {
+		t.Fatal("a reaction left the messages version be")
+	}
+
+	got, err := s.GetRoom(ctx, room.ID)
+
+	if err != nil {
+		t.Fatalf("GetRoom: %v", err)
+	}
+
+	if !got.UpdatedAt.Equal(room.UpdatedAt) {
+		t.Fatalf("a message moved the updated_at of its room from %v to %v", room.UpdatedAt, got.UpdatedAt)
+	}
+}
+
+// testRoomListVersionAfterPurge checks that purging a room doesn't bring the version
+// back to one it had before the rest of the list changed, as a sum of the
+// change_seq of the rooms would on a new store.
+func testRoomListVersionAfterPurge(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+	other := insertRoom(t, s, "BBBBBB")
+
+	before, err := s.GetRoomListVersion(ctx)
+
+	if err != nil {
+		t.Fatalf("GetRoomListVersion: %v", err)
+	}
+
+	if _, err := s.UpdateRoomTheme(ctx, pgstore.UpdateRoomThemeParams{ID: room.ID, Theme: "Renamed"}); err != nil {
+		t.Fatalf("UpdateRoomTheme: %v", err)
+	}
+
+	if err := s.DeleteRoom(ctx, other.ID); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+
+	if n, err := s.PurgeDeletedRooms(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("PurgeDeletedRooms = %d, %v", n, err)
+	}
+
+	if after, _ := s.GetRoomListVersion(ctx); after == before {
+		t.Fatalf("the room list version is back to %+v after a rename and a purge", before)
+	}
+}
+
+func testMessages(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	first := insertMessage(t, s, room.ID, "First")
+	second := insertMessage(t, s, room.ID, "Second")
+
+	author := uuid.New()
+
+	hiddenID, err := s.InsertMessage(ctx, pgstore.InsertMessageParams{
+		RoomID:        room.ID,
+		Message:       "Hidden",
+		Approved:      true,
+		ParticipantID: uuid.NullUUID{UUID: author, Valid: true},
+	})
+
+	if err != nil {
+		t.Fatalf("InsertMessage: %v", err)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	if _, err := s.SetMessageHidden(ctx, pgstore.SetMessageHiddenParams{ID: hiddenID, Hidden: true}); err != nil {
+		t.Fatalf("SetMessageHidden: %v", err)
+	}
+
+	if _, err := s.InsertMessage(ctx, pgstore.InsertMessageParams{
+		RoomID:          room.ID,
+		Message:         "Reply",
+		Approved:        true,
+		ParentMessageID: uuid.NullUUID{UUID: first.ID, Valid: true},
+	}); err != nil {
+		t.Fatalf("InsertMessage of a reply: %v", err)
+	}
+
+	list, err := s.GetRoomMessages(ctx, pgstore.GetRoomMessagesParams{RoomID: room.ID, Limit: 10})
+
+	if err != nil || !equalIDs(ids(list, messageID), []uuid.UUID{first.ID, second.ID}) {
+		t.Fatalf("GetRoomMessages = %v, %v, want the first and second messages", ids(list, messageID), err)
+	}
+
+	list, err = s.GetRoomMessages(ctx, pgstore.GetRoomMessagesParams{
+		RoomID:   room.ID,
+		ViewerID: uuid.NullUUID{UUID: author, Valid: true},
+		Limit:    10,
+	})
+
+	if err != nil || !equalIDs(ids(list, messageID), []uuid.UUID{first.ID, second.ID, hiddenID}) {
+		t.Fatalf("GetRoomMessages for the author of the hidden message = %v, %v", ids(list, messageID), err)
+	}
+
+	pinned, err := s.SetMessagePinned(ctx, pgstore.SetMessagePinnedParams{ID: second.ID, Pinned: true})
+
+	if err != nil {
+		t.Fatalf("SetMessagePinned: %v", err)
+	}
+
+	if !pinned.Pinned || pinned.ChangeSeq <= second.ChangeSeq || pinned.UpdatedAt.Before(second.UpdatedAt) {
+		t.Fatalf("SetMessagePinned = %+v, want it pinned with a new change_seq", pinned)
+	}
+
+	list, err = s.GetRoomMessages(ctx, pgstore.GetRoomMessagesParams{RoomID: room.ID, Limit: 10})
+
+	if err != nil || !equalIDs(ids(list, messageID), []uuid.UUID{second.ID, first.ID}) {
+		t.Fatalf("GetRoomMessages with the second message pinned = %v, %v", ids(list, messageID), err)
+	}
+
+	answered, err := s.MarkMessageAsAnswered(ctx, pgstore.MarkMessageAsAnsweredParams{
+		ID:     first.ID,
+		Answer: pgtype.Text{String: "Yes", Valid: true},
+	})
+
+	if err != nil || !answered.Answered || answered.Answer.String != "Yes" {
+		t.Fatalf("MarkMessageAsAnswered = %+v, %v", answered, err)
+	}
+
+	list, err = s.GetRoomMessages(ctx, pgstore.GetRoomMessagesParams{
+		RoomID:   room.ID,
+		Answered: pgtype.Bool{Bool: false, Valid: true},
+		Limit:    10,
+	})
+
+	if err != nil || !equalIDs(ids(list, messageID), []uuid.UUID{second.ID}) {
+		t.Fatalf("GetRoomMessages of unanswered messages = %v, %v", ids(list, messageID), err)
+	}
+
+	marked, err := s.MarkMessagesAsAnswered(ctx, pgstore.MarkMessagesAsAnsweredParams{RoomID: room.ID, Ids: []uuid.UUID{first.ID, second.ID}})
+
+	if err != nil || !equalIDs(ids(marked, messageID), []uuid.UUID{second.ID}) {
+		t.Fatalf("MarkMessagesAsAnswered = %v, %v, want the second message alone", ids(marked, messageID), err)
+	}
+
+	replies, err := s.GetMessageReplies(ctx, pgstore.GetMessageRepliesParams{ParentMessageID: uuid.NullUUID{UUID: first.ID, Valid: true}})
+
+	if err != nil || len(replies) != 1 || replies[0].Message != "Reply" {
+		t.Fatalf("GetMessageReplies = %v, %v", replies, err)
+	}
+
+	stats, err := s.GetRoomStats(ctx, room.ID)
+
+	if err != nil || stats.MessageCount != 2 || stats.AnsweredCount != 2 {
+		t.Fatalf("GetRoomStats = %+v, %v", stats, err)
+	}
+
+	if err := s.SoftDeleteMessage(ctx, first.ID); err != nil {
+		t.Fatalf("SoftDeleteMessage: %v", err)
+	}
+
+	if _, err := s.GetMessage(ctx, first.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("GetMessage of a deleted message = %v, want pgx.ErrNoRows", err)
+	}
+
+	if _, err := s.UpdateMessage(ctx, pgstore.UpdateMessageParams{ID: first.ID, Message: "x"}); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("UpdateMessage of a deleted message = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func testMessageForeignKeys(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	_, err := s.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: uuid.New(), Message: "Hello", Approved: true})
+
+	if pgCode(err) != "23503" {
+		t.Fatalf("InsertMessage in a missing room = %v, want a foreign key violation", err)
+	}
+
+	_, err = s.InsertRoomBan(ctx, pgstore.InsertRoomBanParams{RoomID: insertRoom(t, s, "AAAAAA").ID})
+
+	if pgCode(err) != "23514" {
+		t.Fatalf("InsertRoomBan of nobody = %v, want a check violation", err)
+	}
+}
+
+func testMessageCursors(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	var all []uuid.UUID
+
+	for range 5 {
+		all = append(all, insertMessage(t, s, room.ID, "Message").ID)
+	}
+
+	page, err := s.GetRoomMessages(ctx, pgstore.GetRoomMessagesParams{RoomID: room.ID, Limit: 2})
+
+	if err != nil || !equalIDs(ids(page, messageID), all[:2]) {
+		t.Fatalf("GetRoomMessages = %v, %v", ids(page, messageID), err)
+	}
+
+	last := page[len(page)-1]
+
+	next, err := s.GetRoomMessagesAfterCursor(ctx, pgstore.GetRoomMessagesAfterCursorParams{
+		RoomID:          room.ID,
+		CursorPinned:    last.Pinned,
+		CursorCreatedAt: last.CreatedAt,
+		CursorID:        last.ID,
+		Limit:           10,
+	})
+
+	if err != nil || !equalIDs(ids(next, messageID), all[2:]) {
+		t.Fatalf("GetRoomMessagesAfterCursor = %v, %v, want %v", ids(next, messageID), err, all[2:])
+	}
+
+	newest, err := s.GetRoomMessagesNewest(ctx, pgstore.GetRoomMessagesNewestParams{RoomID: room.ID, Limit: 1})
+
+	if err != nil || !equalIDs(ids(newest, messageID), all[4:]) {
+		t.Fatalf("GetRoomMessagesNewest = %v, %v", ids(newest, messageID), err)
+	}
+
+	before, err := s.GetRoomMessagesBeforeCursor(ctx, pgstore.GetRoomMessagesBeforeCursorParams{
+		RoomID:          room.ID,
+		CursorPinned:    newest[0].Pinned,
+		CursorCreatedAt: newest[0].CreatedAt,
+		CursorID:        newest[0].ID,
+		Limit:           2,
+	})
+
+	if err != nil || !equalIDs(ids(before, messageID), []uuid.UUID{all[3], all[2]}) {
+		t.Fatalf("GetRoomMessagesBeforeCursor = %v, %v", ids(before, messageID), err)
+	}
+
+	export, err := s.GetRoomMessagesForExport(ctx, pgstore.GetRoomMessagesForExportParams{RoomID: room.ID, Limit: 10})
+
+	if err != nil || !equalIDs(ids(export, messageID), all) {
+		t.Fatalf("GetRoomMessagesForExport = %v, %v", ids(export, messageID), err)
+	}
+}
+
+func testReactions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	message := insertMessage(t, s, room.ID, "Hello")
+
+	alice, bob := uuid.New(), uuid.New()
+
+	if row, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: message.ID, ParticipantID: alice, Type: "like"}); err != nil || row != (pgstore.ReactToMessageRow{ReactionCount: 1, Count: 1}) {
+		t.Fatalf("ReactToMessage = %+v, %v", row, err)
+	}
+
+	if row, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: message.ID, ParticipantID: bob, Type: "heart"}); err != nil || row != (pgstore.ReactToMessageRow{ReactionCount: 2, Count: 1}) {
+		t.Fatalf("ReactToMessage = %+v, %v", row, err)
+	}
+
+	if _, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: message.ID, ParticipantID: alice, Type: "heart"}); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("ReactToMessage twice = %v, want pgx.ErrNoRows", err)
+	}
+
+	if got, _ := s.GetMessage(ctx, message.ID); got.ReactionCount != 2 {
+		t.Fatalf("reaction_count = %d, want 2", got.ReactionCount)
+	}
+
+	counts, err := s.GetMessagesReactions(ctx, []uuid.UUID{message.ID})
+
+	if err != nil || len(counts) != 2 || counts[0].Type != "heart" || counts[1].Type != "like" {
+		t.Fatalf("GetMessagesReactions = %+v, %v", counts, err)
+	}
+
+	row, err := s.RemoveReactionFromMessage(ctx, pgstore.RemoveReactionFromMessageParams{ID: message.ID, ParticipantID: alice})
+
+	if err != nil || row != (pgstore.RemoveReactionFromMessageRow{ReactionCount: 1, Type: "like", Count: 0}) {
+		t.Fatalf("RemoveReactionFromMessage = %+v, %v", row, err)
+	}
+
+	if _, err := s.RemoveReactionFromMessage(ctx, pgstore.RemoveReactionFromMessageParams{ID: message.ID, ParticipantID: alice}); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("RemoveReactionFromMessage twice = %v, want pgx.ErrNoRows", err)
+	}
+
+	top := insertMessage(t, s, room.ID, "Top")
+
+	for range 3 {
+		if _, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: top.ID, ParticipantID: uuid.New(), Type: "like"}); err != nil {
+			t.Fatalf("ReactToMessage: %v", err)
+		}
+	}
+
+	list, err := s.GetTopRoomMessages(ctx, pgstore.GetTopRoomMessagesParams{RoomID: room.ID, Limit: 10})
+
+	if err != nil || !equalIDs(ids(list, messageID), []uuid.UUID{top.ID, message.ID}) {
+		t.Fatalf("GetTopRoomMessages = %v, %v", ids(list, messageID), err)
+	}
+
+	ranks, err := s.GetMessageRanks(ctx, pgstore.GetMessageRanksParams{RoomID: room.ID, MessageIds: []uuid.UUID{message.ID}})
+
+	if err != nil || len(ranks) != 1 || ranks[0].Rank != 2 {
+		t.Fatalf("GetMessageRanks = %+v, %v", ranks, err)
+	}
+}
+
+func testMergeMessages(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	target := insertMessage(t, s, room.ID, "How do I deploy?")
+	duplicate := insertMessage(t, s, room.ID, "How do I deploy it?")
+
+	both, onlyDuplicate := uuid.New(), uuid.New()
+
+	for _, react := range []pgstore.ReactToMessageParams{
+		{ID: target.ID, ParticipantID: both, Type: "like"},
+		{ID: duplicate.ID, ParticipantID: both, Type: "like"},
+		{ID: duplicate.ID, ParticipantID: onlyDuplicate, Type: "heart"},
+	} {
+		if _, err := s.ReactToMessage(ctx, react); err != nil {
+			t.Fatalf("ReactToMessage: %v", err)
+		}
+	}
+
+	similar, err := s.FindSimilarMessages(ctx, pgstore.FindSimilarMessagesParams{Message: "how to deploy", RoomID: room.ID, ExcludeID: uuid.New()})
+
+	if err != nil || len(similar) != 2 {
+		t.Fatalf("FindSimilarMessages = %+v, %v", similar, err)
+	}
+
+	if n, err := s.MergeMessages(ctx, pgstore.MergeMessagesParams{TargetID: target.ID, DuplicateID: duplicate.ID}); err != nil || n != 1 {
+		t.Fatalf("MergeMessages = %d, %v", n, err)
+	}
+
+	if got, _ := s.GetMessage(ctx, target.ID); got.ReactionCount != 2 {
+		t.Fatalf("reaction_count of the target = %d, want 2", got.ReactionCount)
+	}
+
+	if n, err := s.MergeMessages(ctx, pgstore.MergeMessagesParams{TargetID: target.ID, DuplicateID: duplicate.ID}); err != nil || n != 0 {
+		t.Fatalf("MergeMessages of a merged message = %d, %v", n, err)
+	}
+}
+
+func testSearch(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	deploy := insertMessage(t, s, room.ID, "How do we deploy the server?")
+	insertMessage(t, s, room.ID, "Which database should we use?")
+	both := insertMessage(t, s, room.ID, "Deploy the database before you deploy the server")
+
+	found, err := s.SearchRoomMessages(ctx, pgstore.SearchRoomMessagesParams{RoomID: room.ID, Query: "deploy -database", Limit: 10})
+
+	if err != nil || !equalIDs(ids(found, messageID), []uuid.UUID{deploy.ID}) {
+		t.Fatalf("SearchRoomMessages(deploy -database) = %v, %v", ids(found, messageID), err)
+	}
+
+	found, err = s.SearchRoomMessages(ctx, pgstore.SearchRoomMessagesParams{RoomID: room.ID, Query: "deploy", Limit: 10})
+
+	if err != nil || !equalIDs(ids(found, messageID), []uuid.UUID{both.ID, deploy.ID}) {
+		t.Fatalf("SearchRoomMessages(deploy) = %v, %v, want the message with the most matches first", ids(found, messageID), err)
+	}
+}
+
+func testModeration(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	message := insertMessage(t, s, room.ID, "Spam")
+
+	reporter := uuid.New()
+
+	for _, report := range []struct {
+		reason string
+		want   int64
+	}{
+		{"spam", 1},
+		{"again", 0},
+	} {
+		n, err := s.InsertMessageReport(ctx, pgstore.InsertMessageReportParams{MessageID: message.ID, ParticipantID: reporter, Reason: report.reason})
+
+		if err != nil || n != report.want {
+			t.Fatalf("InsertMessageReport(%q) = %d, %v, want %d", report.reason, n, err, report.want)
+		}
+	}
+
+	if _, err := s.InsertMessageReport(ctx, pgstore.InsertMessageReportParams{MessageID: message.ID, ParticipantID: uuid.New(), Reason: "ads"}); err != nil {
+		t.Fatalf("InsertMessageReport: %v", err)
+	}
+
+	reported, err := s.GetRoomReportedMessages(ctx, room.ID)
+
+	if err != nil || len(reported) != 1 || reported[0].ReportCount != 2 || len(reported[0].Reasons) != 2 || reported[0].Reasons[0] != "spam" {
+		t.Fatalf("GetRoomReportedMessages = %+v, %v", reported, err)
+	}
+
+	participant := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+
+	ban, err := s.InsertRoomBan(ctx, pgstore.InsertRoomBanParams{RoomID: room.ID, ParticipantID: participant, Reason: "spam"})
+
+	if err != nil || ban.RoomID != room.ID || ban.ParticipantID != participant {
+		t.Fatalf("InsertRoomBan = %+v, %v", ban, err)
+	}
+
+	if banned, err := s.IsBannedFromRoom(ctx, pgstore.IsBannedFromRoomParams{RoomID: room.ID, ParticipantID: participant}); err != nil || !banned {
+		t.Fatalf("IsBannedFromRoom = %v, %v, want true", banned, err)
+	}
+
+	if banned, err := s.IsBannedFromRoom(ctx, pgstore.IsBannedFromRoomParams{RoomID: room.ID, Ip: pgtype.Text{String: "10.0.0.1", Valid: true}}); err != nil || banned {
+		t.Fatalf("IsBannedFromRoom of another ip = %v, %v, want false", banned, err)
+	}
+
+	if n, err := s.DeleteRoomBan(ctx, pgstore.DeleteRoomBanParams{ID: ban.ID, RoomID: room.ID}); err != nil || n != 1 {
+		t.Fatalf("DeleteRoomBan = %d, %v", n, err)
+	}
+
+	if err := s.InsertAuditLogEntry(ctx, pgstore.InsertAuditLogEntryParams{RoomID: room.ID, Actor: "host", Action: "ban"}); err != nil {
+		t.Fatalf("InsertAuditLogEntry: %v", err)
+	}
+
+	if entries, err := s.GetRoomAuditLog(ctx, pgstore.GetRoomAuditLogParams{RoomID: room.ID, Limit: 10}); err != nil || len(entries) != 1 || entries[0].Action != "ban" {
+		t.Fatalf("GetRoomAuditLog = %+v, %v", entries, err)
+	}
+
+	if err := s.InsertAuditLogEntry(ctx, pgstore.InsertAuditLogEntryParams{RoomID: uuid.New(), Actor: "host", Action: "ban"}); pgCode(err) != "23503" {
+		t.Fatalf("InsertAuditLogEntry of a missing room = %v, want a foreign key violation", err)
+	}
+}
+
+func testPurge(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	message := insertMessage(t, s, room.ID, "Hello")
+
+	if _, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{ID: message.ID, ParticipantID: uuid.New(), Type: "like"}); err != nil {
+		t.Fatalf("ReactToMessage: %v", err)
+	}
+
+	if err := s.DeleteRoom(ctx, room.ID); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+
+	if n, err := s.PurgeDeletedRooms(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("PurgeDeletedRooms = %d, %v", n, err)
+	}
+
+	if counts, err := s.GetMessagesReactions(ctx, []uuid.UUID{message.ID}); err != nil || len(counts) != 0 {
+		t.Fatalf("GetMessagesReactions after the purge = %+v, %v", counts, err)
+	}
+
+	if version, err := s.GetRoomMessagesVersion(ctx, room.ID); err != nil || version != (pgstore.GetRoomMessagesVersionRow{}) {
+		t.Fatalf("GetRoomMessagesVersion after the purge = %+v, %v, want zero", version, err)
+	}
+}
+
+func testIdempotency(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	reserve := pgstore.ReserveIdempotencyKeyParams{Caller: "c", Key: "k", Method: "POST", Path: "/rooms", RequestHash: "h"}
+
+	for want := int64(1); want >= 0; want-- {
+		if n, err := s.ReserveIdempotencyKey(ctx, reserve); err != nil || n != want {
+			t.Fatalf("ReserveIdempotencyKey = %d, %v, want %d", n, err, want)
+		}
+	}
+
+	get := pgstore.GetIdempotencyKeyParams{Caller: "c", Key: "k", Method: "POST", Path: "/rooms"}
+
+	if key, err := s.GetIdempotencyKey(ctx, get); err != nil || key.StatusCode.Valid || key.Body != nil || key.RequestHash != "h" {
+		t.Fatalf("GetIdempotencyKey of a pending key = %+v, %v", key, err)
+	}
+
+	err := s.CompleteIdempotencyKey(ctx, pgstore.CompleteIdempotencyKeyParams{
+		StatusCode:  pgtype.Int4{Int32: 201, Valid: true},
+		ContentType: pgtype.Text{String: "application/json", Valid: true},
+		Body:        []byte(`{"id":1}`),
+		Caller:      "c",
+		Key:         "k",
+		Method:      "POST",
+		Path:        "/rooms",
+	})
+
+	if err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+
+	if key, err := s.GetIdempotencyKey(ctx, get); err != nil || key.StatusCode.Int32 != 201 || string(key.Body) != `{"id":1}` {
+		t.Fatalf("GetIdempotencyKey = %+v, %v", key, err)
+	}
+
+	if n, err := s.DeleteExpiredIdempotencyKeys(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("DeleteExpiredIdempotencyKeys = %d, %v", n, err)
+	}
+
+	if _, err := s.GetIdempotencyKey(ctx, get); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("GetIdempotencyKey of a deleted key = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func testTx(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	room := insertRoom(t, s, "AAAAAA")
+
+	errRollback := errors.New("rollback")
+
+	err := s.WithTx(ctx, func(q store.Store) error {
+		insertMessage(t, q, room.ID, "Rolled back")
+
+		return errRollback
+	})
+
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx = %v, want the error of fn", err)
+	}
+
+	err = s.WithTx(ctx, func(q store.Store) error {
+		insertMessage(t, q, room.ID, "Kept")
+
+		err := q.WithTx(ctx, func(q store.Store) error {
+			insertMessage(t, q, room.ID, "Rolled back with the savepoint")
+
+			return errRollback
+		})
+
+		if !errors.Is(err, errRollback) {
+			t.Errorf("nested WithTx = %v, want the error of fn", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	list, err := s.GetRoomMessages(ctx, pgstore.GetRoomMessagesParams{RoomID: room.ID, Limit: 10})
+
+	if err != nil || len(list) != 1 || list[0].Message != "Kept" {
+		t.Fatalf("GetRoomMessages after the transactions = %+v, %v, want the kept message alone", list, err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("WithTx swallowed the panic of fn")
+			}
+		}()
+
+		_ = s.WithTx(ctx, func(q store.Store) error {
+			insertMessage(t, q, room.ID, "Rolled back by the panic")
+
+			panic("fn panicked")
+		})
+	}()
+
+	if count, _ := s.GetRoomStats(ctx, room.ID); count.MessageCount != 1 {
+		t.Fatalf("%d messages after a panicking transaction, want 1", count.MessageCount)
+	}
+}
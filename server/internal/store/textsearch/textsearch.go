@@ -0,0 +1,253 @@
+// Package textsearch reproduces the text matching of the Postgres queries,
+// ILIKE, pg_trgm similarity and websearch_to_tsquery, for the stores that
+// run without Postgres.
+package textsearch
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// SimilarityThreshold is the default pg_trgm.similarity_threshold, above
+// which the % operator finds two texts similar.
+const SimilarityThreshold float32 = 0.3
+
+// words splits s into lowercased runs of letters and digits, the words of
+// both pg_trgm and the simple text search configuration.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ILike matches s against a LIKE pattern case-insensitively, with % and _ as
+// wildcards and backslash escaping them.
+func ILike(s, pattern string) bool {
+	text := []rune(strings.ToLower(s))
+
+	type token struct {
+		r        rune
+		any, one bool
+	}
+
+	var tokens []token
+
+	runes := []rune(strings.ToLower(pattern))
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes):
+			i++
+
+			tokens = append(tokens, token{r: runes[i]})
+		case r == '%':
+			tokens = append(tokens, token{any: true})
+		case r == '_':
+			tokens = append(tokens, token{one: true})
+		default:
+			tokens = append(tokens, token{r: r})
+		}
+	}
+
+	// matched[j] tells whether text[:i] matches tokens[:j], for the i being
+	// looked at.
+	matched := make([]bool, len(tokens)+1)
+
+	matched[0] = true
+
+	for j, t := range tokens {
+		matched[j+1] = matched[j] && t.any
+	}
+
+	for _, r := range text {
+		next := make([]bool, len(tokens)+1)
+
+		for j, t := range tokens {
+			switch {
+			case t.any:
+				next[j+1] = next[j] || matched[j+1]
+			case t.one || t.r == r:
+				next[j+1] = matched[j]
+			}
+		}
+
+		matched = next
+	}
+
+	return matched[len(tokens)]
+}
+
+// Trigrams returns the set of trigrams of s the way pg_trgm extracts them:
+// every word padded with two spaces in front and one behind.
+func Trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+
+	for _, word := range words(s) {
+		padded := []rune("  " + word + " ")
+
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+
+	return set
+}
+
+// TrigramSimilarity is pg_trgm's similarity: the trigrams both sets share
+// over all the trigrams of the two.
+func TrigramSimilarity(a, b map[string]bool) float32 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+
+	for trigram := range a {
+		if b[trigram] {
+			shared++
+		}
+	}
+
+	return float32(shared) / float32(len(a)+len(b)-shared)
+}
+
+// searchTerm is a word, or a quoted phrase, of a web search.
+type searchTerm struct {
+	words   []string
+	negated bool
+}
+
+// WebSearch is a parsed websearch_to_tsquery query: any of its groups
+// matches when all of the group's terms do.
+type WebSearch [][]searchTerm
+
+// ParseWebSearch parses the syntax of websearch_to_tsquery: words must all
+// match, "quoted phrases" match words in a row, a leading - negates and OR
+// separates alternatives.
+func ParseWebSearch(query string) WebSearch {
+	var search WebSearch
+
+	var group []searchTerm
+
+	negated := false
+
+	add := func(words []string) {
+		if len(words) > 0 {
+			group = append(group, searchTerm{words: words, negated: negated})
+		}
+
+		negated = false
+	}
+
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-':
+			negated = true
+
+			i++
+		case r == '"':
+			end := i + 1
+
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+
+			add(words(string(runes[i+1 : min(end, len(runes))])))
+
+			i = end + 1
+		default:
+			end := i
+
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+
+			raw := string(runes[i:end])
+
+			i = end
+
+			if strings.EqualFold(raw, "or") && !negated {
+				if len(group) > 0 {
+					search = append(search, group)
+
+					group = nil
+				}
+
+				continue
+			}
+
+			for _, word := range words(raw) {
+				add([]string{word})
+			}
+
+			negated = false
+		}
+	}
+
+	if len(group) > 0 {
+		search = append(search, group)
+	}
+
+	return search
+}
+
+// occurrences counts where the words of the term appear in a row in text.
+func (t searchTerm) occurrences(text []string) int {
+	count := 0
+
+	for i := 0; i+len(t.words) <= len(text); i++ {
+		if slices.Equal(text[i:i+len(t.words)], t.words) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Match tells whether text matches the search, and ranks it by how often the
+// terms of the matching groups occur in it. It stands in for ts_rank, which
+// ranks alike for the short texts of a room.
+func (search WebSearch) Match(text string) (int, bool) {
+	tokens := words(text)
+
+	rank := 0
+
+	matched := false
+
+	for _, group := range search {
+		groupRank := 0
+
+		ok := true
+
+		for _, term := range group {
+			n := term.occurrences(tokens)
+
+			if term.negated {
+				ok = n == 0
+			} else {
+				ok = n > 0
+
+				groupRank += n
+			}
+
+			if !ok {
+				break
+			}
+		}
+
+		if ok {
+			matched = true
+
+			rank += groupRank
+		}
+	}
+
+	return rank, matched
+}
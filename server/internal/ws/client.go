@@ -0,0 +1,345 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds every write to a client.
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent before it is considered
+	// gone. Pongs to our pings count, so live clients never hit it.
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait so a pong can arrive in time.
+	pingPeriod = pongWait * 9 / 10
+)
+
+// maxFrameSize bounds the frames clients send. The largest are commands
+// creating a message, whose text is at most 255 characters.
+const maxFrameSize = 4096
+
+// SlowClientPolicy decides what happens to the messages of a client whose
+// queue is full.
+type SlowClientPolicy string
+
+const (
+	// SlowClientDisconnect closes the client with CloseTooSlow. It can
+	// resume from the last event it got once it catches up.
+	SlowClientDisconnect SlowClientPolicy = "disconnect"
+	// SlowClientDropOldest drops the oldest queued message to make room.
+	// The client sees the gap in event ids.
+	SlowClientDropOldest SlowClientPolicy = "drop_oldest"
+	// SlowClientCoalesce replaces queued messages with newer ones of the
+	// same Message.Coalesce key, even before the queue is full. When there
+	// is nothing to replace, the client is disconnected.
+	SlowClientCoalesce SlowClientPolicy = "coalesce"
+)
+
+// ParseSlowClientPolicy returns the policy named s.
+func ParseSlowClientPolicy(s string) (SlowClientPolicy, error) {
+	switch p := SlowClientPolicy(s); p {
+	case SlowClientDisconnect, SlowClientDropOldest, SlowClientCoalesce:
+		return p, nil
+	default:
+		return "", fmt.Errorf("ws: unknown slow client policy %q", s)
+	}
+}
+
+type outbound struct {
+	data *frame
+	// coalesce is the Message.Coalesce of data.
+	coalesce string
+	// skip, when set, is the KindEventSkipped stand-in of data, for the
+	// clients left out of it.
+	skip *frame
+
+	close       bool
+	closeCode   int
+	closeReason string
+}
+
+// Client is a connection subscribed to a room. The room's goroutine owns
+// its state and queues messages for it; only the write pump writes to the
+// connection, so one slow client never holds up the rest of the room.
+type Client struct {
+	conn     *websocket.Conn
+	info     ClientInfo
+	policy   SlowClientPolicy
+	encoding Encoding
+	done     chan struct{}
+	// ctx is canceled along with done, for the work done on behalf of the
+	// client, such as its snapshot and commands.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// queueSize is how many messages can wait for the write pump.
+	queueSize int
+
+	// connectedAt is when the client subscribed, and sent counts the
+	// messages its write pump wrote.
+	connectedAt time.Time
+	sent        atomic.Int64
+
+	// mu guards queue, closed and rooms. The room's goroutine appends to
+	// queue and wakes the write pump, which takes everything queued at once.
+	mu     sync.Mutex
+	queue  []outbound
+	closed bool
+	wake   chan struct{}
+
+	// mux is set for the clients of ServeMux, and rooms holds the ids of
+	// the rooms they are subscribed to. A multiplexed client never waits
+	// for a snapshot, so holding and held stay untouched by its rooms.
+	mux   bool
+	rooms map[string]struct{}
+
+	// kinds, when set, holds the kinds of the events the client gets. See
+	// ServeOptions.Kinds.
+	kinds map[string]struct{}
+
+	// holding is set while the client waits for its snapshot. Broadcasts are
+	// kept in held meanwhile and sent right after it, so the client misses
+	// nothing that happened while the snapshot was built.
+	holding bool
+	held    []outbound
+	// snapshotEventID is the id of the last event published before the
+	// client subscribed, which its snapshot is sent with.
+	snapshotEventID uint64
+
+	// typingAt is when the client last got a typing frame through, and
+	// frameTokens, frameAt and frameStrikes its frame rate limit as of
+	// frameAt. Only its reader touches them.
+	typingAt     time.Time
+	frameTokens  float64
+	frameAt      time.Time
+	frameStrikes int
+}
+
+func newClient(ctx context.Context, conn *websocket.Conn, info ClientInfo, policy SlowClientPolicy, queueSize int) *Client {
+	if policy == "" {
+		policy = SlowClientDisconnect
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &Client{
+		conn:        conn,
+		info:        info,
+		policy:      policy,
+		done:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		queueSize:   queueSize,
+		wake:        make(chan struct{}, 1),
+		connectedAt: time.Now(),
+	}
+}
+
+// Done is closed once the hub dropped the client, either because it fell
+// too far behind or because it was disconnected.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// push queues out following the client's policy. It returns false when out
+// could not be queued and the client has to be disconnected.
+func (c *Client) push(out outbound) bool {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	if c.policy == SlowClientCoalesce && out.coalesce != "" {
+		for i, queued := range c.queue {
+			if queued.coalesce == out.coalesce {
+				// The stale message is swapped for its stand-in rather than
+				// replaced by the new one, so the queue stays in event id
+				// order without gaps. Without a stand-in it is removed.
+				if queued.skip != nil {
+					c.queue[i] = outbound{data: queued.skip}
+				} else {
+					c.queue = append(c.queue[:i], c.queue[i+1:]...)
+				}
+
+				slowClients.Add("coalesced", 1)
+
+				break
+			}
+		}
+	}
+
+	if len(c.queue) >= c.queueSize {
+		if c.policy != SlowClientDropOldest {
+			return false
+		}
+
+		c.queue = append(c.queue[:0], c.queue[1:]...)
+
+		slowClients.Add("dropped", 1)
+	}
+
+	c.queue = append(c.queue, out)
+
+	c.signal()
+
+	return true
+}
+
+// send encodes msg and queues it outside of any room, closing the client
+// when it doesn't fit.
+func (c *Client) send(msg Message) {
+	data, err := encode(msg)
+
+	if err != nil {
+		slog.Error("Failed to encode message", "kind", msg.Kind, "error", err)
+
+		return
+	}
+
+	if !c.push(outbound{data: data}) {
+		c.closeWith(CloseTooSlow, "Too slow", true)
+	}
+}
+
+// wants reports whether c gets the events of the given kind.
+func (c *Client) wants(kind string) bool {
+	if c.kinds == nil || kind == KindServerRestarting {
+		return true
+	}
+
+	_, ok := c.kinds[kind]
+
+	return ok
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+func (c *Client) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close ends the write pump once it sent what is queued. Only the room's
+// goroutine calls it, as it drops the client; later calls do nothing.
+func (c *Client) close() {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	c.shut()
+}
+
+// closeWith queues a close frame after what is already queued, and closes
+// the client. When discard is set, what was queued is dropped so the frame
+// goes out right away. The reason is sent as a CloseReason.
+func (c *Client) closeWith(code int, reason string, discard bool) {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	if discard {
+		c.queue = nil
+	}
+
+	c.queue = append(c.queue, outbound{close: true, closeCode: code, closeReason: reason})
+
+	c.shut()
+}
+
+func (c *Client) shut() {
+	if c.closed {
+		return
+	}
+
+	c.closed = true
+
+	c.signal()
+
+	close(c.done)
+
+	c.cancel()
+}
+
+// writePump writes queued messages and pings until the client is closed or
+// a write fails, then closes the connection.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+
+	defer func() {
+		ticker.Stop()
+
+		_ = c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.wake:
+			c.mu.Lock()
+
+			queue, closed := c.queue, c.closed
+
+			c.queue = nil
+
+			c.mu.Unlock()
+
+			for _, out := range queue {
+				if out.close {
+					closeMessage := websocket.FormatCloseMessage(out.closeCode, formatCloseReason(out.closeCode, out.closeReason))
+
+					if err := c.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second)); err != nil {
+						slog.Warn("Failed to send close message to client", "error", err)
+					}
+
+					return
+				}
+
+				_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+				start := time.Now()
+
+				if err := c.conn.WritePreparedMessage(out.data.in(c.encoding)); err != nil {
+					slog.Info("Failed to send message to client", "error", err)
+
+					return
+				}
+
+				writeLatency.observe(time.Since(start))
+
+				messagesSent.Add(1)
+
+				c.sent.Add(1)
+			}
+
+			if closed {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				slog.Info("Failed to ping client", "error", err)
+
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Close codes of the hub, in the range left to applications. Clients closed
+// with CloseRoomClosed or CloseBanned should not reconnect to the room.
+const (
+	// CloseTooSlow closes clients disconnected by SlowClientDisconnect.
+	CloseTooSlow = 4000
+	// CloseRoomClosed closes the clients of a room that was closed, deleted
+	// or expired.
+	CloseRoomClosed = 4001
+	// CloseBanned closes the clients of a banned participant.
+	CloseBanned = 4003
+	// CloseRateLimited closes clients that kept sending frames past the
+	// limit.
+	CloseRateLimited = 4029
+)
+
+// maxRestartBackoff spreads the reconnects of the clients of a restarting
+// server, so they don't all come back at once.
+const maxRestartBackoff = 10 * time.Second
+
+// maxCloseReasonSize is what is left of the 125 bytes of a control frame
+// after the close code.
+const maxCloseReasonSize = 123
+
+// CloseReason is the JSON reason of the close frames of the hub. RetryAfterMs
+// suggests how long to wait before reconnecting, and is left out when the
+// client should not reconnect.
+type CloseReason struct {
+	Reason       string `json:"reason"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+// retryAfter is the backoff suggested to clients closed with code.
+func retryAfter(code int) time.Duration {
+	switch code {
+	case CloseTooSlow:
+		return time.Second
+	case CloseRateLimited:
+		return 10 * time.Second
+	case websocket.CloseServiceRestart:
+		return time.Second + rand.N(maxRestartBackoff-time.Second)
+	case websocket.CloseTryAgainLater:
+		return 30 * time.Second
+	case websocket.CloseInternalServerErr:
+		return 2 * time.Second
+	default:
+		return 0
+	}
+}
+
+// formatCloseReason builds the JSON reason of a close frame, falling back to
+// the bare reason when it would not fit.
+func formatCloseReason(code int, reason string) string {
+	data, err := json.Marshal(CloseReason{Reason: reason, RetryAfterMs: retryAfter(code).Milliseconds()})
+
+	if err != nil || len(data) > maxCloseReasonSize {
+		return reason
+	}
+
+	return string(data)
+}
@@ -0,0 +1,118 @@
+package ws
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Connection describes a client of the hub, for debugging.
+type Connection struct {
+	RoomIDs       []string
+	RemoteAddr    string
+	ParticipantID uuid.NullUUID
+	Host          bool
+	Multiplexed   bool
+	ConnectedAt   time.Time
+	// EventsSent counts the messages written to the client, and Queued
+	// those waiting for its write pump.
+	EventsSent int64
+	Queued     int
+}
+
+// Connections lists the clients of the hub, oldest first. Multiplexed
+// clients are listed even when they are not subscribed to any room. Each
+// room is asked in turn, so the list is not a consistent snapshot of the
+// whole hub, which is good enough to find stuck rooms and clients.
+func (h *Hub) Connections() []Connection {
+	h.mu.Lock()
+
+	rooms := make([]*room, 0, len(h.rooms))
+
+	for _, rm := range h.rooms {
+		rooms = append(rooms, rm)
+	}
+
+	muxClients := make([]*Client, 0, len(h.muxClients))
+
+	for c := range h.muxClients {
+		muxClients = append(muxClients, c)
+	}
+
+	h.mu.Unlock()
+
+	// Multiplexed clients show up in every room they are subscribed to, so
+	// connections are keyed by client.
+	connections := make(map[*Client]*Connection)
+
+	for _, c := range muxClients {
+		connections[c] = c.describe()
+	}
+
+	for _, rm := range rooms {
+		clients := make(chan []*Client, 1)
+
+		queued := rm.do(func(rm *room) {
+			list := make([]*Client, 0, len(rm.clients))
+
+			for c := range rm.clients {
+				list = append(list, c)
+			}
+
+			clients <- list
+		})
+
+		if !queued {
+			continue
+		}
+
+		for _, c := range <-clients {
+			conn, ok := connections[c]
+
+			if !ok {
+				conn = c.describe()
+
+				connections[c] = conn
+			}
+
+			conn.RoomIDs = append(conn.RoomIDs, rm.id)
+		}
+	}
+
+	list := make([]Connection, 0, len(connections))
+
+	for _, conn := range connections {
+		if conn.RoomIDs == nil {
+			conn.RoomIDs = []string{}
+		}
+
+		sort.Strings(conn.RoomIDs)
+
+		list = append(list, *conn)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ConnectedAt.Before(list[j].ConnectedAt)
+	})
+
+	return list
+}
+
+func (c *Client) describe() *Connection {
+	c.mu.Lock()
+
+	queued := len(c.queue)
+
+	c.mu.Unlock()
+
+	return &Connection{
+		RemoteAddr:    c.conn.RemoteAddr().String(),
+		ParticipantID: c.info.ParticipantID,
+		Host:          c.info.Host,
+		Multiplexed:   c.mux,
+		ConnectedAt:   c.connectedAt,
+		EventsSent:    c.sent.Load(),
+		Queued:        queued,
+	}
+}
@@ -0,0 +1,117 @@
+package ws
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// Encoding is how events are written to a client.
+type Encoding string
+
+const (
+	// EncodingJSON writes each event as a text frame holding the JSON
+	// Message. It is the default.
+	EncodingJSON Encoding = "json"
+	// EncodingProto writes each event as a binary frame holding the Event
+	// of proto/event.proto. The payload stays JSON, but the envelope is
+	// smaller and cheaper to build.
+	EncodingProto Encoding = "proto"
+)
+
+// ParseEncoding returns the encoding named s, or EncodingJSON when s is
+// empty.
+func ParseEncoding(s string) (Encoding, error) {
+	switch e := Encoding(s); e {
+	case "":
+		return EncodingJSON, nil
+	case EncodingJSON, EncodingProto:
+		return e, nil
+	default:
+		return "", fmt.Errorf("ws: unknown encoding %q", s)
+	}
+}
+
+// frame is a message prepared in every encoding. Frames, compressed or not,
+// are only built once per encoding and shared by every client negotiating
+// it, which is what makes compressing large broadcasts cheap.
+type frame struct {
+	json  *websocket.PreparedMessage
+	proto *websocket.PreparedMessage
+}
+
+// in returns the message prepared in the given encoding.
+func (f *frame) in(e Encoding) *websocket.PreparedMessage {
+	if e == EncodingProto {
+		return f.proto
+	}
+
+	return f.json
+}
+
+// encode prepares msg to be written to any number of clients.
+func encode(msg Message) (*frame, error) {
+	raw, err := json.Marshal(msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return prepare(msg, raw)
+}
+
+// prepare is encode for a message already encoded as raw JSON.
+func prepare(msg Message, raw []byte) (*frame, error) {
+	f := &frame{}
+
+	var err error
+
+	if f.json, err = websocket.NewPreparedMessage(websocket.TextMessage, raw); err != nil {
+		return nil, err
+	}
+
+	if f.proto, err = websocket.NewPreparedMessage(websocket.BinaryMessage, marshalProto(msg)); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Field numbers and wire types of the Event message of proto/event.proto.
+const (
+	protoEventID = 1<<3 | 0
+	protoKind    = 2<<3 | 2
+	protoRoomID  = 3<<3 | 2
+	protoValue   = 4<<3 | 2
+)
+
+// marshalProto encodes msg as an Event. The envelope has four fields, so it
+// is written by hand rather than through generated code. Empty fields are
+// left out, as proto3 does.
+func marshalProto(msg Message) []byte {
+	b := make([]byte, 0, len(msg.Kind)+len(msg.RoomID)+len(msg.Value)+32)
+
+	if msg.EventID != 0 {
+		b = binary.AppendUvarint(b, protoEventID)
+		b = binary.AppendUvarint(b, msg.EventID)
+	}
+
+	b = appendProtoBytes(b, protoKind, []byte(msg.Kind))
+	b = appendProtoBytes(b, protoRoomID, []byte(msg.RoomID))
+	b = appendProtoBytes(b, protoValue, msg.Value)
+
+	return b
+}
+
+func appendProtoBytes(b []byte, tag uint64, data []byte) []byte {
+	if len(data) == 0 {
+		return b
+	}
+
+	b = binary.AppendUvarint(b, tag)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+
+	return append(b, data...)
+}
@@ -0,0 +1,105 @@
+package ws
+
+import (
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// maxFrameReadSize is the largest frame read at all. Frames past
+// maxFrameSize but within it get a FrameErrorTooLarge, larger ones close
+// the connection with CloseMessageTooBig.
+const maxFrameReadSize = 4 * maxFrameSize
+
+// KindFrameError answers a frame the hub could not act on, only to the
+// client that sent it, with a FrameError payload.
+const KindFrameError = "frame_error"
+
+// Codes of FrameError.
+const (
+	FrameErrorMalformed   = "malformed_frame"
+	FrameErrorTooLarge    = "frame_too_large"
+	FrameErrorUnknownKind = "unknown_kind"
+	FrameErrorInvalid     = "invalid_frame"
+	FrameErrorInternal    = "internal_error"
+)
+
+// FrameError tells a client what was wrong with one of its frames. ID is
+// the id of the frame, when it had one.
+type FrameError struct {
+	ID     string `json:"id,omitempty"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// readFrames hands the frames read from c to handle until reading fails,
+// then sends the error on the returned channel. Reading is also what keeps
+// the pong deadline moving. Frames past the rate limit are dropped, and
+// frames too large or that handle panics on are answered with a FrameError.
+func (h *Hub) readFrames(roomID string, c *Client, handle func(data []byte)) <-chan error {
+	conn := c.conn
+
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	readErr := make(chan error, 1)
+
+	conn.SetReadLimit(maxFrameReadSize)
+
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+
+			if err != nil {
+				readErr <- err
+
+				return
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+
+			if !h.allowFrame(roomID, c) {
+				continue
+			}
+
+			if len(data) > maxFrameSize {
+				sendFrameError(c, roomID, FrameError{Code: FrameErrorTooLarge, Detail: "Frame is too large"})
+
+				continue
+			}
+
+			handleSafely(roomID, c, data, handle)
+		}
+	}()
+
+	return readErr
+}
+
+// handleSafely calls handle, answering the frame with a FrameErrorInternal
+// rather than taking the server down when it panics.
+func handleSafely(roomID string, c *Client, data []byte, handle func(data []byte)) {
+	defer func() {
+		if v := recover(); v != nil {
+			slog.Error("Panic while handling frame", "room_id", roomID, "panic", v, "stack", string(debug.Stack()))
+
+			sendFrameError(c, roomID, FrameError{Code: FrameErrorInternal, Detail: "Something went wrong"})
+		}
+	}()
+
+	handle(data)
+}
+
+func sendFrameError(c *Client, roomID string, frameErr FrameError) {
+	msg, err := NewMessage(KindFrameError, roomID, frameErr)
+
+	if err != nil {
+		slog.Error("Failed to encode frame error", "room_id", roomID, "error", err)
+
+		return
+	}
+
+	c.send(msg)
+}
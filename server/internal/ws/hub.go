@@ -0,0 +1,1422 @@
+// Package ws fans events out to the WebSocket clients of each room.
+//
+// Every room with subscribers gets its own goroutine, which owns the room's
+// clients and serializes what is sent to them. Handlers talk to it through
+// the Hub. Each client then has a write pump of its own doing the actual
+// writes, so a slow connection never holds up its room.
+//
+// The room's goroutine is the only writer of its events: every publish,
+// replay and snapshot of a room goes through it, and each client's queue is
+// written in the order the goroutine fills it. So every client of a room
+// sees its events in the same order, the order of their event ids, whatever
+// goroutines published them. A client may see fewer of them, when it is
+// left out of some or its slow client policy drops some, but never in
+// another order. Replies meant for a single client, such as command results
+// and frame errors, are not events and are queued as they come.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// maxHeldMessages bounds the broadcasts kept for a client waiting for its
+// snapshot. A client past it is dropped, as it would be for a failed write.
+const maxHeldMessages = 256
+
+// defaultEventBufferSize is how many recent events each room keeps, unless
+// HubOptions.EventBufferSize says otherwise.
+const defaultEventBufferSize = 256
+
+// viewerCountDebounce is how long a room waits after someone joins or leaves
+// before sending the new viewer count, so a burst of joins is one event.
+const viewerCountDebounce = 2 * time.Second
+
+// KindViewerCount is the kind of the events the hub itself sends when the
+// number of clients of a room changes.
+const KindViewerCount = "viewer_count"
+
+type ViewerCount struct {
+	Count int `json:"count"`
+}
+
+// KindViewers is sent along with KindViewerCount, only to the hosts of the
+// room, listing who is connected. At most maxListedViewers are listed.
+const (
+	KindViewers = "viewers"
+
+	maxListedViewers = 500
+)
+
+type Viewers struct {
+	Count   int      `json:"count"`
+	Viewers []Viewer `json:"viewers"`
+}
+
+type Viewer struct {
+	ParticipantID uuid.NullUUID `json:"participant_id"`
+	IP            string        `json:"ip"`
+}
+
+// KindTyping is the frame clients send while their user writes a question.
+// The room is told with a KindSomeoneTyping event, at most once every
+// typingThrottle, which the typing client doesn't get back.
+const (
+	KindTyping        = "typing"
+	KindSomeoneTyping = "someone_typing"
+
+	typingThrottle = 3 * time.Second
+)
+
+type SomeoneTyping struct{}
+
+// KindServerRestarting is sent by the hub to every room as the server shuts
+// down, right before the connections are closed with CloseServiceRestart.
+// Clients should reconnect after a short while.
+const (
+	KindServerRestarting = "server_restarting"
+
+	serverRestartingReason = "Server restarting"
+)
+
+type ServerRestarting struct{}
+
+// KindEventSkipped stands in for an event a client was not meant to get,
+// such as the echo of its own message, or a Coalesce message superseded by a
+// newer one before it left the client's queue. It carries the event id of
+// the event it replaces, so skipped events don't look like missed ones.
+const KindEventSkipped = "event_skipped"
+
+type EventSkipped struct{}
+
+// KindCommandResult is the kind of the reply to a Command, sent only to the
+// client that issued it.
+const KindCommandResult = "command_result"
+
+// Command is a frame asking the server to act on behalf of the client, as
+// it would for an HTTP request. Clients pick the id and get it back in the
+// CommandResult, to match replies with their commands.
+type Command struct {
+	ID    string          `json:"id"`
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
+}
+
+// CommandResult is what became of a Command, in the terms of the HTTP
+// endpoint it stands for.
+type CommandResult struct {
+	ID     string          `json:"id"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// maxCoalesceKeys is how many coalesce keys a room tracks before it sweeps
+// the ones that are no longer throttled.
+const maxCoalesceKeys = 1024
+
+// roomQueueSize is how many operations can wait for a room's goroutine
+// before Publish and the other calls block.
+const roomQueueSize = 64
+
+// Message is the envelope of every event sent to clients. Value holds the
+// payload of the kind, already encoded, so clients can switch on Kind and
+// decode Value into the matching type.
+type Message struct {
+	// EventID is set by the hub when the message is published. It is the
+	// sequence number of the room's events: each one is the previous plus
+	// one, so a client that sees a jump knows it missed some, and can
+	// resync over REST or reconnect with the last one it got to have them
+	// replayed. Ephemeral events, such as someone_typing, have none and are
+	// never replayed.
+	EventID uint64          `json:"event_id,omitempty"`
+	Kind    string          `json:"kind"`
+	RoomID  string          `json:"room_id"`
+	Value   json.RawMessage `json:"value"`
+	// ExceptParticipant, when set, skips the clients of that participant.
+	ExceptParticipant uuid.NullUUID `json:"-"`
+	// HostsOnly skips the clients that didn't prove they host the room, see
+	// ClientInfo.Host. It is for events meant for moderation only.
+	HostsOnly bool `json:"-"`
+	// Coalesce, when set, marks messages that carry the whole state of
+	// something, such as a count, so a newer message with the same key
+	// makes the older one pointless. See SlowClientCoalesce.
+	Coalesce string `json:"-"`
+}
+
+// NewMessage encodes value as the payload of a message of the given kind.
+func NewMessage(kind, roomID string, value any) (Message, error) {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Kind: kind, RoomID: roomID, Value: data}, nil
+}
+
+// ClientInfo is what the hub knows about who is behind a connection. The
+// participant id is only known when the client passed one when subscribing.
+type ClientInfo struct {
+	ParticipantID uuid.NullUUID
+	IP            string
+	// Host is set when the client proved it hosts the room. It is never set
+	// for the clients of ServeMux, which may subscribe to rooms they don't
+	// host.
+	Host bool
+}
+
+// ClientMatch picks clients by who they are: those of the participant, and
+// those connecting from the IP, whichever are set.
+type ClientMatch struct {
+	ParticipantID uuid.NullUUID
+	IP            string
+}
+
+func (m ClientMatch) matches(info ClientInfo) bool {
+	return (m.ParticipantID.Valid && info.ParticipantID == m.ParticipantID) || (m.IP != "" && info.IP == m.IP)
+}
+
+// ServeOptions tune how a client starts its subscription.
+type ServeOptions struct {
+	// Snapshot, when set, is built once the client is subscribed and sent
+	// before any broadcast.
+	Snapshot Snapshot
+	// Resume asks for the events published after LastEventID to be replayed
+	// instead of getting a snapshot. The snapshot is still sent when the
+	// room no longer has all of them.
+	Resume      bool
+	LastEventID uint64
+	// MaxClients, when more than zero, caps the clients of the room. A
+	// client subscribing past it is closed with CloseTryAgainLater.
+	MaxClients int
+	// Command, when set, runs the commands the client sends. It is called
+	// from the client's reader, so a client's commands run one at a time,
+	// with a context that is done once the client is dropped.
+	Command func(ctx context.Context, cmd Command) CommandResult
+	// ReadOnly clients only listen. Their typing frames get a
+	// KindFrameError, as commands do without a Command.
+	ReadOnly bool
+	// SlowClientPolicy is what happens once the client's queue is full. It
+	// defaults to SlowClientDisconnect.
+	SlowClientPolicy SlowClientPolicy
+	// Encoding is how events are written to the client. It defaults to
+	// EncodingJSON. Close frames and what the client sends are unaffected.
+	Encoding Encoding
+	// Kinds, when set, limits the events the client gets to those of the
+	// listed kinds, besides KindServerRestarting. The others are not sent
+	// at all, not even as KindEventSkipped, so the event ids the client
+	// sees skip them. The snapshot and the replies to the client's own
+	// frames are always sent.
+	Kinds []string
+}
+
+// Snapshot builds the first message sent to a client, with the state of the
+// room it can apply later events on top of.
+//
+// The hub calls it once the client is subscribed, and sends the snapshot with
+// the id of the last event published before that, followed by the events
+// published since. Events are published after the writes they report, so
+// everything up to that id is in what the snapshot reads, and the events
+// after it follow with no gap. Some of them may already be in the snapshot,
+// so clients apply events idempotently. A Snapshot must therefore read all
+// of the state it sends when it is called, not before.
+//
+// ctx is done once the client is dropped, so a snapshot nobody is waiting
+// for any more is given up on.
+type Snapshot func(ctx context.Context) (Message, error)
+
+// HubOptions tune every room of a hub.
+type HubOptions struct {
+	// CoalescePerSecond, when more than zero, caps how many messages with
+	// the same Message.Coalesce key a room broadcasts per second. Messages
+	// past it are held, and only the latest one held is sent once the key
+	// is allowed again.
+	CoalescePerSecond int
+	// FramesPerSecond, when more than zero, caps the frames each client can
+	// send, typing frames and commands alike, with bursts of up to
+	// FrameBurst frames. See KindRateLimited.
+	FramesPerSecond int
+	FrameBurst      int
+	// EventBufferSize is how many of its latest events each room keeps, to
+	// replay them to resuming clients and serve them to long polls. Older
+	// events are evicted as new ones come in. It defaults to
+	// defaultEventBufferSize.
+	EventBufferSize int
+	// Relay, when set, shares what is published on the hub, and the clients
+	// it closes, with the hubs of the other instances of the server, for
+	// rooms whose clients are spread across instances.
+	Relay Relay
+}
+
+type Hub struct {
+	opts HubOptions
+	// ctx is the context the hub was created with. Every client's context
+	// derives from it, so draining cancels whatever clients are waiting on.
+	ctx context.Context
+
+	mu    sync.Mutex
+	rooms map[string]*room
+	// peaks is the highest number of clients seen at once per room. It
+	// outlives the room goroutine, which is evicted once idle, and is only
+	// dropped when the room is forgotten.
+	peaks map[string]int
+
+	// relayedAt and relayHeld throttle the messages relayed per room and
+	// Coalesce key, see relayMessage.
+	relayMu   sync.Mutex
+	relayedAt map[string]time.Time
+	relayHeld map[string]Message
+
+	// draining is set once the hub context is done. No room is started
+	// after that, and serving counts the Serve calls still running.
+	draining bool
+	serving  sync.WaitGroup
+
+	// muxClients are the clients of ServeMux, which the hub closes itself
+	// when draining since they don't belong to any one room.
+	muxClients map[*Client]struct{}
+}
+
+// NewHub returns a hub that drains once ctx is done: every room is sent a
+// KindServerRestarting event, then its clients are closed and new ones are
+// turned away.
+func NewHub(ctx context.Context, opts HubOptions) *Hub {
+	if opts.EventBufferSize <= 0 {
+		opts.EventBufferSize = defaultEventBufferSize
+	}
+
+	h := &Hub{
+		opts:       opts,
+		ctx:        ctx,
+		rooms:      make(map[string]*room),
+		peaks:      make(map[string]int),
+		relayedAt:  make(map[string]time.Time),
+		relayHeld:  make(map[string]Message),
+		muxClients: make(map[*Client]struct{}),
+	}
+
+	if opts.Relay != nil {
+		go opts.Relay.Listen(ctx, h.apply)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		h.mu.Lock()
+
+		rooms := h.rooms
+		muxClients := h.muxClients
+
+		h.rooms = make(map[string]*room)
+		h.muxClients = make(map[*Client]struct{})
+		h.draining = true
+
+		h.mu.Unlock()
+
+		for c := range muxClients {
+			if msg, err := NewMessage(KindServerRestarting, "", ServerRestarting{}); err == nil {
+				c.send(msg)
+			}
+
+			c.closeWith(websocket.CloseServiceRestart, serverRestartingReason, false)
+		}
+
+		for _, rm := range rooms {
+			rm.do(func(rm *room) {
+				msg, err := NewMessage(KindServerRestarting, rm.id, ServerRestarting{})
+
+				if err != nil {
+					slog.Error("Failed to encode server restarting event", "room_id", rm.id, "error", err)
+
+					return
+				}
+
+				rm.sendEphemeral(msg, nil)
+			})
+
+			rm.stop(websocket.CloseServiceRestart, serverRestartingReason)
+		}
+	}()
+
+	return h
+}
+
+// Draining reports whether the hub is shutting down, so handlers can turn
+// subscribers away before upgrading their connection.
+func (h *Hub) Draining() bool {
+	h.mu.Lock()
+
+	defer h.mu.Unlock()
+
+	return h.draining
+}
+
+// Wait blocks until every Serve call has returned. It is meant to be called
+// once the hub is draining, as nothing stops new clients before that.
+func (h *Hub) Wait() {
+	h.serving.Wait()
+}
+
+// join counts a Serve call for Wait, unless the hub is already draining.
+func (h *Hub) join() bool {
+	h.mu.Lock()
+
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return false
+	}
+
+	h.serving.Add(1)
+
+	return true
+}
+
+// room returns the running room with the given id, starting it when create
+// is set and the hub is not draining.
+func (h *Hub) room(roomID string, create bool) *room {
+	h.mu.Lock()
+
+	defer h.mu.Unlock()
+
+	rm, ok := h.rooms[roomID]
+
+	if !ok && create && !h.draining {
+		rm = newRoom(h, roomID)
+
+		h.rooms[roomID] = rm
+
+		go rm.run()
+	}
+
+	return rm
+}
+
+// subscribe registers the client, replaying the events it missed when it
+// resumes. It reports whether it did, in which case no snapshot is needed.
+func (h *Hub) subscribe(roomID string, conn *websocket.Conn, info ClientInfo, opts ServeOptions) (*Client, bool) {
+	c := newClient(h.ctx, conn, info, opts.SlowClientPolicy, h.sendBufferSize())
+
+	c.encoding = opts.Encoding
+
+	if len(opts.Kinds) > 0 {
+		c.kinds = make(map[string]struct{}, len(opts.Kinds))
+
+		for _, kind := range opts.Kinds {
+			c.kinds[kind] = struct{}{}
+		}
+	}
+
+	resumed := make(chan bool, 1)
+
+	rm, queued := h.enter(roomID, func(rm *room) {
+		// The handler checks the cap before upgrading, but clients that
+		// passed it together can still overshoot it.
+		if opts.MaxClients > 0 && len(rm.clients) >= opts.MaxClients {
+			c.closeWith(websocket.CloseTryAgainLater, "Room is full", false)
+
+			resumed <- true
+
+			return
+		}
+
+		rm.add(c)
+
+		rm.countChanged()
+
+		if opts.Resume && rm.replay(c, opts.LastEventID) {
+			resumed <- true
+
+			return
+		}
+
+		c.holding = opts.Snapshot != nil
+		c.snapshotEventID = rm.lastEventID
+
+		resumed <- false
+	})
+
+	// The hub is draining, so the client is turned away like the ones it
+	// just closed.
+	if rm == nil {
+		c.closeWith(websocket.CloseServiceRestart, serverRestartingReason, false)
+
+		return c, true
+	}
+
+	// The room was closed before it got to the client, which is as good as
+	// being disconnected by it.
+	if !queued {
+		c.close()
+
+		return c, false
+	}
+
+	return c, <-resumed
+}
+
+// Serve subscribes conn to the room and reads from it until the client goes
+// away, misses the pong deadline or is dropped by the hub. Reading is what
+// processes pongs and close frames, so it has to go on for as long as the
+// connection is kept. Writes go through the client's own write pump.
+//
+// Serve returns once the reader, the write pump and the snapshot are all
+// done, whichever of them ended the subscription. It needs no context of
+// its own: the hub closes its clients as it drains, and a client going away
+// cancels the context its snapshot and commands run with.
+func (h *Hub) Serve(roomID string, conn *websocket.Conn, info ClientInfo, opts ServeOptions) {
+	if h.join() {
+		defer h.serving.Done()
+	}
+
+	c, resumed := h.subscribe(roomID, conn, info, opts)
+
+	pumped := make(chan struct{})
+
+	go func() {
+		c.writePump()
+
+		close(pumped)
+	}()
+
+	// The reader starts before the snapshot is built, so a client that
+	// goes away meanwhile is dropped right away and its snapshot given up.
+	readErr := h.readFrames(roomID, c, func(data []byte) {
+		h.handleFrame(roomID, c, data, opts)
+	})
+
+	snapshotted := make(chan struct{})
+
+	if !resumed && opts.Snapshot != nil {
+		go func() {
+			h.sendSnapshot(roomID, c, opts.Snapshot)
+
+			close(snapshotted)
+		}()
+	} else {
+		close(snapshotted)
+	}
+
+	select {
+	case err := <-readErr:
+		if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			slog.Info("client connection lost", "room_id", roomID, "error", err)
+		}
+
+		h.unsubscribe(roomID, c)
+
+		<-pumped
+	case <-c.Done():
+		// The write pump sends what is left, a close frame included, and
+		// closes the connection, which unblocks the reader.
+		<-pumped
+		<-readErr
+	}
+
+	<-snapshotted
+}
+
+// handleFrame acts on a frame sent by a client. Frames are JSON objects with
+// a kind. KindTyping is handled by the hub, and frames with an id are
+// commands handed to opts.Command, which answers unknown command kinds
+// itself. Anything else gets a KindFrameError.
+func (h *Hub) handleFrame(roomID string, c *Client, data []byte, opts ServeOptions) {
+	var frame Command
+
+	if err := json.Unmarshal(data, &frame); err != nil {
+		sendFrameError(c, roomID, FrameError{Code: FrameErrorMalformed, Detail: "Frames must be JSON objects"})
+
+		return
+	}
+
+	switch {
+	case frame.Kind == "":
+		sendFrameError(c, roomID, FrameError{ID: frame.ID, Code: FrameErrorInvalid, Detail: "Frames need a kind"})
+
+		return
+	case frame.Kind == KindTyping && !opts.ReadOnly:
+	case opts.Command == nil:
+		sendFrameError(c, roomID, FrameError{ID: frame.ID, Code: FrameErrorUnknownKind, Detail: "Unknown frame kind"})
+
+		return
+	case frame.ID == "":
+		sendFrameError(c, roomID, FrameError{Code: FrameErrorInvalid, Detail: "Commands need an id"})
+
+		return
+	default:
+		h.reply(roomID, c, opts.Command(c.ctx, frame))
+
+		return
+	}
+
+	// Clients send typing frames on every keystroke, so they are throttled
+	// here before they reach the room's queue.
+	now := time.Now()
+
+	if now.Sub(c.typingAt) < typingThrottle {
+		return
+	}
+
+	c.typingAt = now
+
+	if rm := h.room(roomID, false); rm != nil {
+		rm.do(func(rm *room) {
+			rm.typing(c)
+		})
+	}
+}
+
+// reply sends the result of a command to the client that issued it, after
+// its snapshot if it is still waiting for it.
+func (h *Hub) reply(roomID string, c *Client, result CommandResult) {
+	msg, err := NewMessage(KindCommandResult, roomID, result)
+
+	if err != nil {
+		slog.Error("Failed to encode command result", "room_id", roomID, "error", err)
+
+		return
+	}
+
+	data, err := encode(msg)
+
+	if err != nil {
+		slog.Error("Failed to encode command result", "room_id", roomID, "error", err)
+
+		return
+	}
+
+	if rm := h.room(roomID, false); rm != nil {
+		rm.do(func(rm *room) {
+			if _, ok := rm.clients[c]; ok {
+				rm.deliver(c, outbound{data: data})
+			}
+		})
+	}
+}
+
+// sendSnapshot sends the snapshot to c followed by what was broadcast while
+// it was being built. A client whose snapshot fails to build is closed.
+func (h *Hub) sendSnapshot(roomID string, c *Client, snapshot Snapshot) {
+	msg, err := snapshot(c.ctx)
+
+	// The snapshot was given up on because the client was dropped or the
+	// hub is draining, which closes the client with its own close code.
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		slog.Error("Failed to build snapshot", "room_id", roomID, "error", err)
+	}
+
+	rm := h.room(roomID, false)
+
+	if rm == nil {
+		return
+	}
+
+	rm.do(func(rm *room) {
+		if _, ok := rm.clients[c]; !ok {
+			return
+		}
+
+		held := c.held
+
+		c.holding = false
+		c.held = nil
+
+		var data *frame
+
+		if err == nil {
+			msg.EventID = c.snapshotEventID
+
+			data, err = encode(msg)
+
+			if err != nil {
+				slog.Error("Failed to encode snapshot", "room_id", roomID, "error", err)
+			}
+		}
+
+		// The events held have nothing to apply to without the snapshot, so
+		// the client is closed to reconnect and try again.
+		if err != nil {
+			rm.close(c, websocket.CloseInternalServerErr, "Failed to build snapshot")
+
+			return
+		}
+
+		if !rm.write(c, outbound{data: data}) {
+			return
+		}
+
+		for _, out := range held {
+			if !rm.write(c, out) {
+				return
+			}
+		}
+	})
+}
+
+func (h *Hub) unsubscribe(roomID string, c *Client) {
+	if rm := h.room(roomID, false); rm != nil {
+		rm.do(func(rm *room) {
+			rm.drop(c)
+		})
+	}
+}
+
+// Publish sends msg to every client of its room, on this instance and,
+// through the relay, on the others. Messages published from the same
+// goroutine reach clients in order, and messages published concurrently
+// reach every client in the same order.
+func (h *Hub) Publish(msg Message) {
+	h.relayMessage(msg)
+
+	h.deliver(msg)
+}
+
+// deliver sends msg to the clients of its room on this instance only. Event
+// ids are given out by each instance, so a relayed message gets a new one.
+func (h *Hub) deliver(msg Message) {
+	rm := h.room(msg.RoomID, false)
+
+	if rm == nil {
+		return
+	}
+
+	rm.do(func(rm *room) {
+		rm.publish(msg)
+	})
+}
+
+// Disconnect sends a close frame to the clients of the room matching match
+// and drops them, on every instance.
+func (h *Hub) Disconnect(roomID string, match ClientMatch, code int, reason string) {
+	h.relay(RelayOp{Kind: RelayDisconnect, RoomID: roomID, Match: match, Code: code, Reason: reason})
+
+	h.disconnect(roomID, match, code, reason)
+}
+
+func (h *Hub) disconnect(roomID string, match ClientMatch, code int, reason string) {
+	rm := h.room(roomID, false)
+
+	if rm == nil {
+		return
+	}
+
+	rm.do(func(rm *room) {
+		for c := range rm.clients {
+			if match.matches(c.info) {
+				rm.close(c, code, reason)
+			}
+		}
+	})
+}
+
+// Close disconnects every client of the room and stops its goroutine, on
+// every instance.
+func (h *Hub) Close(roomID string, code int, reason string) {
+	h.relay(RelayOp{Kind: RelayClose, RoomID: roomID, Code: code, Reason: reason})
+
+	h.close(roomID, code, reason)
+}
+
+func (h *Hub) close(roomID string, code int, reason string) {
+	h.mu.Lock()
+
+	rm, ok := h.rooms[roomID]
+
+	delete(h.rooms, roomID)
+
+	h.mu.Unlock()
+
+	if ok {
+		rm.stop(code, reason)
+	}
+}
+
+// Forget drops everything the hub remembers about a room, for rooms that
+// are gone for good, on every instance.
+func (h *Hub) Forget(roomID string) {
+	h.relay(RelayOp{Kind: RelayForget, RoomID: roomID})
+
+	h.forget(roomID)
+}
+
+func (h *Hub) forget(roomID string) {
+	h.close(roomID, websocket.CloseNormalClosure, "")
+
+	h.mu.Lock()
+
+	delete(h.peaks, roomID)
+
+	h.mu.Unlock()
+
+	h.relayMu.Lock()
+
+	for key := range h.relayedAt {
+		if strings.HasPrefix(key, roomID+"\x00") {
+			delete(h.relayedAt, key)
+		}
+	}
+
+	h.relayMu.Unlock()
+}
+
+// Stats returns how many clients are subscribed to the room right now and
+// the most there ever were at once, until the room is forgotten.
+func (h *Hub) Stats(roomID string) (current, peak int) {
+	if rm := h.room(roomID, false); rm != nil {
+		count := make(chan int, 1)
+
+		if rm.do(func(rm *room) { count <- len(rm.clients) }) {
+			current = <-count
+		}
+	}
+
+	h.mu.Lock()
+
+	peak = h.peaks[roomID]
+
+	h.mu.Unlock()
+
+	return current, peak
+}
+
+// Counts returns how many clients are subscribed right now to each room the
+// hub has running.
+func (h *Hub) Counts() map[string]int {
+	h.mu.Lock()
+
+	rooms := make([]*room, 0, len(h.rooms))
+
+	for _, rm := range h.rooms {
+		rooms = append(rooms, rm)
+	}
+
+	h.mu.Unlock()
+
+	counts := make(map[string]int, len(rooms))
+
+	for _, rm := range rooms {
+		count := make(chan int, 1)
+
+		if rm.do(func(rm *room) { count <- len(rm.clients) }) {
+			counts[rm.id] = <-count
+		}
+	}
+
+	return counts
+}
+
+// sendBufferSize is how many messages can wait for a client's write pump.
+// It leaves room for a snapshot followed by a full replay or held backlog.
+func (h *Hub) sendBufferSize() int {
+	return 2 * max(h.opts.EventBufferSize, maxHeldMessages)
+}
+
+func (h *Hub) trackPeak(roomID string, current int) {
+	h.mu.Lock()
+
+	if current > h.peaks[roomID] {
+		h.peaks[roomID] = current
+	}
+
+	h.mu.Unlock()
+}
+
+type room struct {
+	id      string
+	hub     *Hub
+	clients map[*Client]struct{}
+	ops     chan func(*room)
+
+	// lastEventID is the id of the last event published to the room, and
+	// recent a ring of the last events for resuming clients and long polls.
+	// The ring is only allocated, with bufferSize slots, once the room has
+	// an event to keep.
+	lastEventID uint64
+	recent      []recentEvent
+	recentCount int
+	bufferSize  int
+
+	// countTimer is set while a viewer count event is pending, and sentCount
+	// is the count last sent.
+	countTimer *time.Timer
+	sentCount  int
+
+	lastTypingAt time.Time
+
+	// coalesceInterval is the least time between two broadcasts with the
+	// same Message.Coalesce key. coalescedAt is when each key was last
+	// broadcast, and coalesced holds the latest message of each key
+	// waiting for its turn.
+	coalesceInterval time.Duration
+	coalescedAt      map[string]time.Time
+	coalesced        map[string]Message
+
+	// present holds the participants connected to the room, and anonymous
+	// counts the connections without a participant id.
+	present   map[uuid.UUID]*presence
+	anonymous int
+
+	// polled is closed on the next broadcast, to wake the long polls
+	// waiting for it. It is only made once someone waits.
+	polled chan struct{}
+
+	// usedAt is when the room last lost its last client or was polled, and
+	// idleTimer is set while the room is due to be checked for idleness.
+	usedAt    time.Time
+	idleTimer *time.Timer
+
+	// mu guards stopped, evicted and sending to ops, so nothing is queued
+	// once the room is stopping. Callers take it; the room's goroutine only
+	// tries to, see evictIfIdle.
+	mu      sync.Mutex
+	stopped bool
+	evicted bool
+}
+
+type recentEvent struct {
+	id   uint64
+	kind string
+	// data is the encoded message, which out prepares for the clients.
+	data      []byte
+	out       outbound
+	except    uuid.NullUUID
+	hostsOnly bool
+}
+
+// skips reports whether the client described by info is left out of the
+// event.
+func (e recentEvent) skips(info ClientInfo) bool {
+	return (e.except.Valid && info.ParticipantID == e.except) || (e.hostsOnly && !info.Host)
+}
+
+func newRoom(h *Hub, id string) *room {
+	opts := h.opts
+
+	rm := &room{
+		id:      id,
+		hub:     h,
+		clients: make(map[*Client]struct{}),
+		ops:     make(chan func(*room), roomQueueSize),
+		// Event ids start from the clock rather than zero, so ids handed out
+		// before a restart or before the room was closed and reopened are
+		// never mistaken for newer ones.
+		lastEventID: uint64(time.Now().UnixMicro()),
+		coalescedAt: make(map[string]time.Time),
+		coalesced:   make(map[string]Message),
+		present:     make(map[uuid.UUID]*presence),
+		bufferSize:  opts.EventBufferSize,
+	}
+
+	if opts.CoalescePerSecond > 0 {
+		rm.coalesceInterval = time.Second / time.Duration(opts.CoalescePerSecond)
+	}
+
+	// A room nobody ends up joining is evicted like any other idle one.
+	rm.touch()
+
+	return rm
+}
+
+// remember keeps an event in the ring, evicting the oldest one when full.
+func (rm *room) remember(e recentEvent) {
+	if rm.recent == nil {
+		rm.recent = make([]recentEvent, rm.bufferSize)
+	}
+
+	rm.recent[e.id%uint64(rm.bufferSize)] = e
+
+	rm.recentCount = min(rm.recentCount+1, rm.bufferSize)
+}
+
+// recentEvent returns the event with the given id, which must be buffered.
+func (rm *room) recentEvent(id uint64) recentEvent {
+	return rm.recent[id%uint64(rm.bufferSize)]
+}
+
+// buffered reports whether the events after lastEventID are all in the ring,
+// and lastEventID is one this room handed out. Lookups are counted as hits
+// and misses of the buffer.
+func (rm *room) buffered(lastEventID uint64) bool {
+	oldest := rm.lastEventID - uint64(rm.recentCount)
+
+	if lastEventID < oldest || lastEventID > rm.lastEventID {
+		eventBuffer.Add("misses", 1)
+
+		return false
+	}
+
+	eventBuffer.Add("hits", 1)
+
+	return true
+}
+
+// replay sends c the events after lastEventID. It sends nothing and returns
+// false when some of them are no longer in the ring, or when lastEventID is
+// not one this room handed out.
+func (rm *room) replay(c *Client, lastEventID uint64) bool {
+	if !rm.buffered(lastEventID) {
+		return false
+	}
+
+	for id := lastEventID + 1; id <= rm.lastEventID; id++ {
+		e := rm.recentEvent(id)
+		out := e.out
+
+		if !c.wants(e.kind) {
+			continue
+		}
+
+		if e.skips(c.info) {
+			if out.skip == nil {
+				continue
+			}
+
+			out = outbound{data: out.skip}
+		}
+
+		if !rm.write(c, out) {
+			return true
+		}
+	}
+
+	return true
+}
+
+func (rm *room) run() {
+	for op := range rm.ops {
+		op(rm)
+	}
+}
+
+// do queues op for the room's goroutine. It returns false, without queuing
+// op, when the room is stopping.
+func (rm *room) do(op func(*room)) bool {
+	rm.mu.Lock()
+
+	defer rm.mu.Unlock()
+
+	if rm.stopped {
+		return false
+	}
+
+	rm.ops <- op
+
+	return true
+}
+
+// stop closes every client and ends the room's goroutine once the
+// operations queued before it have run.
+func (rm *room) stop(code int, reason string) {
+	rm.mu.Lock()
+
+	defer rm.mu.Unlock()
+
+	if rm.stopped {
+		return
+	}
+
+	rm.stopped = true
+
+	rm.ops <- func(rm *room) {
+		for c := range rm.clients {
+			rm.close(c, code, reason)
+		}
+
+		rm.wakePollers()
+	}
+
+	close(rm.ops)
+}
+
+// publish broadcasts msg, unless a message with the same coalesce key went
+// out less than coalesceInterval ago. It is then held, replacing whatever
+// was held for the key, and broadcast when the interval is up.
+func (rm *room) publish(msg Message) {
+	if msg.Coalesce == "" || rm.coalesceInterval == 0 {
+		rm.broadcast(msg)
+
+		return
+	}
+
+	key := msg.Coalesce
+
+	if _, ok := rm.coalesced[key]; ok {
+		rm.coalesced[key] = msg
+
+		return
+	}
+
+	now := time.Now()
+
+	if wait := rm.coalesceInterval - now.Sub(rm.coalescedAt[key]); wait > 0 {
+		rm.coalesced[key] = msg
+
+		time.AfterFunc(wait, func() {
+			rm.do(func(rm *room) {
+				msg, ok := rm.coalesced[key]
+
+				if !ok {
+					return
+				}
+
+				delete(rm.coalesced, key)
+
+				rm.coalescedAt[key] = time.Now()
+
+				rm.broadcast(msg)
+			})
+		})
+
+		return
+	}
+
+	// Keys only matter for an interval after their last broadcast, so the
+	// stale ones are swept once there are many of them.
+	if len(rm.coalescedAt) >= maxCoalesceKeys {
+		for k, at := range rm.coalescedAt {
+			if now.Sub(at) >= rm.coalesceInterval {
+				delete(rm.coalescedAt, k)
+			}
+		}
+	}
+
+	rm.coalescedAt[key] = now
+
+	rm.broadcast(msg)
+}
+
+func (rm *room) broadcast(msg Message) {
+	msg.EventID = rm.lastEventID + 1
+
+	// The message is kept encoded for long polling, besides prepared for
+	// the clients.
+	raw, err := json.Marshal(msg)
+
+	if err != nil {
+		slog.Error("Failed to encode message", "kind", msg.Kind, "error", err)
+
+		return
+	}
+
+	data, err := prepare(msg, raw)
+
+	if err != nil {
+		slog.Error("Failed to encode message", "kind", msg.Kind, "error", err)
+
+		return
+	}
+
+	rm.lastEventID = msg.EventID
+
+	broadcasts.Add(1)
+
+	out := outbound{data: data, coalesce: msg.Coalesce}
+
+	if msg.ExceptParticipant.Valid || msg.HostsOnly || msg.Coalesce != "" {
+		out.skip = rm.skipped(msg.EventID)
+	}
+
+	e := recentEvent{id: msg.EventID, kind: msg.Kind, data: raw, out: out, except: msg.ExceptParticipant, hostsOnly: msg.HostsOnly}
+
+	rm.remember(e)
+
+	rm.wakePollers()
+
+	for c := range rm.clients {
+		if !c.wants(e.kind) {
+			continue
+		}
+
+		if e.skips(c.info) {
+			rm.skip(c, out)
+
+			continue
+		}
+
+		rm.deliver(c, out)
+	}
+}
+
+// skipped prepares the KindEventSkipped stand-in of an event. It returns nil
+// when that fails, leaving a gap for the clients that skip the event.
+func (rm *room) skipped(eventID uint64) *frame {
+	data, err := encode(rm.skippedMessage(eventID))
+
+	if err != nil {
+		slog.Error("Failed to encode skipped event", "room_id", rm.id, "error", err)
+
+		return nil
+	}
+
+	return data
+}
+
+func (rm *room) skippedMessage(eventID uint64) Message {
+	return Message{EventID: eventID, Kind: KindEventSkipped, RoomID: rm.id, Value: json.RawMessage("{}")}
+}
+
+// skip delivers the stand-in of out to a client left out of it.
+func (rm *room) skip(c *Client, out outbound) {
+	if out.skip != nil {
+		rm.deliver(c, outbound{data: out.skip})
+	}
+}
+
+// deliver writes out to c, or holds it when c is waiting for its snapshot.
+func (rm *room) deliver(c *Client, out outbound) {
+	if !c.holding {
+		rm.write(c, out)
+
+		return
+	}
+
+	if len(c.held) == maxHeldMessages {
+		slog.Warn("Too many messages held for client", "room_id", rm.id)
+
+		slowClients.Add("disconnected", 1)
+
+		rm.drop(c)
+
+		return
+	}
+
+	c.held = append(c.held, out)
+}
+
+// sendEphemeral sends msg to the clients of the room but c, without an event
+// id and without keeping it for replays. Clients waiting for their snapshot
+// don't get it.
+func (rm *room) sendEphemeral(msg Message, except *Client) {
+	data, err := encode(msg)
+
+	if err != nil {
+		slog.Error("Failed to encode message", "kind", msg.Kind, "error", err)
+
+		return
+	}
+
+	for c := range rm.clients {
+		if c == except || c.holding || !c.wants(msg.Kind) {
+			continue
+		}
+
+		rm.write(c, outbound{data: data, coalesce: msg.Coalesce})
+	}
+}
+
+// typing tells the room someone is typing, unless it was told so less than
+// typingThrottle ago.
+func (rm *room) typing(c *Client) {
+	if _, ok := rm.clients[c]; !ok {
+		return
+	}
+
+	now := time.Now()
+
+	if now.Sub(rm.lastTypingAt) < typingThrottle {
+		return
+	}
+
+	rm.lastTypingAt = now
+
+	msg, err := NewMessage(KindSomeoneTyping, rm.id, SomeoneTyping{})
+
+	if err != nil {
+		slog.Error("Failed to encode typing event", "room_id", rm.id, "error", err)
+
+		return
+	}
+
+	msg.Coalesce = KindSomeoneTyping
+
+	rm.sendEphemeral(msg, c)
+}
+
+// write queues out for c. A client whose policy can't make room for it is
+// disconnected with CloseTooSlow, since it would only hold the room up.
+func (rm *room) write(c *Client, out outbound) bool {
+	if c.push(out) {
+		return true
+	}
+
+	// Clients closed outside of the room, such as multiplexed ones, only
+	// have to leave it.
+	if c.isClosed() {
+		rm.drop(c)
+
+		return false
+	}
+
+	slog.Warn("Client too slow, disconnecting it", "room_id", rm.id)
+
+	slowClients.Add("disconnected", 1)
+
+	// The backlog is dropped so the close frame goes out right away. The
+	// client resumes from the last event it got when it reconnects.
+	c.closeWith(CloseTooSlow, "Too slow", true)
+
+	rm.drop(c)
+
+	return false
+}
+
+// close queues a close frame for c and drops it. The frame goes out after
+// what was queued before, so clients get the event explaining the close.
+//
+// Multiplexed clients only lose the room: they are sent a KindUnsubscribed
+// event with the code and reason instead, and their connection stays open.
+func (rm *room) close(c *Client, code int, reason string) {
+	if _, ok := rm.clients[c]; !ok {
+		return
+	}
+
+	if c.mux {
+		rm.leave(c)
+
+		rm.sendUnsubscribed(c, code, reason)
+
+		return
+	}
+
+	c.closeWith(code, reason, false)
+
+	rm.drop(c)
+}
+
+// drop removes c from the room and closes it.
+func (rm *room) drop(c *Client) {
+	if _, ok := rm.clients[c]; !ok {
+		return
+	}
+
+	rm.leave(c)
+
+	c.close()
+}
+
+// add subscribes c to the room and counts it in the connection metrics.
+func (rm *room) add(c *Client) {
+	rm.clients[c] = struct{}{}
+
+	rm.hub.trackPeak(rm.id, len(rm.clients))
+
+	connections.Add(1)
+
+	roomConnections.Add(rm.id, 1)
+
+	rm.joined(c)
+}
+
+// leave removes c from the room without closing it.
+func (rm *room) leave(c *Client) {
+	if _, ok := rm.clients[c]; !ok {
+		return
+	}
+
+	delete(rm.clients, c)
+
+	connections.Add(-1)
+
+	if len(rm.clients) == 0 {
+		roomConnections.Delete(rm.id)
+
+		rm.touch()
+	} else {
+		roomConnections.Add(rm.id, -1)
+	}
+
+	if c.mux {
+		c.mu.Lock()
+
+		delete(c.rooms, rm.id)
+
+		c.mu.Unlock()
+	}
+
+	rm.left(c)
+
+	rm.countChanged()
+}
+
+// countChanged schedules a viewer count event unless one is pending. The
+// count is read when it fires, so it only goes out when it really changed.
+func (rm *room) countChanged() {
+	if rm.countTimer != nil {
+		return
+	}
+
+	rm.countTimer = time.AfterFunc(viewerCountDebounce, func() {
+		rm.do(func(rm *room) {
+			rm.countTimer = nil
+
+			rm.sendViewerCount()
+			rm.sendViewers()
+		})
+	})
+}
+
+func (rm *room) sendViewerCount() {
+	count := len(rm.clients)
+
+	if count == rm.sentCount {
+		return
+	}
+
+	msg, err := NewMessage(KindViewerCount, rm.id, ViewerCount{Count: count})
+
+	if err != nil {
+		slog.Error("Failed to encode viewer count", "room_id", rm.id, "error", err)
+
+		return
+	}
+
+	msg.Coalesce = KindViewerCount
+
+	rm.sentCount = count
+
+	rm.broadcast(msg)
+}
+
+// sendViewers lists the clients of the room to its hosts, if any are
+// connected.
+func (rm *room) sendViewers() {
+	hosts := false
+
+	viewers := Viewers{Count: len(rm.clients), Viewers: []Viewer{}}
+
+	for c := range rm.clients {
+		hosts = hosts || c.info.Host
+
+		if len(viewers.Viewers) < maxListedViewers {
+			viewers.Viewers = append(viewers.Viewers, Viewer{ParticipantID: c.info.ParticipantID, IP: c.info.IP})
+		}
+	}
+
+	if !hosts {
+		return
+	}
+
+	msg, err := NewMessage(KindViewers, rm.id, viewers)
+
+	if err != nil {
+		slog.Error("Failed to encode viewers", "room_id", rm.id, "error", err)
+
+		return
+	}
+
+	msg.HostsOnly = true
+	msg.Coalesce = KindViewers
+
+	rm.broadcast(msg)
+}
@@ -0,0 +1,404 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const testRoomID = "room"
+
+// serveHub starts a server subscribing every connection to testRoomID, as
+// the participant of the participant_id query parameter if there is one.
+// The hub drains and the server stops when the test ends.
+func serveHub(t testing.TB, opts HubOptions) (*Hub, string) {
+	return serveHubWith(t, opts, websocket.Upgrader{})
+}
+
+func serveHubWith(t testing.TB, opts HubOptions, upgrader websocket.Upgrader) (*Hub, string) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	hub := NewHub(ctx, opts)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			return
+		}
+
+		info := ClientInfo{IP: "127.0.0.1"}
+
+		if id, err := uuid.Parse(r.URL.Query().Get("participant_id")); err == nil {
+			info.ParticipantID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+
+		hub.Serve(testRoomID, conn, info, ServeOptions{})
+	}))
+
+	t.Cleanup(func() {
+		cancel()
+
+		hub.Wait()
+
+		srv.Close()
+	})
+
+	return hub, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t testing.TB, url string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	return conn
+}
+
+// waitForClients waits until the room has n clients.
+func waitForClients(t testing.TB, hub *Hub, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if current, _ := hub.Stats(testRoomID); current == n {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("room never got %d clients", n)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestHubStatsPeak checks that the peak of a room outlives its goroutine
+// and goes once the room is forgotten.
+func TestHubStatsPeak(t *testing.T) {
+	hub, url := serveHub(t, HubOptions{})
+
+	for range 2 {
+		defer dial(t, url).Close()
+	}
+
+	waitForClients(t, hub, 2)
+
+	hub.Close(testRoomID, websocket.CloseNormalClosure, "")
+
+	if current, peak := hub.Stats(testRoomID); current != 0 || peak != 2 {
+		t.Fatalf("Stats after Close = %d, %d, want 0, 2", current, peak)
+	}
+
+	hub.Forget(testRoomID)
+
+	if current, peak := hub.Stats(testRoomID); current != 0 || peak != 0 {
+		t.Fatalf("Stats after Forget = %d, %d, want 0, 0", current, peak)
+	}
+}
+
+type stressEvent struct {
+	Publisher int `json:"publisher"`
+	Seq       int `json:"seq"`
+}
+
+// TestHubOrderUnderConcurrency publishes from several goroutines while
+// other clients keep subscribing and being disconnected, and checks that
+// the clients that stay see every event, in the order of their event ids,
+// and all in the same order. Run it with -race.
+func TestHubOrderUnderConcurrency(t *testing.T) {
+	const (
+		listeners  = 8
+		churners   = 8
+		publishers = 4
+		published  = 200
+	)
+
+	hub, url := serveHub(t, HubOptions{})
+
+	type received struct {
+		ids    []uint64
+		events []stressEvent
+		err    error
+	}
+
+	results := make([]received, listeners)
+
+	var listening sync.WaitGroup
+
+	for i := range listeners {
+		conn := dial(t, url)
+
+		listening.Add(1)
+
+		go func() {
+			defer listening.Done()
+
+			defer conn.Close()
+
+			got := &results[i]
+
+			for {
+				_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+				var msg Message
+
+				if err := conn.ReadJSON(&msg); err != nil {
+					got.err = err
+
+					return
+				}
+
+				got.ids = append(got.ids, msg.EventID)
+
+				if msg.Kind != "stress" {
+					continue
+				}
+
+				var e stressEvent
+
+				if err := json.Unmarshal(msg.Value, &e); err != nil {
+					got.err = err
+
+					return
+				}
+
+				if e.Publisher < 0 {
+					return
+				}
+
+				got.events = append(got.events, e)
+			}
+		}()
+	}
+
+	waitForClients(t, hub, listeners)
+
+	stop := make(chan struct{})
+
+	var churning sync.WaitGroup
+
+	// Churners subscribe over and over, each time disconnected by the hub.
+	for range churners {
+		id := uuid.New()
+
+		churning.Add(1)
+
+		go func() {
+			defer churning.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				conn, _, err := websocket.DefaultDialer.Dial(url+"?participant_id="+id.String(), nil)
+
+				if err != nil {
+					return
+				}
+
+				// The reader ends with the hub closing the connection, or
+				// the deadline when the disconnect came before the client
+				// joined.
+				_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						break
+					}
+				}
+
+				conn.Close()
+			}
+		}()
+
+		churning.Add(1)
+
+		go func() {
+			defer churning.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Millisecond):
+				}
+
+				hub.Disconnect(testRoomID, ClientMatch{ParticipantID: uuid.NullUUID{UUID: id, Valid: true}}, CloseBanned, "Banned from room")
+			}
+		}()
+	}
+
+	var publishing sync.WaitGroup
+
+	for p := range publishers {
+		publishing.Add(1)
+
+		go func() {
+			defer publishing.Done()
+
+			for seq := range published {
+				msg, err := NewMessage("stress", testRoomID, stressEvent{Publisher: p, Seq: seq})
+
+				if err != nil {
+					t.Error(err)
+
+					return
+				}
+
+				hub.Publish(msg)
+			}
+		}()
+	}
+
+	publishing.Wait()
+
+	close(stop)
+
+	churning.Wait()
+
+	// The last event, after every other, tells the listeners to stop.
+	done, err := NewMessage("stress", testRoomID, stressEvent{Publisher: -1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub.Publish(done)
+
+	listening.Wait()
+
+	for i, got := range results {
+		if got.err != nil {
+			t.Fatalf("listener %d: %v", i, got.err)
+		}
+
+		if len(got.events) != publishers*published {
+			t.Fatalf("listener %d got %d events, want %d", i, len(got.events), publishers*published)
+		}
+
+		for j := 1; j < len(got.ids); j++ {
+			if got.ids[j] != got.ids[j-1]+1 {
+				t.Fatalf("listener %d got event %d after %d", i, got.ids[j], got.ids[j-1])
+			}
+		}
+
+		next := make([]int, publishers)
+
+		for _, e := range got.events {
+			if e.Seq != next[e.Publisher] {
+				t.Fatalf("listener %d got event %d of publisher %d, want %d", i, e.Seq, e.Publisher, next[e.Publisher])
+			}
+
+			next[e.Publisher]++
+		}
+
+		for j, e := range got.events {
+			if e != results[0].events[j] {
+				t.Fatalf("listener %d got %+v as event %d, listener 0 got %+v", i, e, j, results[0].events[j])
+			}
+		}
+	}
+}
+
+// BenchmarkHubPublish fans reaction counts out to the clients of a room,
+// with and without permessage-deflate, waiting for every client to read
+// them. Each op is one event sent to every client.
+func BenchmarkHubPublish(b *testing.B) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+
+		if compress {
+			name = "deflate"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			benchmarkHubPublish(b, compress)
+		})
+	}
+}
+
+func benchmarkHubPublish(b *testing.B, compress bool) {
+	const (
+		clients = 100
+		// batch stays well under the queue of each client, so none of
+		// them is dropped as too slow between two waits.
+		batch = 64
+	)
+
+	hub, url := serveHubWith(b, HubOptions{}, websocket.Upgrader{EnableCompression: compress})
+
+	dialer := websocket.Dialer{EnableCompression: compress}
+
+	read := make([]atomic.Int64, clients)
+
+	for i := range clients {
+		conn, _, err := dialer.Dial(url, nil)
+
+		if err != nil {
+			b.Fatalf("dial: %v", err)
+		}
+
+		go func() {
+			defer conn.Close()
+
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+
+				read[i].Add(1)
+			}
+		}()
+	}
+
+	waitForClients(b, hub, clients)
+
+	msg, err := NewMessage("reaction_count", testRoomID, map[string]any{
+		"message_id": uuid.NewString(),
+		"reactions":  map[string]int{"like": 42, "heart": 7, "laugh": 3},
+	})
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for sent := 0; sent < b.N; {
+		n := min(batch, b.N-sent)
+
+		for range n {
+			hub.Publish(msg)
+		}
+
+		sent += n
+
+		// The viewer count the hub sends once everyone joined may be read
+		// too, which only ends the last wait one event early.
+		for i := range read {
+			for read[i].Load() < int64(sent) {
+				time.Sleep(10 * time.Microsecond)
+			}
+		}
+	}
+}
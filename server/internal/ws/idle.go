@@ -0,0 +1,113 @@
+package ws
+
+import "time"
+
+// roomIdleTimeout is how long a room is kept after its last client left or
+// its last long poll, so clients that lost their connection can still resume
+// from its buffer. It is then evicted from the hub, buffer and all, and started
+// afresh by the next client.
+const roomIdleTimeout = time.Minute
+
+// enter queues op for the room, starting the room when it isn't running. It
+// returns a nil room when the hub is draining, and false when the room was
+// closed before op could be queued. A room evicted in between is started
+// again, as if it had never been found.
+func (h *Hub) enter(roomID string, op func(*room)) (*room, bool) {
+	for {
+		rm := h.room(roomID, true)
+
+		if rm == nil {
+			return nil, false
+		}
+
+		if rm.do(op) {
+			return rm, true
+		}
+
+		if !rm.wasEvicted() {
+			return rm, false
+		}
+	}
+}
+
+// touch marks the room as used right now, and makes sure it is checked for
+// idleness once roomIdleTimeout has passed.
+func (rm *room) touch() {
+	rm.usedAt = time.Now()
+
+	rm.armIdleTimer(roomIdleTimeout)
+}
+
+func (rm *room) armIdleTimer(d time.Duration) {
+	if rm.idleTimer != nil {
+		return
+	}
+
+	rm.idleTimer = time.AfterFunc(d, func() {
+		rm.do(func(rm *room) {
+			rm.idleTimer = nil
+
+			rm.evictIfIdle()
+		})
+	})
+}
+
+// evictIfIdle removes the room from the hub and ends its goroutine when it
+// has had no clients nor long polls for roomIdleTimeout. The room's goroutine
+// runs it, so nothing else touches the room meanwhile; it only tries to take
+// rm.mu, as whoever holds it may be waiting for the goroutine to queue an op.
+func (rm *room) evictIfIdle() {
+	if len(rm.clients) > 0 {
+		return
+	}
+
+	if idle := time.Since(rm.usedAt); idle < roomIdleTimeout {
+		rm.armIdleTimer(max(roomIdleTimeout-idle, time.Second))
+
+		return
+	}
+
+	if !rm.mu.TryLock() {
+		rm.armIdleTimer(time.Second)
+
+		return
+	}
+
+	defer rm.mu.Unlock()
+
+	// Ops queued meanwhile, such as a client joining, keep the room.
+	if len(rm.ops) > 0 {
+		rm.armIdleTimer(time.Second)
+
+		return
+	}
+
+	h := rm.hub
+
+	h.mu.Lock()
+
+	if h.rooms[rm.id] == rm {
+		delete(h.rooms, rm.id)
+	}
+
+	h.mu.Unlock()
+
+	rm.stopped = true
+	rm.evicted = true
+
+	// Long polls wait far less than roomIdleTimeout, so there should be
+	// none, but any left would find the room gone and move to the next.
+	rm.wakePollers()
+
+	close(rm.ops)
+}
+
+// wasEvicted reports whether the room stopped for being idle rather than
+// being closed.
+func (rm *room) wasEvicted() bool {
+	rm.mu.Lock()
+
+	defer rm.mu.Unlock()
+
+	return rm.evicted
+}
@@ -0,0 +1,82 @@
+package ws
+
+import (
+	"expvar"
+	"time"
+)
+
+// The hub keeps its metrics in expvar, where they are served as JSON under
+// /debug/vars when the handler exposes it.
+var (
+	// connections is the number of clients subscribed to any room, and
+	// roomConnections the same per room id. Multiplexed clients count once
+	// per room in roomConnections.
+	connections     = expvar.NewInt("ws_connections")
+	roomConnections = expvar.NewMap("ws_room_connections")
+
+	// broadcasts counts the events rooms sent out, and messagesSent the
+	// messages written to connections, one per client an event reached.
+	broadcasts   = expvar.NewInt("ws_broadcasts")
+	messagesSent = expvar.NewInt("ws_messages_sent")
+
+	// eventBuffer counts the lookups of resuming clients and long polls in
+	// the rooms' event buffers, under the hits and misses keys. A miss
+	// means the client had to start over from a snapshot or the REST API.
+	eventBuffer = expvar.NewMap("ws_event_buffer")
+
+	// slowClients counts how often the slow client policies kick in, under
+	// the dropped, coalesced and disconnected keys.
+	slowClients = expvar.NewMap("ws_slow_clients")
+
+	// rateLimited counts the frames dropped for going past the frame rate
+	// limit, and the clients disconnected for it, under the dropped and
+	// disconnected keys.
+	rateLimited = expvar.NewMap("ws_rate_limited")
+
+	// writeLatency is a histogram of the time each write to a connection
+	// took. Every bucket counts the writes up to its bound, and count and
+	// sum_us cover all of them.
+	writeLatency = newLatencyHistogram("ws_write_latency")
+)
+
+type latencyBucket struct {
+	bound time.Duration
+	name  string
+}
+
+var latencyBuckets = []latencyBucket{
+	{time.Millisecond, "le_1ms"},
+	{10 * time.Millisecond, "le_10ms"},
+	{100 * time.Millisecond, "le_100ms"},
+	{time.Second, "le_1s"},
+	{writeWait, "le_10s"},
+}
+
+type latencyHistogram struct {
+	m *expvar.Map
+}
+
+func newLatencyHistogram(name string) latencyHistogram {
+	m := expvar.NewMap(name)
+
+	// The buckets are created up front so they show up before any write.
+	for _, b := range latencyBuckets {
+		m.Add(b.name, 0)
+	}
+
+	m.Add("count", 0)
+	m.Add("sum_us", 0)
+
+	return latencyHistogram{m: m}
+}
+
+func (h latencyHistogram) observe(d time.Duration) {
+	for _, b := range latencyBuckets {
+		if d <= b.bound {
+			h.m.Add(b.name, 1)
+		}
+	}
+
+	h.m.Add("count", 1)
+	h.m.Add("sum_us", d.Microseconds())
+}
@@ -0,0 +1,313 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// Multiplexed clients, served by ServeMux, pick their rooms with
+// KindSubscribe and KindUnsubscribe frames. Every event they get carries the
+// room it comes from in its room_id.
+//
+// KindSubscribed answers a subscribe frame once the client gets the events
+// of the room, with a Subscribed payload, and KindSubscribeFailed one that
+// was refused, with a SubscribeError. KindUnsubscribed is sent when the
+// client leaves a room, whether it asked to or the room closed or banned it,
+// with an Unsubscribed payload.
+const (
+	KindSubscribe   = "subscribe"
+	KindUnsubscribe = "unsubscribe"
+
+	KindSubscribed      = "subscribed"
+	KindSubscribeFailed = "subscribe_failed"
+	KindUnsubscribed    = "unsubscribed"
+)
+
+// SubscribeFrame is sent by multiplexed clients to join or leave a room.
+// Token or AccessCode are needed to join private rooms.
+type SubscribeFrame struct {
+	Kind       string `json:"kind"`
+	RoomID     string `json:"room_id"`
+	Token      string `json:"token,omitempty"`
+	AccessCode string `json:"access_code,omitempty"`
+}
+
+// SubscribeError refuses a subscription with the status and detail the
+// single room endpoint would answer with.
+type SubscribeError struct {
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func (e *SubscribeError) Error() string {
+	return e.Detail
+}
+
+// Subscribed acknowledges a subscription. EventID is the id of the last
+// event of the room before it, so the next one the client gets is the one
+// after it, and gaps can be told from the first event on.
+type Subscribed struct {
+	EventID uint64 `json:"event_id"`
+}
+
+// Unsubscribed tells why a multiplexed client left a room. Code and Reason
+// are those the connection would have been closed with, and are empty when
+// the client asked to leave. RetryAfterMs is as in CloseReason, for
+// subscribing again.
+type Unsubscribed struct {
+	Code         int    `json:"code,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+// MuxOptions tune how a multiplexed client subscribes to rooms.
+type MuxOptions struct {
+	// Authorize checks the client may join the room of a subscribe frame.
+	// Returning a *SubscribeError refuses it with that status, any other
+	// error with a 500.
+	Authorize func(SubscribeFrame) error
+	// MaxRooms, when more than zero, caps the rooms the client can be
+	// subscribed to at once.
+	MaxRooms int
+	// SlowClientPolicy is as in ServeOptions.
+	SlowClientPolicy SlowClientPolicy
+}
+
+// ServeMux serves a client that subscribes to any number of rooms over one
+// connection. It gets the events of its rooms as they happen, without a
+// snapshot or replays, and can't send typing frames or commands.
+func (h *Hub) ServeMux(conn *websocket.Conn, info ClientInfo, opts MuxOptions) {
+	c := newClient(h.ctx, conn, info, opts.SlowClientPolicy, h.sendBufferSize())
+
+	c.mux = true
+	c.rooms = make(map[string]struct{})
+
+	if h.joinMux(c) {
+		defer h.leaveMux(c)
+	} else {
+		c.closeWith(websocket.CloseServiceRestart, serverRestartingReason, false)
+	}
+
+	pumped := make(chan struct{})
+
+	go func() {
+		c.writePump()
+
+		close(pumped)
+	}()
+
+	readErr := h.readFrames("", c, func(data []byte) {
+		h.handleMuxFrame(c, data, opts)
+	})
+
+	select {
+	case err := <-readErr:
+		if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			slog.Info("client connection lost", "error", err)
+		}
+
+		c.close()
+
+		<-pumped
+	case <-c.Done():
+		<-pumped
+		<-readErr
+	}
+
+	c.mu.Lock()
+
+	rooms := make([]string, 0, len(c.rooms))
+
+	for roomID := range c.rooms {
+		rooms = append(rooms, roomID)
+	}
+
+	c.mu.Unlock()
+
+	for _, roomID := range rooms {
+		h.unsubscribe(roomID, c)
+	}
+}
+
+// joinMux counts a ServeMux call for Wait and keeps its client for draining,
+// unless the hub is already draining.
+func (h *Hub) joinMux(c *Client) bool {
+	h.mu.Lock()
+
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return false
+	}
+
+	h.serving.Add(1)
+
+	h.muxClients[c] = struct{}{}
+
+	return true
+}
+
+func (h *Hub) leaveMux(c *Client) {
+	h.mu.Lock()
+
+	delete(h.muxClients, c)
+
+	h.mu.Unlock()
+
+	h.serving.Done()
+}
+
+// handleMuxFrame acts on a frame of a multiplexed client. Frames other than
+// subscribe and unsubscribe ones get a KindFrameError.
+func (h *Hub) handleMuxFrame(c *Client, data []byte, opts MuxOptions) {
+	var frame SubscribeFrame
+
+	if err := json.Unmarshal(data, &frame); err != nil {
+		sendFrameError(c, "", FrameError{Code: FrameErrorMalformed, Detail: "Frames must be JSON objects"})
+
+		return
+	}
+
+	if frame.Kind != KindSubscribe && frame.Kind != KindUnsubscribe {
+		sendFrameError(c, frame.RoomID, FrameError{Code: FrameErrorUnknownKind, Detail: "Unknown frame kind"})
+
+		return
+	}
+
+	if frame.RoomID == "" {
+		sendFrameError(c, "", FrameError{Code: FrameErrorInvalid, Detail: "Frames need a room_id"})
+
+		return
+	}
+
+	switch frame.Kind {
+	case KindSubscribe:
+		h.subscribeMux(c, frame, opts)
+	case KindUnsubscribe:
+		if rm := h.room(frame.RoomID, false); rm != nil {
+			rm.do(func(rm *room) {
+				if _, ok := rm.clients[c]; ok {
+					rm.leave(c)
+
+					rm.sendUnsubscribed(c, 0, "")
+				}
+			})
+		}
+	}
+}
+
+func (h *Hub) subscribeMux(c *Client, frame SubscribeFrame, opts MuxOptions) {
+	// The room is counted right away, before the room's goroutine gets to
+	// it, so frames sent back to back can't go past MaxRooms.
+	c.mu.Lock()
+
+	_, subscribed := c.rooms[frame.RoomID]
+	full := opts.MaxRooms > 0 && !subscribed && len(c.rooms) >= opts.MaxRooms
+
+	if !full {
+		c.rooms[frame.RoomID] = struct{}{}
+	}
+
+	c.mu.Unlock()
+
+	if full {
+		sendSubscribeFailed(c, frame.RoomID, &SubscribeError{Status: http.StatusTooManyRequests, Detail: "Too many rooms"})
+
+		return
+	}
+
+	fail := func(err error) {
+		if !subscribed {
+			c.mu.Lock()
+
+			delete(c.rooms, frame.RoomID)
+
+			c.mu.Unlock()
+		}
+
+		sendSubscribeFailed(c, frame.RoomID, err)
+	}
+
+	if opts.Authorize != nil {
+		if err := opts.Authorize(frame); err != nil {
+			fail(err)
+
+			return
+		}
+	}
+
+	rm, queued := h.enter(frame.RoomID, func(rm *room) {
+		// The acknowledgement is queued before the client is added, so it
+		// comes before any event of the room.
+		msg, err := NewMessage(KindSubscribed, rm.id, Subscribed{EventID: rm.lastEventID})
+
+		if err != nil {
+			slog.Error("Failed to encode subscribed event", "room_id", rm.id, "error", err)
+
+			return
+		}
+
+		c.send(msg)
+
+		// A client closed meanwhile is on its way out of its rooms, so it
+		// must not be added to another one.
+		if _, ok := rm.clients[c]; ok || c.isClosed() {
+			return
+		}
+
+		rm.add(c)
+
+		rm.countChanged()
+	})
+
+	if rm == nil {
+		fail(&SubscribeError{Status: http.StatusServiceUnavailable, Detail: serverRestartingReason})
+
+		return
+	}
+
+	if !queued {
+		fail(&SubscribeError{Status: http.StatusConflict, Detail: "Room is closed"})
+	}
+}
+
+func sendSubscribeFailed(c *Client, roomID string, err error) {
+	var subscribeErr *SubscribeError
+
+	if !errors.As(err, &subscribeErr) {
+		slog.Error("Failed to authorize subscription", "room_id", roomID, "error", err)
+
+		subscribeErr = &SubscribeError{Status: http.StatusInternalServerError, Detail: "Something went wrong"}
+	}
+
+	msg, err := NewMessage(KindSubscribeFailed, roomID, subscribeErr)
+
+	if err != nil {
+		slog.Error("Failed to encode subscribe failure", "room_id", roomID, "error", err)
+
+		return
+	}
+
+	c.send(msg)
+}
+
+// sendUnsubscribed tells a multiplexed client it left the room.
+func (rm *room) sendUnsubscribed(c *Client, code int, reason string) {
+	msg, err := NewMessage(KindUnsubscribed, rm.id, Unsubscribed{
+		Code:         code,
+		Reason:       reason,
+		RetryAfterMs: retryAfter(code).Milliseconds(),
+	})
+
+	if err != nil {
+		slog.Error("Failed to encode unsubscribed event", "room_id", rm.id, "error", err)
+
+		return
+	}
+
+	c.send(msg)
+}
@@ -0,0 +1,210 @@
+// Package pgrelay relays the events of the websocket hub, and the clients it
+// closes, between the instances of the server over Postgres LISTEN/NOTIFY, so running several
+// replicas needs nothing but the database they already share.
+//
+// Delivery is best effort: events sent while an instance is reconnecting
+// its listener are lost for the clients of that instance, and so are
+// events too large for a NOTIFY payload.
+package pgrelay
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"server/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// channel is the channel every instance listens and notifies on.
+const channel = "wsrs_events"
+
+// maxPayloadSize is the largest payload Postgres accepts in a NOTIFY,
+// which must be shorter than 8000 bytes.
+const maxPayloadSize = 7999
+
+// queueSize bounds the events waiting to be sent. Events past it are
+// dropped rather than holding up the publishers.
+const queueSize = 1024
+
+// reconnectDelay is how long the listener waits before reconnecting after
+// losing its connection.
+const reconnectDelay = time.Second
+
+// envelope is the payload of a notification: the operation, the message
+// it publishes along with the fields the hub keeps out of its JSON, or the
+// clients it closes, and the instance that sent it.
+type envelope struct {
+	Instance          uuid.UUID       `json:"instance"`
+	Op                ws.RelayOpKind  `json:"op"`
+	Kind              string          `json:"kind,omitempty"`
+	RoomID            string          `json:"room_id"`
+	Value             json.RawMessage `json:"value,omitempty"`
+	ExceptParticipant uuid.NullUUID   `json:"except_participant"`
+	HostsOnly         bool            `json:"hosts_only,omitempty"`
+	Coalesce          string          `json:"coalesce,omitempty"`
+	MatchParticipant  uuid.NullUUID   `json:"match_participant"`
+	MatchIP           string          `json:"match_ip,omitempty"`
+	Code              int             `json:"code,omitempty"`
+	Reason            string          `json:"reason,omitempty"`
+}
+
+func newEnvelope(instance uuid.UUID, op ws.RelayOp) envelope {
+	e := envelope{
+		Instance:         instance,
+		Op:               op.Kind,
+		RoomID:           op.RoomID,
+		MatchParticipant: op.Match.ParticipantID,
+		MatchIP:          op.Match.IP,
+		Code:             op.Code,
+		Reason:           op.Reason,
+	}
+
+	if op.Kind == ws.RelayPublish {
+		e.Kind = op.Message.Kind
+		e.Value = op.Message.Value
+		e.ExceptParticipant = op.Message.ExceptParticipant
+		e.HostsOnly = op.Message.HostsOnly
+		e.Coalesce = op.Message.Coalesce
+	}
+
+	return e
+}
+
+func (e envelope) op() ws.RelayOp {
+	return ws.RelayOp{
+		Kind: e.Op,
+		Message: ws.Message{
+			Kind:              e.Kind,
+			RoomID:            e.RoomID,
+			Value:             e.Value,
+			ExceptParticipant: e.ExceptParticipant,
+			HostsOnly:         e.HostsOnly,
+			Coalesce:          e.Coalesce,
+		},
+		RoomID: e.RoomID,
+		Match:  ws.ClientMatch{ParticipantID: e.MatchParticipant, IP: e.MatchIP},
+		Code:   e.Code,
+		Reason: e.Reason,
+	}
+}
+
+// Relay is a ws.Relay over Postgres. Notifications are sent through the
+// pool, and received on a connection of their own that does not count
+// against it.
+type Relay struct {
+	pool *pgxpool.Pool
+	// instance tells the notifications of this instance, which it receives
+	// too, from those of the others.
+	instance uuid.UUID
+	queue    chan ws.RelayOp
+}
+
+var _ ws.Relay = (*Relay)(nil)
+
+func New(pool *pgxpool.Pool) *Relay {
+	return &Relay{
+		pool:     pool,
+		instance: uuid.New(),
+		queue:    make(chan ws.RelayOp, queueSize),
+	}
+}
+
+func (r *Relay) Send(op ws.RelayOp) {
+	select {
+	case r.queue <- op:
+	default:
+		slog.Warn("Relay queue is full, operation not relayed", "room_id", op.RoomID, "op", op.Kind, "kind", op.Message.Kind)
+	}
+}
+
+// Listen also sends the queued events until ctx is done, so nothing is
+// relayed before the hub starts it.
+func (r *Relay) Listen(ctx context.Context, deliver func(ws.RelayOp)) {
+	go r.notify(ctx)
+
+	for {
+		err := r.listen(ctx, deliver)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Error("Lost the relay connection, reconnecting", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (r *Relay) listen(ctx context.Context, deliver func(ws.RelayOp)) error {
+	conn, err := pgx.ConnectConfig(ctx, r.pool.Config().ConnConfig.Copy())
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "listen "+channel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		var e envelope
+
+		if err := json.Unmarshal([]byte(notification.Payload), &e); err != nil {
+			slog.Error("Failed to decode relayed event", "error", err)
+
+			continue
+		}
+
+		if e.Instance == r.instance {
+			continue
+		}
+
+		deliver(e.op())
+	}
+}
+
+// notify sends the queued operations one at a time, so the other instances
+// get them in the order they were made.
+func (r *Relay) notify(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case op := <-r.queue:
+			payload, err := json.Marshal(newEnvelope(r.instance, op))
+
+			if err != nil {
+				slog.Error("Failed to encode relayed operation", "error", err)
+
+				continue
+			}
+
+			if len(payload) > maxPayloadSize {
+				slog.Warn("Event too large to relay", "room_id", op.RoomID, "kind", op.Message.Kind, "size", len(payload))
+
+				continue
+			}
+
+			if _, err := r.pool.Exec(ctx, "select pg_notify($1, $2)", channel, string(payload)); err != nil {
+				slog.Error("Failed to relay operation", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var (
+	// ErrEventsGone is returned by Events when some of the events asked for
+	// are no longer buffered, or the id they follow was not handed out by
+	// the room. The client has to resync from the REST endpoints.
+	ErrEventsGone = errors.New("ws: events are no longer available")
+	// ErrDraining is returned by Events once the hub is shutting down.
+	ErrDraining = errors.New("ws: hub is draining")
+)
+
+// Events is the long polling counterpart of Serve. It returns the events of
+// the room after sinceEventID, as a client described by info would get them,
+// waiting up to wait for the next one when there are none yet. They come
+// from the buffer used to resume clients, so polling clients can fall at
+// most HubOptions.EventBufferSize events behind.
+//
+// The returned id is the one to pass as sinceEventID next time. It is the
+// last event of the room when sinceEventID is zero, in which case no events
+// are returned, and with ErrEventsGone, so the client can resync and go on
+// from there.
+func (h *Hub) Events(ctx context.Context, roomID string, info ClientInfo, sinceEventID uint64, wait time.Duration) ([]json.RawMessage, uint64, error) {
+	timer := time.NewTimer(wait)
+
+	defer timer.Stop()
+
+	type result struct {
+		events []json.RawMessage
+		last   uint64
+		err    error
+		polled <-chan struct{}
+	}
+
+	for {
+		res := make(chan result, 1)
+
+		rm, queued := h.enter(roomID, func(rm *room) {
+			rm.touch()
+
+			if sinceEventID == 0 {
+				res <- result{last: rm.lastEventID}
+
+				return
+			}
+
+			if !rm.buffered(sinceEventID) {
+				res <- result{last: rm.lastEventID, err: ErrEventsGone}
+
+				return
+			}
+
+			if events := rm.eventsSince(info, sinceEventID); len(events) > 0 {
+				res <- result{events: events, last: rm.lastEventID}
+
+				return
+			}
+
+			if rm.polled == nil {
+				rm.polled = make(chan struct{})
+			}
+
+			res <- result{last: rm.lastEventID, polled: rm.polled}
+		})
+
+		if rm == nil {
+			return nil, sinceEventID, ErrDraining
+		}
+
+		// The room was closed, and its room_closed event already went out.
+		if !queued {
+			return nil, sinceEventID, nil
+		}
+
+		r := <-res
+
+		if r.polled == nil {
+			return r.events, r.last, r.err
+		}
+
+		select {
+		case <-r.polled:
+		case <-timer.C:
+			return nil, sinceEventID, nil
+		case <-ctx.Done():
+			return nil, sinceEventID, ctx.Err()
+		}
+	}
+}
+
+// eventsSince returns the events after sinceEventID, which must be
+// buffered, with the stand-ins of those info is left out of.
+func (rm *room) eventsSince(info ClientInfo, sinceEventID uint64) []json.RawMessage {
+	events := make([]json.RawMessage, 0, rm.lastEventID-sinceEventID)
+
+	for id := sinceEventID + 1; id <= rm.lastEventID; id++ {
+		e := rm.recentEvent(id)
+
+		if !e.skips(info) {
+			events = append(events, e.data)
+
+			continue
+		}
+
+		data, err := json.Marshal(rm.skippedMessage(id))
+
+		if err != nil {
+			slog.Error("Failed to encode skipped event", "room_id", rm.id, "error", err)
+
+			continue
+		}
+
+		events = append(events, data)
+	}
+
+	return events
+}
+
+// wakePollers wakes the long polls waiting for the room's next event.
+func (rm *room) wakePollers() {
+	if rm.polled != nil {
+		close(rm.polled)
+
+		rm.polled = nil
+	}
+}
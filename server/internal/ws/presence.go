@@ -0,0 +1,161 @@
+package ws
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KindParticipantJoined and KindParticipantLeft are sent to the hosts of a
+// room when a participant opens their first connection to it, or closes
+// their last one. They are ephemeral: hosts that missed some get the whole
+// list from Presence.
+const (
+	KindParticipantJoined = "participant_joined"
+	KindParticipantLeft   = "participant_left"
+)
+
+type ParticipantPresence struct {
+	ParticipantID uuid.UUID `json:"participant_id"`
+}
+
+// Presence lists who is connected to a room. Participants are only known
+// by the anonymous ids their clients pass, and the connections without one
+// are only counted.
+type Presence struct {
+	Participants []PresentParticipant
+	Anonymous    int
+}
+
+type PresentParticipant struct {
+	ParticipantID uuid.UUID
+	Connections   int
+	// JoinedAt is when the participant's oldest connection still open was
+	// opened.
+	JoinedAt time.Time
+}
+
+// presence is what a room tracks of a participant connected to it.
+type presence struct {
+	connections int
+	joinedAt    time.Time
+}
+
+// Presence returns who is connected to the room, in the order they joined.
+func (h *Hub) Presence(roomID string) Presence {
+	p := Presence{Participants: []PresentParticipant{}}
+
+	rm := h.room(roomID, false)
+
+	if rm == nil {
+		return p
+	}
+
+	res := make(chan Presence, 1)
+
+	queued := rm.do(func(rm *room) {
+		p := Presence{Participants: make([]PresentParticipant, 0, len(rm.present))}
+
+		for id, pr := range rm.present {
+			p.Participants = append(p.Participants, PresentParticipant{
+				ParticipantID: id,
+				Connections:   pr.connections,
+				JoinedAt:      pr.joinedAt,
+			})
+		}
+
+		p.Anonymous = rm.anonymous
+
+		res <- p
+	})
+
+	if !queued {
+		return p
+	}
+
+	p = <-res
+
+	sort.Slice(p.Participants, func(i, j int) bool {
+		return p.Participants[i].JoinedAt.Before(p.Participants[j].JoinedAt)
+	})
+
+	return p
+}
+
+// joined counts c in the presence of the room, telling the hosts when it is
+// the first connection of its participant.
+func (rm *room) joined(c *Client) {
+	if !c.info.ParticipantID.Valid {
+		rm.anonymous++
+
+		return
+	}
+
+	id := c.info.ParticipantID.UUID
+
+	pr, ok := rm.present[id]
+
+	if !ok {
+		pr = &presence{joinedAt: time.Now()}
+
+		rm.present[id] = pr
+	}
+
+	pr.connections++
+
+	if !ok {
+		rm.sendToHosts(KindParticipantJoined, ParticipantPresence{ParticipantID: id}, c)
+	}
+}
+
+// left is joined in reverse.
+func (rm *room) left(c *Client) {
+	if !c.info.ParticipantID.Valid {
+		rm.anonymous--
+
+		return
+	}
+
+	id := c.info.ParticipantID.UUID
+
+	pr, ok := rm.present[id]
+
+	if !ok {
+		return
+	}
+
+	pr.connections--
+
+	if pr.connections == 0 {
+		delete(rm.present, id)
+
+		rm.sendToHosts(KindParticipantLeft, ParticipantPresence{ParticipantID: id}, nil)
+	}
+}
+
+// sendToHosts sends an ephemeral event to the hosts of the room but except.
+func (rm *room) sendToHosts(kind string, value any, except *Client) {
+	msg, err := NewMessage(kind, rm.id, value)
+
+	if err != nil {
+		slog.Error("Failed to encode message", "kind", kind, "error", err)
+
+		return
+	}
+
+	data, err := encode(msg)
+
+	if err != nil {
+		slog.Error("Failed to encode message", "kind", kind, "error", err)
+
+		return
+	}
+
+	for c := range rm.clients {
+		if c != except && c.info.Host && !c.holding && c.wants(kind) {
+			rm.write(c, outbound{data: data})
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package ws
+
+import (
+	"log/slog"
+	"time"
+)
+
+// KindRateLimited warns a client sending frames faster than the hub allows.
+// Frames past the limit are dropped, and a client that keeps sending them is
+// closed with CloseRateLimited.
+const (
+	KindRateLimited = "rate_limited"
+
+	// maxFrameStrikes is how many frames past the limit a client may send
+	// before it is closed. Strikes are forgotten once the client has been
+	// quiet long enough for its whole burst to come back.
+	maxFrameStrikes = 10
+
+	rateLimitedReason = "Too many frames"
+)
+
+// RateLimited is the payload of KindRateLimited, sent with the first frame
+// dropped. RetryAfterMs is how long until a frame is accepted again.
+type RateLimited struct {
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// allowFrame reports whether a frame read from c may be handled. Each client
+// has a token bucket of HubOptions.FrameBurst frames, refilled at
+// HubOptions.FramesPerSecond. Only the client's reader calls it.
+func (h *Hub) allowFrame(roomID string, c *Client) bool {
+	if c.isClosed() {
+		return false
+	}
+
+	if h.opts.FramesPerSecond <= 0 {
+		return true
+	}
+
+	rate := float64(h.opts.FramesPerSecond)
+	burst := float64(max(h.opts.FrameBurst, 1))
+	now := time.Now()
+
+	if c.frameAt.IsZero() {
+		c.frameTokens = burst
+	} else {
+		c.frameTokens = min(burst, c.frameTokens+now.Sub(c.frameAt).Seconds()*rate)
+	}
+
+	c.frameAt = now
+
+	if c.frameTokens == burst {
+		c.frameStrikes = 0
+	}
+
+	if c.frameTokens >= 1 {
+		c.frameTokens--
+
+		return true
+	}
+
+	c.frameStrikes++
+
+	if c.frameStrikes >= maxFrameStrikes {
+		slog.Info("Closing client sending too many frames", "room_id", roomID)
+
+		rateLimited.Add("disconnected", 1)
+
+		c.closeWith(CloseRateLimited, rateLimitedReason, false)
+
+		return false
+	}
+
+	rateLimited.Add("dropped", 1)
+
+	if c.frameStrikes == 1 {
+		retryAfter := time.Duration((1 - c.frameTokens) / rate * float64(time.Second))
+
+		msg, err := NewMessage(KindRateLimited, roomID, RateLimited{RetryAfterMs: retryAfter.Milliseconds()})
+
+		if err != nil {
+			slog.Error("Failed to encode rate limited event", "room_id", roomID, "error", err)
+
+			return false
+		}
+
+		c.send(msg)
+	}
+
+	return false
+}
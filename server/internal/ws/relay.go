@@ -0,0 +1,129 @@
+package ws
+
+import (
+	"context"
+	"time"
+)
+
+// Relay carries what the hub is asked to do between the hubs of the
+// instances of the server: publishes, and the disconnects and closes that
+// follow bans and closed rooms. The events the hub sends itself, such as
+// viewer counts and typing, stay on the instance they happen on.
+type Relay interface {
+	// Send hands op to the other instances. It must not block, since it is
+	// called on every publish.
+	Send(op RelayOp)
+	// Listen passes the operations sent by the other instances to deliver
+	// until ctx is done. The hub calls it once, when it is created.
+	Listen(ctx context.Context, deliver func(RelayOp))
+}
+
+// RelayOpKind tells which call of the hub a RelayOp stands for.
+type RelayOpKind string
+
+const (
+	RelayPublish    RelayOpKind = "publish"
+	RelayDisconnect RelayOpKind = "disconnect"
+	RelayClose      RelayOpKind = "close"
+	RelayForget     RelayOpKind = "forget"
+)
+
+// RelayOp is a call of the hub to repeat on the other instances, for the
+// room RoomID. Message is only set for RelayPublish, Match for
+// RelayDisconnect, and Code and Reason for the ones closing clients.
+type RelayOp struct {
+	Kind    RelayOpKind
+	Message Message
+	RoomID  string
+	Match   ClientMatch
+	Code    int
+	Reason  string
+}
+
+// apply runs an operation relayed by another instance on the clients of
+// this one.
+func (h *Hub) apply(op RelayOp) {
+	switch op.Kind {
+	case RelayPublish:
+		h.deliver(op.Message)
+	case RelayDisconnect:
+		h.disconnect(op.RoomID, op.Match, op.Code, op.Reason)
+	case RelayClose:
+		h.close(op.RoomID, op.Code, op.Reason)
+	case RelayForget:
+		h.forget(op.RoomID)
+	}
+}
+
+// relay hands op to the relay, if the hub has one.
+func (h *Hub) relay(op RelayOp) {
+	if h.opts.Relay != nil {
+		h.opts.Relay.Send(op)
+	}
+}
+
+// relayMessage relays a published message. Messages with a Coalesce key are
+// throttled like the rooms throttle their broadcasts, so a burst of
+// reactions is one notification rather than one per reaction. The rooms of
+// the other instances throttle them again, which changes nothing.
+func (h *Hub) relayMessage(msg Message) {
+	if h.opts.Relay == nil {
+		return
+	}
+
+	if msg.Coalesce == "" || h.opts.CoalescePerSecond <= 0 {
+		h.relay(RelayOp{Kind: RelayPublish, RoomID: msg.RoomID, Message: msg})
+
+		return
+	}
+
+	interval := time.Second / time.Duration(h.opts.CoalescePerSecond)
+
+	key := msg.RoomID + "\x00" + msg.Coalesce
+
+	h.relayMu.Lock()
+
+	defer h.relayMu.Unlock()
+
+	if _, ok := h.relayHeld[key]; ok {
+		h.relayHeld[key] = msg
+
+		return
+	}
+
+	now := time.Now()
+
+	if wait := interval - now.Sub(h.relayedAt[key]); wait > 0 {
+		h.relayHeld[key] = msg
+
+		time.AfterFunc(wait, func() {
+			h.relayMu.Lock()
+
+			msg, ok := h.relayHeld[key]
+
+			delete(h.relayHeld, key)
+
+			h.relayedAt[key] = time.Now()
+
+			h.relayMu.Unlock()
+
+			if ok {
+				h.relay(RelayOp{Kind: RelayPublish, RoomID: msg.RoomID, Message: msg})
+			}
+		})
+
+		return
+	}
+
+	if len(h.relayedAt) >= maxCoalesceKeys {
+		for k, at := range h.relayedAt {
+			if now.Sub(at) >= interval {
+				delete(h.relayedAt, k)
+			}
+		}
+	}
+
+	h.relayedAt[key] = now
+
+	h.relay(RelayOp{Kind: RelayPublish, RoomID: msg.RoomID, Message: msg})
+}